@@ -3,16 +3,22 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"net/http"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"portfoliopulse/internal/api"
 	"portfoliopulse/internal/db"
+	"portfoliopulse/internal/ledger"
 	"portfoliopulse/internal/market"
+	"portfoliopulse/internal/models"
+	"portfoliopulse/internal/notify"
 	"portfoliopulse/internal/realtime"
 	"portfoliopulse/internal/store"
 )
@@ -24,13 +30,136 @@ func envOr(key, fallback string) string {
 	return fallback
 }
 
+// parseDurations reads "key=duration;key=duration" specs. Durations take
+// Go syntax plus a whole-day "d" suffix, e.g. "stock=15m;crypto=5m" or
+// "tick=48h;1m=7d".
+func parseDurations(spec string) (map[string]time.Duration, error) {
+	out := make(map[string]time.Duration)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, raw, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("entry %q: expected key=duration", entry)
+		}
+		raw = strings.TrimSpace(raw)
+		var d time.Duration
+		var err error
+		if days, found := strings.CutSuffix(raw, "d"); found {
+			var n int
+			n, err = strconv.Atoi(days)
+			d = time.Duration(n) * 24 * time.Hour
+		} else {
+			d, err = time.ParseDuration(raw)
+		}
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("entry %q: expected a non-negative duration", entry)
+		}
+		out[strings.TrimSpace(name)] = d
+	}
+	return out, nil
+}
+
+func parseStaleAfter(spec string) (map[models.AssetType]time.Duration, error) {
+	durations, err := parseDurations(spec)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[models.AssetType]time.Duration, len(durations))
+	for name, d := range durations {
+		if d == 0 {
+			return nil, fmt.Errorf("%s: threshold must be positive", name)
+		}
+		out[models.AssetType(name)] = d
+	}
+	return out, nil
+}
+
+func parseRetention(spec string) (map[models.BarInterval]time.Duration, error) {
+	durations, err := parseDurations(spec)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[models.BarInterval]time.Duration, len(durations))
+	for name, d := range durations {
+		interval := models.BarInterval(name)
+		if interval != models.BarTick && interval.Duration() == 0 {
+			return nil, fmt.Errorf("unknown resolution %q", name)
+		}
+		out[interval] = d
+	}
+	return out, nil
+}
+
 func main() {
 	var (
-		addr   = flag.String("addr", ":8080", "server listen address")
-		dbPath = flag.String("db", envOr("DB_PATH", "./portfoliopulse.db"), "sqlite database file")
+		addr       = flag.String("addr", ":8080", "server listen address")
+		dbPath     = flag.String("db", envOr("DB_PATH", "./portfoliopulse.db"), "sqlite database file")
+		costMethod = flag.String("cost-method", envOr("COST_METHOD", "fifo"), "default lot method for sells: fifo, lifo, hifo or average")
+		sources    = flag.String("market-sources", envOr("MARKET_SOURCES", market.DefaultSpec), "price source chains per asset type, primary first (e.g. stock=yahoo;crypto=coingecko,yahoo)")
+		tripAfter  = flag.Int("breaker-threshold", 3, "consecutive failures before a price source's circuit opens")
+		cooldown   = flag.Duration("breaker-cooldown", time.Minute, "how long an open circuit waits before a half-open probe")
+		staleAfter = flag.String("stale-after", envOr("STALE_AFTER", "stock=15m;crypto=5m"), "per asset type age after which a quote is flagged stale")
+		retention  = flag.String("history-retention", envOr("HISTORY_RETENTION", "tick=48h;1m=7d;1h=180d"), "price history kept per resolution (tick, 1m, 1h, 1d); 0 keeps forever")
+		eodTime    = flag.String("eod-time", envOr("EOD_TIME", "21:00"), "UTC time of day the end-of-day portfolio snapshot is saved")
+		intraday   = flag.Duration("intraday-snapshots", 0, "interval between intraday portfolio snapshots (0 disables)")
+		baseCcy    = flag.String("base-currency", envOr("BASE_CURRENCY", models.DefaultCurrency), "currency portfolio values are reported in")
+		fxSpec     = flag.String("fx-source", envOr("FX_SOURCE", market.DefaultFXSpec), "exchange rate source (frankfurter or static:<file>)")
+		fractional = flag.String("fractional", envOr("FRACTIONAL", "crypto"), "comma-separated asset types the rebalancing planner may trade in fractional quantities")
+		shortRate  = flag.Float64("tax-rate-short", 37, "short-term tax rate in percent for tax-loss harvesting estimates")
+		longRate   = flag.Float64("tax-rate-long", 20, "long-term tax rate in percent for tax-loss harvesting estimates")
+		webhooks   = flag.String("webhooks", envOr("WEBHOOKS_FILE", ""), "JSON file of webhook targets notified when alerts fire")
+		attempts   = flag.Int("notify-attempts", 5, "delivery attempts per notification before giving up")
+		backoff    = flag.Duration("notify-backoff", 2*time.Second, "delay before the first notification retry, doubled after each")
+		smtpHost   = flag.String("smtp-host", envOr("SMTP_HOST", ""), "SMTP server that alert emails are sent through (empty disables email)")
+		smtpPort   = flag.Int("smtp-port", 0, "SMTP port (default 587, 465 with -smtp-tls tls, 25 with none)")
+		smtpUser   = flag.String("smtp-username", envOr("SMTP_USERNAME", ""), "SMTP username for PLAIN auth (empty skips auth)")
+		smtpPass   = flag.String("smtp-password", envOr("SMTP_PASSWORD", ""), "SMTP password")
+		smtpTLS    = flag.String("smtp-tls", envOr("SMTP_TLS", string(notify.TLSStartTLS)), "SMTP connection security: starttls, tls or none")
+		emailFrom  = flag.String("email-from", envOr("EMAIL_FROM", ""), "sender address of alert emails")
+		emailTo    = flag.String("email-to", envOr("EMAIL_TO", ""), "comma-separated recipients of alert emails")
+		emailTmpl  = flag.String("email-templates", envOr("EMAIL_TEMPLATES", ""), "directory of email templates overriding the built-in ones")
+		digestTime = flag.String("digest-time", envOr("DIGEST_TIME", ""), "UTC time of day the portfolio digest is sent (empty disables it)")
+		adminToken = flag.String("admin-token", envOr("ADMIN_TOKEN", ""), "bearer token required by /api/admin routes (empty leaves them open)")
 	)
 	flag.Parse()
 
+	method := models.CostMethod(*costMethod)
+	if !ledger.ValidMethod(method) || method == models.CostSpecific {
+		log.Fatalf("invalid cost method %q", *costMethod)
+	}
+
+	thresholds, err := parseStaleAfter(*staleAfter)
+	if err != nil {
+		log.Fatalf("invalid stale-after: %v", err)
+	}
+	keep, err := parseRetention(*retention)
+	if err != nil {
+		log.Fatalf("invalid history-retention: %v", err)
+	}
+	eod, err := time.Parse("15:04", *eodTime)
+	if err != nil {
+		log.Fatalf("invalid eod-time %q: expected HH:MM", *eodTime)
+	}
+	var digestAt time.Time
+	if *digestTime != "" {
+		if digestAt, err = time.Parse("15:04", *digestTime); err != nil {
+			log.Fatalf("invalid digest-time %q: expected HH:MM", *digestTime)
+		}
+	}
+	var fractionalTypes []models.AssetType
+	for _, name := range strings.Split(*fractional, ",") {
+		switch t := models.AssetType(strings.TrimSpace(name)); t {
+		case "":
+		case models.AssetStock, models.AssetCrypto:
+			fractionalTypes = append(fractionalTypes, t)
+		default:
+			log.Fatalf("invalid fractional asset type %q", name)
+		}
+	}
+
 	sqlDB, err := db.Open(*dbPath)
 	if err != nil {
 		log.Fatalf("database init failed: %v", err)
@@ -38,9 +167,69 @@ func main() {
 	defer sqlDB.Close()
 
 	st := store.NewSQLiteStore(sqlDB)
-	provider := market.NewProvider()
+	client := &http.Client{Timeout: 10 * time.Second}
+	chains, err := market.DefaultRegistry.Build(*sources, client)
+	if err != nil {
+		log.Fatalf("market sources: %v", err)
+	}
+	fx, err := market.DefaultRegistry.BuildFX(*fxSpec, client)
+	if err != nil {
+		log.Fatalf("fx source: %v", err)
+	}
+	var channels []notify.Channel
+	if *webhooks != "" {
+		hooks, err := notify.LoadWebhooks(*webhooks, client)
+		if err != nil {
+			log.Fatalf("webhooks: %v", err)
+		}
+		for _, h := range hooks {
+			channels = append(channels, h)
+		}
+	}
+	if *smtpHost != "" {
+		var to []string
+		for _, addr := range strings.Split(*emailTo, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				to = append(to, addr)
+			}
+		}
+		email, err := notify.NewEmail(notify.EmailConfig{
+			Host:        *smtpHost,
+			Port:        *smtpPort,
+			Username:    *smtpUser,
+			Password:    *smtpPass,
+			TLS:         notify.EmailTLS(*smtpTLS),
+			From:        *emailFrom,
+			To:          to,
+			TemplateDir: *emailTmpl,
+		})
+		if err != nil {
+			log.Fatalf("email: %v", err)
+		}
+		channels = append(channels, email)
+	}
+	dispatcher := notify.NewDispatcher(st, channels,
+		notify.WithRouter(notify.NewStoredChannels(st, client)),
+		notify.WithRetry(*attempts, *backoff),
+	)
+	defer dispatcher.Close()
+
+	provider := market.NewProvider(chains, market.WithBreaker(*tripAfter, *cooldown), market.WithFX(fx, *baseCcy))
 	hub := realtime.NewHub()
-	apiServer := api.NewServer(st, provider, hub)
+	opts := []api.Option{
+		api.WithCostMethod(method),
+		api.WithStaleAfter(thresholds),
+		api.WithHistoryRetention(keep),
+		api.WithSnapshotSchedule(time.Duration(eod.Hour())*time.Hour+time.Duration(eod.Minute())*time.Minute, *intraday),
+		api.WithFractional(fractionalTypes...),
+		api.WithTaxRates(*shortRate, *longRate),
+		api.WithNotifier(dispatcher),
+		api.WithAdminToken(*adminToken),
+	}
+	if *digestTime != "" {
+		opts = append(opts, api.WithDigest(time.Duration(digestAt.Hour())*time.Hour+time.Duration(digestAt.Minute())*time.Minute))
+	}
+	apiServer := api.NewServer(st, provider, hub, opts...)
 
 	httpServer := &http.Server{
 		Addr:              *addr,
@@ -52,6 +241,7 @@ func main() {
 	defer cancel()
 
 	go apiServer.StartPolling(ctx, 30*time.Second)
+	go apiServer.StartSnapshotScheduler(ctx)
 
 	go func() {
 		<-ctx.Done()
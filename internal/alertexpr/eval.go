@@ -0,0 +1,107 @@
+package alertexpr
+
+import "portfoliopulse/internal/models"
+
+// Env supplies the values an expression reads. ok is false when a value
+// is unavailable, e.g. no quote yet or too little price history.
+type Env interface {
+	Call(fn, ticker string, assetType models.AssetType) (float64, bool)
+	Field(name string) (float64, bool)
+}
+
+// Eval evaluates e against env. ok is false when a value it needed was
+// unavailable or it divided by zero; && and || skip operands they do not
+// need. values records every function and field read, keyed as written
+// by String.
+func (e *Expr) Eval(env Env) (result, ok bool, values map[string]float64) {
+	ev := &evaluator{env: env, values: make(map[string]float64)}
+	result = ev.boolean(e.root)
+	return result, !ev.missing, ev.values
+}
+
+type evaluator struct {
+	env     Env
+	values  map[string]float64
+	missing bool
+}
+
+func (ev *evaluator) boolean(n node) bool {
+	if ev.missing {
+		return false
+	}
+	switch n := n.(type) {
+	case *unaryNode:
+		return !ev.boolean(n.x)
+	case *binaryNode:
+		switch n.op {
+		case "&&":
+			return ev.boolean(n.x) && ev.boolean(n.y)
+		case "||":
+			return ev.boolean(n.x) || ev.boolean(n.y)
+		}
+		x, y := ev.number(n.x), ev.number(n.y)
+		if ev.missing {
+			return false
+		}
+		switch n.op {
+		case "<":
+			return x < y
+		case "<=":
+			return x <= y
+		case ">":
+			return x > y
+		case ">=":
+			return x >= y
+		case "==":
+			return x == y
+		case "!=":
+			return x != y
+		}
+	}
+	return false
+}
+
+func (ev *evaluator) number(n node) float64 {
+	if ev.missing {
+		return 0
+	}
+	switch n := n.(type) {
+	case *numberNode:
+		return n.value
+	case *callNode:
+		v, ok := ev.env.Call(n.fn, n.ticker, n.assetType)
+		if !ok {
+			ev.missing = true
+			return 0
+		}
+		ev.values[format(n)] = v
+		return v
+	case *fieldNode:
+		v, ok := ev.env.Field(n.name)
+		if !ok {
+			ev.missing = true
+			return 0
+		}
+		ev.values[format(n)] = v
+		return v
+	case *unaryNode:
+		return -ev.number(n.x)
+	case *binaryNode:
+		x, y := ev.number(n.x), ev.number(n.y)
+		switch n.op {
+		case "+":
+			return x + y
+		case "-":
+			return x - y
+		case "*":
+			return x * y
+		case "/":
+			if y == 0 {
+				ev.missing = true
+				return 0
+			}
+			return x / y
+		}
+	}
+	return 0
+}
@@ -0,0 +1,496 @@
+package alertexpr
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"portfoliopulse/internal/models"
+)
+
+// Functions take a ticker and an optional asset type, e.g. price("BTC") or
+// price("BTC", "crypto"), and map to a description for error messages.
+var Functions = map[string]string{
+	"price":      "the latest price",
+	"change_1h":  "the percent move over the last hour",
+	"change_24h": "the percent move over the last 24 hours",
+	"change_7d":  "the percent move over the last 7 days",
+	"value":      "the market value held",
+	"pnl":        "the unrealized P&L held",
+	"pnl_pct":    "the unrealized P&L as a percent of cost",
+	"weight":     "the percent of the portfolio's total value held",
+}
+
+// Fields are the portfolio values expressions may read, e.g.
+// portfolio.total_value.
+var Fields = map[string]string{
+	"total_value":  "the total value, cash included",
+	"total_cost":   "the total cost basis",
+	"total_pnl":    "the total unrealized P&L",
+	"total_cash":   "the total cash",
+	"realized_pnl": "the total realized P&L",
+	"day_change":   "the percent move since the last end-of-day snapshot",
+}
+
+// Error is a parse or validation error at a 1-based column of the source.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("column %d: %s", e.Pos, e.Msg) }
+
+// Ref is a ticker an expression reads.
+type Ref struct {
+	Ticker    string
+	AssetType models.AssetType
+}
+
+// Expr is a parsed alert condition that evaluates to true or false.
+type Expr struct {
+	root node
+}
+
+type node interface {
+	pos() int
+	isBool() bool
+}
+
+type numberNode struct {
+	p     int
+	value float64
+}
+
+type callNode struct {
+	p         int
+	fn        string
+	ticker    string
+	tickerPos int
+	assetType models.AssetType
+}
+
+type fieldNode struct {
+	p    int
+	name string
+}
+
+type unaryNode struct {
+	p  int
+	op string
+	x  node
+}
+
+type binaryNode struct {
+	p    int
+	op   string
+	x, y node
+}
+
+func (n *numberNode) pos() int { return n.p }
+func (n *callNode) pos() int   { return n.p }
+func (n *fieldNode) pos() int  { return n.p }
+func (n *unaryNode) pos() int  { return n.p }
+func (n *binaryNode) pos() int { return n.p }
+
+func (n *numberNode) isBool() bool { return false }
+func (n *callNode) isBool() bool   { return false }
+func (n *fieldNode) isBool() bool  { return false }
+func (n *unaryNode) isBool() bool  { return n.op == "!" }
+func (n *binaryNode) isBool() bool { return precedence[n.op] <= precedence["!="] }
+
+// precedence ranks binary operators, loosest first.
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3,
+	"+": 4, "-": 4,
+	"*": 5, "/": 5,
+}
+
+// Parse reads an expression such as
+//
+//	change_24h("SOL") > 8 && portfolio.total_value > 50000
+//
+// and checks it is a true/false condition. Errors are *Error.
+func Parse(src string) (*Expr, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	root, err := p.expr(1)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s", t)}
+	}
+	if !root.isBool() {
+		return nil, &Error{Pos: 1, Msg: `expression must be a condition, e.g. price("BTC") > 100000`}
+	}
+	return &Expr{root: root}, nil
+}
+
+// Resolve fills in the asset type of every ticker that does not name one,
+// using assetTypeOf (typically the type the ticker is held as).
+func (e *Expr) Resolve(assetTypeOf func(ticker string) (models.AssetType, bool)) error {
+	var err error
+	walk(e.root, func(n node) {
+		c, ok := n.(*callNode)
+		if !ok || c.assetType != "" || err != nil {
+			return
+		}
+		t, ok := assetTypeOf(c.ticker)
+		if !ok {
+			err = &Error{Pos: c.tickerPos, Msg: fmt.Sprintf(`%q is not held; name its asset type, e.g. %s(%q, "crypto")`, c.ticker, c.fn, c.ticker)}
+			return
+		}
+		c.assetType = t
+	})
+	return err
+}
+
+// Refs returns the tickers e reads, sorted, each once.
+func (e *Expr) Refs() []Ref {
+	seen := make(map[Ref]bool)
+	refs := make([]Ref, 0)
+	walk(e.root, func(n node) {
+		if c, ok := n.(*callNode); ok {
+			ref := Ref{Ticker: c.ticker, AssetType: c.assetType}
+			if !seen[ref] {
+				seen[ref] = true
+				refs = append(refs, ref)
+			}
+		}
+	})
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].AssetType != refs[j].AssetType {
+			return refs[i].AssetType < refs[j].AssetType
+		}
+		return refs[i].Ticker < refs[j].Ticker
+	})
+	return refs
+}
+
+// Rewrite points every function reading ref at ticker instead, for
+// corporate actions, and multiplies each price of it by ratio so literals
+// compared against the old price keep their meaning: after a 4:1 split
+// price("AAPL") > 200 reads price("AAPL") * 4 > 200. Other functions are
+// unaffected by a ratio. It reports whether e changed.
+func (e *Expr) Rewrite(ref Ref, ticker string, ratio float64) bool {
+	changed := false
+	var rewrite func(n node) node
+	rewrite = func(n node) node {
+		switch n := n.(type) {
+		case *callNode:
+			if n.ticker != ref.Ticker || n.assetType != ref.AssetType {
+				return n
+			}
+			changed = true
+			n.ticker = ticker
+			if n.fn == "price" && ratio != 1 {
+				return &binaryNode{p: n.p, op: "*", x: n, y: &numberNode{p: n.p, value: ratio}}
+			}
+		case *unaryNode:
+			n.x = rewrite(n.x)
+		case *binaryNode:
+			n.x = rewrite(n.x)
+			n.y = rewrite(n.y)
+		}
+		return n
+	}
+	e.root = rewrite(e.root)
+	return changed
+}
+
+// String prints e in canonical form: tickers upper-cased, resolved asset
+// types spelled out and only the parentheses precedence needs.
+func (e *Expr) String() string {
+	return format(e.root)
+}
+
+func format(n node) string {
+	switch n := n.(type) {
+	case *numberNode:
+		return strconv.FormatFloat(n.value, 'f', -1, 64)
+	case *callNode:
+		if n.assetType == "" {
+			return fmt.Sprintf("%s(%q)", n.fn, n.ticker)
+		}
+		return fmt.Sprintf("%s(%q, %q)", n.fn, n.ticker, string(n.assetType))
+	case *fieldNode:
+		return "portfolio." + n.name
+	case *unaryNode:
+		operand := format(n.x)
+		if _, ok := n.x.(*binaryNode); ok {
+			operand = "(" + operand + ")"
+		}
+		return n.op + operand
+	case *binaryNode:
+		left, right := format(n.x), format(n.y)
+		if b, ok := n.x.(*binaryNode); ok && precedence[b.op] < precedence[n.op] {
+			left = "(" + left + ")"
+		}
+		// Operators are left-associative, so an equal-precedence right
+		// operand keeps its parentheses.
+		if b, ok := n.y.(*binaryNode); ok && precedence[b.op] <= precedence[n.op] {
+			right = "(" + right + ")"
+		}
+		return left + " " + n.op + " " + right
+	}
+	return ""
+}
+
+func walk(n node, visit func(node)) {
+	visit(n)
+	switch n := n.(type) {
+	case *unaryNode:
+		walk(n.x, visit)
+	case *binaryNode:
+		walk(n.x, visit)
+		walk(n.y, visit)
+	}
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// operators lists two-character operators before their one-character
+// prefixes so the longest match wins.
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "+", "-", "*", "/", "!", "(", ")", ",", "."}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9' || (c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9'):
+			start := i
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.') {
+				i++
+			}
+			toks = append(toks, token{kind: tokNumber, text: src[start:i], pos: start + 1})
+		case c == '"' || c == '\'':
+			start := i
+			end := strings.IndexByte(src[i+1:], c)
+			if end < 0 {
+				return nil, &Error{Pos: start + 1, Msg: "unterminated string"}
+			}
+			toks = append(toks, token{kind: tokString, text: src[i+1 : i+1+end], pos: start + 1})
+			i += end + 2
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(src) && (src[i] == '_' || src[i] >= 'a' && src[i] <= 'z' || src[i] >= 'A' && src[i] <= 'Z' || src[i] >= '0' && src[i] <= '9') {
+				i++
+			}
+			toks = append(toks, token{kind: tokIdent, text: src[start:i], pos: start + 1})
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					toks = append(toks, token{kind: tokOp, text: op, pos: i + 1})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, &Error{Pos: i + 1, Msg: fmt.Sprintf("unexpected character %q", c)}
+			}
+		}
+	}
+	if len(toks) == 0 {
+		return nil, &Error{Pos: 1, Msg: "expression is empty"}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(src) + 1}), nil
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) expect(op string) (token, error) {
+	t := p.next()
+	if t.kind != tokOp || t.text != op {
+		return t, &Error{Pos: t.pos, Msg: fmt.Sprintf("expected %q, found %s", op, t)}
+	}
+	return t, nil
+}
+
+// expr parses binary operators of at least minPrec by precedence climbing
+// and type-checks each operator's operands.
+func (p *parser) expr(minPrec int) (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		prec, ok := precedence[t.text]
+		if t.kind != tokOp || !ok || prec < minPrec {
+			return left, nil
+		}
+		p.next()
+		right, err := p.expr(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case prec <= precedence["&&"]:
+			if !left.isBool() || !right.isBool() {
+				return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("%s needs conditions on both sides", t.text)}
+			}
+		case prec == precedence["=="]:
+			if b, ok := left.(*binaryNode); ok && precedence[b.op] == prec {
+				return nil, &Error{Pos: t.pos, Msg: "comparisons cannot be chained; combine them with &&"}
+			}
+			if left.isBool() || right.isBool() {
+				return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("%s compares numbers; combine conditions with && or ||", t.text)}
+			}
+		default:
+			if left.isBool() || right.isBool() {
+				return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("%s needs numbers on both sides", t.text)}
+			}
+		}
+		left = &binaryNode{p: t.pos, op: t.text, x: left, y: right}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	t := p.peek()
+	if t.kind == tokOp && (t.text == "-" || t.text == "!") {
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if (t.text == "!") != x.isBool() {
+			if t.text == "!" {
+				return nil, &Error{Pos: t.pos, Msg: "! needs a condition"}
+			}
+			return nil, &Error{Pos: t.pos, Msg: "- needs a number"}
+		}
+		return &unaryNode{p: t.pos, op: t.text, x: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("invalid number %q", t.text)}
+		}
+		return &numberNode{p: t.pos, value: v}, nil
+	case tokIdent:
+		if t.text == "portfolio" {
+			return p.field(t)
+		}
+		return p.call(t)
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.expr(1)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		}
+	case tokString:
+		return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("unexpected string %s; tickers go inside a function, e.g. price(%s)", t, t)}
+	}
+	return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("expected a number, function or portfolio field, found %s", t)}
+}
+
+func (p *parser) field(portfolio token) (node, error) {
+	if _, err := p.expect("."); err != nil {
+		return nil, err
+	}
+	t := p.next()
+	if _, ok := Fields[t.text]; t.kind != tokIdent || !ok {
+		return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("unknown portfolio field %s; expected one of %s", t, listKeys(Fields))}
+	}
+	return &fieldNode{p: portfolio.pos, name: t.text}, nil
+}
+
+func (p *parser) call(name token) (node, error) {
+	if _, ok := Functions[name.text]; !ok {
+		return nil, &Error{Pos: name.pos, Msg: fmt.Sprintf("unknown function %q; expected one of %s", name.text, listKeys(Functions))}
+	}
+	if _, err := p.expect("("); err != nil {
+		return nil, err
+	}
+	ticker := p.next()
+	if ticker.kind != tokString || strings.TrimSpace(ticker.text) == "" {
+		return nil, &Error{Pos: ticker.pos, Msg: fmt.Sprintf(`%s needs a quoted ticker, e.g. %s("BTC")`, name.text, name.text)}
+	}
+	c := &callNode{p: name.pos, fn: name.text, ticker: strings.ToUpper(strings.TrimSpace(ticker.text)), tickerPos: ticker.pos}
+	if t := p.peek(); t.kind == tokOp && t.text == "," {
+		p.next()
+		assetType := p.next()
+		switch models.AssetType(assetType.text) {
+		case models.AssetStock, models.AssetCrypto:
+			if assetType.kind == tokString {
+				c.assetType = models.AssetType(assetType.text)
+				break
+			}
+			fallthrough
+		default:
+			return nil, &Error{Pos: assetType.pos, Msg: `asset type must be "stock" or "crypto"`}
+		}
+	}
+	if _, err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func listKeys(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
@@ -0,0 +1,151 @@
+package alertexpr
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"portfoliopulse/internal/models"
+)
+
+type mapEnv map[string]float64
+
+func (m mapEnv) Call(fn, ticker string, assetType models.AssetType) (float64, bool) {
+	v, ok := m[fn+":"+ticker]
+	return v, ok
+}
+
+func (m mapEnv) Field(name string) (float64, bool) {
+	v, ok := m["portfolio."+name]
+	return v, ok
+}
+
+func held(ticker string) (models.AssetType, bool) {
+	switch ticker {
+	case "BTC", "ETH", "SOL":
+		return models.AssetCrypto, true
+	case "TSLA":
+		return models.AssetStock, true
+	}
+	return "", false
+}
+
+func TestParseCanonical(t *testing.T) {
+	cases := []struct {
+		src, want string
+	}{
+		{`price("btc") / price("ETH") > 20`, `price("BTC", "crypto") / price("ETH", "crypto") > 20`},
+		{`pnl_pct('TSLA') < -15`, `pnl_pct("TSLA", "stock") < -15`},
+		{`change_24h("SOL") > 8 && portfolio.total_value > 50000`, `change_24h("SOL", "crypto") > 8 && portfolio.total_value > 50000`},
+		{`(price("NVDA", "stock") - 100) * 2 >= 10 || !(weight("BTC") < 25)`, `(price("NVDA", "stock") - 100) * 2 >= 10 || !(weight("BTC", "crypto") < 25)`},
+		{`value("BTC") - (value("ETH") - 5) > 0`, `value("BTC", "crypto") - (value("ETH", "crypto") - 5) > 0`},
+	}
+	for _, c := range cases {
+		e, err := Parse(c.src)
+		if err != nil {
+			t.Fatalf("parse %s: %v", c.src, err)
+		}
+		if err := e.Resolve(held); err != nil {
+			t.Fatalf("resolve %s: %v", c.src, err)
+		}
+		if got := e.String(); got != c.want {
+			t.Fatalf("canonical form of %s: expected %s, got %s", c.src, c.want, got)
+		}
+		// The canonical form parses back to itself.
+		again, err := Parse(e.String())
+		if err != nil || again.String() != c.want {
+			t.Fatalf("reparse %s: %v %v", c.want, again, err)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		src string
+		pos int
+	}{
+		{``, 1},
+		{`price("BTC")`, 1},
+		{`price("BTC") > `, 16},
+		{`price(BTC) > 1`, 7},
+		{`prices("BTC") > 1`, 1},
+		{`price("BTC", "bond") > 1`, 14},
+		{`portfolio.value > 1`, 11},
+		{`price("BTC") > 1 > 2`, 18},
+		{`price("BTC") > 1 + (2 < 3)`, 18},
+		{`price("BTC") > 1 && 5`, 18},
+		{`price("BTC) > 1`, 7},
+		{`price("BTC") > 1 $`, 18},
+		{`(price("BTC") > 1`, 18},
+	}
+	for _, c := range cases {
+		_, err := Parse(c.src)
+		var perr *Error
+		if !errors.As(err, &perr) {
+			t.Fatalf("parse %q: expected *Error, got %v", c.src, err)
+		}
+		if perr.Pos != c.pos {
+			t.Fatalf("parse %q: expected column %d, got %v", c.src, c.pos, err)
+		}
+	}
+
+	_, err := Parse(`price("A") < 1 < 2`)
+	var chained *Error
+	if !errors.As(err, &chained) || chained.Pos != 16 || chained.Msg != "comparisons cannot be chained; combine them with &&" {
+		t.Fatalf("expected a chained comparison error at column 16, got %v", err)
+	}
+
+	e, err := Parse(`price("BTC") > 1 && price("DOGE") > 1`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	var perr *Error
+	if err := e.Resolve(held); !errors.As(err, &perr) || perr.Pos != 27 {
+		t.Fatalf("expected an unheld ticker error at column 27, got %v", err)
+	}
+}
+
+func TestEval(t *testing.T) {
+	env := mapEnv{
+		"price:BTC":             100000,
+		"price:ETH":             4000,
+		"change_24h:SOL":        9,
+		"portfolio.total_value": 40000,
+	}
+	cases := []struct {
+		src    string
+		want   bool
+		ok     bool
+		values int
+	}{
+		{`price("BTC") / price("ETH") > 20`, true, true, 2},
+		{`price("BTC") / price("ETH") > 30`, false, true, 2},
+		{`change_24h("SOL") > 8 && portfolio.total_value > 50000`, false, true, 2},
+		// Short-circuiting skips the missing quote.
+		{`change_24h("SOL") < 8 && price("DOGE") > 1`, false, true, 1},
+		{`change_24h("SOL") > 8 || price("DOGE") > 1`, true, true, 1},
+		{`price("DOGE") > 1 || change_24h("SOL") > 8`, false, false, 0},
+		{`price("BTC") / (price("ETH") - 4000) > 1`, false, false, 2},
+		{`-price("ETH") < -3999.5`, true, true, 1},
+	}
+	for _, c := range cases {
+		e, err := Parse(c.src)
+		if err != nil {
+			t.Fatalf("parse %s: %v", c.src, err)
+		}
+		got, ok, values := e.Eval(env)
+		if got != c.want || ok != c.ok || len(values) != c.values {
+			t.Fatalf("%s: expected %v/%v with %d values, got %v/%v with %v", c.src, c.want, c.ok, c.values, got, ok, values)
+		}
+	}
+
+	e, _ := Parse(`price("BTC", "crypto") / price("ETH", "crypto") > 20`)
+	_, _, values := e.Eval(env)
+	if math.Abs(values[`price("BTC", "crypto")`]-100000) > 1e-9 {
+		t.Fatalf("expected values keyed by canonical call, got %v", values)
+	}
+	refs := e.Refs()
+	if len(refs) != 2 || refs[0] != (Ref{"BTC", models.AssetCrypto}) || refs[1] != (Ref{"ETH", models.AssetCrypto}) {
+		t.Fatalf("unexpected refs %v", refs)
+	}
+}
@@ -0,0 +1,182 @@
+package analytics
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// ErrNoSolution is returned by XIRR when the cash flows have no rate that
+// discounts them to zero, e.g. when every flow has the same sign.
+var ErrNoSolution = errors.New("xirr has no solution for these cash flows")
+
+const year = 365 * 24 * time.Hour
+
+// ValuePoint is the market value of a portfolio or holding at an instant.
+type ValuePoint struct {
+	At    time.Time
+	Value float64
+}
+
+// CashFlow is money moving into (positive) or out of (negative) what is
+// being measured: a buy is a contribution, sell proceeds a withdrawal.
+type CashFlow struct {
+	At     time.Time
+	Amount float64
+}
+
+// TWR chain-links sub-period returns between consecutive valuations so the
+// result is independent of when and how much money moved. Each sub-period
+// uses the Modified Dietz formula, weighting a flow by the fraction of the
+// sub-period it was invested for. Flows before the first point are ignored;
+// that value already contains them.
+func TWR(points []ValuePoint, flows []CashFlow) float64 {
+	points = sortedPoints(points)
+	flows = sortedFlows(flows)
+
+	growth := 1.0
+	next := 0
+	for next < len(flows) && len(points) > 0 && flows[next].At.Before(points[0].At) {
+		next++
+	}
+	for i := 1; i < len(points); i++ {
+		start, end := points[i-1], points[i]
+		from := start.At
+		if start.Value <= 0 && next < len(flows) && flows[next].At.Before(end.At) {
+			// Nothing was invested until the first flow, so the sub-period
+			// really starts there.
+			from = flows[next].At
+		}
+		span := end.At.Sub(from).Seconds()
+
+		net, weighted := 0.0, 0.0
+		for ; next < len(flows) && !flows[next].At.After(end.At); next++ {
+			f := flows[next]
+			net += f.Amount
+			if span > 0 {
+				weighted += f.Amount * end.At.Sub(f.At).Seconds() / span
+			}
+		}
+
+		base := start.Value + weighted
+		if base <= 0 {
+			// Nothing was invested during this stretch, so it has no return.
+			continue
+		}
+		growth *= 1 + (end.Value-start.Value-net)/base
+	}
+	return growth - 1
+}
+
+// XIRR returns the annualised rate r at which the investor's flows net to
+// zero: sum(amount / (1+r)^(years since first flow)). Flows here are from
+// the investor's side, so contributions are negative and the final value
+// is a positive flow at the end.
+func XIRR(flows []CashFlow) (float64, error) {
+	return irr(flows, year)
+}
+
+// irr finds the rate per unit of time that nets the flows to zero.
+func irr(flows []CashFlow, unit time.Duration) (float64, error) {
+	flows = sortedFlows(flows)
+	if len(flows) < 2 {
+		return 0, ErrNoSolution
+	}
+	hasPos, hasNeg := false, false
+	for _, f := range flows {
+		hasPos = hasPos || f.Amount > 0
+		hasNeg = hasNeg || f.Amount < 0
+	}
+	if !hasPos || !hasNeg {
+		return 0, ErrNoSolution
+	}
+
+	t0 := flows[0].At
+	npv := func(rate float64) (value, slope float64) {
+		for _, f := range flows {
+			years := f.At.Sub(t0).Seconds() / unit.Seconds()
+			d := math.Pow(1+rate, years)
+			value += f.Amount / d
+			slope -= years * f.Amount / (d * (1 + rate))
+		}
+		return value, slope
+	}
+
+	// Newton's method converges quickly from a sensible guess; fall back to
+	// bisection when it wanders outside (-1, ∞) or stalls.
+	rate := 0.1
+	for i := 0; i < 50; i++ {
+		value, slope := npv(rate)
+		if math.Abs(value) < 1e-7 {
+			return rate, nil
+		}
+		if slope == 0 {
+			break
+		}
+		nextRate := rate - value/slope
+		if nextRate <= -1 || math.IsNaN(nextRate) || math.IsInf(nextRate, 0) {
+			break
+		}
+		rate = nextRate
+	}
+
+	lo, hi := -0.999999, 1.0
+	for v, _ := npv(hi); v > 0 && hi < 1e6; v, _ = npv(hi) {
+		hi *= 2
+	}
+	vlo, _ := npv(lo)
+	vhi, _ := npv(hi)
+	if math.Signbit(vlo) == math.Signbit(vhi) {
+		return 0, ErrNoSolution
+	}
+	for i := 0; i < 200; i++ {
+		mid := (lo + hi) / 2
+		v, _ := npv(mid)
+		if math.Abs(v) < 1e-7 || hi-lo < 1e-12 {
+			return mid, nil
+		}
+		if math.Signbit(v) == math.Signbit(vlo) {
+			lo, vlo = mid, v
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2, nil
+}
+
+// MWR is the money-weighted return over a window: the starting value is
+// treated as an initial contribution, the flows as further contributions and
+// withdrawals, and the ending value as a final withdrawal. Windows of a year
+// or more are annualised (XIRR); shorter ones return the rate over the
+// window itself, since annualising a few days' gain is meaningless.
+func MWR(start, end ValuePoint, flows []CashFlow) (float64, error) {
+	investor := make([]CashFlow, 0, len(flows)+2)
+	if start.Value != 0 {
+		investor = append(investor, CashFlow{At: start.At, Amount: -start.Value})
+	}
+	for _, f := range flows {
+		investor = append(investor, CashFlow{At: f.At, Amount: -f.Amount})
+	}
+	investor = append(investor, CashFlow{At: end.At, Amount: end.Value})
+
+	unit := year
+	if window := end.At.Sub(investor[0].At); window > 0 && window < year {
+		unit = window
+	}
+	return irr(investor, unit)
+}
+
+func sortedPoints(points []ValuePoint) []ValuePoint {
+	out := make([]ValuePoint, len(points))
+	copy(out, points)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].At.Before(out[j].At) })
+	return out
+}
+
+func sortedFlows(flows []CashFlow) []CashFlow {
+	out := make([]CashFlow, len(flows))
+	copy(out, flows)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].At.Before(out[j].At) })
+	return out
+}
@@ -0,0 +1,72 @@
+package analytics
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func near(a, b, tol float64) bool { return math.Abs(a-b) <= tol }
+
+func TestTWRIgnoresCashFlowSize(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.AddDate(0, 1, 0)
+	t2 := t1.AddDate(0, 1, 0)
+
+	// +10% on 100, then a 100 contribution, then +10% on 210.
+	points := []ValuePoint{{At: t0, Value: 100}, {At: t1, Value: 210}, {At: t2, Value: 231}}
+	flows := []CashFlow{{At: t1, Amount: 100}}
+	if got := TWR(points, flows); !near(got, 0.21, 1e-9) {
+		t.Fatalf("expected 21%% chain-linked return, got %v", got)
+	}
+
+	// A position opened mid-window measures from the first contribution.
+	points = []ValuePoint{{At: t0, Value: 0}, {At: t2, Value: 330}}
+	flows = []CashFlow{{At: t1, Amount: 300}}
+	if got := TWR(points, flows); !near(got, 0.1, 1e-9) {
+		t.Fatalf("expected 10%% from first contribution, got %v", got)
+	}
+
+	// Selling everything at the end still books the gain.
+	points = []ValuePoint{{At: t0, Value: 100}, {At: t1, Value: 0}}
+	flows = []CashFlow{{At: t1, Amount: -120}}
+	if got := TWR(points, flows); !near(got, 0.2, 1e-9) {
+		t.Fatalf("expected 20%% on full exit, got %v", got)
+	}
+}
+
+func TestXIRR(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+
+	got, err := XIRR([]CashFlow{
+		{At: day(2008, 1, 1), Amount: -10000},
+		{At: day(2008, 3, 1), Amount: 2750},
+		{At: day(2008, 10, 30), Amount: 4250},
+		{At: day(2009, 2, 15), Amount: 3250},
+		{At: day(2009, 4, 1), Amount: 2750},
+	})
+	if err != nil {
+		t.Fatalf("xirr: %v", err)
+	}
+	if !near(got, 0.373362535, 1e-6) {
+		t.Fatalf("expected 37.34%%, got %v", got)
+	}
+
+	got, err = MWR(ValuePoint{At: day(2023, 1, 1), Value: 1000}, ValuePoint{At: day(2024, 1, 1), Value: 900}, nil)
+	if err != nil || !near(got, -0.1, 1e-6) {
+		t.Fatalf("expected -10%%, got %v (%v)", got, err)
+	}
+
+	if _, err := XIRR([]CashFlow{{At: day(2024, 1, 1), Amount: -1}, {At: day(2024, 2, 1), Amount: -1}}); !errors.Is(err, ErrNoSolution) {
+		t.Fatalf("expected ErrNoSolution, got %v", err)
+	}
+}
+
+func TestMWRShortWindowIsNotAnnualised(t *testing.T) {
+	t0 := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	got, err := MWR(ValuePoint{At: t0, Value: 0}, ValuePoint{At: t0.AddDate(0, 0, 10), Value: 110}, []CashFlow{{At: t0, Amount: 100}})
+	if err != nil || !near(got, 0.1, 1e-6) {
+		t.Fatalf("expected 10%% over the window, got %v (%v)", got, err)
+	}
+}
@@ -0,0 +1,632 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"portfoliopulse/internal/models"
+	"portfoliopulse/internal/store"
+)
+
+// defaultAlertWindow is how far back a change alert looks when it does not
+// set WindowMinutes.
+const defaultAlertWindow = 24 * 60
+
+type alertRequest struct {
+	PortfolioID     int64                 `json:"portfolioId"`
+	Scope           models.AlertScope     `json:"scope"`
+	Ticker          string                `json:"ticker"`
+	AssetType       models.AssetType      `json:"assetType"`
+	Kind            models.AlertKind      `json:"kind"`
+	Direction       models.AlertDirection `json:"direction"`
+	Threshold       float64               `json:"threshold"`
+	WindowMinutes   int                   `json:"windowMinutes"`
+	Trail           models.TrailUnit      `json:"trail"`
+	Mode            models.AlertMode      `json:"mode"`
+	Hysteresis      float64               `json:"hysteresis"`
+	CooldownMinutes int                   `json:"cooldownMinutes"`
+	Severity        models.AlertSeverity  `json:"severity"`
+	Expression      string                `json:"expression"`
+	Channels        []string              `json:"channels"`
+}
+
+func (req alertRequest) validate() string {
+	if msg := req.validateCondition(); msg != "" {
+		return msg
+	}
+	switch req.Mode {
+	case models.AlertOnce, models.AlertRearm:
+	case models.AlertCooldown:
+		if req.CooldownMinutes <= 0 {
+			return "cooldown alerts need a positive cooldownMinutes"
+		}
+	default:
+		return "mode must be once, rearm or cooldown"
+	}
+	if req.Hysteresis < 0 || (req.Hysteresis != 0 && req.Mode != models.AlertRearm) {
+		return "hysteresis must be non-negative and only applies to rearm alerts"
+	}
+	if req.CooldownMinutes < 0 || (req.CooldownMinutes != 0 && req.Mode != models.AlertCooldown) {
+		return "cooldownMinutes only applies to cooldown alerts"
+	}
+	if req.Severity.Rank() == 0 {
+		return "severity must be info, warning or critical"
+	}
+	return ""
+}
+
+// validateCondition checks what the alert compares: its scope, kind,
+// direction and threshold, or for an expression alert that it sets nothing
+// else. The expression itself is parsed by the handler.
+func (req alertRequest) validateCondition() string {
+	if req.Kind == models.AlertExpression || req.Expression != "" {
+		switch {
+		case req.Kind != models.AlertExpression:
+			return "expression only applies to kind expression"
+		case strings.TrimSpace(req.Expression) == "":
+			return "expression alerts need an expression"
+		case req.Scope != models.ScopePortfolio:
+			return "expression alerts must have scope portfolio"
+		case req.Ticker != "" || req.AssetType != "" || req.Direction != "" || req.Threshold != 0 ||
+			req.Trail != "" || req.WindowMinutes != 0 || req.Hysteresis != 0:
+			return "expression alerts take no ticker, assetType, direction, threshold, trail, windowMinutes or hysteresis"
+		}
+		return ""
+	}
+	switch req.Scope {
+	case models.ScopeTicker:
+		if req.Ticker == "" || req.Threshold <= 0 {
+			return "invalid alert payload"
+		}
+		if req.AssetType != models.AssetStock && req.AssetType != models.AssetCrypto {
+			return "assetType must be stock or crypto"
+		}
+		switch req.Kind {
+		case models.AlertPrice, models.AlertChange, models.AlertFromCost, models.AlertFromClose:
+		default:
+			return "kind must be price, change, cost or close"
+		}
+	case models.ScopePortfolio:
+		if req.Ticker != "" || req.AssetType != "" {
+			return "portfolio alerts take no ticker or assetType"
+		}
+		if !req.Kind.Portfolio() {
+			return "portfolio alerts need kind total_value, total_pnl, day_change, drawdown or drift"
+		}
+		// Total P&L can be negative, so only its threshold may be too.
+		if req.Threshold == 0 || (req.Threshold < 0 && req.Kind != models.AlertTotalPnL) {
+			return "threshold must be positive"
+		}
+		if req.Kind == models.AlertDrawdown && req.Direction != models.AlertBelow {
+			return "drawdown alerts must have direction below"
+		}
+	default:
+		return "scope must be ticker or portfolio"
+	}
+	switch req.Direction {
+	case models.AlertAbove, models.AlertBelow:
+	case models.AlertEither:
+		if !req.Kind.Percent() {
+			return "direction either only applies to percent alerts"
+		}
+	case models.AlertTrailing:
+		if req.Kind != models.AlertPrice {
+			return "direction trailing only applies to price alerts"
+		}
+		if req.Trail != models.TrailPercent && req.Trail != models.TrailAmount {
+			return "trail must be percent or amount"
+		}
+		if req.Trail == models.TrailPercent && req.Threshold >= 100 {
+			return "a percent trail must be below 100"
+		}
+	default:
+		return "direction must be above, below, either or trailing"
+	}
+	if req.Trail != "" && req.Direction != models.AlertTrailing {
+		return "trail only applies to trailing alerts"
+	}
+	if req.WindowMinutes < 0 || (req.WindowMinutes != 0 && req.Kind != models.AlertChange) {
+		return "windowMinutes must be positive and only applies to change alerts"
+	}
+	return ""
+}
+
+func (s *Server) handleListAlerts(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.portfolioScope(w, r)
+	if !ok {
+		return
+	}
+	alerts, err := s.store.ListAlerts(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if pid != 0 {
+		scoped := make([]models.PriceAlert, 0, len(alerts))
+		for _, a := range alerts {
+			if a.PortfolioID == pid {
+				scoped = append(scoped, a)
+			}
+		}
+		alerts = scoped
+	}
+	writeJSON(w, http.StatusOK, alerts)
+}
+
+func (s *Server) handleCreateAlert(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.portfolioScope(w, r)
+	if !ok {
+		return
+	}
+	var req alertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if pid != 0 {
+		req.PortfolioID = pid
+	}
+	// Portfolio alerts read their own portfolio, so settle it up front.
+	if req.PortfolioID == 0 {
+		req.PortfolioID = models.DefaultPortfolioID
+	}
+
+	req.Ticker = strings.ToUpper(strings.TrimSpace(req.Ticker))
+	// An expression is all an expression alert needs.
+	if req.Expression != "" && req.Kind == "" {
+		req.Kind = models.AlertExpression
+	}
+	if req.Kind == models.AlertExpression && req.Scope == "" {
+		req.Scope = models.ScopePortfolio
+	}
+	if req.Scope == "" {
+		req.Scope = models.ScopeTicker
+	}
+	if req.Kind == "" && req.Scope == models.ScopeTicker {
+		req.Kind = models.AlertPrice
+	}
+	if req.Direction == models.AlertTrailing && req.Trail == "" {
+		req.Trail = models.TrailPercent
+	}
+	if req.Mode == "" {
+		req.Mode = models.AlertOnce
+	}
+	if req.Severity == "" {
+		req.Severity = models.SeverityInfo
+	}
+	if msg := req.validate(); msg != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return
+	}
+	if req.Kind == models.AlertChange && req.WindowMinutes == 0 {
+		req.WindowMinutes = defaultAlertWindow
+	}
+	if req.Kind == models.AlertExpression {
+		expr, ok := s.parseAlertExpression(r.Context(), w, req.PortfolioID, req.Expression)
+		if !ok {
+			return
+		}
+		req.Expression = expr.String()
+	}
+
+	alert := models.PriceAlert{
+		PortfolioID:     req.PortfolioID,
+		Scope:           req.Scope,
+		Ticker:          req.Ticker,
+		AssetType:       req.AssetType,
+		Kind:            req.Kind,
+		Direction:       req.Direction,
+		Threshold:       req.Threshold,
+		WindowMinutes:   req.WindowMinutes,
+		Trail:           req.Trail,
+		Mode:            req.Mode,
+		Hysteresis:      req.Hysteresis,
+		CooldownMinutes: req.CooldownMinutes,
+		Severity:        req.Severity,
+		Expression:      req.Expression,
+		Channels:        req.Channels,
+	}
+	// A trailing alert's peak starts at the current price, so it only
+	// tracks highs from its creation on.
+	if quote, ok := s.market.Snapshot()[assetKey(alert.AssetType, alert.Ticker)]; ok && alert.Direction == models.AlertTrailing && quote.Price > 0 {
+		now := time.Now().UTC()
+		alert.HighWaterMark, alert.HighWaterAt = quote.Price, &now
+	}
+	if alert.Kind == models.AlertDrawdown {
+		alert.HighWaterMark, alert.HighWaterAt = s.portfolioPeak(r.Context(), alert.PortfolioID)
+	}
+
+	created, err := s.store.CreateAlert(r.Context(), alert)
+	if errors.Is(err, store.ErrUnknownChannel) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		writePortfolioError(w, err)
+		return
+	}
+
+	_ = s.RefreshAndBroadcast(context.Background())
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (s *Server) handleDeleteAlert(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = s.store.DeleteAlert(r.Context(), id)
+	if err != nil {
+		writeAlertError(w, err)
+		return
+	}
+
+	_ = s.RefreshAndBroadcast(context.Background())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRearmAlert arms a triggered alert again. Trailing and drawdown
+// alerts restart their peak from the current price or total value, so they
+// do not fire again straight away.
+func (s *Server) handleRearmAlert(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	alert, err := s.store.GetAlert(r.Context(), id)
+	if err != nil {
+		writeAlertError(w, err)
+		return
+	}
+
+	highWater := 0.0
+	if quote, ok := s.market.Snapshot()[assetKey(alert.AssetType, alert.Ticker)]; ok && alert.Direction == models.AlertTrailing {
+		highWater = quote.Price
+	}
+	if alert.Kind == models.AlertDrawdown {
+		if current, err := s.valuePortfolio(r.Context(), s.market.Snapshot()); err == nil {
+			highWater = scopeSnapshot(current, alert.PortfolioID).TotalValue
+		}
+	}
+	if err := s.store.RearmAlert(r.Context(), id, highWater, time.Now().UTC()); err != nil {
+		writeAlertError(w, err)
+		return
+	}
+	alert, err = s.store.GetAlert(r.Context(), id)
+	if err != nil {
+		writeAlertError(w, err)
+		return
+	}
+
+	_ = s.RefreshAndBroadcast(context.Background())
+	writeJSON(w, http.StatusOK, alert)
+}
+
+func (s *Server) handleListAlertEvents(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	events, err := s.store.ListAlertEvents(r.Context(), id)
+	if err != nil {
+		writeAlertError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+func writeAlertError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "alert not found"})
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err)
+}
+
+// evaluateAlerts checks every armed alert against quotes, or for portfolio
+// alerts against the valued snapshot (whose holdings also serve cost-based
+// alerts), or for expression alerts against both, and records the ones that
+// fire. Triggered rearm alerts are checked too, and armed again once the
+// value has crossed back past the threshold by their hysteresis.
+func (s *Server) evaluateAlerts(ctx context.Context, quotes map[string]models.Quote, snap models.PortfolioSnapshot) ([]models.PriceAlert, error) {
+	alerts, err := s.store.ListAlerts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	alertsFired := make([]models.PriceAlert, 0)
+	for _, alert := range alerts {
+		if alert.Triggered && alert.Mode != models.AlertRearm {
+			continue
+		}
+		var (
+			value float64
+			ok    bool
+		)
+		switch {
+		case alert.Kind == models.AlertExpression:
+			alert, value, ok = s.expressionAlertValue(ctx, alert, quotes, snap)
+		case alert.Scope == models.ScopePortfolio:
+			alert, value, ok = s.portfolioAlertValue(ctx, alert, snap)
+		default:
+			alert, value, ok = s.tickerAlertValue(ctx, alert, quotes, snap.Holdings)
+		}
+		if !ok {
+			continue
+		}
+
+		now := time.Now().UTC()
+		if alert.Triggered {
+			if alertRearms(alert, value) {
+				if err := s.store.RearmAlert(ctx, alert.ID, 0, now); err != nil {
+					log.Printf("failed to rearm alert %d: %v", alert.ID, err)
+				}
+			}
+			continue
+		}
+		if !alertFires(alert, value) {
+			continue
+		}
+		if alert.Mode == models.AlertCooldown && alert.TriggeredAt != nil &&
+			now.Sub(*alert.TriggeredAt) < time.Duration(alert.CooldownMinutes)*time.Minute {
+			continue
+		}
+		ev := models.AlertEvent{AlertID: alert.ID, FiredAt: now, TotalValue: scopeSnapshot(snap, alert.PortfolioID).TotalValue}
+		if alert.Scope == models.ScopeTicker {
+			ev.Price = quotes[assetKey(alert.AssetType, alert.Ticker)].Price
+		}
+		ev, fired, err := s.store.MarkAlertTriggered(ctx, ev)
+		if err != nil {
+			log.Printf("failed to mark alert triggered %d: %v", alert.ID, err)
+			continue
+		}
+		if !fired {
+			// A concurrent refresh fired it first.
+			continue
+		}
+		alert.EventID = ev.ID
+		alert.Triggered = alert.Mode != models.AlertCooldown
+		alert.TriggeredAt = &now
+		alert.FireCount++
+		alertsFired = append(alertsFired, alert)
+	}
+	return alertsFired, nil
+}
+
+// tickerAlertValue returns what a ticker alert's threshold is compared
+// with: the price, or the percent move from its reference. It reports false
+// while there is no quote or reference yet.
+func (s *Server) tickerAlertValue(ctx context.Context, alert models.PriceAlert, quotes map[string]models.Quote, holdings []models.HoldingWithPrice) (models.PriceAlert, float64, bool) {
+	quote, ok := quotes[assetKey(alert.AssetType, alert.Ticker)]
+	price := quote.Price
+	if !ok || price <= 0 {
+		return alert, 0, false
+	}
+
+	switch {
+	case alert.Direction == models.AlertTrailing:
+		alert = s.trackHighWater(ctx, alert, price)
+		alert.Reference = alert.HighWaterMark
+		alert.ChangePct = round2((price/alert.HighWaterMark - 1) * 100)
+	case alert.Kind.Percent():
+		reference, current, ok := s.alertReference(ctx, alert, quote, holdings)
+		if !ok {
+			return alert, 0, false
+		}
+		value := (current/reference - 1) * 100
+		alert.Reference = reference
+		alert.ChangePct = round2(value)
+		return alert, value, true
+	}
+	return alert, price, true
+}
+
+// portfolioAlertValue returns what a portfolio alert's threshold is
+// compared with, taken from the alert's own portfolio within the combined
+// snapshot. Day change waits for the portfolio's first end-of-day snapshot;
+// drawdown tracks its own peak like a trailing alert.
+func (s *Server) portfolioAlertValue(ctx context.Context, alert models.PriceAlert, snap models.PortfolioSnapshot) (models.PriceAlert, float64, bool) {
+	own := scopeSnapshot(snap, alert.PortfolioID)
+	switch alert.Kind {
+	case models.AlertTotalValue:
+		return alert, own.TotalValue, true
+	case models.AlertTotalPnL:
+		return alert, own.TotalPnL, true
+	case models.AlertDayChange:
+		reference, err := s.store.PreviousPortfolioClose(ctx, alert.PortfolioID, time.Now().UTC().Truncate(24*time.Hour))
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("alert %d previous portfolio close: %v", alert.ID, err)
+			}
+			return alert, 0, false
+		}
+		if reference <= 0 {
+			return alert, 0, false
+		}
+		value := (own.TotalValue/reference - 1) * 100
+		alert.Reference, alert.ChangePct = round2(reference), round2(value)
+		return alert, value, true
+	case models.AlertDrift:
+		targets, err := s.store.ListAllocationTargets(ctx, alert.PortfolioID)
+		if err != nil {
+			log.Printf("alert %d allocation targets: %v", alert.ID, err)
+			return alert, 0, false
+		}
+		if len(targets) == 0 {
+			return alert, 0, false
+		}
+		// The value is the drift that matters for the direction: the most
+		// overweight bucket for above, the most underweight for below and
+		// the largest either way for either.
+		value := 0.0
+		alert.Drift = nil
+		for _, d := range allocationDrift(snap, alert.PortfolioID, targets) {
+			switch {
+			case alert.Direction == models.AlertAbove && d.DriftPct > value,
+				alert.Direction == models.AlertBelow && d.DriftPct < value,
+				alert.Direction == models.AlertEither && math.Abs(d.DriftPct) > math.Abs(value):
+				value = d.DriftPct
+			}
+			if alertFires(alert, d.DriftPct) {
+				alert.Drift = append(alert.Drift, d)
+			}
+		}
+		return alert, value, true
+	case models.AlertDrawdown:
+		alert = s.trackHighWater(ctx, alert, own.TotalValue)
+		if alert.HighWaterMark <= 0 {
+			return alert, 0, false
+		}
+		value := (own.TotalValue/alert.HighWaterMark - 1) * 100
+		alert.Reference, alert.ChangePct = round2(alert.HighWaterMark), round2(value)
+		return alert, value, true
+	}
+	return alert, 0, false
+}
+
+// portfolioPeak is where a new drawdown alert's peak starts: the highest
+// saved snapshot value of portfolio pid, or its current value when that is
+// higher.
+func (s *Server) portfolioPeak(ctx context.Context, pid int64) (float64, *time.Time) {
+	peak, err := s.store.PeakPortfolioValue(ctx, pid)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("peak portfolio value: %v", err)
+	}
+	if current, err := s.valuePortfolio(ctx, s.market.Snapshot()); err == nil {
+		if value := scopeSnapshot(current, pid).TotalValue; value > peak {
+			peak = value
+		}
+	}
+	if peak <= 0 {
+		return 0, nil
+	}
+	now := time.Now().UTC()
+	return peak, &now
+}
+
+// trackHighWater raises a trailing or drawdown alert's peak to price when
+// it is a new high, persisting it so a restart resumes from the same peak.
+func (s *Server) trackHighWater(ctx context.Context, alert models.PriceAlert, price float64) models.PriceAlert {
+	if price <= alert.HighWaterMark {
+		return alert
+	}
+	now := time.Now().UTC()
+	if err := s.store.RaiseAlertHighWater(ctx, alert.ID, price, now); err != nil {
+		log.Printf("failed to raise alert high water %d: %v", alert.ID, err)
+	}
+	alert.HighWaterMark, alert.HighWaterAt = price, &now
+	alert.StopPrice = alert.TrailingStop()
+	return alert
+}
+
+// alertReference returns the price a percent alert measures from and the
+// current price to compare with it, both in the same currency. It reports
+// false while there is no reference yet, e.g. before enough history has
+// been recorded or while the portfolio holds none of the ticker.
+func (s *Server) alertReference(ctx context.Context, alert models.PriceAlert, quote models.Quote, holdings []models.HoldingWithPrice) (float64, float64, bool) {
+	var (
+		reference float64
+		err       error
+	)
+	switch alert.Kind {
+	case models.AlertChange:
+		window := time.Duration(alert.WindowMinutes) * time.Minute
+		reference, err = s.store.PriceAt(ctx, alert.AssetType, alert.Ticker, time.Now().UTC().Add(-window))
+	case models.AlertFromClose:
+		if quote.PreviousClose > 0 {
+			return quote.PreviousClose, quote.Price, true
+		}
+		reference, err = s.store.PreviousClose(ctx, alert.AssetType, alert.Ticker, time.Now().UTC().Truncate(24*time.Hour))
+	case models.AlertFromCost:
+		quantity, cost, currency := 0.0, 0.0, ""
+		for _, h := range holdings {
+			if h.PortfolioID == alert.PortfolioID && h.AssetType == alert.AssetType && h.Ticker == alert.Ticker {
+				quantity += h.Quantity
+				cost += h.Quantity * h.AvgCost
+				currency = h.Currency
+			}
+		}
+		if quantity <= 0 || cost <= 0 {
+			return 0, 0, false
+		}
+		// Cost is kept in the holding's currency, so compare it with the
+		// quote converted into that currency.
+		price, ok := convertQuote(quote, currency, s.market.FXRates())
+		return cost / quantity, price, ok
+	}
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("alert %d reference price: %v", alert.ID, err)
+		}
+		return 0, 0, false
+	}
+	return reference, quote.Price, reference > 0
+}
+
+// alertFires compares value (a price, or a percent move for percent kinds)
+// with the alert's threshold. A percent "below" threshold is a drop, and a
+// trailing alert compares the price with its stop below the peak. An
+// expression alert's value is 1 while its expression holds.
+func alertFires(alert models.PriceAlert, value float64) bool {
+	if alert.Kind == models.AlertExpression {
+		return value != 0
+	}
+	switch alert.Direction {
+	case models.AlertAbove:
+		return value >= alert.Threshold
+	case models.AlertBelow:
+		if alert.Kind.Percent() {
+			return value <= -alert.Threshold
+		}
+		return value <= alert.Threshold
+	case models.AlertEither:
+		return math.Abs(value) >= alert.Threshold
+	case models.AlertTrailing:
+		return alert.HighWaterMark > 0 && value <= alert.TrailingStop()
+	}
+	return false
+}
+
+// alertRearms reports whether a triggered rearm alert has moved back out of
+// its condition by at least its hysteresis: the threshold is moved the width
+// of the band away from the side it fires on, and the alert re-arms once
+// that moved threshold no longer fires.
+func alertRearms(alert models.PriceAlert, value float64) bool {
+	band := alert
+	if alert.Direction == models.AlertBelow && !alert.Kind.Percent() {
+		band.Threshold += alert.Hysteresis
+	} else {
+		band.Threshold -= alert.Hysteresis
+	}
+	return !alertFires(band, value)
+}
+
+// convertQuote expresses a quote in currency (the default currency when
+// empty). It reports false when a needed exchange rate is missing.
+func convertQuote(quote models.Quote, currency string, fx models.FXRates) (float64, bool) {
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+	if quote.Currency == "" || quote.Currency == currency {
+		return quote.Price, true
+	}
+	quoteRate, quoteOK := fx.Rates[quote.Currency]
+	rate, ok := fx.Rates[currency]
+	if !quoteOK || !ok || rate == 0 {
+		return 0, false
+	}
+	return quote.Price * quoteRate / rate, true
+}
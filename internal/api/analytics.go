@@ -0,0 +1,287 @@
+package api
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"portfoliopulse/internal/analytics"
+	"portfoliopulse/internal/models"
+	"portfoliopulse/internal/store"
+)
+
+func (s *Server) handleReturns(w http.ResponseWriter, r *http.Request) {
+	period := models.ReturnPeriod(strings.ToUpper(r.URL.Query().Get("period")))
+	if period == "" {
+		period = models.PeriodAll
+	}
+
+	pid, ok := s.incomePortfolio(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	txs, err := s.store.ListTransactions(ctx, store.TransactionFilter{PortfolioID: pid})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	movements, err := s.externalCashMovements(ctx, pid)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	income, err := s.store.ListIncome(ctx, store.IncomeFilter{PortfolioID: pid})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	first := now
+	for _, tx := range txs {
+		if tx.ExecutedAt.Before(first) {
+			first = tx.ExecutedAt
+		}
+	}
+	for _, m := range movements {
+		if m.ExecutedAt.Before(first) {
+			first = m.ExecutedAt
+		}
+	}
+	start, ok := periodStart(period, now, first)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "period must be 1M, 3M, YTD, 1Y or ALL"})
+		return
+	}
+
+	snaps, err := s.store.ListPortfolioSnapshots(ctx, store.SnapshotFilter{
+		PortfolioID: pid, Kind: models.SnapshotEOD, To: now, WithHoldings: true,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	live, err := s.valuePortfolio(ctx, s.market.Snapshot())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if pid != 0 {
+		live = scopeSnapshot(live, pid)
+	}
+
+	// Trades and income settled in cash move money inside the portfolio;
+	// only the unsettled ones and deposits or withdrawals cross its boundary.
+	fx := s.market.FXRates()
+	external := make([]models.Transaction, 0, len(txs))
+	for _, tx := range txs {
+		if !tx.CashSettled {
+			external = append(external, tx)
+		}
+	}
+	paidOut := make([]models.IncomeEvent, 0, len(income))
+	for _, ev := range income {
+		if !ev.CashSettled {
+			paidOut = append(paidOut, ev)
+		}
+	}
+	flows := append(transactionFlows(external, fx), movementFlows(movements, fx)...)
+	flows = append(flows, incomeFlows(paidOut, fx)...)
+	report := models.ReturnsReport{
+		Period: period,
+		Portfolio: measureReturns(start, now, snaps, flows, live.TotalValue, func(v models.ValueSnapshot) float64 {
+			return v.TotalValue
+		}),
+		Holdings: make([]models.Returns, 0, len(live.Holdings)),
+	}
+
+	for _, h := range live.Holdings {
+		own := make([]models.Transaction, 0)
+		for _, tx := range txs {
+			if tx.HoldingID == h.ID {
+				own = append(own, tx)
+			}
+		}
+		ownIncome := make([]models.IncomeEvent, 0)
+		for _, ev := range income {
+			if ev.HoldingID == h.ID {
+				ownIncome = append(ownIncome, ev)
+			}
+		}
+		ownFlows := append(transactionFlows(own, fx), incomeFlows(ownIncome, fx)...)
+		ret := measureReturns(start, now, snaps, ownFlows, h.MarketValue, func(v models.ValueSnapshot) float64 {
+			total := 0.0
+			for _, hv := range v.Holdings {
+				if hv.HoldingID == h.ID {
+					total += hv.MarketValue
+				}
+			}
+			return total
+		})
+		if ret.StartValue == 0 && ret.EndValue == 0 && ret.NetFlows == 0 {
+			continue
+		}
+		ret.HoldingID = h.ID
+		ret.Ticker = h.Ticker
+		ret.AssetType = h.AssetType
+		report.Holdings = append(report.Holdings, ret)
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// periodStart resolves a named period to its first instant. ALL starts at
+// first, the earliest recorded activity.
+func periodStart(period models.ReturnPeriod, now, first time.Time) (time.Time, bool) {
+	switch period {
+	case models.Period1M:
+		return now.AddDate(0, -1, 0), true
+	case models.Period3M:
+		return now.AddDate(0, -3, 0), true
+	case models.PeriodYTD:
+		return time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.UTC), true
+	case models.Period1Y:
+		return now.AddDate(-1, 0, 0), true
+	case models.PeriodAll:
+		return first, true
+	}
+	return time.Time{}, false
+}
+
+// measureReturns values one series over [start, now]. The opening value is
+// the last end-of-day snapshot at or before start, or zero when no money had
+// flowed in yet. Without either, the window begins at the first snapshot
+// inside it, which From reports. Values and flows are in the base currency.
+func measureReturns(start, now time.Time, snaps []models.ValueSnapshot, all []analytics.CashFlow, live float64, valueOf func(models.ValueSnapshot) float64) models.Returns {
+	var opening *analytics.ValuePoint
+	points := make([]analytics.ValuePoint, 0, len(snaps)+2)
+	for _, snap := range snaps {
+		if !snap.TakenAt.After(start) {
+			opening = &analytics.ValuePoint{At: start, Value: valueOf(snap)}
+			continue
+		}
+		points = append(points, analytics.ValuePoint{At: snap.TakenAt, Value: valueOf(snap)})
+	}
+	if opening == nil {
+		heldBefore := false
+		for _, f := range all {
+			heldBefore = heldBefore || f.At.Before(start)
+		}
+		if !heldBefore {
+			opening = &analytics.ValuePoint{At: start, Value: 0}
+		}
+	}
+	if opening != nil {
+		points = append([]analytics.ValuePoint{*opening}, points...)
+	}
+	points = append(points, analytics.ValuePoint{At: now, Value: live})
+
+	first, last := points[0], points[len(points)-1]
+	flows := make([]analytics.CashFlow, 0, len(all))
+	net := 0.0
+	for _, f := range all {
+		if f.At.Before(first.At) || f.At.After(last.At) {
+			continue
+		}
+		flows = append(flows, f)
+		net += f.Amount
+	}
+
+	out := models.Returns{
+		From:       first.At,
+		To:         last.At,
+		StartValue: round2(first.Value),
+		EndValue:   round2(last.Value),
+		NetFlows:   round2(net),
+		TWRPct:     round2(analytics.TWR(points, flows) * 100),
+	}
+	if mwr, err := analytics.MWR(first, last, flows); err == nil && !math.IsInf(mwr, 0) && !math.IsNaN(mwr) {
+		pct := round2(mwr * 100)
+		out.MWRPct = &pct
+	}
+	return out
+}
+
+// transactionFlows converts transactions into base-currency flows at the
+// rate each was booked at, or today's rate when none was recorded.
+func transactionFlows(txs []models.Transaction, fx models.FXRates) []analytics.CashFlow {
+	flows := make([]analytics.CashFlow, 0, len(txs))
+	for _, tx := range txs {
+		flows = append(flows, analytics.CashFlow{At: tx.ExecutedAt, Amount: cashFlow(tx) * bookedRate(tx.FXRate, tx.Currency, fx)})
+	}
+	return flows
+}
+
+// movementFlows converts deposits and withdrawals into base-currency flows.
+func movementFlows(movements []models.CashMovement, fx models.FXRates) []analytics.CashFlow {
+	flows := make([]analytics.CashFlow, 0, len(movements))
+	for _, m := range movements {
+		flows = append(flows, analytics.CashFlow{At: m.ExecutedAt, Amount: m.Amount * bookedRate(m.FXRate, m.Currency, fx)})
+	}
+	return flows
+}
+
+// incomeFlows treats income as money leaving the position: paid out to the
+// investor, or paid back in as a reinvestment buy at the same moment.
+func incomeFlows(events []models.IncomeEvent, fx models.FXRates) []analytics.CashFlow {
+	flows := make([]analytics.CashFlow, 0, len(events))
+	for _, ev := range events {
+		flows = append(flows, analytics.CashFlow{At: ev.PaidAt, Amount: -ev.Amount * bookedRate(ev.FXRate, ev.Currency, fx)})
+	}
+	return flows
+}
+
+func bookedRate(rate float64, currency string, fx models.FXRates) float64 {
+	if rate == 0 {
+		rate = fx.Rates[currency]
+	}
+	if rate == 0 {
+		rate = 1
+	}
+	return rate
+}
+
+// externalCashMovements lists the deposits and withdrawals of every cash
+// account of portfolio pid (of all of them when pid is zero): the money
+// that enters or leaves a portfolio through cash.
+func (s *Server) externalCashMovements(ctx context.Context, pid int64) ([]models.CashMovement, error) {
+	accounts, err := s.store.ListCashAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]models.CashMovement, 0)
+	for _, a := range accounts {
+		if pid != 0 && a.PortfolioID != pid {
+			continue
+		}
+		movements, err := s.store.ListCashMovements(ctx, a.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range movements {
+			if m.Type == models.CashDeposit || m.Type == models.CashWithdrawal {
+				out = append(out, m)
+			}
+		}
+	}
+	return out, nil
+}
+
+// cashFlow is the money a transaction moves into the position, in the
+// holding's currency: purchases and their fees in, sale proceeds out.
+// Transfers count at their recorded price.
+func cashFlow(tx models.Transaction) float64 {
+	switch tx.Type {
+	case models.TxBuy, models.TxTransferIn:
+		return tx.Quantity*tx.Price + tx.Fee
+	case models.TxSell, models.TxTransferOut:
+		return -(tx.Quantity*tx.Price - tx.Fee)
+	case models.TxFee:
+		return tx.Fee
+	}
+	return 0
+}
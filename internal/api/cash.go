@@ -0,0 +1,274 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"portfoliopulse/internal/models"
+	"portfoliopulse/internal/store"
+)
+
+func (s *Server) handleListCashAccounts(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.portfolioScope(w, r)
+	if !ok {
+		return
+	}
+	if raw := r.URL.Query().Get("portfolioId"); raw != "" && pid == 0 {
+		id, err := parseID(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		pid = id
+	}
+
+	accounts, err := s.store.ListCashAccounts(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if pid != 0 {
+		scoped := make([]models.CashAccount, 0, len(accounts))
+		for _, a := range accounts {
+			if a.PortfolioID == pid {
+				scoped = append(scoped, a)
+			}
+		}
+		accounts = scoped
+	}
+	writeJSON(w, http.StatusOK, accounts)
+}
+
+func (s *Server) handleGetCashAccount(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	a, err := s.store.GetCashAccount(r.Context(), id)
+	if err != nil {
+		writeCashError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a)
+}
+
+func (s *Server) handleCreateCashAccount(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.portfolioScope(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		PortfolioID int64  `json:"portfolioId"`
+		Currency    string `json:"currency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if pid != 0 {
+		req.PortfolioID = pid
+	}
+	if !validCurrency(req.Currency) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "currency must be a 3-letter ISO code"})
+		return
+	}
+
+	created, err := s.store.CreateCashAccount(r.Context(), models.CashAccount{
+		PortfolioID: req.PortfolioID,
+		Currency:    req.Currency,
+	})
+	if err != nil {
+		writeCashError(w, err)
+		return
+	}
+
+	_ = s.RefreshAndBroadcast(context.Background())
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (s *Server) handleDeleteCashAccount(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.store.DeleteCashAccount(r.Context(), id); err != nil {
+		writeCashError(w, err)
+		return
+	}
+
+	_ = s.RefreshAndBroadcast(context.Background())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListCashMovements(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	movements, err := s.store.ListCashMovements(r.Context(), id)
+	if err != nil {
+		writeCashError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, movements)
+}
+
+func (s *Server) handleCreateCashMovement(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var req struct {
+		Type       models.CashMovementType `json:"type"`
+		Amount     float64                 `json:"amount"`
+		FXRate     float64                 `json:"fxRate"`
+		ExecutedAt *time.Time              `json:"executedAt"`
+		Note       string                  `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	switch req.Type {
+	case models.CashDeposit, models.CashWithdrawal, models.CashDividend, models.CashInterest, models.CashFee:
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "type must be deposit, withdrawal, dividend, interest or fee"})
+		return
+	}
+	if req.Amount <= 0 || req.FXRate < 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "amount must be positive and fxRate non-negative"})
+		return
+	}
+
+	account, err := s.store.GetCashAccount(r.Context(), id)
+	if err != nil {
+		writeCashError(w, err)
+		return
+	}
+	m := models.CashMovement{
+		AccountID: id,
+		Type:      req.Type,
+		Amount:    req.Amount,
+		FXRate:    req.FXRate,
+		Note:      strings.TrimSpace(req.Note),
+	}
+	if m.FXRate == 0 {
+		m.FXRate = s.market.FXRates().Rates[account.Currency]
+	}
+	if req.ExecutedAt != nil {
+		m.ExecutedAt = req.ExecutedAt.UTC()
+	}
+
+	created, err := s.store.CreateCashMovement(r.Context(), m)
+	if err != nil {
+		writeCashError(w, err)
+		return
+	}
+
+	_ = s.RefreshAndBroadcast(context.Background())
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (s *Server) handleDeleteCashMovement(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := parseID(vars["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	mid, err := parseID(vars["mid"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.store.DeleteCashMovement(r.Context(), id, mid); err != nil {
+		writeCashError(w, err)
+		return
+	}
+
+	_ = s.RefreshAndBroadcast(context.Background())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// withCashSettlement decides whether a new trade settles against cash: as
+// asked when settle is given, otherwise whenever the holding's portfolio has
+// a cash account in its currency.
+func (s *Server) withCashSettlement(ctx context.Context, tx models.Transaction, settle *bool) models.Transaction {
+	if settle != nil {
+		tx.CashSettled = *settle
+		return tx
+	}
+	pid, currency := tx.PortfolioID, tx.Currency
+	if tx.HoldingID != 0 {
+		h, err := s.store.GetHolding(ctx, tx.HoldingID)
+		if err != nil {
+			return tx
+		}
+		pid, currency = h.PortfolioID, h.Currency
+	} else if existing, ok := s.findHolding(ctx, tx.PortfolioID, tx.AssetType, tx.Ticker); ok {
+		currency = existing.Currency
+	}
+	tx.CashSettled = s.hasCashAccount(ctx, pid, currency)
+	return tx
+}
+
+// hasCashAccount reports whether portfolio pid (the default one when zero)
+// has a cash account in currency (the default currency when empty).
+func (s *Server) hasCashAccount(ctx context.Context, pid int64, currency string) bool {
+	if pid == 0 {
+		pid = models.DefaultPortfolioID
+	}
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+	accounts, err := s.store.ListCashAccounts(ctx)
+	if err != nil {
+		return false
+	}
+	for _, a := range accounts {
+		if a.PortfolioID == pid && a.Currency == currency {
+			return true
+		}
+	}
+	return false
+}
+
+// findHolding looks up the holding a ticker-addressed entry will be booked
+// against, the same way the store resolves it.
+func (s *Server) findHolding(ctx context.Context, pid int64, assetType models.AssetType, ticker string) (models.Holding, bool) {
+	holdings, err := s.store.ListHoldings(ctx)
+	if err != nil {
+		return models.Holding{}, false
+	}
+	if pid == 0 {
+		pid = models.DefaultPortfolioID
+	}
+	for _, h := range holdings {
+		if h.PortfolioID == pid && h.AssetType == assetType && h.Ticker == ticker {
+			return h, true
+		}
+	}
+	return models.Holding{}, false
+}
+
+func writeCashError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "cash account, movement or portfolio not found"})
+	case errors.Is(err, store.ErrCashAccountExists):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"portfoliopulse/internal/models"
+	"portfoliopulse/internal/notify"
+	"portfoliopulse/internal/store"
+)
+
+// maskedHeader replaces header values in channel responses. Sending it
+// back in an update keeps the stored value.
+const maskedHeader = "********"
+
+type channelRequest struct {
+	Name    string             `json:"name"`
+	Type    models.ChannelType `json:"type"`
+	URL     string             `json:"url"`
+	ChatID  string             `json:"chatId"`
+	Headers map[string]string  `json:"headers"`
+	// Secret is left out of responses, so an update without one keeps
+	// the stored secret; "" clears it.
+	Secret   *string              `json:"secret"`
+	Template string               `json:"template"`
+	Rules    []models.ChannelRule `json:"rules"`
+}
+
+// channel validates req, answering 400 itself when it is invalid. An
+// update passes the stored channel, whose secret and masked header values
+// it keeps.
+func (req channelRequest) channel(w http.ResponseWriter, stored models.NotificationChannel) (models.NotificationChannel, bool) {
+	c := models.NotificationChannel{
+		Name:     strings.TrimSpace(req.Name),
+		Type:     req.Type,
+		URL:      strings.TrimSpace(req.URL),
+		ChatID:   strings.TrimSpace(req.ChatID),
+		Headers:  req.Headers,
+		Secret:   stored.Secret,
+		Template: req.Template,
+		Rules:    req.Rules,
+	}
+	if req.Secret != nil {
+		c.Secret = *req.Secret
+	}
+	for name, value := range c.Headers {
+		if value == maskedHeader {
+			if old, ok := stored.Headers[name]; ok {
+				c.Headers[name] = old
+			}
+		}
+	}
+	if c.Name == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name is required"})
+		return c, false
+	}
+	if c.Type == "" {
+		c.Type = models.ChannelWebhook
+	}
+	for _, rule := range c.Rules {
+		switch rule.AssetType {
+		case "", models.AssetStock, models.AssetCrypto:
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "rule assetType must be stock or crypto"})
+			return c, false
+		}
+		if rule.MinSeverity != "" && rule.MinSeverity.Rank() == 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "rule minSeverity must be info, warning or critical"})
+			return c, false
+		}
+	}
+	// Building the channel checks the URL, type, chat and template the
+	// same way routing will.
+	if _, err := notify.NewWebhook(notify.ConfigFor(c), http.DefaultClient); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return c, false
+	}
+	return c, true
+}
+
+// redactChannel is c as the API shows it, without its secret and header
+// values, which often carry credentials.
+func redactChannel(c models.NotificationChannel) models.NotificationChannel {
+	c.HasSecret, c.Secret = c.Secret != "", ""
+	if c.Headers != nil {
+		masked := make(map[string]string, len(c.Headers))
+		for name := range c.Headers {
+			masked[name] = maskedHeader
+		}
+		c.Headers = masked
+	}
+	return c
+}
+
+func (s *Server) handleListChannels(w http.ResponseWriter, r *http.Request) {
+	channels, err := s.store.ListChannels(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for i, c := range channels {
+		channels[i] = redactChannel(c)
+	}
+	writeJSON(w, http.StatusOK, channels)
+}
+
+func (s *Server) handleGetChannel(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	c, err := s.store.GetChannel(r.Context(), id)
+	if err != nil {
+		writeChannelError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, redactChannel(c))
+}
+
+func (s *Server) handleCreateChannel(w http.ResponseWriter, r *http.Request) {
+	var req channelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	c, ok := req.channel(w, models.NotificationChannel{})
+	if !ok {
+		return
+	}
+	created, err := s.store.CreateChannel(r.Context(), c)
+	if err != nil {
+		writeChannelError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, redactChannel(created))
+}
+
+func (s *Server) handleUpdateChannel(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var req channelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	stored, err := s.store.GetChannel(r.Context(), id)
+	if err != nil {
+		writeChannelError(w, err)
+		return
+	}
+	c, ok := req.channel(w, stored)
+	if !ok {
+		return
+	}
+	updated, err := s.store.UpdateChannel(r.Context(), id, c)
+	if err != nil {
+		writeChannelError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, redactChannel(updated))
+}
+
+func (s *Server) handleDeleteChannel(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.store.DeleteChannel(r.Context(), id); err != nil {
+		writeChannelError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeChannelError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "channel not found"})
+	case errors.Is(err, store.ErrChannelExists):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
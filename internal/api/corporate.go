@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"portfoliopulse/internal/models"
+	"portfoliopulse/internal/store"
+)
+
+type corporateActionRequest struct {
+	Type         models.CorporateActionType `json:"type"`
+	AssetType    models.AssetType           `json:"assetType"`
+	Ticker       string                     `json:"ticker"`
+	NewTicker    string                     `json:"newTicker"`
+	Ratio        float64                    `json:"ratio"`
+	CostFraction float64                    `json:"costFraction"`
+	EffectiveAt  *time.Time                 `json:"effectiveAt"`
+	Note         string                     `json:"note"`
+}
+
+func (req corporateActionRequest) validate() string {
+	if strings.TrimSpace(req.Ticker) == "" {
+		return "ticker is required"
+	}
+	if req.AssetType != models.AssetStock && req.AssetType != models.AssetCrypto {
+		return "assetType must be stock or crypto"
+	}
+	renames := req.Type == models.ActionTickerChange || req.Type == models.ActionSpinOff || req.Type == models.ActionMerger
+	newTicker := strings.ToUpper(strings.TrimSpace(req.NewTicker))
+	if renames && (newTicker == "" || newTicker == strings.ToUpper(strings.TrimSpace(req.Ticker))) {
+		return "newTicker is required and must differ from ticker"
+	}
+
+	switch req.Type {
+	case models.ActionSplit:
+		if req.Ratio <= 1 {
+			return "a split needs a ratio above 1 (new shares per old share)"
+		}
+	case models.ActionReverseSplit:
+		if req.Ratio <= 0 || req.Ratio >= 1 {
+			return "a reverse split needs a ratio between 0 and 1 (new shares per old share)"
+		}
+	case models.ActionTickerChange:
+		if req.Ratio != 0 && req.Ratio != 1 {
+			return "a ticker change takes no ratio"
+		}
+	case models.ActionMerger:
+		if req.Ratio <= 0 {
+			return "a merger needs a positive ratio (new shares per old share)"
+		}
+	case models.ActionSpinOff:
+		if req.Ratio <= 0 {
+			return "a spin-off needs a positive ratio (new shares per parent share)"
+		}
+		if req.CostFraction <= 0 || req.CostFraction >= 1 {
+			return "a spin-off needs a costFraction between 0 and 1"
+		}
+	default:
+		return "type must be split, reverse_split, ticker_change, spin_off or merger"
+	}
+	if req.Type != models.ActionSpinOff && req.CostFraction != 0 {
+		return "costFraction only applies to spin_off"
+	}
+	return ""
+}
+
+func (s *Server) handleListCorporateActions(w http.ResponseWriter, r *http.Request) {
+	actions, err := s.store.ListCorporateActions(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, actions)
+}
+
+func (s *Server) handleGetCorporateAction(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	a, err := s.store.GetCorporateAction(r.Context(), id)
+	if err != nil {
+		writeCorporateActionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a)
+}
+
+func (s *Server) handleApplyCorporateAction(w http.ResponseWriter, r *http.Request) {
+	var req corporateActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return
+	}
+
+	a := models.CorporateAction{
+		Type:         req.Type,
+		AssetType:    req.AssetType,
+		Ticker:       req.Ticker,
+		NewTicker:    req.NewTicker,
+		Ratio:        req.Ratio,
+		CostFraction: req.CostFraction,
+		Note:         req.Note,
+	}
+	if a.Type == models.ActionTickerChange {
+		a.Ratio = 1
+	}
+	if req.EffectiveAt != nil {
+		a.EffectiveAt = req.EffectiveAt.UTC()
+	}
+
+	applied, err := s.store.ApplyCorporateAction(r.Context(), a)
+	if err != nil {
+		writeCorporateActionError(w, err)
+		return
+	}
+
+	_ = s.RefreshAndBroadcast(context.Background())
+	writeJSON(w, http.StatusCreated, applied)
+}
+
+// requireAdmin guards admin routes with the configured bearer token. With
+// no token configured they are open, like the rest of the API.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "admin token required"})
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func writeCorporateActionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "corporate action not found"})
+	case errors.Is(err, store.ErrCorporateActionApplied):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeTransactionError(w, err)
+	}
+}
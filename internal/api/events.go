@@ -0,0 +1,120 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"portfoliopulse/internal/store"
+)
+
+// maxEventNote bounds an event's note, which is free text.
+const maxEventNote = 2000
+
+// handleListEvents lists alert firings across alerts, newest first,
+// optionally only one alert's or the unacknowledged ones.
+func (s *Server) handleListEvents(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.portfolioScope(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	filter := store.AlertEventFilter{PortfolioID: pid}
+	if raw := q.Get("alertId"); raw != "" {
+		id, err := parseID(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		filter.AlertID = id
+	}
+	if raw := q.Get("unacknowledged"); raw != "" {
+		unacked, err := strconv.ParseBool(raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unacknowledged must be true or false"})
+			return
+		}
+		filter.Unacknowledged = unacked
+	}
+	if raw := q.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > 1000 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 1000"})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	events, err := s.store.ListEvents(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+func (s *Server) handleGetEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ev, err := s.store.GetAlertEvent(r.Context(), id)
+	if err != nil {
+		writeEventError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ev)
+}
+
+func (s *Server) handleAcknowledgeEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ev, err := s.store.AcknowledgeAlertEvent(r.Context(), id, time.Now().UTC())
+	if err != nil {
+		writeEventError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ev)
+}
+
+func (s *Server) handleSetEventNote(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var req struct {
+		Note string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Note) > maxEventNote {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "note must be at most 2000 bytes"})
+		return
+	}
+	ev, err := s.store.SetAlertEventNote(r.Context(), id, req.Note)
+	if err != nil {
+		writeEventError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ev)
+}
+
+func writeEventError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "alert event not found"})
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err)
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"portfoliopulse/internal/alertexpr"
+	"portfoliopulse/internal/models"
+)
+
+// changeWindows are the lookbacks of the change_* expression functions.
+var changeWindows = map[string]time.Duration{
+	"change_1h":  time.Hour,
+	"change_24h": 24 * time.Hour,
+	"change_7d":  7 * 24 * time.Hour,
+}
+
+// parseAlertExpression parses src and fills in the asset type of tickers
+// that do not name one from the holdings of portfolio pid. Parse errors get
+// a 400 with the column they were found at.
+func (s *Server) parseAlertExpression(ctx context.Context, w http.ResponseWriter, pid int64, src string) (*alertexpr.Expr, bool) {
+	expr, err := alertexpr.Parse(src)
+	if err == nil {
+		var holdings []models.Holding
+		if holdings, err = s.store.ListHoldings(ctx); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return nil, false
+		}
+		err = expr.Resolve(func(ticker string) (models.AssetType, bool) {
+			for _, h := range holdings {
+				if h.PortfolioID == pid && h.Ticker == ticker {
+					return h.AssetType, true
+				}
+			}
+			return "", false
+		})
+	}
+	var perr *alertexpr.Error
+	if errors.As(err, &perr) {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "expression " + perr.Error(), "position": perr.Pos})
+		return nil, false
+	}
+	return expr, true
+}
+
+// expressionTickers returns the tickers armed expression alerts read, so
+// a refresh quotes them whether or not they are held.
+func (s *Server) expressionTickers(ctx context.Context) ([]models.Holding, error) {
+	alerts, err := s.store.ListAlerts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []models.Holding
+	for _, alert := range alerts {
+		if alert.Kind != models.AlertExpression || (alert.Triggered && alert.Mode != models.AlertRearm) {
+			continue
+		}
+		expr, err := alertexpr.Parse(alert.Expression)
+		if err != nil {
+			continue
+		}
+		for _, ref := range expr.Refs() {
+			out = append(out, models.Holding{Ticker: ref.Ticker, AssetType: ref.AssetType})
+		}
+	}
+	return out, nil
+}
+
+// expressionAlertValue evaluates an expression alert, returning 1 while its
+// condition holds and 0 otherwise, with the values it read on the alert.
+// It reports false while any value it needs is unavailable.
+func (s *Server) expressionAlertValue(ctx context.Context, alert models.PriceAlert, quotes map[string]models.Quote, snap models.PortfolioSnapshot) (models.PriceAlert, float64, bool) {
+	expr, err := alertexpr.Parse(alert.Expression)
+	if err != nil {
+		log.Printf("alert %d expression: %v", alert.ID, err)
+		return alert, 0, false
+	}
+	env := &expressionEnv{s: s, ctx: ctx, quotes: quotes, snap: scopeSnapshot(snap, alert.PortfolioID), alert: alert}
+	result, ok, values := expr.Eval(env)
+	if !ok {
+		return alert, 0, false
+	}
+	alert.Values = values
+	if result {
+		return alert, 1, true
+	}
+	return alert, 0, true
+}
+
+// expressionEnv reads expression values from a refresh's quotes and the
+// alert's own portfolio within its snapshot, like portfolio alerts, and
+// changes from price history.
+type expressionEnv struct {
+	s      *Server
+	ctx    context.Context
+	quotes map[string]models.Quote
+	snap   models.PortfolioSnapshot
+	alert  models.PriceAlert
+}
+
+func (env *expressionEnv) Call(fn, ticker string, assetType models.AssetType) (float64, bool) {
+	quote, ok := env.quotes[assetKey(assetType, ticker)]
+	if fn == "price" {
+		return quote.Price, ok && quote.Price > 0
+	}
+	if window, isChange := changeWindows[fn]; isChange {
+		if !ok || quote.Price <= 0 {
+			return 0, false
+		}
+		reference, err := env.s.store.PriceAt(env.ctx, assetType, ticker, time.Now().UTC().Add(-window))
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("alert %d reference price: %v", env.alert.ID, err)
+			}
+			return 0, false
+		}
+		if reference <= 0 {
+			return 0, false
+		}
+		return (quote.Price/reference - 1) * 100, true
+	}
+
+	// The holding functions sum every holding of the ticker in the
+	// portfolio, in the base currency; a ticker that is not held is worth 0.
+	value, cost, pnl := 0.0, 0.0, 0.0
+	for _, h := range env.snap.Holdings {
+		if h.AssetType != assetType || h.Ticker != ticker {
+			continue
+		}
+		if h.Price <= 0 {
+			return 0, false
+		}
+		value += h.MarketValue
+		cost += h.CostBasis
+		pnl += h.PnL
+	}
+	switch fn {
+	case "value":
+		return value, true
+	case "pnl":
+		return pnl, true
+	case "pnl_pct":
+		if cost <= 0 {
+			return 0, false
+		}
+		return pnl / cost * 100, true
+	case "weight":
+		if env.snap.TotalValue <= 0 {
+			return 0, false
+		}
+		return value / env.snap.TotalValue * 100, true
+	}
+	return 0, false
+}
+
+func (env *expressionEnv) Field(name string) (float64, bool) {
+	switch name {
+	case "total_value":
+		return env.snap.TotalValue, true
+	case "total_cost":
+		return env.snap.TotalCost, true
+	case "total_pnl":
+		return env.snap.TotalPnL, true
+	case "total_cash":
+		return env.snap.TotalCash, true
+	case "realized_pnl":
+		return env.snap.TotalRealizedPnL, true
+	case "day_change":
+		reference, err := env.s.store.PreviousPortfolioClose(env.ctx, env.alert.PortfolioID, time.Now().UTC().Truncate(24*time.Hour))
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("alert %d previous portfolio close: %v", env.alert.ID, err)
+			}
+			return 0, false
+		}
+		if reference <= 0 {
+			return 0, false
+		}
+		return (env.snap.TotalValue/reference - 1) * 100, true
+	}
+	return 0, false
+}
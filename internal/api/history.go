@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"portfoliopulse/internal/models"
+	"portfoliopulse/internal/notify"
+	"portfoliopulse/internal/store"
+)
+
+// StartSnapshotScheduler persists portfolio valuations until ctx is done:
+// an end-of-day snapshot once the UTC clock passes the configured EOD time
+// each day, plus intraday snapshots at the configured interval when enabled.
+// Prices come from the quote cache the polling loop keeps warm. When
+// digests are enabled it also sends the daily digest; a restart after the
+// digest time waits for the next day rather than sending it twice.
+func (s *Server) StartSnapshotScheduler(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	var lastEOD, lastDigest string
+	var lastIntraday time.Time
+	if start := time.Now().UTC(); start.Sub(start.Truncate(24*time.Hour)) >= s.digestAt {
+		lastDigest = start.Format("2006-01-02")
+	}
+	check := func(now time.Time) {
+		day := now.Format("2006-01-02")
+		midnight := now.Truncate(24 * time.Hour)
+		if s.digest && s.notifier != nil && day != lastDigest && now.Sub(midnight) >= s.digestAt {
+			if err := s.sendDigest(context.Background(), now); err != nil {
+				log.Printf("digest failed: %v", err)
+			} else {
+				lastDigest = day
+			}
+		}
+		if day != lastEOD && now.Sub(midnight) >= s.eodAt {
+			if _, err := s.takeValueSnapshot(context.Background(), models.SnapshotEOD, now); err != nil {
+				log.Printf("eod snapshot failed: %v", err)
+			} else {
+				lastEOD = day
+			}
+		}
+		if s.intradayEvery > 0 && now.Sub(lastIntraday) >= s.intradayEvery {
+			if _, err := s.takeValueSnapshot(context.Background(), models.SnapshotIntraday, now); err != nil {
+				log.Printf("intraday snapshot failed: %v", err)
+			} else {
+				lastIntraday = now
+			}
+		}
+	}
+
+	check(time.Now().UTC())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			check(now.UTC())
+		}
+	}
+}
+
+// sendDigest hands the notifier the combined snapshot, built like
+// /api/portfolio's.
+func (s *Server) sendDigest(ctx context.Context, at time.Time) error {
+	snap, err := s.BuildSnapshot(ctx)
+	if err != nil {
+		return err
+	}
+	s.notifier.Notify(notify.Event{Type: notify.EventDigest, At: at, Snapshot: &snap})
+	return nil
+}
+
+// takeValueSnapshot saves the combined valuation and one of each portfolio,
+// whose closes and peaks portfolio alerts read, and returns the combined one.
+func (s *Server) takeValueSnapshot(ctx context.Context, kind models.SnapshotKind, at time.Time) (models.ValueSnapshot, error) {
+	valuation, err := s.valuePortfolio(ctx, s.market.Snapshot())
+	if err != nil {
+		return models.ValueSnapshot{}, err
+	}
+	for _, p := range valuation.Portfolios {
+		if _, err := s.store.SavePortfolioSnapshot(ctx, valueSnapshot(scopeSnapshot(valuation, p.PortfolioID), kind, at)); err != nil {
+			return models.ValueSnapshot{}, err
+		}
+	}
+	return s.store.SavePortfolioSnapshot(ctx, valueSnapshot(valuation, kind, at))
+}
+
+// valueSnapshot is the saved form of valuation.
+func valueSnapshot(valuation models.PortfolioSnapshot, kind models.SnapshotKind, at time.Time) models.ValueSnapshot {
+	snap := models.ValueSnapshot{
+		PortfolioID:      valuation.PortfolioID,
+		Kind:             kind,
+		TakenAt:          at,
+		TotalValue:       valuation.TotalValue,
+		TotalCost:        valuation.TotalCost,
+		TotalPnL:         valuation.TotalPnL,
+		TotalRealizedPnL: valuation.TotalRealizedPnL,
+		Holdings:         make([]models.HoldingValue, 0, len(valuation.Holdings)),
+	}
+	for _, h := range valuation.Holdings {
+		snap.Holdings = append(snap.Holdings, models.HoldingValue{
+			HoldingID:   h.ID,
+			Ticker:      h.Ticker,
+			AssetType:   h.AssetType,
+			Quantity:    h.Quantity,
+			Price:       h.Price,
+			MarketValue: h.MarketValue,
+			CostBasis:   h.CostBasis,
+		})
+	}
+	return snap
+}
+
+func (s *Server) handlePortfolioHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, err := parseTimeParam(q.Get("from"), false)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid from: " + err.Error()})
+		return
+	}
+	to, err := parseTimeParam(q.Get("to"), true)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid to: " + err.Error()})
+		return
+	}
+
+	pid, ok := s.incomePortfolio(w, r)
+	if !ok {
+		return
+	}
+
+	filter := store.SnapshotFilter{PortfolioID: pid, From: from, To: to, WithHoldings: q.Get("holdings") == "true"}
+	switch kind := q.Get("kind"); kind {
+	case "", string(models.SnapshotEOD):
+		filter.Kind = models.SnapshotEOD
+	case string(models.SnapshotIntraday):
+		filter.Kind = models.SnapshotIntraday
+	case "all":
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "kind must be eod, intraday or all"})
+		return
+	}
+
+	points, err := s.store.ListPortfolioSnapshots(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	curve := models.EquityCurve{From: from, To: to, Points: points}
+	if len(points) > 0 {
+		if curve.From.IsZero() {
+			curve.From = points[0].TakenAt
+		}
+		if curve.To.IsZero() {
+			curve.To = points[len(points)-1].TakenAt
+		}
+	}
+	writeJSON(w, http.StatusOK, curve)
+}
@@ -0,0 +1,421 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"portfoliopulse/internal/models"
+	"portfoliopulse/internal/store"
+)
+
+type incomeRequest struct {
+	PortfolioID int64             `json:"portfolioId"`
+	HoldingID   int64             `json:"holdingId"`
+	Ticker      string            `json:"ticker"`
+	AssetType   models.AssetType  `json:"assetType"`
+	Currency    string            `json:"currency"`
+	Type        models.IncomeType `json:"type"`
+	Amount      float64           `json:"amount"`
+	Quantity    float64           `json:"quantity"`
+	Price       float64           `json:"price"`
+	Reinvest    bool              `json:"reinvest"`
+	SettleCash  *bool             `json:"settleCash"`
+	FXRate      float64           `json:"fxRate"`
+	PaidAt      *time.Time        `json:"paidAt"`
+	Note        string            `json:"note"`
+}
+
+func (req incomeRequest) validate() string {
+	switch req.Type {
+	case models.IncomeDividend, models.IncomeInterest:
+		if req.Amount <= 0 {
+			return "dividend and interest need a positive amount"
+		}
+	case models.IncomeStaking:
+		if req.Quantity <= 0 {
+			return "staking rewards need a positive quantity"
+		}
+	default:
+		return "type must be dividend, interest or staking"
+	}
+	if req.Amount < 0 || req.Quantity < 0 || req.Price < 0 || req.FXRate < 0 {
+		return "amount, quantity, price and fxRate must not be negative"
+	}
+	if !validCurrency(req.Currency) {
+		return "currency must be a 3-letter ISO code"
+	}
+	reinvest := req.Reinvest || req.Type == models.IncomeStaking
+	if reinvest && req.SettleCash != nil && *req.SettleCash {
+		return "reinvested income is not paid into cash"
+	}
+	if req.HoldingID == 0 {
+		if strings.TrimSpace(req.Ticker) == "" {
+			return "holdingId or ticker is required"
+		}
+		if req.AssetType != models.AssetStock && req.AssetType != models.AssetCrypto {
+			return "assetType must be stock or crypto"
+		}
+	}
+	return ""
+}
+
+func (s *Server) handleListIncome(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.portfolioScope(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	filter := store.IncomeFilter{PortfolioID: pid, Type: models.IncomeType(q.Get("type"))}
+	if raw := q.Get("holdingId"); raw != "" {
+		id, err := parseID(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		filter.HoldingID = id
+	}
+	if raw := q.Get("portfolioId"); raw != "" && pid == 0 {
+		id, err := parseID(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		filter.PortfolioID = id
+	}
+	var err error
+	if filter.From, err = parseTimeParam(q.Get("from"), false); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid from: " + err.Error()})
+		return
+	}
+	if filter.To, err = parseTimeParam(q.Get("to"), true); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid to: " + err.Error()})
+		return
+	}
+
+	events, err := s.store.ListIncome(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+func (s *Server) handleGetIncome(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ev, err := s.store.GetIncome(r.Context(), id)
+	if err != nil {
+		writeIncomeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ev)
+}
+
+func (s *Server) handleCreateIncome(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.portfolioScope(w, r)
+	if !ok {
+		return
+	}
+	var req incomeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if pid != 0 {
+		req.PortfolioID = pid
+	}
+	if msg := req.validate(); msg != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return
+	}
+
+	ctx := r.Context()
+	ev := models.IncomeEvent{
+		PortfolioID: req.PortfolioID,
+		HoldingID:   req.HoldingID,
+		Ticker:      strings.ToUpper(strings.TrimSpace(req.Ticker)),
+		AssetType:   req.AssetType,
+		Currency:    strings.ToUpper(req.Currency),
+		Type:        req.Type,
+		Amount:      req.Amount,
+		Reinvested:  req.Reinvest || req.Type == models.IncomeStaking,
+		Quantity:    req.Quantity,
+		Price:       req.Price,
+		FXRate:      req.FXRate,
+		Note:        strings.TrimSpace(req.Note),
+	}
+	if req.PaidAt != nil {
+		ev.PaidAt = req.PaidAt.UTC()
+	}
+
+	// The holding decides the currency and, when none was given, the
+	// price a reinvestment is booked at.
+	h := models.Holding{PortfolioID: ev.PortfolioID, Ticker: ev.Ticker, AssetType: ev.AssetType, Currency: ev.Currency}
+	if ev.HoldingID != 0 {
+		found, err := s.store.GetHolding(ctx, ev.HoldingID)
+		if err != nil {
+			writeIncomeError(w, err)
+			return
+		}
+		h = found
+	} else if found, ok := s.findHolding(ctx, ev.PortfolioID, ev.AssetType, ev.Ticker); ok {
+		h = found
+	}
+	if h.Currency == "" {
+		h.Currency = models.DefaultCurrency
+	}
+
+	if ev.Reinvested {
+		if msg := s.priceReinvestment(&ev, h); msg != "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+			return
+		}
+	} else if req.SettleCash != nil {
+		ev.CashSettled = *req.SettleCash
+	} else {
+		ev.CashSettled = s.hasCashAccount(ctx, h.PortfolioID, h.Currency)
+	}
+	if ev.FXRate == 0 {
+		ev.FXRate = s.market.FXRates().Rates[h.Currency]
+	}
+
+	created, err := s.store.CreateIncome(ctx, ev)
+	if err != nil {
+		writeIncomeError(w, err)
+		return
+	}
+
+	_ = s.RefreshAndBroadcast(context.Background())
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// priceReinvestment fills in whichever of amount, quantity and price the
+// request left out, falling back to the holding's current price. It returns
+// a message when the reinvestment cannot be priced.
+func (s *Server) priceReinvestment(ev *models.IncomeEvent, h models.Holding) string {
+	switch {
+	case ev.Amount > 0 && ev.Price > 0:
+		ev.Quantity = ev.Amount / ev.Price
+	case ev.Amount > 0 && ev.Quantity > 0:
+		ev.Price = ev.Amount / ev.Quantity
+	default:
+		if ev.Price == 0 {
+			price, ok := s.localPrice(h)
+			if !ok {
+				return "price is required when there is no current quote"
+			}
+			ev.Price = price
+		}
+		if ev.Quantity == 0 {
+			ev.Quantity = ev.Amount / ev.Price
+		}
+		ev.Amount = ev.Quantity * ev.Price
+	}
+	return ""
+}
+
+// localPrice is the holding's latest quote in the holding's own currency.
+func (s *Server) localPrice(h models.Holding) (float64, bool) {
+	quote, ok := s.market.Snapshot()[assetKey(h.AssetType, h.Ticker)]
+	if !ok || quote.Price <= 0 {
+		return 0, false
+	}
+	return convertQuote(quote, h.Currency, s.market.FXRates())
+}
+
+func (s *Server) handleDeleteIncome(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.store.DeleteIncome(r.Context(), id); err != nil {
+		writeIncomeError(w, err)
+		return
+	}
+
+	_ = s.RefreshAndBroadcast(context.Background())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleIncomeSummary reports the last twelve months of income per holding
+// with yield on cost and current yield, for one portfolio or all of them.
+func (s *Server) handleIncomeSummary(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.incomePortfolio(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	now := time.Now().UTC()
+	from := now.AddDate(-1, 0, 0)
+	events, err := s.store.ListIncome(ctx, store.IncomeFilter{PortfolioID: pid, From: from, To: now})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	live, err := s.valuePortfolio(ctx, s.market.Snapshot())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if pid != 0 {
+		live = scopeSnapshot(live, pid)
+	}
+
+	fx := s.market.FXRates()
+	summary := models.IncomeSummary{
+		From:         from,
+		To:           now,
+		BaseCurrency: live.BaseCurrency,
+		ByType:       make(map[models.IncomeType]float64),
+		Holdings:     make([]models.HoldingIncome, 0),
+	}
+	byHolding := make(map[int64]*models.HoldingIncome)
+	for _, ev := range events {
+		amount := ev.Amount * bookedRate(ev.FXRate, ev.Currency, fx)
+		summary.TTMIncome += amount
+		summary.ByType[ev.Type] += amount
+		hi, ok := byHolding[ev.HoldingID]
+		if !ok {
+			hi = &models.HoldingIncome{HoldingID: ev.HoldingID, PortfolioID: ev.PortfolioID, Ticker: ev.Ticker, AssetType: ev.AssetType}
+			byHolding[ev.HoldingID] = hi
+		}
+		hi.TTMIncome += amount
+		paidAt := ev.PaidAt
+		hi.LastPaidAt = &paidAt
+	}
+
+	cost, value := 0.0, 0.0
+	for _, h := range live.Holdings {
+		cost += h.CostBasis
+		value += h.MarketValue
+		if hi, ok := byHolding[h.ID]; ok {
+			hi.CostBasis = h.CostBasis
+			hi.MarketValue = h.MarketValue
+		}
+	}
+	for _, hi := range byHolding {
+		hi.YieldOnCostPct = yieldPct(hi.TTMIncome, hi.CostBasis)
+		hi.CurrentYieldPct = yieldPct(hi.TTMIncome, hi.MarketValue)
+		hi.TTMIncome = round2(hi.TTMIncome)
+		summary.Holdings = append(summary.Holdings, *hi)
+	}
+	sort.SliceStable(summary.Holdings, func(i, j int) bool {
+		if summary.Holdings[i].TTMIncome != summary.Holdings[j].TTMIncome {
+			return summary.Holdings[i].TTMIncome > summary.Holdings[j].TTMIncome
+		}
+		return summary.Holdings[i].HoldingID < summary.Holdings[j].HoldingID
+	})
+
+	summary.YieldOnCostPct = yieldPct(summary.TTMIncome, cost)
+	summary.CurrentYieldPct = yieldPct(summary.TTMIncome, value)
+	summary.TTMIncome = round2(summary.TTMIncome)
+	for t, v := range summary.ByType {
+		summary.ByType[t] = round2(v)
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// handleIncomeCalendar buckets a calendar year of income by month.
+func (s *Server) handleIncomeCalendar(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.incomePortfolio(w, r)
+	if !ok {
+		return
+	}
+	year := time.Now().UTC().Year()
+	if raw := r.URL.Query().Get("year"); raw != "" {
+		y, err := strconv.Atoi(raw)
+		if err != nil || y < 1900 || y > 9999 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "year must be a four-digit year"})
+			return
+		}
+		year = y
+	}
+
+	from := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0).Add(-time.Nanosecond)
+	events, err := s.store.ListIncome(r.Context(), store.IncomeFilter{PortfolioID: pid, From: from, To: to})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	fx := s.market.FXRates()
+	cal := models.IncomeCalendar{Year: year, BaseCurrency: fx.Base, Months: make([]models.IncomeMonth, 12)}
+	for i := range cal.Months {
+		cal.Months[i] = models.IncomeMonth{
+			Month:  fmt.Sprintf("%04d-%02d", year, i+1),
+			ByType: make(map[models.IncomeType]float64),
+			Events: make([]models.IncomeEvent, 0),
+		}
+	}
+	for _, ev := range events {
+		m := &cal.Months[ev.PaidAt.UTC().Month()-1]
+		amount := ev.Amount * bookedRate(ev.FXRate, ev.Currency, fx)
+		m.Total += amount
+		m.ByType[ev.Type] += amount
+		m.Events = append(m.Events, ev)
+		cal.Total += amount
+	}
+	for i := range cal.Months {
+		m := &cal.Months[i]
+		m.Total = round2(m.Total)
+		for t, v := range m.ByType {
+			m.ByType[t] = round2(v)
+		}
+	}
+	cal.Total = round2(cal.Total)
+	writeJSON(w, http.StatusOK, cal)
+}
+
+// incomePortfolio reads the optional ?portfolioId= of the income, tax,
+// realized gains, history and returns reports, answering 400/404 itself
+// when it is invalid.
+func (s *Server) incomePortfolio(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	raw := r.URL.Query().Get("portfolioId")
+	if raw == "" {
+		return 0, true
+	}
+	pid, err := parseID(raw)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return 0, false
+	}
+	if _, err := s.store.GetPortfolio(r.Context(), pid); err != nil {
+		writePortfolioError(w, err)
+		return 0, false
+	}
+	return pid, true
+}
+
+func yieldPct(income, base float64) float64 {
+	if base <= 0 {
+		return 0
+	}
+	return round2(income / base * 100)
+}
+
+func writeIncomeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "income event, holding or portfolio not found"})
+	case errors.Is(err, store.ErrNoCashAccount):
+		writeError(w, http.StatusConflict, store.ErrNoCashAccount)
+	default:
+		writeTransactionError(w, err)
+	}
+}
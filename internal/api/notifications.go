@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"portfoliopulse/internal/models"
+	"portfoliopulse/internal/store"
+)
+
+func (s *Server) handleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := store.DeliveryFilter{
+		Channel: q.Get("channel"),
+		Status:  models.DeliveryStatus(q.Get("status")),
+	}
+	switch filter.Status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryFailed:
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "status must be pending, delivered or failed"})
+		return
+	}
+	if raw := q.Get("alertId"); raw != "" {
+		id, err := parseID(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		filter.AlertID = id
+	}
+	if raw := q.Get("eventId"); raw != "" {
+		id, err := parseID(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		filter.EventID = id
+	}
+	if raw := q.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > 1000 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 1000"})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	deliveries, err := s.store.ListDeliveries(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
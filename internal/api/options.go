@@ -0,0 +1,94 @@
+package api
+
+import (
+	"time"
+
+	"portfoliopulse/internal/models"
+)
+
+// defaultStaleAfter applies to asset types missing from the configured
+// staleness thresholds.
+const defaultStaleAfter = 15 * time.Minute
+
+// Option customises a Server at construction time.
+type Option func(*Server)
+
+// WithCostMethod sets the lot method stamped on sells that do not name one.
+// The default is FIFO.
+func WithCostMethod(m models.CostMethod) Option {
+	return func(s *Server) { s.costMethod = m }
+}
+
+// WithStaleAfter sets, per asset type, how old a quote's fetch time may be
+// before holdings priced from it are flagged stale.
+func WithStaleAfter(thresholds map[models.AssetType]time.Duration) Option {
+	return func(s *Server) {
+		for assetType, d := range thresholds {
+			s.staleAfter[assetType] = d
+		}
+	}
+}
+
+// WithHistoryRetention sets how long raw ticks (models.BarTick) and each bar
+// interval are kept. A zero duration keeps that resolution forever. Entries
+// replace the defaults of 48h ticks, 7d 1m bars and 180d 1h bars; daily bars
+// are kept forever unless configured.
+func WithHistoryRetention(retention map[models.BarInterval]time.Duration) Option {
+	return func(s *Server) {
+		for interval, keep := range retention {
+			s.historyRetention[interval] = keep
+		}
+	}
+}
+
+// WithSnapshotSchedule sets when the daily end-of-day valuation is saved,
+// as an offset from UTC midnight (default 21:00, after the US close), and
+// how often intraday valuations are saved (zero, the default, disables them).
+func WithSnapshotSchedule(eodAt, intradayEvery time.Duration) Option {
+	return func(s *Server) {
+		s.eodAt = eodAt
+		s.intradayEvery = intradayEvery
+	}
+}
+
+// WithFractional sets which asset types the rebalancing planner may trade in
+// fractional quantities. The default is crypto only.
+func WithFractional(types ...models.AssetType) Option {
+	return func(s *Server) {
+		s.fractional = make(map[models.AssetType]bool, len(types))
+		for _, t := range types {
+			s.fractional[t] = true
+		}
+	}
+}
+
+// WithTaxRates sets the short- and long-term tax rates, in percent, that
+// the tax-loss harvesting report estimates savings at. The defaults are 37
+// and 20.
+func WithTaxRates(shortTermPct, longTermPct float64) Option {
+	return func(s *Server) {
+		s.shortTermRate = shortTermPct
+		s.longTermRate = longTermPct
+	}
+}
+
+// WithNotifier sends every alert firing, and the daily digest when enabled,
+// to n, e.g. a notify.Dispatcher.
+func WithNotifier(n Notifier) Option {
+	return func(s *Server) { s.notifier = n }
+}
+
+// WithDigest sends the notifier a daily portfolio digest once the UTC clock
+// passes digestAt, an offset from midnight. Digests are off by default.
+func WithDigest(digestAt time.Duration) Option {
+	return func(s *Server) {
+		s.digest = true
+		s.digestAt = digestAt
+	}
+}
+
+// WithAdminToken requires "Authorization: Bearer <token>" on /api/admin
+// routes. An empty token leaves them open.
+func WithAdminToken(token string) Option {
+	return func(s *Server) { s.adminToken = token }
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"portfoliopulse/internal/models"
+	"portfoliopulse/internal/store"
+)
+
+func (s *Server) handleListPortfolios(w http.ResponseWriter, r *http.Request) {
+	portfolios, err := s.store.ListPortfolios(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, portfolios)
+}
+
+func (s *Server) handleCreatePortfolio(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name is required"})
+		return
+	}
+
+	created, err := s.store.CreatePortfolio(r.Context(), models.Portfolio{Name: req.Name})
+	if err != nil {
+		writePortfolioError(w, err)
+		return
+	}
+
+	_ = s.RefreshAndBroadcast(context.Background())
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (s *Server) handleGetPortfolio(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.portfolioScope(w, r)
+	if !ok {
+		return
+	}
+	p, err := s.store.GetPortfolio(r.Context(), pid)
+	if err != nil {
+		writePortfolioError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handleRenamePortfolio(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.portfolioScope(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name is required"})
+		return
+	}
+
+	updated, err := s.store.RenamePortfolio(r.Context(), pid, req.Name)
+	if err != nil {
+		writePortfolioError(w, err)
+		return
+	}
+
+	_ = s.RefreshAndBroadcast(context.Background())
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (s *Server) handleDeletePortfolio(w http.ResponseWriter, r *http.Request) {
+	pid, err := parseID(mux.Vars(r)["pid"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.store.DeletePortfolio(r.Context(), pid); err != nil {
+		writePortfolioError(w, err)
+		return
+	}
+
+	_ = s.RefreshAndBroadcast(context.Background())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handlePortfolioView(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.portfolioScope(w, r)
+	if !ok {
+		return
+	}
+	snapshot, err := s.BuildSnapshot(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, scopeSnapshot(snapshot, pid))
+}
+
+// portfolioScope reads the {pid} route variable and checks the portfolio
+// exists, answering 400/404 itself when it does not. Routes without {pid}
+// get zero, meaning every portfolio for reads and the default for writes.
+func (s *Server) portfolioScope(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	raw, scoped := mux.Vars(r)["pid"]
+	if !scoped {
+		return 0, true
+	}
+	pid, err := parseID(raw)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return 0, false
+	}
+	if _, err := s.store.GetPortfolio(r.Context(), pid); err != nil {
+		writePortfolioError(w, err)
+		return 0, false
+	}
+	return pid, true
+}
+
+// scopeSnapshot narrows the combined snapshot to one portfolio, using the
+// per-portfolio totals valuePortfolio already computed.
+func scopeSnapshot(all models.PortfolioSnapshot, pid int64) models.PortfolioSnapshot {
+	out := models.PortfolioSnapshot{
+		PortfolioID:  pid,
+		BaseCurrency: all.BaseCurrency,
+		Holdings:     make([]models.HoldingWithPrice, 0),
+		Cash:         make([]models.CashValue, 0),
+		UpdatedAt:    all.UpdatedAt,
+	}
+	for _, t := range all.Portfolios {
+		if t.PortfolioID == pid {
+			out.PortfolioName = t.Name
+			out.TotalValue = t.TotalValue
+			out.TotalCash = t.TotalCash
+			out.TotalCost = t.TotalCost
+			out.TotalPnL = t.TotalPnL
+			out.TotalFXPnL = t.TotalFXPnL
+			out.TotalRealizedPnL = t.TotalRealizedPnL
+		}
+	}
+	for _, h := range all.Holdings {
+		if h.PortfolioID == pid {
+			out.Holdings = append(out.Holdings, h)
+		}
+	}
+	for _, c := range all.Cash {
+		if c.PortfolioID == pid {
+			out.Cash = append(out.Cash, c)
+		}
+	}
+	out.Allocation = allocation(out.Holdings, out.Cash, out.TotalValue)
+	for _, a := range all.AlertsFired {
+		if a.PortfolioID == pid {
+			out.AlertsFired = append(out.AlertsFired, a)
+		}
+	}
+	return out
+}
+
+// portfolioTopic is the hub topic a portfolio's snapshots are published on.
+// The combined view uses the empty topic.
+func portfolioTopic(pid int64) string {
+	if pid == 0 {
+		return ""
+	}
+	return "portfolio:" + strconv.FormatInt(pid, 10)
+}
+
+func writePortfolioError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "portfolio not found"})
+	case errors.Is(err, store.ErrPortfolioExists), errors.Is(err, store.ErrDefaultPortfolio):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"portfoliopulse/internal/models"
+)
+
+// defaultHistoryWindow is how far back a history request reaches when no
+// from is given, chosen so each interval returns a chart-sized series.
+var defaultHistoryWindow = map[models.BarInterval]time.Duration{
+	models.BarTick:   24 * time.Hour,
+	models.BarMinute: 24 * time.Hour,
+	models.BarHour:   30 * 24 * time.Hour,
+	models.BarDay:    365 * 24 * time.Hour,
+}
+
+// recordPrices persists the current quote cache to price history. Quotes
+// whose source failed this cycle keep their old FetchedAt and are ignored by
+// the store as duplicates.
+func (s *Server) recordPrices(ctx context.Context) {
+	quotes := s.market.Snapshot()
+	ticks := make([]models.PriceTick, 0, len(quotes))
+	for k, q := range quotes {
+		assetType, ticker, ok := strings.Cut(k, ":")
+		if !ok || q.FetchedAt.IsZero() {
+			continue
+		}
+		ticks = append(ticks, models.PriceTick{
+			AssetType: models.AssetType(assetType),
+			Ticker:    ticker,
+			Price:     q.Price,
+			Source:    q.Source,
+			At:        q.FetchedAt,
+		})
+	}
+	if err := s.store.RecordPrices(ctx, ticks); err != nil {
+		log.Printf("record price history: %v", err)
+	}
+}
+
+func (s *Server) pruneHistory(ctx context.Context) {
+	if len(s.historyRetention) == 0 {
+		return
+	}
+	now := time.Now().UTC()
+	cutoffs := make(map[models.BarInterval]time.Time, len(s.historyRetention))
+	for interval, keep := range s.historyRetention {
+		if keep > 0 {
+			cutoffs[interval] = now.Add(-keep)
+		}
+	}
+	if n, err := s.store.PrunePriceHistory(ctx, cutoffs); err != nil {
+		log.Printf("prune price history: %v", err)
+	} else if n > 0 {
+		log.Printf("pruned %d price history rows", n)
+	}
+}
+
+func (s *Server) handlePriceHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	assetType := models.AssetType(strings.ToLower(vars["assetType"]))
+	if assetType != models.AssetStock && assetType != models.AssetCrypto {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "assetType must be stock or crypto"})
+		return
+	}
+
+	q := r.URL.Query()
+	interval := models.BarInterval(q.Get("interval"))
+	if interval == "" {
+		interval = models.BarHour
+	}
+	window, ok := defaultHistoryWindow[interval]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "interval must be tick, 1m, 1h or 1d"})
+		return
+	}
+
+	from, err := parseTimeParam(q.Get("from"), false)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid from: " + err.Error()})
+		return
+	}
+	to, err := parseTimeParam(q.Get("to"), true)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid to: " + err.Error()})
+		return
+	}
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	if from.IsZero() {
+		from = to.Add(-window)
+	}
+	if from.After(to) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "from must not be after to"})
+		return
+	}
+
+	ticker := strings.ToUpper(strings.TrimSpace(vars["ticker"]))
+	bars, err := s.store.ListPriceBars(r.Context(), assetType, ticker, interval, from, to)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.PriceHistory{
+		AssetType: assetType,
+		Ticker:    ticker,
+		Interval:  interval,
+		From:      from,
+		To:        to,
+		Bars:      bars,
+	})
+}
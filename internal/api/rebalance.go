@@ -0,0 +1,254 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"portfoliopulse/internal/models"
+)
+
+// rebalanceOptions shape a rebalancing plan. Contribution is new money in
+// the base currency invested on top of the portfolio's cash, trades worth
+// less than MinTrade are dropped, ContributionsOnly proposes no sells, and
+// only asset types in Fractional may trade fractional quantities.
+type rebalanceOptions struct {
+	Contribution      float64
+	MinTrade          float64
+	ContributionsOnly bool
+	Fractional        map[models.AssetType]bool
+}
+
+// handleRebalance proposes the trades that bring a portfolio back to its
+// targets. It is a dry run: nothing is recorded.
+func (s *Server) handleRebalance(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.portfolioScope(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	opts := rebalanceOptions{
+		ContributionsOnly: q.Get("contributionsOnly") == "true",
+		Fractional:        s.fractional,
+	}
+	for name, dst := range map[string]*float64{"contribution": &opts.Contribution, "minTrade": &opts.MinTrade} {
+		raw := q.Get(name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v < 0 || math.IsInf(v, 0) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": name + " must be a non-negative number"})
+			return
+		}
+		*dst = v
+	}
+	if raw, set := q["fractional"]; set {
+		opts.Fractional = make(map[models.AssetType]bool)
+		for _, name := range strings.Split(strings.Join(raw, ","), ",") {
+			switch t := models.AssetType(strings.TrimSpace(name)); t {
+			case "":
+			case models.AssetStock, models.AssetCrypto:
+				opts.Fractional[t] = true
+			default:
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "fractional lists asset types stock or crypto"})
+				return
+			}
+		}
+	}
+
+	targets, err := s.store.ListAllocationTargets(r.Context(), pid)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(targets) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "portfolio has no targets"})
+		return
+	}
+	snap, err := s.valuePortfolio(r.Context(), s.market.Snapshot())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, planRebalance(scopeSnapshot(snap, pid), targets, opts))
+}
+
+// planRebalance works out what each targeted holding should be worth and
+// proposes the trades that get it there. A holding follows its ticker
+// target if it has one, else its first tag target, else its asset type
+// target; the holdings a tag or asset type governs share what is left of
+// that bucket's target once its more specific holdings are accounted for,
+// pro rata to their current value. Untargeted holdings are left alone. Buys
+// are paid from cash, the contribution and the proceeds of sells, keeping
+// back any cash target, and are scaled down together when that is not
+// enough.
+func planRebalance(scoped models.PortfolioSnapshot, targets []models.AllocationTarget, opts rebalanceOptions) models.RebalancePlan {
+	total := scoped.TotalValue + opts.Contribution
+	plan := models.RebalancePlan{
+		PortfolioID:  scoped.PortfolioID,
+		BaseCurrency: scoped.BaseCurrency,
+		DryRun:       true,
+		TotalValue:   round2(total),
+		Contribution: round2(opts.Contribution),
+		CashBefore:   scoped.TotalCash,
+		Trades:       make([]models.RebalanceTrade, 0),
+		Before:       driftOf(scoped, targets),
+	}
+	warn := func(format string, args ...any) {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	desired := make(map[int]float64)
+	reserve := 0.0
+	for _, bucket := range []models.TargetBucket{models.BucketTicker, models.BucketTag, models.BucketAssetType} {
+		for _, t := range targets {
+			if t.Bucket != bucket {
+				continue
+			}
+			if t.Bucket == models.BucketAssetType && models.AssetType(t.Key) == models.AssetCash {
+				reserve = t.WeightPct / 100 * total
+				continue
+			}
+			want := t.WeightPct / 100 * total
+			governed := make([]int, 0)
+			for i, h := range scoped.Holdings {
+				if !inBucket(h, t) {
+					continue
+				}
+				if d, ok := desired[i]; ok {
+					want -= d
+				} else {
+					governed = append(governed, i)
+				}
+			}
+			if len(governed) == 0 {
+				warn("no holding to trade for %s target %s", t.Bucket, t.Key)
+				continue
+			}
+			share := 0.0
+			for _, i := range governed {
+				share += scoped.Holdings[i].MarketValue
+			}
+			for _, i := range governed {
+				weight := 1 / float64(len(governed))
+				if share > 0 {
+					weight = scoped.Holdings[i].MarketValue / share
+				}
+				desired[i] = math.Max(want, 0) * weight
+			}
+		}
+	}
+
+	buys := make([]models.RebalanceTrade, 0)
+	sells := make([]models.RebalanceTrade, 0)
+	units := make(map[int64]float64)
+	for i, h := range scoped.Holdings {
+		want, ok := desired[i]
+		if !ok {
+			continue
+		}
+		unit := h.Price * h.FXRate
+		if h.Quantity > 0 && h.MarketValue > 0 {
+			unit = h.MarketValue / h.Quantity
+		}
+		if unit <= 0 {
+			warn("%s has no price to trade at", h.Ticker)
+			continue
+		}
+		units[h.ID] = unit
+		trade := models.RebalanceTrade{
+			HoldingID: h.ID,
+			Ticker:    h.Ticker,
+			AssetType: h.AssetType,
+			Currency:  h.Currency,
+			Price:     h.Price,
+		}
+		quantity := tradeQuantity((want-h.MarketValue)/unit, opts.Fractional[h.AssetType])
+		switch {
+		case quantity > 0:
+			trade.Side, trade.Quantity = models.TxBuy, quantity
+			buys = append(buys, trade)
+		case quantity < 0 && !opts.ContributionsOnly:
+			trade.Side, trade.Quantity = models.TxSell, -quantity
+			sells = append(sells, trade)
+		}
+	}
+
+	cash := scoped.TotalCash + opts.Contribution
+	sells = keepTrades(sells, units, opts.MinTrade)
+	for _, t := range sells {
+		cash += t.Quantity * units[t.HoldingID]
+	}
+	buys = keepTrades(buys, units, opts.MinTrade)
+	spend := 0.0
+	for _, t := range buys {
+		spend += t.Quantity * units[t.HoldingID]
+	}
+	if available := math.Max(cash-reserve, 0); spend > available {
+		warn("buys scaled to the %.2f %s of cash available", available, scoped.BaseCurrency)
+		for i := range buys {
+			buys[i].Quantity = tradeQuantity(buys[i].Quantity*available/spend, opts.Fractional[buys[i].AssetType])
+		}
+		buys = keepTrades(buys, units, opts.MinTrade)
+	}
+	for _, t := range buys {
+		cash -= t.Quantity * units[t.HoldingID]
+	}
+
+	sort.SliceStable(sells, func(i, j int) bool { return sells[i].Value > sells[j].Value })
+	sort.SliceStable(buys, func(i, j int) bool { return buys[i].Value > buys[j].Value })
+	plan.Trades = append(append(plan.Trades, sells...), buys...)
+	plan.CashAfter = round2(cash)
+
+	// Project the portfolio after the trades, with the change in cash as
+	// one base-currency entry.
+	after := scoped
+	after.TotalValue = total
+	after.Holdings = append([]models.HoldingWithPrice(nil), scoped.Holdings...)
+	for i, h := range after.Holdings {
+		for _, t := range plan.Trades {
+			if t.HoldingID != h.ID {
+				continue
+			}
+			if t.Side == models.TxBuy {
+				after.Holdings[i].MarketValue += t.Value
+			} else {
+				after.Holdings[i].MarketValue -= t.Value
+			}
+		}
+	}
+	after.Cash = append(append([]models.CashValue(nil), scoped.Cash...), models.CashValue{
+		Currency: scoped.BaseCurrency,
+		Value:    cash - scoped.TotalCash,
+	})
+	plan.After = driftOf(after, targets)
+	return plan
+}
+
+// tradeQuantity rounds a signed quantity toward zero: to whole units, or to
+// eight decimals for fractional asset types.
+func tradeQuantity(quantity float64, fractional bool) float64 {
+	if fractional {
+		return math.Trunc(quantity*1e8) / 1e8
+	}
+	return math.Trunc(quantity)
+}
+
+// keepTrades values trades and drops the empty ones and those worth less
+// than minTrade.
+func keepTrades(trades []models.RebalanceTrade, units map[int64]float64, minTrade float64) []models.RebalanceTrade {
+	kept := trades[:0]
+	for _, t := range trades {
+		value := t.Quantity * units[t.HoldingID]
+		if t.Quantity <= 0 || value < minTrade {
+			continue
+		}
+		t.Value = round2(value)
+		kept = append(kept, t)
+	}
+	return kept
+}
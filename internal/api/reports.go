@@ -0,0 +1,150 @@
+package api
+
+import (
+	"encoding/csv"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"portfoliopulse/internal/models"
+	"portfoliopulse/internal/store"
+)
+
+// handleTaxLossHarvest reports the open lots currently at a loss, as JSON
+// or with ?format=csv as a spreadsheet-friendly CSV.
+func (s *Server) handleTaxLossHarvest(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "format must be json or csv"})
+		return
+	}
+	pid, ok := s.incomePortfolio(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	snap, err := s.valuePortfolio(ctx, s.market.Snapshot())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// Wash sales look at buys in every portfolio, not just the one asked
+	// about.
+	now := time.Now().UTC()
+	recent, err := s.store.ListTransactions(ctx, store.TransactionFilter{From: now.AddDate(0, 0, -models.WashSaleDays)})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	report := models.HarvestReport{
+		AsOf:             now,
+		BaseCurrency:     snap.BaseCurrency,
+		ShortTermRatePct: s.shortTermRate,
+		LongTermRatePct:  s.longTermRate,
+		Lots:             make([]models.HarvestLot, 0),
+	}
+	for _, h := range snap.Holdings {
+		if (pid != 0 && h.PortfolioID != pid) || h.Price <= 0 {
+			continue
+		}
+		lots, err := s.store.ListLots(ctx, h.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		for _, lot := range lots {
+			costRate := lot.FXRate
+			if costRate == 0 {
+				costRate = h.FXRate
+			}
+			cost := lot.Remaining * lot.CostPerUnit * costRate
+			value := lot.Remaining * h.Price * h.FXRate
+			if value >= cost {
+				continue
+			}
+
+			hl := models.HarvestLot{
+				LotID:       lot.ID,
+				HoldingID:   h.ID,
+				PortfolioID: h.PortfolioID,
+				Ticker:      h.Ticker,
+				AssetType:   h.AssetType,
+				Currency:    h.Currency,
+				AcquiredAt:  lot.AcquiredAt,
+				DaysHeld:    int(now.Sub(lot.AcquiredAt).Hours() / 24),
+				Term:        models.TermShort,
+				Quantity:    lot.Remaining,
+				CostPerUnit: lot.CostPerUnit,
+				Price:       h.Price,
+				CostBasis:   round2(cost),
+				MarketValue: round2(value),
+				Loss:        round2(value - cost),
+			}
+			rate := s.shortTermRate
+			if lot.AcquiredAt.AddDate(1, 0, 0).Before(now) {
+				hl.Term, rate = models.TermLong, s.longTermRate
+				report.LongTermLoss += value - cost
+			} else {
+				report.ShortTermLoss += value - cost
+			}
+			hl.EstimatedSavings = round2((cost - value) * rate / 100)
+			report.EstimatedSavings += (cost - value) * rate / 100
+
+			// The buy that opened this lot is not a replacement purchase.
+			for _, tx := range recent {
+				if tx.Type != models.TxBuy || tx.ID == lot.ID || tx.AssetType != h.AssetType || tx.Ticker != h.Ticker {
+					continue
+				}
+				if hl.LastBuyAt == nil || tx.ExecutedAt.After(*hl.LastBuyAt) {
+					at := tx.ExecutedAt
+					hl.WashSale, hl.LastBuyAt = true, &at
+				}
+			}
+			report.Lots = append(report.Lots, hl)
+		}
+	}
+
+	sort.SliceStable(report.Lots, func(i, j int) bool { return report.Lots[i].Loss < report.Lots[j].Loss })
+	report.TotalLoss = round2(report.ShortTermLoss + report.LongTermLoss)
+	report.ShortTermLoss = round2(report.ShortTermLoss)
+	report.LongTermLoss = round2(report.LongTermLoss)
+	report.EstimatedSavings = round2(report.EstimatedSavings)
+
+	if format == "csv" {
+		writeHarvestCSV(w, report)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// writeHarvestCSV writes one row per lot. Report-level totals are left to
+// the spreadsheet.
+func writeHarvestCSV(w http.ResponseWriter, report models.HarvestReport) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="tax-loss-harvest.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	num := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{
+		"lot_id", "holding_id", "portfolio_id", "ticker", "asset_type", "currency", "acquired_at", "days_held", "term",
+		"quantity", "cost_per_unit", "price", "cost_basis", "market_value", "loss", "estimated_savings", "wash_sale", "last_buy_at",
+	})
+	for _, l := range report.Lots {
+		lastBuy := ""
+		if l.LastBuyAt != nil {
+			lastBuy = l.LastBuyAt.Format(time.RFC3339)
+		}
+		_ = out.Write([]string{
+			strconv.FormatInt(l.LotID, 10), strconv.FormatInt(l.HoldingID, 10), strconv.FormatInt(l.PortfolioID, 10),
+			l.Ticker, string(l.AssetType), l.Currency, l.AcquiredAt.Format(time.RFC3339), strconv.Itoa(l.DaysHeld), string(l.Term),
+			num(l.Quantity), num(l.CostPerUnit), num(l.Price), num(l.CostBasis), num(l.MarketValue), num(l.Loss),
+			num(l.EstimatedSavings), strconv.FormatBool(l.WashSale), lastBuy,
+		})
+	}
+	out.Flush()
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -18,24 +19,47 @@ import (
 	"github.com/gorilla/websocket"
 
 	"portfoliopulse/internal/models"
+	"portfoliopulse/internal/notify"
 	"portfoliopulse/internal/realtime"
 	"portfoliopulse/internal/store"
 )
 
 type Server struct {
-	store    store.Store
-	market   PriceProvider
-	hub      *realtime.Hub
-	router   *mux.Router
-	upgrader websocket.Upgrader
+	store      store.Store
+	market     PriceProvider
+	hub        *realtime.Hub
+	router     *mux.Router
+	upgrader   websocket.Upgrader
+	costMethod models.CostMethod
+	staleAfter map[models.AssetType]time.Duration
+	fractional map[models.AssetType]bool
+
+	shortTermRate float64
+	longTermRate  float64
+
+	historyRetention map[models.BarInterval]time.Duration
+	eodAt            time.Duration
+	intradayEvery    time.Duration
+	digest           bool
+	digestAt         time.Duration
+	adminToken       string
+	notifier         Notifier
+}
+
+// Notifier is told about events such as alert firings. It must not block.
+type Notifier interface {
+	Notify(ev notify.Event)
 }
 
 type PriceProvider interface {
 	Refresh(ctx context.Context, holdings []models.Holding) error
-	Snapshot() map[string]float64
+	Snapshot() map[string]models.Quote
+	Sources() map[models.AssetType][]string
+	SourceHealth() []models.SourceStatus
+	FXRates() models.FXRates
 }
 
-func NewServer(s store.Store, p PriceProvider, hub *realtime.Hub) *Server {
+func NewServer(s store.Store, p PriceProvider, hub *realtime.Hub, opts ...Option) *Server {
 	server := &Server{
 		store:  s,
 		market: p,
@@ -43,19 +67,99 @@ func NewServer(s store.Store, p PriceProvider, hub *realtime.Hub) *Server {
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool { return true },
 		},
+		costMethod: models.CostFIFO,
+		staleAfter: map[models.AssetType]time.Duration{
+			models.AssetStock:  defaultStaleAfter,
+			models.AssetCrypto: 5 * time.Minute,
+		},
+		fractional:    map[models.AssetType]bool{models.AssetCrypto: true},
+		shortTermRate: 37,
+		longTermRate:  20,
+		historyRetention: map[models.BarInterval]time.Duration{
+			models.BarTick:   48 * time.Hour,
+			models.BarMinute: 7 * 24 * time.Hour,
+			models.BarHour:   180 * 24 * time.Hour,
+		},
+		eodAt: 21 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(server)
 	}
 
 	r := mux.NewRouter()
 	r.Use(corsMiddleware)
 
 	r.HandleFunc("/api/health", server.handleHealth).Methods(http.MethodGet)
+	r.HandleFunc("/api/portfolios", server.handleListPortfolios).Methods(http.MethodGet)
+	r.HandleFunc("/api/portfolios", server.handleCreatePortfolio).Methods(http.MethodPost)
+	r.HandleFunc("/api/portfolios/{pid}", server.handleGetPortfolio).Methods(http.MethodGet)
+	r.HandleFunc("/api/portfolios/{pid}", server.handleRenamePortfolio).Methods(http.MethodPut)
+	r.HandleFunc("/api/portfolios/{pid}", server.handleDeletePortfolio).Methods(http.MethodDelete)
+	r.HandleFunc("/api/portfolios/{pid}/snapshot", server.handlePortfolioView).Methods(http.MethodGet)
+	r.HandleFunc("/api/portfolios/{pid}/holdings", server.handleListHoldings).Methods(http.MethodGet)
+	r.HandleFunc("/api/portfolios/{pid}/holdings", server.handleCreateHolding).Methods(http.MethodPost)
+	r.HandleFunc("/api/portfolios/{pid}/transactions", server.handleListTransactions).Methods(http.MethodGet)
+	r.HandleFunc("/api/portfolios/{pid}/transactions", server.handleCreateTransaction).Methods(http.MethodPost)
+	r.HandleFunc("/api/portfolios/{pid}/alerts", server.handleListAlerts).Methods(http.MethodGet)
+	r.HandleFunc("/api/portfolios/{pid}/alerts", server.handleCreateAlert).Methods(http.MethodPost)
+	r.HandleFunc("/api/portfolios/{pid}/alert-events", server.handleListEvents).Methods(http.MethodGet)
+	r.HandleFunc("/api/portfolios/{pid}/cash", server.handleListCashAccounts).Methods(http.MethodGet)
+	r.HandleFunc("/api/portfolios/{pid}/cash", server.handleCreateCashAccount).Methods(http.MethodPost)
+	r.HandleFunc("/api/portfolios/{pid}/income", server.handleListIncome).Methods(http.MethodGet)
+	r.HandleFunc("/api/portfolios/{pid}/income", server.handleCreateIncome).Methods(http.MethodPost)
+	r.HandleFunc("/api/portfolios/{pid}/targets", server.handleListTargets).Methods(http.MethodGet)
+	r.HandleFunc("/api/portfolios/{pid}/targets", server.handleSetTargets).Methods(http.MethodPut)
+	r.HandleFunc("/api/portfolios/{pid}/drift", server.handleDrift).Methods(http.MethodGet)
+	r.HandleFunc("/api/portfolios/{pid}/rebalance", server.handleRebalance).Methods(http.MethodGet)
 	r.HandleFunc("/api/holdings", server.handleListHoldings).Methods(http.MethodGet)
 	r.HandleFunc("/api/holdings", server.handleCreateHolding).Methods(http.MethodPost)
 	r.HandleFunc("/api/holdings/{id}", server.handleDeleteHolding).Methods(http.MethodDelete)
+	r.HandleFunc("/api/holdings/{id}/lots", server.handleListLots).Methods(http.MethodGet)
+	r.HandleFunc("/api/holdings/{id}/tags", server.handleSetHoldingTags).Methods(http.MethodPut)
+	r.HandleFunc("/api/transactions", server.handleListTransactions).Methods(http.MethodGet)
+	r.HandleFunc("/api/transactions", server.handleCreateTransaction).Methods(http.MethodPost)
+	r.HandleFunc("/api/transactions/{id}", server.handleGetTransaction).Methods(http.MethodGet)
+	r.HandleFunc("/api/transactions/{id}", server.handleUpdateTransaction).Methods(http.MethodPut)
+	r.HandleFunc("/api/transactions/{id}", server.handleDeleteTransaction).Methods(http.MethodDelete)
+	r.HandleFunc("/api/realized", server.handleRealized).Methods(http.MethodGet)
+	r.HandleFunc("/api/income", server.handleListIncome).Methods(http.MethodGet)
+	r.HandleFunc("/api/income", server.handleCreateIncome).Methods(http.MethodPost)
+	r.HandleFunc("/api/income/summary", server.handleIncomeSummary).Methods(http.MethodGet)
+	r.HandleFunc("/api/income/calendar", server.handleIncomeCalendar).Methods(http.MethodGet)
+	r.HandleFunc("/api/income/{id}", server.handleGetIncome).Methods(http.MethodGet)
+	r.HandleFunc("/api/income/{id}", server.handleDeleteIncome).Methods(http.MethodDelete)
+	r.HandleFunc("/api/cash", server.handleListCashAccounts).Methods(http.MethodGet)
+	r.HandleFunc("/api/cash", server.handleCreateCashAccount).Methods(http.MethodPost)
+	r.HandleFunc("/api/cash/{id}", server.handleGetCashAccount).Methods(http.MethodGet)
+	r.HandleFunc("/api/cash/{id}", server.handleDeleteCashAccount).Methods(http.MethodDelete)
+	r.HandleFunc("/api/cash/{id}/movements", server.handleListCashMovements).Methods(http.MethodGet)
+	r.HandleFunc("/api/cash/{id}/movements", server.handleCreateCashMovement).Methods(http.MethodPost)
+	r.HandleFunc("/api/cash/{id}/movements/{mid}", server.handleDeleteCashMovement).Methods(http.MethodDelete)
 	r.HandleFunc("/api/alerts", server.handleListAlerts).Methods(http.MethodGet)
 	r.HandleFunc("/api/alerts", server.handleCreateAlert).Methods(http.MethodPost)
 	r.HandleFunc("/api/alerts/{id}", server.handleDeleteAlert).Methods(http.MethodDelete)
+	r.HandleFunc("/api/alerts/{id}/rearm", server.handleRearmAlert).Methods(http.MethodPost)
+	r.HandleFunc("/api/alerts/{id}/events", server.handleListAlertEvents).Methods(http.MethodGet)
+	r.HandleFunc("/api/alert-events", server.handleListEvents).Methods(http.MethodGet)
+	r.HandleFunc("/api/alert-events/{id}", server.handleGetEvent).Methods(http.MethodGet)
+	r.HandleFunc("/api/alert-events/{id}/ack", server.handleAcknowledgeEvent).Methods(http.MethodPost)
+	r.HandleFunc("/api/alert-events/{id}/note", server.handleSetEventNote).Methods(http.MethodPut)
+	r.HandleFunc("/api/channels", server.handleListChannels).Methods(http.MethodGet)
+	r.HandleFunc("/api/channels", server.handleCreateChannel).Methods(http.MethodPost)
+	r.HandleFunc("/api/channels/{id}", server.handleGetChannel).Methods(http.MethodGet)
+	r.HandleFunc("/api/channels/{id}", server.handleUpdateChannel).Methods(http.MethodPut)
+	r.HandleFunc("/api/channels/{id}", server.handleDeleteChannel).Methods(http.MethodDelete)
+	r.HandleFunc("/api/notifications/deliveries", server.handleListDeliveries).Methods(http.MethodGet)
+	r.HandleFunc("/api/admin/corporate-actions", server.requireAdmin(server.handleListCorporateActions)).Methods(http.MethodGet)
+	r.HandleFunc("/api/admin/corporate-actions", server.requireAdmin(server.handleApplyCorporateAction)).Methods(http.MethodPost)
+	r.HandleFunc("/api/admin/corporate-actions/{id}", server.requireAdmin(server.handleGetCorporateAction)).Methods(http.MethodGet)
 	r.HandleFunc("/api/portfolio", server.handlePortfolioSnapshot).Methods(http.MethodGet)
+	r.HandleFunc("/api/portfolio/history", server.handlePortfolioHistory).Methods(http.MethodGet)
+	r.HandleFunc("/api/analytics/returns", server.handleReturns).Methods(http.MethodGet)
+	r.HandleFunc("/api/reports/tax-loss-harvest", server.handleTaxLossHarvest).Methods(http.MethodGet)
+	r.HandleFunc("/api/market/sources", server.handleMarketSources).Methods(http.MethodGet)
+	r.HandleFunc("/api/market/fx", server.handleFXRates).Methods(http.MethodGet)
+	r.HandleFunc("/api/prices/{assetType}/{ticker}/history", server.handlePriceHistory).Methods(http.MethodGet)
 	r.HandleFunc("/ws", server.handleWebSocket).Methods(http.MethodGet)
 
 	// Serve React SPA (catch-all, must be last)
@@ -92,8 +196,11 @@ func (s *Server) Handler() http.Handler {
 func (s *Server) StartPolling(ctx context.Context, interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	pruneTicker := time.NewTicker(time.Hour)
+	defer pruneTicker.Stop()
 
 	_ = s.RefreshAndBroadcast(context.Background())
+	s.pruneHistory(context.Background())
 	for {
 		select {
 		case <-ctx.Done():
@@ -102,6 +209,8 @@ func (s *Server) StartPolling(ctx context.Context, interval time.Duration) {
 			if err := s.RefreshAndBroadcast(context.Background()); err != nil {
 				log.Printf("polling refresh failed: %v", err)
 			}
+		case <-pruneTicker.C:
+			s.pruneHistory(context.Background())
 		}
 	}
 }
@@ -111,120 +220,314 @@ func (s *Server) RefreshAndBroadcast(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	accounts, err := s.store.ListCashAccounts(ctx)
+	if err != nil {
+		return err
+	}
+	for _, a := range accounts {
+		holdings = append(holdings, models.Holding{Ticker: a.Currency, AssetType: models.AssetCash, Currency: a.Currency})
+	}
+	watched, err := s.expressionTickers(ctx)
+	if err != nil {
+		return err
+	}
+	holdings = append(holdings, watched...)
 
+	// A failing source only leaves its own tickers on their last price;
+	// everything else still gets a fresh snapshot.
 	if err := s.market.Refresh(ctx, holdings); err != nil {
-		return err
+		log.Printf("market refresh incomplete: %v", err)
 	}
+	s.recordPrices(ctx)
 
 	snapshot, err := s.BuildSnapshot(ctx)
 	if err != nil {
 		return err
 	}
 
-	s.hub.BroadcastJSON(snapshot)
+	s.hub.PublishJSON("", snapshot)
+	for _, p := range snapshot.Portfolios {
+		s.hub.PublishJSON(portfolioTopic(p.PortfolioID), scopeSnapshot(snapshot, p.PortfolioID))
+	}
 	return nil
 }
 
+// BuildSnapshot values every portfolio combined and evaluates alerts against
+// the same quotes and totals, marking any that fire.
 func (s *Server) BuildSnapshot(ctx context.Context) (models.PortfolioSnapshot, error) {
-	holdings, err := s.store.ListHoldings(ctx)
+	quotes := s.market.Snapshot()
+	out, err := s.valuePortfolio(ctx, quotes)
+	if err != nil {
+		return models.PortfolioSnapshot{}, err
+	}
+
+	alertsFired, err := s.evaluateAlerts(ctx, quotes, out)
 	if err != nil {
 		return models.PortfolioSnapshot{}, err
 	}
+	if len(alertsFired) > 0 {
+		out.AlertsFired = alertsFired
+	}
+	if s.notifier != nil {
+		for _, alert := range alertsFired {
+			alert := alert
+			s.notifier.Notify(notify.Event{Type: notify.EventAlertFired, At: *alert.TriggeredAt, Alert: &alert})
+		}
+	}
+
+	return out, nil
+}
 
-	alerts, err := s.store.ListAlerts(ctx)
+// valuePortfolio prices every holding from quotes, adds each cash account,
+// and totals them overall and per portfolio in the base currency. Unlike
+// BuildSnapshot it has no side effects, so schedulers and reports can call
+// it freely.
+func (s *Server) valuePortfolio(ctx context.Context, quotes map[string]models.Quote) (models.PortfolioSnapshot, error) {
+	holdings, err := s.store.ListHoldings(ctx)
 	if err != nil {
 		return models.PortfolioSnapshot{}, err
 	}
+	portfolios, err := s.store.ListPortfolios(ctx)
+	if err != nil {
+		return models.PortfolioSnapshot{}, err
+	}
+	totals := make(map[int64]*models.PortfolioTotals, len(portfolios))
+	for _, p := range portfolios {
+		totals[p.ID] = &models.PortfolioTotals{PortfolioID: p.ID, Name: p.Name}
+	}
 
+	fx := s.market.FXRates()
 	out := models.PortfolioSnapshot{
-		Holdings: make([]models.HoldingWithPrice, 0, len(holdings)),
-		UpdatedAt: time.Now().UTC(),
+		BaseCurrency: fx.Base,
+		Holdings:     make([]models.HoldingWithPrice, 0, len(holdings)),
+		UpdatedAt:    time.Now().UTC(),
 	}
 
-	prices := s.market.Snapshot()
-	alertsFired := make([]models.PriceAlert, 0)
 	for _, h := range holdings {
-		price := prices[assetKey(h.AssetType, h.Ticker)]
-		marketValue := h.Quantity * price
-		costBasis := h.Quantity * h.AvgCost
+		quote, hasQuote := quotes[assetKey(h.AssetType, h.Ticker)]
+		quoteCurrency := quote.Currency
+		if quoteCurrency == "" {
+			quoteCurrency = h.Currency
+		}
+		// Without both rates the amounts cannot be converted; value them
+		// 1:1 as before currencies were tracked and flag the holding.
+		rate, holdingOK := fx.Rates[h.Currency]
+		quoteRate, quoteOK := fx.Rates[quoteCurrency]
+		converted := holdingOK && quoteOK
+		if !converted {
+			rate, quoteRate = 1, 1
+		}
+		costRate := h.CostFXRate
+		if costRate == 0 {
+			costRate = rate
+		}
+
+		price := quote.Price * quoteRate / rate
+		localValue := h.Quantity * price
+		localCost := h.Quantity * h.AvgCost
+		marketValue := localValue * rate
+		costBasis := localCost * costRate
 		pnl := marketValue - costBasis
+		fxPnL := localCost * (rate - costRate)
 		pnlPct := 0.0
 		if costBasis > 0 {
 			pnlPct = (pnl / costBasis) * 100
 		}
 
-		out.Holdings = append(out.Holdings, models.HoldingWithPrice{
-			Holding:     h,
-			Price:       round2(price),
-			MarketValue: round2(marketValue),
-			CostBasis:   round2(costBasis),
-			PnL:         round2(pnl),
-			PnLPct:      round2(pnlPct),
-		})
+		// Realized P&L is kept in the holding's currency and converted at
+		// today's rate.
+		realized := h.RealizedPnL * rate
+		t, inPortfolio := totals[h.PortfolioID]
+		out.TotalRealizedPnL += realized
+		if inPortfolio {
+			t.TotalRealizedPnL += realized
+		}
+		h.RealizedPnL = round2(h.RealizedPnL)
+		hp := models.HoldingWithPrice{
+			Holding:          h,
+			Price:            round2(price),
+			FXRate:           rate,
+			LocalMarketValue: round2(localValue),
+			LocalCostBasis:   round2(localCost),
+			MarketValue:      round2(marketValue),
+			CostBasis:        round2(costBasis),
+			PnL:              round2(pnl),
+			PnLPct:           round2(pnlPct),
+			PricePnL:         round2((localValue - localCost) * rate),
+			FXPnL:            round2(fxPnL),
+			Stale:            !hasQuote || !converted || s.isStale(h.AssetType, quote, out.UpdatedAt),
+		}
+		if hasQuote {
+			asOf := quote.FetchedAt
+			if quote.MarketTime != nil {
+				asOf = *quote.MarketTime
+			}
+			hp.PriceAsOf = &asOf
+			hp.Source = quote.Source
+		}
+		out.Holdings = append(out.Holdings, hp)
 
 		out.TotalValue += marketValue
 		out.TotalCost += costBasis
+		out.TotalFXPnL += fxPnL
+		if inPortfolio {
+			t.TotalValue += marketValue
+			t.TotalCost += costBasis
+			t.TotalFXPnL += fxPnL
+		}
+	}
+
+	accounts, err := s.store.ListCashAccounts(ctx)
+	if err != nil {
+		return models.PortfolioSnapshot{}, err
+	}
+	out.Cash = make([]models.CashValue, 0, len(accounts))
+	for _, a := range accounts {
+		rate, ok := fx.Rates[a.Currency]
+		if !ok {
+			rate = 1
+		}
+		value := a.Balance * rate
+		out.Cash = append(out.Cash, models.CashValue{
+			AccountID:   a.ID,
+			PortfolioID: a.PortfolioID,
+			Currency:    a.Currency,
+			Balance:     round2(a.Balance),
+			FXRate:      rate,
+			Value:       round2(value),
+			Stale:       !ok,
+		})
+		out.TotalValue += value
+		out.TotalCash += value
+		if t, ok := totals[a.PortfolioID]; ok {
+			t.TotalValue += value
+			t.TotalCash += value
+		}
 	}
 
-	out.TotalPnL = out.TotalValue - out.TotalCost
+	out.TotalPnL = out.TotalValue - out.TotalCash - out.TotalCost
 	out.TotalValue = round2(out.TotalValue)
+	out.TotalCash = round2(out.TotalCash)
 	out.TotalCost = round2(out.TotalCost)
 	out.TotalPnL = round2(out.TotalPnL)
+	out.TotalFXPnL = round2(out.TotalFXPnL)
+	out.TotalRealizedPnL = round2(out.TotalRealizedPnL)
+	out.Allocation = allocation(out.Holdings, out.Cash, out.TotalValue)
+
+	out.Portfolios = make([]models.PortfolioTotals, 0, len(portfolios))
+	for _, p := range portfolios {
+		t := totals[p.ID]
+		t.TotalPnL = round2(t.TotalValue - t.TotalCash - t.TotalCost)
+		t.TotalValue = round2(t.TotalValue)
+		t.TotalCash = round2(t.TotalCash)
+		t.TotalCost = round2(t.TotalCost)
+		t.TotalFXPnL = round2(t.TotalFXPnL)
+		t.TotalRealizedPnL = round2(t.TotalRealizedPnL)
+		out.Portfolios = append(out.Portfolios, *t)
+	}
 
-	for _, alert := range alerts {
-		if alert.Triggered {
-			continue
-		}
-		price, ok := prices[assetKey(alert.AssetType, alert.Ticker)]
-		if !ok || price <= 0 {
-			continue
-		}
+	return out, nil
+}
 
-		fired := (alert.Direction == models.AlertAbove && price >= alert.Threshold) ||
-			(alert.Direction == models.AlertBelow && price <= alert.Threshold)
-		if fired {
-			now := time.Now().UTC()
-			if err := s.store.MarkAlertTriggered(ctx, alert.ID, now); err != nil {
-				log.Printf("failed to mark alert triggered %d: %v", alert.ID, err)
-				continue
-			}
-			alert.Triggered = true
-			alert.TriggeredAt = &now
-			alertsFired = append(alertsFired, alert)
+// allocation splits total across positions, merging holdings of the same
+// ticker and cash of the same currency, largest first.
+func allocation(holdings []models.HoldingWithPrice, cash []models.CashValue, total float64) []models.AllocationSlice {
+	slices := make([]models.AllocationSlice, 0, len(holdings)+len(cash))
+	index := make(map[string]int)
+	add := func(label string, assetType models.AssetType, value float64) {
+		k := assetKey(assetType, label)
+		i, ok := index[k]
+		if !ok {
+			i = len(slices)
+			index[k] = i
+			slices = append(slices, models.AllocationSlice{Label: label, AssetType: assetType})
 		}
+		slices[i].Value += value
+	}
+	for _, h := range holdings {
+		add(h.Ticker, h.AssetType, h.MarketValue)
+	}
+	for _, c := range cash {
+		add(c.Currency, models.AssetCash, c.Value)
 	}
 
-	if len(alertsFired) > 0 {
-		out.AlertsFired = alertsFired
+	for i := range slices {
+		slices[i].Value = round2(slices[i].Value)
+		if total != 0 {
+			slices[i].WeightPct = round2(slices[i].Value / total * 100)
+		}
 	}
+	sort.SliceStable(slices, func(i, j int) bool { return slices[i].Value > slices[j].Value })
+	return slices
+}
 
-	return out, nil
+// isStale measures staleness from when the quote was fetched rather than
+// its market time, so a stock's Friday close is not stale all weekend as
+// long as polling keeps confirming it.
+func (s *Server) isStale(assetType models.AssetType, q models.Quote, now time.Time) bool {
+	limit, ok := s.staleAfter[assetType]
+	if !ok {
+		limit = defaultStaleAfter
+	}
+	return now.Sub(q.FetchedAt) > limit
 }
 
+// handleHealth always answers 200 so probes keep the pod in rotation while a
+// price source is down; "degraded" signals an open breaker.
 func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
-	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	sources := s.market.SourceHealth()
+	status := "ok"
+	for _, src := range sources {
+		if src.State != models.BreakerClosed {
+			status = "degraded"
+			break
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": status, "sources": sources})
 }
 
 func (s *Server) handleListHoldings(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.portfolioScope(w, r)
+	if !ok {
+		return
+	}
 	holdings, err := s.store.ListHoldings(r.Context())
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err)
 		return
 	}
+	if pid != 0 {
+		scoped := make([]models.Holding, 0, len(holdings))
+		for _, h := range holdings {
+			if h.PortfolioID == pid {
+				scoped = append(scoped, h)
+			}
+		}
+		holdings = scoped
+	}
 	writeJSON(w, http.StatusOK, holdings)
 }
 
 func (s *Server) handleCreateHolding(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.portfolioScope(w, r)
+	if !ok {
+		return
+	}
 	var req struct {
-		Ticker    string           `json:"ticker"`
-		AssetType models.AssetType `json:"assetType"`
-		Quantity  float64          `json:"quantity"`
-		AvgCost   float64          `json:"avgCost"`
+		PortfolioID int64            `json:"portfolioId"`
+		Ticker      string           `json:"ticker"`
+		AssetType   models.AssetType `json:"assetType"`
+		Currency    string           `json:"currency"`
+		Quantity    float64          `json:"quantity"`
+		AvgCost     float64          `json:"avgCost"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, err)
 		return
 	}
+	if pid != 0 {
+		req.PortfolioID = pid
+	}
 
 	req.Ticker = strings.TrimSpace(strings.ToUpper(req.Ticker))
 	if req.Ticker == "" || req.Quantity <= 0 || req.AvgCost < 0 {
@@ -236,14 +539,26 @@ func (s *Server) handleCreateHolding(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !validCurrency(req.Currency) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "currency must be a 3-letter ISO code"})
+		return
+	}
+	currency := strings.ToUpper(req.Currency)
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+
 	created, err := s.store.CreateHolding(r.Context(), models.Holding{
-		Ticker:    req.Ticker,
-		AssetType: req.AssetType,
-		Quantity:  req.Quantity,
-		AvgCost:   req.AvgCost,
+		PortfolioID: req.PortfolioID,
+		Ticker:      req.Ticker,
+		AssetType:   req.AssetType,
+		Currency:    currency,
+		Quantity:    req.Quantity,
+		AvgCost:     req.AvgCost,
+		CostFXRate:  s.market.FXRates().Rates[currency],
 	})
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
+		writePortfolioError(w, err)
 		return
 	}
 
@@ -272,94 +587,58 @@ func (s *Server) handleDeleteHolding(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (s *Server) handleListAlerts(w http.ResponseWriter, r *http.Request) {
-	alerts, err := s.store.ListAlerts(r.Context())
+func (s *Server) handlePortfolioSnapshot(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := s.BuildSnapshot(r.Context())
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, alerts)
+	writeJSON(w, http.StatusOK, snapshot)
 }
 
-func (s *Server) handleCreateAlert(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Ticker    string                `json:"ticker"`
-		AssetType models.AssetType      `json:"assetType"`
-		Direction models.AlertDirection `json:"direction"`
-		Threshold float64               `json:"threshold"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, err)
-		return
-	}
-
-	req.Ticker = strings.ToUpper(strings.TrimSpace(req.Ticker))
-	if req.Ticker == "" || req.Threshold <= 0 {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid alert payload"})
-		return
-	}
-	if req.AssetType != models.AssetStock && req.AssetType != models.AssetCrypto {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "assetType must be stock or crypto"})
-		return
-	}
-	if req.Direction != models.AlertAbove && req.Direction != models.AlertBelow {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "direction must be above or below"})
-		return
-	}
-
-	created, err := s.store.CreateAlert(r.Context(), models.PriceAlert{
-		Ticker:    req.Ticker,
-		AssetType: req.AssetType,
-		Direction: req.Direction,
-		Threshold: req.Threshold,
-	})
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		return
-	}
-
-	_ = s.RefreshAndBroadcast(context.Background())
-	writeJSON(w, http.StatusCreated, created)
+func (s *Server) handleMarketSources(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.market.Sources())
 }
 
-func (s *Server) handleDeleteAlert(w http.ResponseWriter, r *http.Request) {
-	id, err := parseID(mux.Vars(r)["id"])
-	if err != nil {
-		writeError(w, http.StatusBadRequest, err)
-		return
-	}
+// handleFXRates reports the exchange rates snapshots are converted with.
+func (s *Server) handleFXRates(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.market.FXRates())
+}
 
-	err = s.store.DeleteAlert(r.Context(), id)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			writeJSON(w, http.StatusNotFound, map[string]string{"error": "alert not found"})
+// handleWebSocket streams the combined snapshot, or with ?portfolioId= only
+// that portfolio's.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	var pid int64
+	if raw := r.URL.Query().Get("portfolioId"); raw != "" {
+		id, err := parseID(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
 			return
 		}
-		writeError(w, http.StatusInternalServerError, err)
-		return
-	}
-
-	_ = s.RefreshAndBroadcast(context.Background())
-	w.WriteHeader(http.StatusNoContent)
-}
-
-func (s *Server) handlePortfolioSnapshot(w http.ResponseWriter, r *http.Request) {
-	snapshot, err := s.BuildSnapshot(r.Context())
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		return
+		if _, err := s.store.GetPortfolio(r.Context(), id); err != nil {
+			writePortfolioError(w, err)
+			return
+		}
+		pid = id
 	}
-	writeJSON(w, http.StatusOK, snapshot)
-}
 
-func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return
 	}
-	s.hub.AddClient(conn)
+	s.hub.Subscribe(conn, portfolioTopic(pid))
 
+	// The first message also carries the firings no one has acknowledged,
+	// so a client that was away sees what it missed.
 	if snapshot, err := s.BuildSnapshot(r.Context()); err == nil {
+		if pid != 0 {
+			snapshot = scopeSnapshot(snapshot, pid)
+		}
+		events, err := s.store.ListEvents(r.Context(), store.AlertEventFilter{PortfolioID: pid, Unacknowledged: true})
+		if err != nil {
+			log.Printf("unacknowledged alert events: %v", err)
+		}
+		snapshot.UnacknowledgedEvents = events
 		_ = conn.WriteJSON(snapshot)
 	}
 
@@ -392,8 +671,8 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,DELETE,OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE,OPTIONS")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
@@ -402,6 +681,23 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// validCurrency accepts an empty code (meaning the default) or three
+// ASCII letters.
+func validCurrency(code string) bool {
+	if code == "" {
+		return true
+	}
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range strings.ToUpper(code) {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
 func assetKey(assetType models.AssetType, ticker string) string {
 	return string(assetType) + ":" + strings.ToUpper(strings.TrimSpace(ticker))
 }
@@ -4,32 +4,62 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
 
 	"portfoliopulse/internal/db"
 	"portfoliopulse/internal/models"
+	"portfoliopulse/internal/notify"
 	"portfoliopulse/internal/realtime"
 	"portfoliopulse/internal/store"
 )
 
 type fakeMarket struct {
-	prices map[string]float64
+	prices    map[string]float64
+	fetchedAt time.Time
+	rates     map[string]float64
 }
 
 func (f *fakeMarket) Refresh(_ context.Context, _ []models.Holding) error { return nil }
-func (f *fakeMarket) Snapshot() map[string]float64 {
-	out := make(map[string]float64, len(f.prices))
+func (f *fakeMarket) Snapshot() map[string]models.Quote {
+	fetchedAt := f.fetchedAt
+	if fetchedAt.IsZero() {
+		fetchedAt = time.Now().UTC()
+	}
+	out := make(map[string]models.Quote, len(f.prices))
 	for k, v := range f.prices {
-		out[k] = v
+		out[k] = models.Quote{Price: v, Source: "fake", FetchedAt: fetchedAt}
 	}
 	return out
 }
 
+func (f *fakeMarket) Sources() map[models.AssetType][]string {
+	return map[models.AssetType][]string{models.AssetStock: {"fake"}}
+}
+
+func (f *fakeMarket) SourceHealth() []models.SourceStatus {
+	return []models.SourceStatus{{AssetType: models.AssetStock, Source: "fake", State: models.BreakerClosed}}
+}
+
+func (f *fakeMarket) FXRates() models.FXRates {
+	rates := map[string]float64{"USD": 1}
+	for cur, rate := range f.rates {
+		rates[cur] = rate
+	}
+	return models.FXRates{Base: "USD", Rates: rates}
+}
+
 func setupServer(t *testing.T) (*Server, *sql.DB) {
 	t.Helper()
 	dbFile := filepath.Join(t.TempDir(), "api.db")
@@ -115,6 +145,1749 @@ func TestPortfolioSnapshotHandler(t *testing.T) {
 	if snapshot.TotalValue != 400 || snapshot.TotalCost != 200 || snapshot.TotalPnL != 200 {
 		t.Fatalf("unexpected totals: %+v", snapshot)
 	}
+	if h := snapshot.Holdings[0]; h.Stale || h.Source != "fake" || h.PriceAsOf == nil {
+		t.Fatalf("unexpected quote metadata: %+v", h)
+	}
+}
+
+func TestSnapshotFlagsStaleQuotes(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+	server.market.(*fakeMarket).fetchedAt = time.Now().Add(-time.Hour)
+
+	for _, body := range []string{
+		`{"ticker":"AAPL","assetType":"stock","quantity":1,"avgCost":100}`,
+		`{"ticker":"NOPE","assetType":"stock","quantity":1,"avgCost":100}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/holdings", bytes.NewReader([]byte(body)))
+		server.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	snapshot, err := server.BuildSnapshot(context.Background())
+	if err != nil {
+		t.Fatalf("build snapshot: %v", err)
+	}
+	if len(snapshot.Holdings) != 2 || !snapshot.Holdings[0].Stale || !snapshot.Holdings[1].Stale {
+		t.Fatalf("expected both holdings stale: %+v", snapshot.Holdings)
+	}
+	if snapshot.Holdings[1].PriceAsOf != nil {
+		t.Fatalf("unpriced holding should have no priceAsOf: %+v", snapshot.Holdings[1])
+	}
+}
+
+func TestTransactionHandlers(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/transactions", bytes.NewReader([]byte(body)))
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := post(`{"ticker":"AAPL","assetType":"stock","type":"buy","quantity":3,"price":100,"executedAt":"2024-01-02T15:00:00Z"}`)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", resp.Code, resp.Body.String())
+	}
+	resp = post(`{"ticker":"AAPL","assetType":"stock","type":"sell","quantity":1,"price":150,"executedAt":"2024-02-02T15:00:00Z"}`)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", resp.Code, resp.Body.String())
+	}
+	resp = post(`{"ticker":"AAPL","assetType":"stock","type":"sell","quantity":5,"price":150}`)
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for oversell, got %d", resp.Code)
+	}
+	resp = post(`{"ticker":"AAPL","assetType":"stock","type":"dividend","quantity":1}`)
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown type, got %d", resp.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/portfolio", nil)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	var snapshot models.PortfolioSnapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &snapshot); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	if len(snapshot.Holdings) != 1 || snapshot.Holdings[0].Quantity != 2 || snapshot.TotalCost != 200 {
+		t.Fatalf("unexpected snapshot from ledger: %+v", snapshot)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/transactions?ticker=aapl", nil)
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	var txs []models.Transaction
+	if err := json.Unmarshal(rec.Body.Bytes(), &txs); err != nil {
+		t.Fatalf("decode transactions: %v", err)
+	}
+	if len(txs) != 2 || txs[0].Type != models.TxBuy {
+		t.Fatalf("unexpected transactions: %+v", txs)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/api/transactions/"+itoa(txs[1].ID),
+		bytes.NewReader([]byte(`{"type":"sell","quantity":2,"price":150,"executedAt":"2024-02-02T15:00:00Z"}`)))
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 on update, got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	// An edit without executedAt keeps the trade where it was.
+	req = httptest.NewRequest(http.MethodPut, "/api/transactions/"+itoa(txs[1].ID),
+		bytes.NewReader([]byte(`{"type":"sell","quantity":1,"price":160}`)))
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	var edited models.Transaction
+	_ = json.Unmarshal(rec.Body.Bytes(), &edited)
+	if rec.Code != http.StatusOK || !edited.ExecutedAt.Equal(time.Date(2024, 2, 2, 15, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the sell to keep its time, got %d %+v", rec.Code, edited)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/transactions/"+itoa(txs[1].ID), nil)
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 on delete, got %d", rec.Code)
+	}
+}
+
+func TestRealizedHandler(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	for _, body := range []string{
+		`{"ticker":"AAPL","assetType":"stock","type":"buy","quantity":1,"price":100,"executedAt":"2024-01-02T15:00:00Z"}`,
+		`{"ticker":"AAPL","assetType":"stock","type":"buy","quantity":1,"price":160,"executedAt":"2024-01-03T15:00:00Z"}`,
+		`{"ticker":"AAPL","assetType":"stock","type":"sell","quantity":1,"price":150,"executedAt":"2024-02-02T15:00:00Z"}`,
+		`{"ticker":"AAPL","assetType":"stock","type":"sell","quantity":1,"price":170,"costMethod":"lifo","executedAt":"2024-03-02T15:00:00Z"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/transactions", bytes.NewReader([]byte(body)))
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, req)
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d, body=%s", resp.Code, resp.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/realized?from=2024-02-01&to=2024-02-28", nil)
+	resp := httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.Code)
+	}
+	var report models.RealizedReport
+	if err := json.Unmarshal(resp.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode realized: %v", err)
+	}
+	// Default FIFO closes the 100 lot first.
+	if len(report.Gains) != 1 || report.TotalGain != 50 {
+		t.Fatalf("unexpected realized report: %+v", report)
+	}
+
+	resp = httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/realized?portfolioId=99", nil))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown portfolio, got %d", resp.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/portfolio", nil)
+	resp = httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, req)
+	var snapshot models.PortfolioSnapshot
+	if err := json.Unmarshal(resp.Body.Bytes(), &snapshot); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	if snapshot.TotalRealizedPnL != 60 || snapshot.Holdings[0].RealizedPnL != 60 {
+		t.Fatalf("unexpected realized totals: %+v", snapshot)
+	}
+}
+
+func TestPriceHistoryHandler(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	if err := server.RefreshAndBroadcast(context.Background()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/prices/stock/aapl/history?interval=1m", nil)
+	resp := httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", resp.Code, resp.Body.String())
+	}
+	var history models.PriceHistory
+	if err := json.Unmarshal(resp.Body.Bytes(), &history); err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+	if history.Ticker != "AAPL" || len(history.Bars) != 1 || history.Bars[0].Close != 200 {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/prices/stock/AAPL/history?interval=5m", nil)
+	resp = httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown interval, got %d", resp.Code)
+	}
+}
+
+func TestPortfolioHistoryHandler(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	body, _ := json.Marshal(map[string]any{"ticker": "AAPL", "assetType": "stock", "quantity": 2, "avgCost": 150})
+	resp := httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/holdings", bytes.NewReader(body)))
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("create holding: %d %s", resp.Code, resp.Body.String())
+	}
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	if _, err := server.takeValueSnapshot(ctx, models.SnapshotEOD, now.Add(-24*time.Hour)); err != nil {
+		t.Fatalf("eod snapshot: %v", err)
+	}
+	if _, err := server.takeValueSnapshot(ctx, models.SnapshotIntraday, now); err != nil {
+		t.Fatalf("intraday snapshot: %v", err)
+	}
+
+	resp = httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/portfolio/history?holdings=true", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", resp.Code, resp.Body.String())
+	}
+	var curve models.EquityCurve
+	if err := json.Unmarshal(resp.Body.Bytes(), &curve); err != nil {
+		t.Fatalf("decode curve: %v", err)
+	}
+	if len(curve.Points) != 1 || curve.Points[0].TotalValue != 400 || curve.Points[0].TotalPnL != 100 {
+		t.Fatalf("unexpected eod curve: %+v", curve)
+	}
+	if len(curve.Points[0].Holdings) != 1 || curve.Points[0].Holdings[0].Ticker != "AAPL" {
+		t.Fatalf("expected holding breakdown, got %+v", curve.Points[0].Holdings)
+	}
+
+	resp = httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/portfolio/history?kind=all", nil))
+	if err := json.Unmarshal(resp.Body.Bytes(), &curve); err != nil {
+		t.Fatalf("decode curve: %v", err)
+	}
+	if len(curve.Points) != 2 {
+		t.Fatalf("expected eod and intraday points, got %+v", curve.Points)
+	}
+
+	resp = httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/portfolio/history?portfolioId=1", nil))
+	if err := json.Unmarshal(resp.Body.Bytes(), &curve); err != nil {
+		t.Fatalf("decode curve: %v", err)
+	}
+	if len(curve.Points) != 1 || curve.Points[0].PortfolioID != 1 || curve.Points[0].TotalValue != 400 {
+		t.Fatalf("expected the default portfolio's own eod point, got %+v", curve.Points)
+	}
+
+	resp = httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/portfolio/history?portfolioId=99", nil))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown portfolio, got %d", resp.Code)
+	}
+
+	resp = httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/portfolio/history?kind=weekly", nil))
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown kind, got %d", resp.Code)
+	}
+}
+
+func TestReturnsHandler(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	body, _ := json.Marshal(map[string]any{"ticker": "AAPL", "assetType": "stock", "quantity": 2, "avgCost": 150})
+	resp := httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/holdings", bytes.NewReader(body)))
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("create holding: %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp = httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/analytics/returns?period=1m", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", resp.Code, resp.Body.String())
+	}
+	var report models.ReturnsReport
+	if err := json.Unmarshal(resp.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode returns: %v", err)
+	}
+	// Bought at 150, now priced at 200.
+	if p := report.Portfolio; p.TWRPct != 33.33 || p.NetFlows != 300 || p.EndValue != 400 || p.MWRPct == nil {
+		t.Fatalf("unexpected portfolio returns: %+v", p)
+	}
+	if len(report.Holdings) != 1 || report.Holdings[0].Ticker != "AAPL" || report.Holdings[0].TWRPct != 33.33 {
+		t.Fatalf("unexpected holding returns: %+v", report.Holdings)
+	}
+
+	// Another portfolio measures only its own, empty, history.
+	body, _ = json.Marshal(map[string]any{"name": "Other"})
+	resp = httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/portfolios", bytes.NewReader(body)))
+	var other models.Portfolio
+	if err := json.Unmarshal(resp.Body.Bytes(), &other); err != nil || other.ID == 0 {
+		t.Fatalf("create portfolio: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/analytics/returns?period=1m&portfolioId="+itoa(other.ID), nil))
+	if err := json.Unmarshal(resp.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode returns: %v", err)
+	}
+	if p := report.Portfolio; p.NetFlows != 0 || p.EndValue != 0 || len(report.Holdings) != 0 {
+		t.Fatalf("expected nothing in the other portfolio, got %+v %+v", p, report.Holdings)
+	}
+
+	resp = httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/analytics/returns?portfolioId=99", nil))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown portfolio, got %d", resp.Code)
+	}
+
+	resp = httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/analytics/returns?period=2W", nil))
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown period, got %d", resp.Code)
+	}
+}
+
+func TestPortfolioScopedRoutes(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	do := func(method, path string, payload any) *httptest.ResponseRecorder {
+		t.Helper()
+		var body bytes.Buffer
+		if payload != nil {
+			_ = json.NewEncoder(&body).Encode(payload)
+		}
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(method, path, &body))
+		return resp
+	}
+
+	resp := do(http.MethodPost, "/api/portfolios", map[string]any{"name": "IRA"})
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("create portfolio: %d %s", resp.Code, resp.Body.String())
+	}
+	var ira models.Portfolio
+	_ = json.Unmarshal(resp.Body.Bytes(), &ira)
+	if resp := do(http.MethodPost, "/api/portfolios", map[string]any{"name": "ira"}); resp.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for duplicate name, got %d", resp.Code)
+	}
+
+	base := "/api/portfolios/" + itoa(ira.ID)
+	holding := map[string]any{"ticker": "AAPL", "assetType": "stock", "quantity": 1, "avgCost": 100}
+	if resp := do(http.MethodPost, base+"/holdings", holding); resp.Code != http.StatusCreated {
+		t.Fatalf("create scoped holding: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := do(http.MethodPost, "/api/holdings", holding); resp.Code != http.StatusCreated {
+		t.Fatalf("create default holding: %d %s", resp.Code, resp.Body.String())
+	}
+
+	var holdings []models.Holding
+	_ = json.Unmarshal(do(http.MethodGet, base+"/holdings", nil).Body.Bytes(), &holdings)
+	if len(holdings) != 1 || holdings[0].PortfolioID != ira.ID {
+		t.Fatalf("expected one IRA holding, got %+v", holdings)
+	}
+
+	var rollup models.PortfolioSnapshot
+	_ = json.Unmarshal(do(http.MethodGet, "/api/portfolio", nil).Body.Bytes(), &rollup)
+	if rollup.PortfolioID != 0 || rollup.TotalValue != 400 || len(rollup.Portfolios) != 2 || rollup.Portfolios[1].TotalValue != 200 {
+		t.Fatalf("unexpected roll-up: %+v", rollup)
+	}
+
+	var view models.PortfolioSnapshot
+	_ = json.Unmarshal(do(http.MethodGet, base+"/snapshot", nil).Body.Bytes(), &view)
+	if view.PortfolioID != ira.ID || view.PortfolioName != "IRA" || view.TotalValue != 200 || len(view.Holdings) != 1 {
+		t.Fatalf("unexpected portfolio view: %+v", view)
+	}
+
+	if resp := do(http.MethodGet, "/api/portfolios/99/holdings", nil); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown portfolio, got %d", resp.Code)
+	}
+	if resp := do(http.MethodDelete, "/api/portfolios/1", nil); resp.Code != http.StatusConflict {
+		t.Fatalf("expected 409 deleting default portfolio, got %d", resp.Code)
+	}
+	if resp := do(http.MethodDelete, base, nil); resp.Code != http.StatusNoContent {
+		t.Fatalf("delete portfolio: %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestSnapshotConvertsForeignHoldings(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+	fm := server.market.(*fakeMarket)
+	fm.prices["stock:SAP"] = 110
+	fm.rates = map[string]float64{"EUR": 1.1}
+
+	body, _ := json.Marshal(map[string]any{"ticker": "SAP", "assetType": "stock", "currency": "eur", "quantity": 10, "avgCost": 100})
+	resp := httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/holdings", bytes.NewReader(body)))
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("create holding: %d %s", resp.Code, resp.Body.String())
+	}
+
+	// The euro strengthens after the purchase.
+	fm.rates["EUR"] = 1.2
+	snapshot, err := server.BuildSnapshot(context.Background())
+	if err != nil {
+		t.Fatalf("build snapshot: %v", err)
+	}
+	if len(snapshot.Holdings) != 1 || snapshot.BaseCurrency != "USD" {
+		t.Fatalf("unexpected snapshot: %+v", snapshot)
+	}
+	h := snapshot.Holdings[0]
+	// Local: 1100 value on 1000 cost. Base: 1320 value on 1100 cost, of
+	// which 120 is the price gain at today's rate and 100 the currency move.
+	if h.Currency != "EUR" || h.LocalMarketValue != 1100 || h.MarketValue != 1320 || h.CostBasis != 1100 {
+		t.Fatalf("unexpected conversion: %+v", h)
+	}
+	if h.PricePnL != 120 || h.FXPnL != 100 || h.PnL != 220 || snapshot.TotalFXPnL != 100 {
+		t.Fatalf("unexpected P&L split: %+v", h)
+	}
+
+	delete(fm.rates, "EUR")
+	snapshot, err = server.BuildSnapshot(context.Background())
+	if err != nil {
+		t.Fatalf("build snapshot: %v", err)
+	}
+	if !snapshot.Holdings[0].Stale {
+		t.Fatalf("expected holding without a rate to be flagged stale")
+	}
+}
+
+func TestCashAccountsInSnapshot(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+	server.market.(*fakeMarket).rates = map[string]float64{"EUR": 1.1}
+
+	post := func(path string, payload any) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		return resp
+	}
+
+	resp := post("/api/portfolios/1/cash", map[string]any{"currency": "USD"})
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("create usd account: %d %s", resp.Code, resp.Body.String())
+	}
+	var usd models.CashAccount
+	_ = json.NewDecoder(resp.Body).Decode(&usd)
+	if resp := post("/api/cash", map[string]any{"currency": "USD"}); resp.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a duplicate account, got %d", resp.Code)
+	}
+	resp = post("/api/cash", map[string]any{"currency": "EUR"})
+	var eur models.CashAccount
+	_ = json.NewDecoder(resp.Body).Decode(&eur)
+
+	if resp := post("/api/cash/"+itoa(usd.ID)+"/movements", map[string]any{"type": "deposit", "amount": 1000}); resp.Code != http.StatusCreated {
+		t.Fatalf("deposit: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := post("/api/cash/"+itoa(eur.ID)+"/movements", map[string]any{"type": "interest", "amount": 100}); resp.Code != http.StatusCreated {
+		t.Fatalf("interest: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := post("/api/cash/"+itoa(usd.ID)+"/movements", map[string]any{"type": "gift", "amount": 5}); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown movement type, got %d", resp.Code)
+	}
+
+	// With a USD account in place, a USD buy settles against it by default.
+	resp = post("/api/transactions", map[string]any{"ticker": "AAPL", "assetType": "stock", "type": "buy", "quantity": 2, "price": 150})
+	var buy models.Transaction
+	_ = json.NewDecoder(resp.Body).Decode(&buy)
+	if resp.Code != http.StatusCreated || !buy.CashSettled {
+		t.Fatalf("expected a settled buy, got %d %+v", resp.Code, buy)
+	}
+
+	snapshot, err := server.BuildSnapshot(context.Background())
+	if err != nil {
+		t.Fatalf("build snapshot: %v", err)
+	}
+	// Holdings 400 (cost 300), USD cash 700, EUR cash 110.
+	if snapshot.TotalValue != 1210 || snapshot.TotalCash != 810 || snapshot.TotalPnL != 100 || len(snapshot.Cash) != 2 {
+		t.Fatalf("unexpected totals: %+v", snapshot)
+	}
+	if snapshot.Portfolios[0].TotalCash != 810 || snapshot.Portfolios[0].TotalPnL != 100 {
+		t.Fatalf("unexpected portfolio totals: %+v", snapshot.Portfolios[0])
+	}
+	alloc := snapshot.Allocation
+	if len(alloc) != 3 || alloc[0].Label != "USD" || alloc[0].AssetType != models.AssetCash || alloc[0].WeightPct != 57.85 {
+		t.Fatalf("unexpected allocation: %+v", alloc)
+	}
+	if alloc[1].Label != "AAPL" || alloc[1].Value != 400 || alloc[2].Label != "EUR" || alloc[2].Value != 110 {
+		t.Fatalf("unexpected allocation order: %+v", alloc)
+	}
+
+	listResp := httptest.NewRecorder()
+	server.Handler().ServeHTTP(listResp, httptest.NewRequest(http.MethodGet, "/api/cash/"+itoa(usd.ID)+"/movements", nil))
+	var movements []models.CashMovement
+	_ = json.NewDecoder(listResp.Body).Decode(&movements)
+	if len(movements) != 2 || movements[1].Type != models.CashTrade || movements[1].Amount != -300 {
+		t.Fatalf("unexpected movements: %+v", movements)
+	}
+}
+
+func TestScopedTransactionRejectsOtherPortfolioHolding(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	other, err := server.store.CreatePortfolio(ctx, models.Portfolio{Name: "Other"})
+	if err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	h, err := server.store.CreateHolding(ctx, models.Holding{PortfolioID: other.ID, Ticker: "AAPL", AssetType: models.AssetStock, Quantity: 1, AvgCost: 150})
+	if err != nil {
+		t.Fatalf("create holding: %v", err)
+	}
+
+	post := func(path string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]any{"holdingId": h.ID, "type": "buy", "quantity": 1, "price": 150})
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		return resp
+	}
+	if resp := post("/api/portfolios/" + itoa(models.DefaultPortfolioID) + "/transactions"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 booking another portfolio's holding, got %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := post("/api/portfolios/" + itoa(other.ID) + "/transactions"); resp.Code != http.StatusCreated {
+		t.Fatalf("expected the holding's own portfolio to accept it, got %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestIncomeHandlers(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	post := func(path string, payload any) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		return resp
+	}
+	get := func(path string, v any) {
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, path, nil))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("GET %s: %d %s", path, resp.Code, resp.Body.String())
+		}
+		_ = json.NewDecoder(resp.Body).Decode(v)
+	}
+
+	if resp := post("/api/holdings", map[string]any{"ticker": "AAPL", "assetType": "stock", "quantity": 10, "avgCost": 150}); resp.Code != http.StatusCreated {
+		t.Fatalf("create holding: %d", resp.Code)
+	}
+	if resp := post("/api/income", map[string]any{"ticker": "AAPL", "assetType": "stock", "type": "dividend", "amount": 30}); resp.Code != http.StatusCreated {
+		t.Fatalf("cash dividend: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := post("/api/income", map[string]any{"ticker": "AAPL", "assetType": "stock", "type": "bonus", "amount": 30}); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown type, got %d", resp.Code)
+	}
+	if resp := post("/api/income", map[string]any{"ticker": "AAPL", "assetType": "stock", "type": "dividend", "amount": 5, "settleCash": true}); resp.Code != http.StatusConflict {
+		t.Fatalf("expected 409 without a cash account, got %d", resp.Code)
+	}
+
+	// Without a price the reinvestment is booked at the current quote (200).
+	resp := post("/api/income", map[string]any{"ticker": "AAPL", "assetType": "stock", "type": "dividend", "amount": 20, "reinvest": true})
+	var reinvested models.IncomeEvent
+	_ = json.NewDecoder(resp.Body).Decode(&reinvested)
+	if resp.Code != http.StatusCreated || reinvested.Quantity != 0.1 || reinvested.Price != 200 || reinvested.TransactionID == 0 {
+		t.Fatalf("unexpected reinvestment: %d %+v", resp.Code, reinvested)
+	}
+
+	var summary models.IncomeSummary
+	get("/api/income/summary", &summary)
+	// 50 of income on 1520 of cost (1500 + the 20 reinvested), worth 2020.
+	if summary.TTMIncome != 50 || summary.YieldOnCostPct != 3.29 || summary.CurrentYieldPct != 2.48 || len(summary.Holdings) != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	if summary.ByType[models.IncomeDividend] != 50 || summary.Holdings[0].Ticker != "AAPL" || summary.Holdings[0].YieldOnCostPct != 3.29 {
+		t.Fatalf("unexpected summary breakdown: %+v", summary)
+	}
+
+	var cal models.IncomeCalendar
+	get("/api/income/calendar", &cal)
+	month := cal.Months[time.Now().UTC().Month()-1]
+	if len(cal.Months) != 12 || cal.Total != 50 || month.Total != 50 || len(month.Events) != 2 {
+		t.Fatalf("unexpected calendar: %+v", cal)
+	}
+
+	del := httptest.NewRecorder()
+	server.Handler().ServeHTTP(del, httptest.NewRequest(http.MethodDelete, "/api/income/"+itoa(reinvested.ID), nil))
+	if del.Code != http.StatusNoContent {
+		t.Fatalf("delete income: %d %s", del.Code, del.Body.String())
+	}
+	var holdings []models.Holding
+	get("/api/holdings", &holdings)
+	if len(holdings) != 1 || holdings[0].Quantity != 10 {
+		t.Fatalf("expected the reinvested shares to be removed: %+v", holdings)
+	}
+}
+
+func TestCorporateActionHandlers(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+	WithAdminToken("secret")(server)
+
+	apply := func(token string, payload any) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/corporate-actions", bytes.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, req)
+		return resp
+	}
+
+	body, _ := json.Marshal(map[string]any{"ticker": "AAPL", "assetType": "stock", "quantity": 10, "avgCost": 800})
+	created := httptest.NewRecorder()
+	server.Handler().ServeHTTP(created, httptest.NewRequest(http.MethodPost, "/api/holdings", bytes.NewReader(body)))
+	if created.Code != http.StatusCreated {
+		t.Fatalf("create holding: %d", created.Code)
+	}
+
+	split := map[string]any{"type": "split", "ticker": "AAPL", "assetType": "stock", "ratio": 4}
+	if resp := apply("", split); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without the admin token, got %d", resp.Code)
+	}
+	if resp := apply("secret", map[string]any{"type": "split", "ticker": "AAPL", "assetType": "stock", "ratio": 0.5}); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a split ratio below 1, got %d", resp.Code)
+	}
+	resp := apply("secret", split)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("apply split: %d %s", resp.Code, resp.Body.String())
+	}
+	var applied models.CorporateAction
+	_ = json.NewDecoder(resp.Body).Decode(&applied)
+	if applied.ID == 0 || len(applied.Changes) == 0 {
+		t.Fatalf("expected an audit trail, got %+v", applied)
+	}
+
+	// 40 shares at 200 against a cost of 8000: no phantom 75% loss.
+	snap, err := server.BuildSnapshot(context.Background())
+	if err != nil {
+		t.Fatalf("build snapshot: %v", err)
+	}
+	if len(snap.Holdings) != 1 || snap.Holdings[0].Quantity != 40 || snap.Holdings[0].AvgCost != 200 || snap.TotalPnL != 0 {
+		t.Fatalf("unexpected snapshot after split: %+v", snap)
+	}
+
+	get := httptest.NewRequest(http.MethodGet, "/api/admin/corporate-actions/"+itoa(applied.ID), nil)
+	get.Header.Set("Authorization", "Bearer secret")
+	getResp := httptest.NewRecorder()
+	server.Handler().ServeHTTP(getResp, get)
+	var fetched models.CorporateAction
+	_ = json.NewDecoder(getResp.Body).Decode(&fetched)
+	if getResp.Code != http.StatusOK || len(fetched.Changes) != len(applied.Changes) {
+		t.Fatalf("unexpected fetched action: %d %+v", getResp.Code, fetched)
+	}
+
+	// The entries a spin-off books cannot be edited or deleted.
+	if resp := apply("secret", map[string]any{"type": "spin_off", "ticker": "AAPL", "assetType": "stock", "newTicker": "SPUN", "ratio": 1, "costFraction": 0.1}); resp.Code != http.StatusCreated {
+		t.Fatalf("apply spin-off: %d %s", resp.Code, resp.Body.String())
+	}
+	txs, err := server.store.ListTransactions(context.Background(), store.TransactionFilter{})
+	if err != nil {
+		t.Fatalf("list transactions: %v", err)
+	}
+	booked := 0
+	for _, tx := range txs {
+		if tx.Type != models.TxSpinOff && tx.Type != models.TxCostAdjust {
+			continue
+		}
+		booked++
+		body, _ := json.Marshal(map[string]any{"type": "buy", "quantity": 1, "price": 1})
+		put := httptest.NewRecorder()
+		server.Handler().ServeHTTP(put, httptest.NewRequest(http.MethodPut, "/api/transactions/"+itoa(tx.ID), bytes.NewReader(body)))
+		del := httptest.NewRecorder()
+		server.Handler().ServeHTTP(del, httptest.NewRequest(http.MethodDelete, "/api/transactions/"+itoa(tx.ID), nil))
+		if put.Code != http.StatusConflict || del.Code != http.StatusConflict {
+			t.Fatalf("expected 409 editing and deleting a %s entry, got %d and %d", tx.Type, put.Code, del.Code)
+		}
+	}
+	if booked != 2 {
+		t.Fatalf("expected a spin-off lot and a cost adjustment, got %+v", txs)
+	}
+}
+
+func TestPercentAlerts(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	if _, err := server.store.CreateHolding(ctx, models.Holding{Ticker: "AAPL", AssetType: models.AssetStock, Quantity: 10, AvgCost: 250}); err != nil {
+		t.Fatalf("create holding: %v", err)
+	}
+	// AAPL is at 200: 180 a day ago and 210 at yesterday's close.
+	now := time.Now().UTC()
+	if err := server.store.RecordPrices(ctx, []models.PriceTick{
+		{AssetType: models.AssetStock, Ticker: "AAPL", Price: 180, At: now.Add(-25 * time.Hour)},
+		{AssetType: models.AssetStock, Ticker: "AAPL", Price: 210, At: now.Truncate(24 * time.Hour).Add(-time.Nanosecond)},
+	}); err != nil {
+		t.Fatalf("record prices: %v", err)
+	}
+
+	post := func(payload map[string]any) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/alerts", bytes.NewReader(body)))
+		return resp
+	}
+	if resp := post(map[string]any{"ticker": "AAPL", "assetType": "stock", "direction": "either", "threshold": 5}); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for either on a price alert, got %d", resp.Code)
+	}
+	if resp := post(map[string]any{"ticker": "AAPL", "assetType": "stock", "kind": "cost", "direction": "below", "threshold": 5, "windowMinutes": 60}); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a window on a cost alert, got %d", resp.Code)
+	}
+	resp := post(map[string]any{"ticker": "AAPL", "assetType": "stock", "kind": "change", "direction": "above", "threshold": 20})
+	var created models.PriceAlert
+	_ = json.NewDecoder(resp.Body).Decode(&created)
+	if resp.Code != http.StatusCreated || created.Kind != models.AlertChange || created.WindowMinutes != 24*60 {
+		t.Fatalf("unexpected change alert: %d %+v", resp.Code, created)
+	}
+
+	for _, a := range []models.PriceAlert{
+		{Kind: models.AlertFromCost, Direction: models.AlertBelow, Threshold: 10},
+		{Kind: models.AlertChange, Direction: models.AlertEither, Threshold: 5, WindowMinutes: 24 * 60},
+		{Kind: models.AlertFromClose, Direction: models.AlertBelow, Threshold: 3},
+		{Kind: models.AlertFromClose, Direction: models.AlertAbove, Threshold: 3},
+	} {
+		a.Ticker, a.AssetType = "AAPL", models.AssetStock
+		if _, err := server.store.CreateAlert(ctx, a); err != nil {
+			t.Fatalf("create alert: %v", err)
+		}
+	}
+
+	snap, err := server.BuildSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("build snapshot: %v", err)
+	}
+	fired := make(map[models.AlertKind]models.PriceAlert)
+	for _, a := range snap.AlertsFired {
+		fired[a.Kind] = a
+	}
+	if len(snap.AlertsFired) != 3 {
+		t.Fatalf("expected the cost, 24h and close alerts to fire, got %+v", snap.AlertsFired)
+	}
+	if a := fired[models.AlertFromCost]; a.Reference != 250 || a.ChangePct != -20 {
+		t.Fatalf("unexpected cost alert: %+v", a)
+	}
+	if a := fired[models.AlertChange]; a.Reference != 180 || a.ChangePct != 11.11 {
+		t.Fatalf("unexpected change alert: %+v", a)
+	}
+	if a := fired[models.AlertFromClose]; a.Direction != models.AlertBelow || a.Reference != 210 || a.ChangePct != -4.76 {
+		t.Fatalf("unexpected close alert: %+v", a)
+	}
+}
+
+func TestTrailingStopAlert(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	post := func(payload map[string]any) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/alerts", bytes.NewReader(body)))
+		return resp
+	}
+	if resp := post(map[string]any{"ticker": "AAPL", "assetType": "stock", "direction": "trailing", "threshold": 100}); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a 100%% trail, got %d", resp.Code)
+	}
+	if resp := post(map[string]any{"ticker": "AAPL", "assetType": "stock", "direction": "below", "threshold": 5, "trail": "amount"}); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for trail on a below alert, got %d", resp.Code)
+	}
+	resp := post(map[string]any{"ticker": "AAPL", "assetType": "stock", "direction": "trailing", "threshold": 10})
+	var created models.PriceAlert
+	_ = json.NewDecoder(resp.Body).Decode(&created)
+	if resp.Code != http.StatusCreated || created.Trail != models.TrailPercent || created.HighWaterMark != 200 || created.StopPrice != 180 {
+		t.Fatalf("unexpected trailing alert: %d %+v", resp.Code, created)
+	}
+
+	listAlerts := func(s *Server) models.PriceAlert {
+		t.Helper()
+		resp := httptest.NewRecorder()
+		s.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/alerts", nil))
+		var alerts []models.PriceAlert
+		_ = json.NewDecoder(resp.Body).Decode(&alerts)
+		if len(alerts) != 1 {
+			t.Fatalf("expected 1 alert, got %+v", alerts)
+		}
+		return alerts[0]
+	}
+
+	ctx := context.Background()
+	fm := server.market.(*fakeMarket)
+	fm.prices["stock:AAPL"] = 250
+	if _, err := server.BuildSnapshot(ctx); err != nil {
+		t.Fatalf("build snapshot: %v", err)
+	}
+	if a := listAlerts(server); a.HighWaterMark != 250 || a.StopPrice != 225 || a.HighWaterAt == nil || a.Triggered {
+		t.Fatalf("expected the peak raised to 250, got %+v", a)
+	}
+
+	// A restarted server resumes from the stored peak rather than today's price.
+	restarted := NewServer(store.NewSQLiteStore(sqlDB), &fakeMarket{prices: map[string]float64{"stock:AAPL": 230}}, realtime.NewHub())
+	snap, err := restarted.BuildSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("build snapshot: %v", err)
+	}
+	if len(snap.AlertsFired) != 0 || listAlerts(restarted).HighWaterMark != 250 {
+		t.Fatalf("expected 230 to stay above the stop, got %+v", snap.AlertsFired)
+	}
+
+	restarted.market.(*fakeMarket).prices["stock:AAPL"] = 224
+	snap, err = restarted.BuildSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("build snapshot: %v", err)
+	}
+	if len(snap.AlertsFired) != 1 || snap.AlertsFired[0].Reference != 250 || snap.AlertsFired[0].ChangePct != -10.4 {
+		t.Fatalf("expected the stop to fire 10.4%% below the peak, got %+v", snap.AlertsFired)
+	}
+}
+
+func TestAlertModes(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	post := func(path string, payload map[string]any) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		return resp
+	}
+	if resp := post("/api/alerts", map[string]any{"ticker": "AAPL", "assetType": "stock", "direction": "above", "threshold": 210, "mode": "cooldown"}); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a cooldown alert without minutes, got %d", resp.Code)
+	}
+	if resp := post("/api/alerts", map[string]any{"ticker": "AAPL", "assetType": "stock", "direction": "above", "threshold": 210, "hysteresis": 5}); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for hysteresis on a once alert, got %d", resp.Code)
+	}
+
+	create := func(payload map[string]any) models.PriceAlert {
+		t.Helper()
+		resp := post("/api/alerts", payload)
+		var created models.PriceAlert
+		_ = json.NewDecoder(resp.Body).Decode(&created)
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("create alert: %d %s", resp.Code, resp.Body.String())
+		}
+		return created
+	}
+	once := create(map[string]any{"ticker": "AAPL", "assetType": "stock", "direction": "above", "threshold": 210})
+	rearm := create(map[string]any{"ticker": "AAPL", "assetType": "stock", "direction": "above", "threshold": 210, "mode": "rearm", "hysteresis": 5})
+	cooldown := create(map[string]any{"ticker": "AAPL", "assetType": "stock", "direction": "above", "threshold": 210, "mode": "cooldown", "cooldownMinutes": 60})
+	if once.Mode != models.AlertOnce || rearm.Hysteresis != 5 || cooldown.CooldownMinutes != 60 {
+		t.Fatalf("unexpected alerts: %+v %+v %+v", once, rearm, cooldown)
+	}
+
+	ctx := context.Background()
+	fm := server.market.(*fakeMarket)
+	fired := func(price float64) map[int64]bool {
+		t.Helper()
+		fm.prices["stock:AAPL"] = price
+		snap, err := server.BuildSnapshot(ctx)
+		if err != nil {
+			t.Fatalf("build snapshot: %v", err)
+		}
+		out := make(map[int64]bool)
+		for _, a := range snap.AlertsFired {
+			out[a.ID] = true
+		}
+		return out
+	}
+
+	if got := fired(215); !got[once.ID] || !got[rearm.ID] || !got[cooldown.ID] {
+		t.Fatalf("expected all three to fire at 215, got %v", got)
+	}
+	// Still above: nothing re-fires, the cooldown alert is within its hour.
+	if got := fired(216); len(got) != 0 {
+		t.Fatalf("expected no repeat firings, got %v", got)
+	}
+	// Back under 210 but inside the 5 band: the rearm alert stays disarmed.
+	fired(207)
+	if got := fired(212); len(got) != 0 {
+		t.Fatalf("expected the band to hold the rearm alert, got %v", got)
+	}
+	fired(204)
+	if got := fired(211); !got[rearm.ID] || got[once.ID] || got[cooldown.ID] {
+		t.Fatalf("expected only the rearm alert to fire again, got %v", got)
+	}
+
+	// Once the cooldown has passed it fires again while the condition holds.
+	if _, err := sqlDB.Exec(`UPDATE alert_events SET fired_at = ? WHERE alert_id = ?`, time.Now().UTC().Add(-2*time.Hour), cooldown.ID); err != nil {
+		t.Fatalf("age cooldown event: %v", err)
+	}
+	if got := fired(211); !got[cooldown.ID] || got[once.ID] {
+		t.Fatalf("expected the cooldown alert to fire again, got %v", got)
+	}
+
+	// Re-arming refreshes the snapshot, so move below the threshold first.
+	fired(205)
+	resp := post("/api/alerts/"+itoa(once.ID)+"/rearm", nil)
+	var rearmed models.PriceAlert
+	_ = json.NewDecoder(resp.Body).Decode(&rearmed)
+	if resp.Code != http.StatusOK || rearmed.Triggered || rearmed.FireCount != 1 {
+		t.Fatalf("unexpected rearm response: %d %+v", resp.Code, rearmed)
+	}
+	if got := fired(211); !got[once.ID] {
+		t.Fatalf("expected the re-armed once alert to fire, got %v", got)
+	}
+	if resp := post("/api/alerts/999/rearm", nil); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 re-arming a missing alert, got %d", resp.Code)
+	}
+
+	events := httptest.NewRecorder()
+	server.Handler().ServeHTTP(events, httptest.NewRequest(http.MethodGet, "/api/alerts/"+itoa(rearm.ID)+"/events", nil))
+	var history []models.AlertEvent
+	_ = json.NewDecoder(events.Body).Decode(&history)
+	if events.Code != http.StatusOK || len(history) != 2 || history[0].AlertID != rearm.ID {
+		t.Fatalf("expected two rearm events, got %d %+v", events.Code, history)
+	}
+}
+
+func TestPortfolioAlerts(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	if _, err := server.store.CreateHolding(ctx, models.Holding{Ticker: "AAPL", AssetType: models.AssetStock, Quantity: 10, AvgCost: 180}); err != nil {
+		t.Fatalf("create holding: %v", err)
+	}
+	if _, err := server.store.SavePortfolioSnapshot(ctx, models.ValueSnapshot{
+		PortfolioID: models.DefaultPortfolioID, Kind: models.SnapshotEOD, TakenAt: time.Now().UTC().Add(-24 * time.Hour),
+		TotalValue: 2100, TotalCost: 1800, TotalPnL: 300,
+	}); err != nil {
+		t.Fatalf("save snapshot: %v", err)
+	}
+
+	post := func(payload map[string]any) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/alerts", bytes.NewReader(body)))
+		return resp
+	}
+	for _, bad := range []map[string]any{
+		{"scope": "portfolio", "ticker": "AAPL", "kind": "total_value", "direction": "above", "threshold": 1000},
+		{"scope": "portfolio", "kind": "price", "direction": "above", "threshold": 1000},
+		{"scope": "portfolio", "kind": "drawdown", "direction": "above", "threshold": 10},
+		{"scope": "portfolio", "kind": "total_value", "direction": "below", "threshold": -5},
+		{"scope": "holding", "ticker": "AAPL", "assetType": "stock", "direction": "above", "threshold": 1},
+	} {
+		if resp := post(bad); resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %v, got %d", bad, resp.Code)
+		}
+	}
+
+	create := func(payload map[string]any) models.PriceAlert {
+		t.Helper()
+		resp := post(payload)
+		var created models.PriceAlert
+		_ = json.NewDecoder(resp.Body).Decode(&created)
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("create alert: %d %s", resp.Code, resp.Body.String())
+		}
+		return created
+	}
+	value := create(map[string]any{"scope": "portfolio", "kind": "total_value", "direction": "above", "threshold": 2200})
+	pnl := create(map[string]any{"scope": "portfolio", "kind": "total_pnl", "direction": "below", "threshold": -100})
+	day := create(map[string]any{"scope": "portfolio", "kind": "day_change", "direction": "below", "threshold": 5})
+	drawdown := create(map[string]any{"scope": "portfolio", "kind": "drawdown", "direction": "below", "threshold": 10})
+	if value.Scope != models.ScopePortfolio || value.Ticker != "" || drawdown.HighWaterMark != 2100 {
+		t.Fatalf("unexpected portfolio alerts: %+v %+v", value, drawdown)
+	}
+
+	fm := server.market.(*fakeMarket)
+	fired := func(price float64) map[int64]models.PriceAlert {
+		t.Helper()
+		fm.prices["stock:AAPL"] = price
+		snap, err := server.BuildSnapshot(ctx)
+		if err != nil {
+			t.Fatalf("build snapshot: %v", err)
+		}
+		out := make(map[int64]models.PriceAlert)
+		for _, a := range snap.AlertsFired {
+			out[a.ID] = a
+		}
+		return out
+	}
+
+	// 2000 is 4.76% under yesterday's close and the 2100 peak.
+	if got := fired(200); len(got) != 0 {
+		t.Fatalf("expected nothing to fire at 2000, got %v", got)
+	}
+	if got := fired(230); len(got) != 1 || got[value.ID].ID == 0 {
+		t.Fatalf("expected the total value alert at 2300, got %v", got)
+	}
+	got := fired(185)
+	if len(got) != 2 || got[day.ID].Reference != 2100 || got[day.ID].ChangePct != -11.9 {
+		t.Fatalf("expected a day change of -11.9%% from 2100, got %v", got)
+	}
+	if got[drawdown.ID].Reference != 2300 || got[drawdown.ID].ChangePct != -19.57 {
+		t.Fatalf("expected a drawdown of 19.57%% from the 2300 peak, got %+v", got[drawdown.ID])
+	}
+	if got := fired(165); len(got) != 1 || got[pnl.ID].ID == 0 {
+		t.Fatalf("expected the P&L alert at -150, got %v", got)
+	}
+}
+
+func TestPortfolioAlertsReadTheirOwnPortfolio(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	second, err := server.store.CreatePortfolio(ctx, models.Portfolio{Name: "Second"})
+	if err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	// The default portfolio is worth 2000, the second 100.
+	if _, err := server.store.CreateHolding(ctx, models.Holding{Ticker: "AAPL", AssetType: models.AssetStock, Quantity: 10, AvgCost: 180}); err != nil {
+		t.Fatalf("create holding: %v", err)
+	}
+	if _, err := server.store.CreateHolding(ctx, models.Holding{PortfolioID: second.ID, Ticker: "MSFT", AssetType: models.AssetStock, Quantity: 1, AvgCost: 100}); err != nil {
+		t.Fatalf("create holding: %v", err)
+	}
+	fm := server.market.(*fakeMarket)
+	fm.prices["stock:AAPL"] = 200
+	fm.prices["stock:MSFT"] = 100
+
+	// Yesterday's close and the peak are saved per portfolio too.
+	if _, err := server.takeValueSnapshot(ctx, models.SnapshotEOD, time.Now().UTC().Add(-24*time.Hour)); err != nil {
+		t.Fatalf("take snapshot: %v", err)
+	}
+
+	create := func(payload map[string]any) models.PriceAlert {
+		t.Helper()
+		body, _ := json.Marshal(payload)
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/portfolios/"+itoa(second.ID)+"/alerts", bytes.NewReader(body)))
+		var created models.PriceAlert
+		_ = json.NewDecoder(resp.Body).Decode(&created)
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("create alert: %d %s", resp.Code, resp.Body.String())
+		}
+		return created
+	}
+	value := create(map[string]any{"scope": "portfolio", "kind": "total_value", "direction": "above", "threshold": 500})
+	day := create(map[string]any{"scope": "portfolio", "kind": "day_change", "direction": "above", "threshold": 5})
+	drawdown := create(map[string]any{"scope": "portfolio", "kind": "drawdown", "direction": "below", "threshold": 10})
+	if value.Triggered || drawdown.HighWaterMark != 100 {
+		t.Fatalf("expected the second portfolio's alerts armed from its own 100, got %+v %+v", value, drawdown)
+	}
+
+	fired := func() map[int64]models.PriceAlert {
+		t.Helper()
+		snap, err := server.BuildSnapshot(ctx)
+		if err != nil {
+			t.Fatalf("build snapshot: %v", err)
+		}
+		out := make(map[int64]models.PriceAlert)
+		for _, a := range snap.AlertsFired {
+			out[a.ID] = a
+		}
+		return out
+	}
+	// The default portfolio rising moves none of them.
+	fm.prices["stock:AAPL"] = 300
+	if got := fired(); len(got) != 0 {
+		t.Fatalf("expected nothing to fire on the default portfolio's move, got %v", got)
+	}
+	fm.prices["stock:MSFT"] = 110
+	got := fired()
+	if len(got) != 1 || got[day.ID].Reference != 100 || got[day.ID].ChangePct != 10 {
+		t.Fatalf("expected a day change of 10%% from the second portfolio's 100, got %v", got)
+	}
+	fm.prices["stock:MSFT"] = 95
+	got = fired()
+	if len(got) != 1 || got[drawdown.ID].Reference != 110 {
+		t.Fatalf("expected a drawdown from the second portfolio's 110 peak, got %v", got)
+	}
+	events, err := server.store.ListAlertEvents(ctx, drawdown.ID)
+	if err != nil || len(events) != 1 || events[0].TotalValue != 95 {
+		t.Fatalf("expected one drawdown event at the second portfolio's 95, got %+v %v", events, err)
+	}
+}
+
+func TestExpressionAlerts(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	if _, err := server.store.CreateHolding(ctx, models.Holding{Ticker: "AAPL", AssetType: models.AssetStock, Quantity: 10, AvgCost: 180}); err != nil {
+		t.Fatalf("create holding: %v", err)
+	}
+	// AAPL was 180 a day ago; BTC is watched without being held.
+	if err := server.store.RecordPrices(ctx, []models.PriceTick{
+		{AssetType: models.AssetStock, Ticker: "AAPL", Price: 180, At: time.Now().UTC().Add(-25 * time.Hour)},
+	}); err != nil {
+		t.Fatalf("record prices: %v", err)
+	}
+	// Creating an alert evaluates it, so start where none holds.
+	fm := server.market.(*fakeMarket)
+	fm.prices["stock:AAPL"] = 170
+	fm.prices["crypto:BTC"] = 100000
+
+	post := func(payload map[string]any) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/alerts", bytes.NewReader(body)))
+		return resp
+	}
+	for _, bad := range []struct {
+		payload  map[string]any
+		position int
+	}{
+		{map[string]any{"expression": `price("BTC") > 1`}, 7},
+		{map[string]any{"expression": `price("AAPL") >`}, 16},
+		{map[string]any{"expression": `price("AAPL") + 1`}, 1},
+		{map[string]any{"expression": `price("AAPL") > 1`, "threshold": 5}, 0},
+		{map[string]any{"expression": `price("AAPL") > 1`, "scope": "ticker"}, 0},
+		{map[string]any{"kind": "expression"}, 0},
+	} {
+		resp := post(bad.payload)
+		var body struct {
+			Error    string `json:"error"`
+			Position int    `json:"position"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		if resp.Code != http.StatusBadRequest || body.Position != bad.position {
+			t.Fatalf("expected 400 at column %d for %v, got %d %+v", bad.position, bad.payload, resp.Code, body)
+		}
+	}
+
+	create := func(expression string) models.PriceAlert {
+		t.Helper()
+		resp := post(map[string]any{"expression": expression, "severity": "warning"})
+		var created models.PriceAlert
+		_ = json.NewDecoder(resp.Body).Decode(&created)
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("create alert: %d %s", resp.Code, resp.Body.String())
+		}
+		return created
+	}
+	ratio := create(`price("BTC", "crypto") / price("aapl") > 600`)
+	loss := create(`pnl_pct("AAPL") < -15 && portfolio.total_value > 1000`)
+	move := create(`change_24h("AAPL") > 8`)
+	if ratio.Kind != models.AlertExpression || ratio.Scope != models.ScopePortfolio ||
+		ratio.Expression != `price("BTC", "crypto") / price("AAPL", "stock") > 600` {
+		t.Fatalf("unexpected expression alert %+v", ratio)
+	}
+
+	fired := func(price float64) map[int64]models.PriceAlert {
+		t.Helper()
+		fm.prices["stock:AAPL"] = price
+		snap, err := server.BuildSnapshot(ctx)
+		if err != nil {
+			t.Fatalf("build snapshot: %v", err)
+		}
+		out := make(map[int64]models.PriceAlert)
+		for _, a := range snap.AlertsFired {
+			out[a.ID] = a
+		}
+		return out
+	}
+
+	// At 200 AAPL is up 11.1% on the day and the ratio is 500.
+	got := fired(200)
+	if len(got) != 1 || got[move.ID].Values[`change_24h("AAPL", "stock")`] < 11.1 {
+		t.Fatalf("expected the 24h change alert at 200, got %v", got)
+	}
+	// At 150 the ratio is 666.7 and AAPL is 16.7% under cost.
+	got = fired(150)
+	if len(got) != 2 || got[ratio.ID].ID == 0 || got[loss.ID].Values[`portfolio.total_value`] != 1500 {
+		t.Fatalf("expected the ratio and loss alerts at 150, got %v", got)
+	}
+	if summary := notify.Summary(notify.Event{Alert: &ratio}); summary != ratio.Expression {
+		t.Fatalf("expected the expression as the summary, got %q", summary)
+	}
+
+	// In a second portfolio holding only MSFT worth 100, an expression
+	// reads that portfolio alone.
+	second, err := server.store.CreatePortfolio(ctx, models.Portfolio{Name: "Second"})
+	if err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	if _, err := server.store.CreateHolding(ctx, models.Holding{PortfolioID: second.ID, Ticker: "MSFT", AssetType: models.AssetStock, Quantity: 1, AvgCost: 100}); err != nil {
+		t.Fatalf("create holding: %v", err)
+	}
+	fm.prices["stock:MSFT"] = 100
+	postTo := func(payload map[string]any) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/portfolios/"+itoa(second.ID)+"/alerts", bytes.NewReader(body)))
+		return resp
+	}
+	if resp := postTo(map[string]any{"expression": `price("AAPL") > 1`}); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected AAPL unresolved outside the default portfolio, got %d", resp.Code)
+	}
+	resp := postTo(map[string]any{"expression": `portfolio.total_value < 500 && weight("MSFT") > 99`})
+	var own models.PriceAlert
+	_ = json.NewDecoder(resp.Body).Decode(&own)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("create alert: %d %s", resp.Code, resp.Body.String())
+	}
+	if events, err := server.store.ListAlertEvents(ctx, own.ID); err != nil || len(events) != 1 {
+		t.Fatalf("expected the second portfolio's alert to fire on its own 100, got %+v %v", events, err)
+	}
+}
+
+func TestAllocationDriftAlerts(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	fm := server.market.(*fakeMarket)
+	fm.prices["crypto:BTC"] = 10000
+	aapl, err := server.store.CreateHolding(ctx, models.Holding{Ticker: "AAPL", AssetType: models.AssetStock, Quantity: 10, AvgCost: 150})
+	if err != nil {
+		t.Fatalf("create holding: %v", err)
+	}
+	if _, err := server.store.CreateHolding(ctx, models.Holding{Ticker: "BTC", AssetType: models.AssetCrypto, Quantity: 0.3, AvgCost: 9000}); err != nil {
+		t.Fatalf("create holding: %v", err)
+	}
+
+	put := func(path string, payload any) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodPut, path, bytes.NewReader(body)))
+		return resp
+	}
+	resp := put("/api/holdings/"+itoa(aapl.ID)+"/tags", map[string]any{"tags": []string{"Tech", "tech", " core "}})
+	var tagged models.Holding
+	_ = json.NewDecoder(resp.Body).Decode(&tagged)
+	if resp.Code != http.StatusOK || len(tagged.Tags) != 2 || tagged.Tags[0] != "core" || tagged.Tags[1] != "tech" {
+		t.Fatalf("unexpected tags: %d %+v", resp.Code, tagged)
+	}
+
+	for _, bad := range [][]map[string]any{
+		{{"bucket": "ticker", "key": "AAPL", "assetType": "stock", "weightPct": 60}, {"bucket": "ticker", "key": "BTC", "assetType": "crypto", "weightPct": 50}},
+		{{"bucket": "tag", "key": "tech", "weightPct": 10}, {"bucket": "tag", "key": "TECH", "weightPct": 10}},
+		{{"bucket": "asset_type", "key": "bond", "weightPct": 10}},
+		{{"bucket": "sector", "key": "tech", "weightPct": 10}},
+	} {
+		if resp := put("/api/portfolios/1/targets", bad); resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %v, got %d", bad, resp.Code)
+		}
+	}
+	if resp := put("/api/portfolios/99/targets", []map[string]any{}); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing portfolio, got %d", resp.Code)
+	}
+	resp = put("/api/portfolios/1/targets", []map[string]any{
+		{"bucket": "ticker", "key": "aapl", "assetType": "stock", "weightPct": 50},
+		{"bucket": "asset_type", "key": "crypto", "weightPct": 50},
+		{"bucket": "tag", "key": "Tech", "weightPct": 50},
+	})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("set targets: %d %s", resp.Code, resp.Body.String())
+	}
+
+	// 2000 of AAPL and 3000 of BTC: 40% against 50% targets, 60% crypto.
+	resp = httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/portfolios/1/drift", nil))
+	var drift []models.AllocationDrift
+	_ = json.NewDecoder(resp.Body).Decode(&drift)
+	byKey := make(map[string]models.AllocationDrift)
+	for _, d := range drift {
+		byKey[d.Key] = d
+	}
+	if len(drift) != 3 || byKey["AAPL"].CurrentPct != 40 || byKey["crypto"].DriftPct != 10 || byKey["tech"].DriftPct != -10 {
+		t.Fatalf("unexpected drift: %+v", drift)
+	}
+
+	post := func(payload map[string]any) models.PriceAlert {
+		t.Helper()
+		body, _ := json.Marshal(payload)
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/alerts", bytes.NewReader(body)))
+		var created models.PriceAlert
+		_ = json.NewDecoder(resp.Body).Decode(&created)
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("create alert: %d %s", resp.Code, resp.Body.String())
+		}
+		return created
+	}
+	either := post(map[string]any{"scope": "portfolio", "kind": "drift", "direction": "either", "threshold": 15})
+	over := post(map[string]any{"scope": "portfolio", "kind": "drift", "direction": "above", "threshold": 20})
+
+	// BTC doubles: 25% AAPL, 75% crypto.
+	fm.prices["crypto:BTC"] = 20000
+	snap, err := server.BuildSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("build snapshot: %v", err)
+	}
+	fired := make(map[int64]models.PriceAlert)
+	for _, a := range snap.AlertsFired {
+		fired[a.ID] = a
+	}
+	if len(fired[either.ID].Drift) != 3 {
+		t.Fatalf("expected all three buckets past 15 points, got %+v", fired[either.ID])
+	}
+	if d := fired[over.ID].Drift; len(d) != 1 || d[0].Key != "crypto" || d[0].CurrentPct != 75 || d[0].TargetPct != 50 {
+		t.Fatalf("expected only crypto overweight, got %+v", d)
+	}
+}
+
+func TestRebalancePlan(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	server.market.(*fakeMarket).prices["crypto:BTC"] = 10000
+	if _, err := server.store.CreateHolding(ctx, models.Holding{Ticker: "AAPL", AssetType: models.AssetStock, Quantity: 10, AvgCost: 150}); err != nil {
+		t.Fatalf("create holding: %v", err)
+	}
+	if _, err := server.store.CreateHolding(ctx, models.Holding{Ticker: "BTC", AssetType: models.AssetCrypto, Quantity: 0.3, AvgCost: 9000}); err != nil {
+		t.Fatalf("create holding: %v", err)
+	}
+	account, err := server.store.CreateCashAccount(ctx, models.CashAccount{PortfolioID: models.DefaultPortfolioID, Currency: "USD"})
+	if err != nil {
+		t.Fatalf("create cash account: %v", err)
+	}
+	if _, err := server.store.CreateCashMovement(ctx, models.CashMovement{AccountID: account.ID, Type: models.CashDeposit, Amount: 1000, ExecutedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/portfolios/1/rebalance"+query, nil))
+		return resp
+	}
+	if resp := get(""); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without targets, got %d", resp.Code)
+	}
+	if _, err := server.store.SetAllocationTargets(ctx, models.DefaultPortfolioID, []models.AllocationTarget{
+		{Bucket: models.BucketTicker, AssetType: models.AssetStock, Key: "AAPL", WeightPct: 50},
+		{Bucket: models.BucketAssetType, Key: "crypto", WeightPct: 40},
+		{Bucket: models.BucketAssetType, Key: "cash", WeightPct: 10},
+	}); err != nil {
+		t.Fatalf("set targets: %v", err)
+	}
+	for _, bad := range []string{"?minTrade=-1", "?contribution=x", "?fractional=bond"} {
+		if resp := get(bad); resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", bad, resp.Code)
+		}
+	}
+
+	plan := func(query string) models.RebalancePlan {
+		t.Helper()
+		resp := get(query)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("rebalance %s: %d %s", query, resp.Code, resp.Body.String())
+		}
+		var p models.RebalancePlan
+		_ = json.NewDecoder(resp.Body).Decode(&p)
+		return p
+	}
+
+	// 2000 AAPL, 3000 BTC and 1000 cash against 50/40/10: sell 600 of BTC
+	// and buy 1000 of AAPL, leaving 600 in cash.
+	full := plan("")
+	if !full.DryRun || full.TotalValue != 6000 || len(full.Trades) != 2 || full.CashAfter != 600 {
+		t.Fatalf("unexpected plan: %+v", full)
+	}
+	if sell := full.Trades[0]; sell.Side != models.TxSell || sell.Ticker != "BTC" || sell.Quantity != 0.06 || sell.Value != 600 {
+		t.Fatalf("unexpected sell: %+v", sell)
+	}
+	if buy := full.Trades[1]; buy.Side != models.TxBuy || buy.Ticker != "AAPL" || buy.Quantity != 5 || buy.Value != 1000 {
+		t.Fatalf("unexpected buy: %+v", buy)
+	}
+	for _, d := range full.After {
+		if d.DriftPct != 0 {
+			t.Fatalf("expected the plan to reach every target, got %+v", full.After)
+		}
+	}
+
+	// Without sells only 1100 - 610 kept back is left for AAPL's 1050
+	// shortfall, so whole shares stop at 2 and fractional ones at 2.45.
+	noSells := plan("?contributionsOnly=true&contribution=100")
+	if len(noSells.Trades) != 1 || noSells.Trades[0].Quantity != 2 || len(noSells.Warnings) != 1 {
+		t.Fatalf("unexpected contributions-only plan: %+v", noSells)
+	}
+	fractional := plan("?contributionsOnly=true&contribution=100&fractional=stock,crypto")
+	if len(fractional.Trades) != 1 || fractional.Trades[0].Quantity != 2.45 || fractional.CashAfter != 610 {
+		t.Fatalf("unexpected fractional plan: %+v", fractional)
+	}
+
+	// With 1000 more, BTC is only 200 over and that sell is too small; the
+	// AAPL buy then has 2000 - 700 kept back to spend.
+	if small := plan("?minTrade=700&contribution=1000"); len(small.Trades) != 1 || small.Trades[0].Side != models.TxBuy || small.Trades[0].Quantity != 6 {
+		t.Fatalf("expected the small sell dropped and the buy limited to cash, got %+v", small)
+	}
+}
+
+func TestTaxLossHarvestReport(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	now := time.Now().UTC()
+	for _, buy := range []struct {
+		quantity, price float64
+		at              time.Time
+	}{
+		{10, 250, now.AddDate(-2, 0, 0)},
+		{2, 150, now.AddDate(0, 0, -60)},
+		{5, 220, now.AddDate(0, 0, -10)},
+	} {
+		body, _ := json.Marshal(map[string]any{"ticker": "AAPL", "assetType": "stock", "type": "buy",
+			"quantity": buy.quantity, "price": buy.price, "executedAt": buy.at.Format(time.RFC3339)})
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/transactions", bytes.NewReader(body)))
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("buy: %d %s", resp.Code, resp.Body.String())
+		}
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/reports/tax-loss-harvest"+query, nil))
+		return resp
+	}
+	if resp := get("?format=xml"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown format, got %d", resp.Code)
+	}
+
+	// At 200, the 250 lot is 500 down long term and the 220 lot 100 down
+	// short term; the 150 lot is a gain. The recent buy makes selling the
+	// old lot a wash sale.
+	resp := get("")
+	var report models.HarvestReport
+	_ = json.NewDecoder(resp.Body).Decode(&report)
+	if resp.Code != http.StatusOK || len(report.Lots) != 2 || report.TotalLoss != -600 || report.EstimatedSavings != 137 {
+		t.Fatalf("unexpected report: %d %+v", resp.Code, report)
+	}
+	old, recent := report.Lots[0], report.Lots[1]
+	if old.Term != models.TermLong || old.Loss != -500 || old.EstimatedSavings != 100 || !old.WashSale || old.LastBuyAt == nil {
+		t.Fatalf("unexpected long-term lot: %+v", old)
+	}
+	if recent.Term != models.TermShort || recent.Loss != -100 || recent.EstimatedSavings != 37 || recent.WashSale || recent.DaysHeld != 10 {
+		t.Fatalf("unexpected short-term lot: %+v", recent)
+	}
+	if missing := get("?portfolioId=99"); missing.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown portfolio, got %d %s", missing.Code, missing.Body.String())
+	}
+
+	resp = get("?format=csv")
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil || resp.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("read csv: %v %q", err, resp.Header().Get("Content-Type"))
+	}
+	if len(rows) != 3 || rows[0][3] != "ticker" || rows[1][8] != "long" || rows[1][14] != "-500" || rows[1][16] != "true" {
+		t.Fatalf("unexpected csv: %v", rows)
+	}
+}
+
+func TestAlertWebhookDeliveries(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	received := make(chan notify.Event, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev notify.Event
+		_ = json.NewDecoder(r.Body).Decode(&ev)
+		received <- ev
+	}))
+	defer receiver.Close()
+	hook, err := notify.NewWebhook(notify.WebhookConfig{Name: "ops", URL: receiver.URL}, receiver.Client())
+	if err != nil {
+		t.Fatalf("new webhook: %v", err)
+	}
+	dispatcher := notify.NewDispatcher(server.store, []notify.Channel{hook}, notify.WithRetry(1, time.Millisecond))
+	server.notifier = dispatcher
+
+	ctx := context.Background()
+	alert, err := server.store.CreateAlert(ctx, models.PriceAlert{Ticker: "AAPL", AssetType: models.AssetStock, Direction: models.AlertAbove, Threshold: 150})
+	if err != nil {
+		t.Fatalf("create alert: %v", err)
+	}
+	if _, err := server.BuildSnapshot(ctx); err != nil {
+		t.Fatalf("build snapshot: %v", err)
+	}
+	dispatcher.Wait()
+	if ev := <-received; ev.Type != notify.EventAlertFired || ev.Alert == nil || ev.Alert.ID != alert.ID || ev.Alert.FireCount != 1 {
+		t.Fatalf("unexpected webhook event: %+v", ev)
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/notifications/deliveries"+query, nil))
+		return resp
+	}
+	resp := get("?alertId=" + itoa(alert.ID) + "&status=delivered")
+	var deliveries []models.NotificationDelivery
+	_ = json.NewDecoder(resp.Body).Decode(&deliveries)
+	if resp.Code != http.StatusOK || len(deliveries) != 1 || deliveries[0].Channel != "ops" || deliveries[0].ResponseCode != http.StatusOK {
+		t.Fatalf("unexpected deliveries: %d %+v", resp.Code, deliveries)
+	}
+	if resp := get("?status=failed"); resp.Body.String() != "[]\n" {
+		t.Fatalf("expected no failed deliveries, got %s", resp.Body.String())
+	}
+	if resp := get("?status=lost"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown status, got %d", resp.Code)
+	}
+}
+
+type recordingNotifier struct {
+	events []notify.Event
+}
+
+func (r *recordingNotifier) Notify(ev notify.Event) { r.events = append(r.events, ev) }
+
+func TestDailyDigest(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+	notifier := &recordingNotifier{}
+	server.notifier = notifier
+
+	ctx := context.Background()
+	if _, err := server.store.CreateHolding(ctx, models.Holding{Ticker: "AAPL", AssetType: models.AssetStock, Quantity: 10, AvgCost: 150}); err != nil {
+		t.Fatalf("create holding: %v", err)
+	}
+	at := time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC)
+	if err := server.sendDigest(ctx, at); err != nil {
+		t.Fatalf("send digest: %v", err)
+	}
+	if len(notifier.events) != 1 {
+		t.Fatalf("expected one event, got %+v", notifier.events)
+	}
+	ev := notifier.events[0]
+	if ev.Type != notify.EventDigest || !ev.At.Equal(at) || ev.Snapshot == nil || ev.Snapshot.TotalValue != 2000 || ev.Snapshot.TotalPnL != 500 {
+		t.Fatalf("unexpected digest: %+v", ev)
+	}
+}
+
+func TestChannelsRouteAlerts(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	receiver := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		hits[r.URL.Path]++
+	}))
+	defer receiver.Close()
+
+	do := func(method, path string, payload any) *httptest.ResponseRecorder {
+		t.Helper()
+		var body bytes.Buffer
+		if payload != nil {
+			_ = json.NewEncoder(&body).Encode(payload)
+		}
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(method, path, &body))
+		return resp
+	}
+
+	resp := do(http.MethodPost, "/api/channels", map[string]any{
+		"name": "stocks", "type": "slack", "url": receiver.URL + "/stocks",
+		"rules": []map[string]any{{"assetType": "stock", "minSeverity": "warning"}},
+	})
+	var stocks models.NotificationChannel
+	_ = json.NewDecoder(resp.Body).Decode(&stocks)
+	if resp.Code != http.StatusCreated || len(stocks.Rules) != 1 || stocks.Rules[0].MinSeverity != models.SeverityWarning {
+		t.Fatalf("unexpected channel: %d %+v", resp.Code, stocks)
+	}
+	if resp := do(http.MethodPost, "/api/channels", map[string]any{"name": "crypto", "type": "ntfy", "url": receiver.URL + "/crypto",
+		"rules": []map[string]any{{"assetType": "crypto"}}}); resp.Code != http.StatusCreated {
+		t.Fatalf("create crypto channel: %d %s", resp.Code, resp.Body.String())
+	}
+	for _, bad := range []map[string]any{
+		{"name": "", "url": receiver.URL},
+		{"name": "tg", "type": "telegram", "url": receiver.URL},
+		{"name": "x", "url": "ftp://example.com"},
+		{"name": "x", "url": receiver.URL, "rules": []map[string]any{{"minSeverity": "meh"}}},
+	} {
+		if resp := do(http.MethodPost, "/api/channels", bad); resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %v, got %d", bad, resp.Code)
+		}
+	}
+	// Secrets and header values never come back out.
+	resp = do(http.MethodPost, "/api/channels", map[string]any{"name": "signed", "url": receiver.URL + "/signed",
+		"secret": "s3cret", "headers": map[string]string{"Authorization": "Bearer t0ken"}, "rules": []map[string]any{{"ticker": "NONE"}}})
+	var signed models.NotificationChannel
+	_ = json.NewDecoder(resp.Body).Decode(&signed)
+	if resp.Code != http.StatusCreated || strings.Contains(resp.Body.String(), "s3cret") || strings.Contains(resp.Body.String(), "t0ken") || !signed.HasSecret {
+		t.Fatalf("expected a redacted channel, got %d %s", resp.Code, resp.Body.String())
+	}
+	// Sending the redacted channel back keeps the secret and headers.
+	signed.Name = "signed2"
+	if resp := do(http.MethodPut, "/api/channels/"+itoa(signed.ID), signed); resp.Code != http.StatusOK || strings.Contains(resp.Body.String(), "t0ken") {
+		t.Fatalf("update signed channel: %d %s", resp.Code, resp.Body.String())
+	}
+	if stored, err := server.store.GetChannel(context.Background(), signed.ID); err != nil || stored.Secret != "s3cret" || stored.Headers["Authorization"] != "Bearer t0ken" {
+		t.Fatalf("expected the secret and headers kept, got %+v %v", stored, err)
+	}
+	if resp := do(http.MethodGet, "/api/channels", nil); strings.Contains(resp.Body.String(), "s3cret") || strings.Contains(resp.Body.String(), "t0ken") {
+		t.Fatalf("expected listed channels redacted, got %s", resp.Body.String())
+	}
+	if resp := do(http.MethodDelete, "/api/channels/"+itoa(signed.ID), nil); resp.Code != http.StatusNoContent {
+		t.Fatalf("delete signed channel: %d", resp.Code)
+	}
+	if resp := do(http.MethodPost, "/api/channels", map[string]any{"name": "stocks", "url": receiver.URL}); resp.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a duplicate name, got %d", resp.Code)
+	}
+	if resp := do(http.MethodPut, "/api/channels/999", map[string]any{"name": "gone", "url": receiver.URL}); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing channel, got %d", resp.Code)
+	}
+
+	dispatcher := notify.NewDispatcher(server.store, nil,
+		notify.WithRouter(notify.NewStoredChannels(server.store, receiver.Client())), notify.WithRetry(1, time.Millisecond))
+	server.notifier = dispatcher
+	if resp := do(http.MethodPost, "/api/alerts", map[string]any{"ticker": "AAPL", "assetType": "stock", "direction": "above", "threshold": 150, "severity": "loud"}); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown severity, got %d", resp.Code)
+	}
+	// An info alert misses the stocks channel's minimum severity; a
+	// critical one reaches it.
+	for _, severity := range []string{"info", "critical"} {
+		resp := do(http.MethodPost, "/api/alerts", map[string]any{"ticker": "AAPL", "assetType": "stock", "direction": "above", "threshold": 150, "severity": severity})
+		var alert models.PriceAlert
+		_ = json.NewDecoder(resp.Body).Decode(&alert)
+		if resp.Code != http.StatusCreated || string(alert.Severity) != severity {
+			t.Fatalf("unexpected alert: %d %+v", resp.Code, alert)
+		}
+	}
+	dispatcher.Wait()
+	if hits["/stocks"] != 1 || hits["/crypto"] != 0 {
+		t.Fatalf("unexpected routing: %v", hits)
+	}
+
+	// An alert naming a channel goes there, whatever the rules say.
+	if resp := do(http.MethodPost, "/api/alerts", map[string]any{"ticker": "AAPL", "assetType": "stock", "direction": "above", "threshold": 150, "channels": []string{"nope"}}); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown channel, got %d", resp.Code)
+	}
+	resp = do(http.MethodPost, "/api/alerts", map[string]any{"ticker": "AAPL", "assetType": "stock", "direction": "above", "threshold": 150,
+		"severity": "critical", "channels": []string{"crypto"}})
+	var named models.PriceAlert
+	_ = json.NewDecoder(resp.Body).Decode(&named)
+	if resp.Code != http.StatusCreated || len(named.Channels) != 1 || named.Channels[0] != "crypto" {
+		t.Fatalf("unexpected alert: %d %+v", resp.Code, named)
+	}
+	dispatcher.Wait()
+	if hits["/stocks"] != 1 || hits["/crypto"] != 1 {
+		t.Fatalf("expected the named channel only, got %v", hits)
+	}
+
+	// Without rules a channel takes every alert.
+	if resp := do(http.MethodPut, "/api/channels/"+itoa(stocks.ID), map[string]any{"name": "everything", "type": "discord", "url": receiver.URL + "/stocks"}); resp.Code != http.StatusOK {
+		t.Fatalf("update channel: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := do(http.MethodDelete, "/api/channels/"+itoa(stocks.ID), nil); resp.Code != http.StatusNoContent {
+		t.Fatalf("delete channel: %d", resp.Code)
+	}
+	var channels []models.NotificationChannel
+	_ = json.NewDecoder(do(http.MethodGet, "/api/channels", nil).Body).Decode(&channels)
+	if len(channels) != 1 || channels[0].Name != "crypto" || channels[0].Type != models.ChannelNtfy {
+		t.Fatalf("unexpected channels: %+v", channels)
+	}
+}
+
+func TestAlertEventAcknowledgement(t *testing.T) {
+	server, sqlDB := setupServer(t)
+	defer sqlDB.Close()
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+	hook, err := notify.NewWebhook(notify.WebhookConfig{Name: "ops", URL: receiver.URL}, receiver.Client())
+	if err != nil {
+		t.Fatalf("new webhook: %v", err)
+	}
+	dispatcher := notify.NewDispatcher(server.store, []notify.Channel{hook}, notify.WithRetry(1, time.Millisecond))
+	server.notifier = dispatcher
+
+	ctx := context.Background()
+	if _, err := server.store.CreateHolding(ctx, models.Holding{Ticker: "AAPL", AssetType: models.AssetStock, Quantity: 10, AvgCost: 150}); err != nil {
+		t.Fatalf("create holding: %v", err)
+	}
+	alert, err := server.store.CreateAlert(ctx, models.PriceAlert{
+		Ticker: "AAPL", AssetType: models.AssetStock, Direction: models.AlertAbove, Threshold: 150, Mode: models.AlertCooldown, CooldownMinutes: 1,
+	})
+	if err != nil {
+		t.Fatalf("create alert: %v", err)
+	}
+	snap, err := server.BuildSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("build snapshot: %v", err)
+	}
+	dispatcher.Wait()
+	if len(snap.AlertsFired) != 1 || snap.AlertsFired[0].EventID == 0 {
+		t.Fatalf("expected the alert to fire with its event, got %+v", snap.AlertsFired)
+	}
+	eventID := snap.AlertsFired[0].EventID
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		return resp
+	}
+	resp := do(http.MethodGet, "/api/alert-events?unacknowledged=true", "")
+	var events []models.AlertEvent
+	_ = json.NewDecoder(resp.Body).Decode(&events)
+	if resp.Code != http.StatusOK || len(events) != 1 || events[0].ID != eventID || events[0].AlertID != alert.ID {
+		t.Fatalf("unexpected unacknowledged events: %d %+v", resp.Code, events)
+	}
+	ev := events[0]
+	if ev.Price != 200 || ev.TotalValue != 2000 || ev.PortfolioID != 1 || len(ev.Deliveries) != 1 ||
+		ev.Deliveries[0].Status != models.DeliveryDelivered || ev.Deliveries[0].EventID != eventID {
+		t.Fatalf("expected the observed price, value and delivery, got %+v", ev)
+	}
+
+	// A client connecting now is told about the firing it missed.
+	ws := httptest.NewServer(server.Handler())
+	defer ws.Close()
+	readFirst := func() models.PortfolioSnapshot {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ws.URL, "http")+"/ws", nil)
+		if err != nil {
+			t.Fatalf("dial websocket: %v", err)
+		}
+		defer conn.Close()
+		var first models.PortfolioSnapshot
+		if err := conn.ReadJSON(&first); err != nil {
+			t.Fatalf("read websocket: %v", err)
+		}
+		return first
+	}
+	if first := readFirst(); len(first.UnacknowledgedEvents) != 1 || first.UnacknowledgedEvents[0].ID != eventID {
+		t.Fatalf("expected the unacknowledged event on connect, got %+v", first.UnacknowledgedEvents)
+	}
+
+	if resp := do(http.MethodPut, "/api/alert-events/"+itoa(eventID)+"/note", `{"note": "trimmed the position"}`); resp.Code != http.StatusOK ||
+		!strings.Contains(resp.Body.String(), `"note":"trimmed the position"`) {
+		t.Fatalf("set note: %d %s", resp.Code, resp.Body.String())
+	}
+	resp = do(http.MethodPost, "/api/alert-events/"+itoa(eventID)+"/ack", "")
+	var acked models.AlertEvent
+	_ = json.NewDecoder(resp.Body).Decode(&acked)
+	if resp.Code != http.StatusOK || acked.AcknowledgedAt == nil || acked.Note != "trimmed the position" {
+		t.Fatalf("acknowledge: %d %+v", resp.Code, acked)
+	}
+	if resp := do(http.MethodGet, "/api/alert-events?unacknowledged=true", ""); resp.Body.String() != "[]\n" {
+		t.Fatalf("expected no unacknowledged events, got %s", resp.Body.String())
+	}
+	if first := readFirst(); len(first.UnacknowledgedEvents) != 0 {
+		t.Fatalf("expected nothing missed after acknowledging, got %+v", first.UnacknowledgedEvents)
+	}
+
+	for _, bad := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{http.MethodPost, "/api/alert-events/999/ack", "", http.StatusNotFound},
+		{http.MethodGet, "/api/alert-events/999", "", http.StatusNotFound},
+		{http.MethodPut, "/api/alert-events/" + itoa(eventID) + "/note", `{"note": ` + strconv.Quote(strings.Repeat("x", 2001)) + `}`, http.StatusBadRequest},
+		{http.MethodGet, "/api/alert-events?unacknowledged=maybe", "", http.StatusBadRequest},
+	} {
+		if resp := do(bad.method, bad.path, bad.body); resp.Code != bad.code {
+			t.Fatalf("expected %d for %s %s, got %d", bad.code, bad.method, bad.path, resp.Code)
+		}
+	}
 }
 
 func itoa(v int64) string {
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"portfoliopulse/internal/models"
+)
+
+// targetsRequest replaces a portfolio's target weights.
+type targetsRequest []models.AllocationTarget
+
+func (req targetsRequest) validate() string {
+	seen := make(map[string]bool, len(req))
+	sums := make(map[models.TargetBucket]float64)
+	for _, t := range req {
+		key := strings.TrimSpace(t.Key)
+		switch t.Bucket {
+		case models.BucketTicker:
+			if t.AssetType != models.AssetStock && t.AssetType != models.AssetCrypto {
+				return "ticker targets need assetType stock or crypto"
+			}
+			key = strings.ToUpper(key)
+		case models.BucketAssetType:
+			if t.AssetType != "" {
+				return "asset_type targets take the type as key, not assetType"
+			}
+			switch models.AssetType(key) {
+			case models.AssetStock, models.AssetCrypto, models.AssetCash:
+			default:
+				return "asset_type target keys must be stock, crypto or cash"
+			}
+		case models.BucketTag:
+			if t.AssetType != "" {
+				return "tag targets take no assetType"
+			}
+			key = strings.ToLower(key)
+		default:
+			return "bucket must be ticker, asset_type or tag"
+		}
+		if key == "" {
+			return "every target needs a key"
+		}
+		if t.WeightPct < 0 || t.WeightPct > 100 {
+			return "weightPct must be between 0 and 100"
+		}
+		id := fmt.Sprintf("%s:%s:%s", t.Bucket, t.AssetType, key)
+		if seen[id] {
+			return fmt.Sprintf("duplicate target %s %s", t.Bucket, key)
+		}
+		seen[id] = true
+		sums[t.Bucket] += t.WeightPct
+	}
+	for bucket, sum := range sums {
+		if sum > 100+1e-9 {
+			return fmt.Sprintf("%s targets add up to more than 100%%", bucket)
+		}
+	}
+	return ""
+}
+
+func (s *Server) handleListTargets(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.portfolioScope(w, r)
+	if !ok {
+		return
+	}
+	targets, err := s.store.ListAllocationTargets(r.Context(), pid)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, targets)
+}
+
+func (s *Server) handleSetTargets(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.portfolioScope(w, r)
+	if !ok {
+		return
+	}
+	var req targetsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return
+	}
+
+	targets, err := s.store.SetAllocationTargets(r.Context(), pid, req)
+	if err != nil {
+		writePortfolioError(w, err)
+		return
+	}
+
+	_ = s.RefreshAndBroadcast(context.Background())
+	writeJSON(w, http.StatusOK, targets)
+}
+
+// handleDrift compares each of a portfolio's targets with its current
+// weight.
+func (s *Server) handleDrift(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.portfolioScope(w, r)
+	if !ok {
+		return
+	}
+	targets, err := s.store.ListAllocationTargets(r.Context(), pid)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	snap, err := s.valuePortfolio(r.Context(), s.market.Snapshot())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, allocationDrift(snap, pid, targets))
+}
+
+func (s *Server) handleSetHoldingTags(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	h, err := s.store.SetHoldingTags(r.Context(), id, req.Tags)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "holding not found"})
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	_ = s.RefreshAndBroadcast(context.Background())
+	writeJSON(w, http.StatusOK, h)
+}
+
+// allocationDrift measures each target against portfolio pid's share of
+// the combined snapshot.
+func allocationDrift(snap models.PortfolioSnapshot, pid int64, targets []models.AllocationTarget) []models.AllocationDrift {
+	return driftOf(scopeSnapshot(snap, pid), targets)
+}
+
+// driftOf measures each target against a snapshot already scoped to one
+// portfolio. A holding with several tags counts toward each of them, and
+// cash only toward the cash asset type.
+func driftOf(scoped models.PortfolioSnapshot, targets []models.AllocationTarget) []models.AllocationDrift {
+	out := make([]models.AllocationDrift, 0, len(targets))
+	for _, t := range targets {
+		value := 0.0
+		for _, h := range scoped.Holdings {
+			if inBucket(h, t) {
+				value += h.MarketValue
+			}
+		}
+		if t.Bucket == models.BucketAssetType && models.AssetType(t.Key) == models.AssetCash {
+			for _, c := range scoped.Cash {
+				value += c.Value
+			}
+		}
+		current := 0.0
+		if scoped.TotalValue > 0 {
+			current = value / scoped.TotalValue * 100
+		}
+		out = append(out, models.AllocationDrift{
+			Bucket:     t.Bucket,
+			AssetType:  t.AssetType,
+			Key:        t.Key,
+			TargetPct:  t.WeightPct,
+			CurrentPct: round2(current),
+			DriftPct:   round2(current - t.WeightPct),
+			Value:      round2(value),
+		})
+	}
+	return out
+}
+
+func inBucket(h models.HoldingWithPrice, t models.AllocationTarget) bool {
+	switch t.Bucket {
+	case models.BucketTicker:
+		return h.AssetType == t.AssetType && h.Ticker == t.Key
+	case models.BucketAssetType:
+		return string(h.AssetType) == t.Key
+	case models.BucketTag:
+		for _, tag := range h.Tags {
+			if tag == t.Key {
+				return true
+			}
+		}
+	}
+	return false
+}
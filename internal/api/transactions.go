@@ -0,0 +1,412 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"portfoliopulse/internal/ledger"
+	"portfoliopulse/internal/models"
+	"portfoliopulse/internal/store"
+)
+
+type transactionRequest struct {
+	PortfolioID int64                  `json:"portfolioId"`
+	HoldingID   int64                  `json:"holdingId"`
+	Ticker      string                 `json:"ticker"`
+	AssetType   models.AssetType       `json:"assetType"`
+	Currency    string                 `json:"currency"`
+	Type        models.TransactionType `json:"type"`
+	Quantity    float64                `json:"quantity"`
+	Price       float64                `json:"price"`
+	Fee         float64                `json:"fee"`
+	FXRate      float64                `json:"fxRate"`
+	CostMethod  models.CostMethod      `json:"costMethod"`
+	Lots        []models.LotSelection  `json:"lots"`
+	SettleCash  *bool                  `json:"settleCash"`
+	ExecutedAt  *time.Time             `json:"executedAt"`
+	Note        string                 `json:"note"`
+}
+
+func (req transactionRequest) validate() string {
+	switch req.Type {
+	case models.TxBuy, models.TxSell, models.TxTransferIn, models.TxTransferOut:
+		if req.Quantity <= 0 || req.Price < 0 || req.Fee < 0 {
+			return "quantity must be positive and price/fee non-negative"
+		}
+	case models.TxFee:
+		if req.Fee <= 0 || req.Quantity != 0 {
+			return "fee transactions need a positive fee and no quantity"
+		}
+	default:
+		return "type must be buy, sell, fee, transfer_in or transfer_out"
+	}
+
+	if req.FXRate < 0 {
+		return "fxRate must be positive when given"
+	}
+	if !validCurrency(req.Currency) {
+		return "currency must be a 3-letter ISO code"
+	}
+
+	closes := req.Type == models.TxSell || req.Type == models.TxTransferOut
+	if !closes && (req.CostMethod != "" || len(req.Lots) > 0) {
+		return "costMethod and lots only apply to sell and transfer_out"
+	}
+	if req.CostMethod != "" && !ledger.ValidMethod(req.CostMethod) {
+		return "costMethod must be fifo, lifo, hifo, average or specific"
+	}
+	if len(req.Lots) > 0 && req.CostMethod != "" && req.CostMethod != models.CostSpecific {
+		return "lots can only be given with costMethod specific"
+	}
+	if req.CostMethod == models.CostSpecific && len(req.Lots) == 0 {
+		return "costMethod specific requires lots"
+	}
+	return ""
+}
+
+func (req transactionRequest) toModel() models.Transaction {
+	tx := models.Transaction{
+		PortfolioID: req.PortfolioID,
+		HoldingID:   req.HoldingID,
+		Ticker:      strings.ToUpper(strings.TrimSpace(req.Ticker)),
+		AssetType:   req.AssetType,
+		Currency:    strings.ToUpper(req.Currency),
+		Type:        req.Type,
+		Quantity:    req.Quantity,
+		Price:       req.Price,
+		Fee:         req.Fee,
+		FXRate:      req.FXRate,
+		CostMethod:  req.CostMethod,
+		Lots:        req.Lots,
+		Note:        strings.TrimSpace(req.Note),
+	}
+	if len(tx.Lots) > 0 {
+		tx.CostMethod = models.CostSpecific
+	}
+	if req.ExecutedAt != nil {
+		tx.ExecutedAt = req.ExecutedAt.UTC()
+	}
+	return tx
+}
+
+func (s *Server) handleListTransactions(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.portfolioScope(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	filter := store.TransactionFilter{
+		PortfolioID: pid,
+		Ticker:      q.Get("ticker"),
+		AssetType:   models.AssetType(q.Get("assetType")),
+	}
+	if raw := q.Get("holdingId"); raw != "" {
+		id, err := parseID(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		filter.HoldingID = id
+	}
+	if raw := q.Get("portfolioId"); raw != "" && pid == 0 {
+		id, err := parseID(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		filter.PortfolioID = id
+	}
+
+	txs, err := s.store.ListTransactions(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, txs)
+}
+
+func (s *Server) handleGetTransaction(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	tx, err := s.store.GetTransaction(r.Context(), id)
+	if err != nil {
+		writeTransactionError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tx)
+}
+
+func (s *Server) handleCreateTransaction(w http.ResponseWriter, r *http.Request) {
+	pid, ok := s.portfolioScope(w, r)
+	if !ok {
+		return
+	}
+	var req transactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if pid != 0 {
+		req.PortfolioID = pid
+	}
+
+	if msg := req.validate(); msg != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return
+	}
+	if req.HoldingID == 0 {
+		if strings.TrimSpace(req.Ticker) == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "holdingId or ticker is required"})
+			return
+		}
+		if req.AssetType != models.AssetStock && req.AssetType != models.AssetCrypto {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "assetType must be stock or crypto"})
+			return
+		}
+	}
+
+	tx := s.withFXRate(r.Context(), s.withCostMethod(req.toModel()))
+	created, err := s.store.CreateTransaction(r.Context(), s.withCashSettlement(r.Context(), tx, req.SettleCash))
+	if err != nil {
+		writeTransactionError(w, err)
+		return
+	}
+
+	_ = s.RefreshAndBroadcast(context.Background())
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (s *Server) handleUpdateTransaction(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	existing, err := s.store.GetTransaction(r.Context(), id)
+	if err != nil {
+		writeTransactionError(w, err)
+		return
+	}
+	if !editableTransaction(w, existing) {
+		return
+	}
+	var req transactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+		return
+	}
+
+	tx := s.withCostMethod(req.toModel())
+	tx.ID = id
+	if req.ExecutedAt == nil {
+		tx.ExecutedAt = existing.ExecutedAt
+	}
+	if tx.FXRate == 0 {
+		tx.FXRate = existing.FXRate
+	}
+	tx.CashSettled = existing.CashSettled
+	if req.SettleCash != nil {
+		tx.CashSettled = *req.SettleCash
+	}
+	updated, err := s.store.UpdateTransaction(r.Context(), tx)
+	if err != nil {
+		writeTransactionError(w, err)
+		return
+	}
+
+	_ = s.RefreshAndBroadcast(context.Background())
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (s *Server) handleDeleteTransaction(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	existing, err := s.store.GetTransaction(r.Context(), id)
+	if err != nil {
+		writeTransactionError(w, err)
+		return
+	}
+	if !editableTransaction(w, existing) {
+		return
+	}
+	if err := s.store.DeleteTransaction(r.Context(), id); err != nil {
+		writeTransactionError(w, err)
+		return
+	}
+
+	_ = s.RefreshAndBroadcast(context.Background())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// editableTransaction answers 409 for the entries corporate actions book,
+// whose audit trail an edit or delete would no longer match.
+func editableTransaction(w http.ResponseWriter, tx models.Transaction) bool {
+	if tx.Type == models.TxSpinOff || tx.Type == models.TxCostAdjust {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "transactions booked by a corporate action cannot be edited or deleted"})
+		return false
+	}
+	return true
+}
+
+// withCostMethod stamps the configured default onto sells that did not pick
+// a method, so changing the default later never rewrites past gains.
+func (s *Server) withCostMethod(tx models.Transaction) models.Transaction {
+	if (tx.Type == models.TxSell || tx.Type == models.TxTransferOut) && tx.CostMethod == "" {
+		tx.CostMethod = s.costMethod
+	}
+	return tx
+}
+
+// withFXRate records today's rate on a new transaction that did not give
+// one, so its cost keeps the exchange rate it was bought at.
+func (s *Server) withFXRate(ctx context.Context, tx models.Transaction) models.Transaction {
+	if tx.FXRate != 0 {
+		return tx
+	}
+	currency := tx.Currency
+	if tx.HoldingID != 0 {
+		h, err := s.store.GetHolding(ctx, tx.HoldingID)
+		if err != nil {
+			return tx
+		}
+		currency = h.Currency
+	} else if existing, ok := s.findHolding(ctx, tx.PortfolioID, tx.AssetType, tx.Ticker); ok {
+		currency = existing.Currency
+	}
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+	tx.FXRate = s.market.FXRates().Rates[currency]
+	return tx
+}
+
+func (s *Server) handleListLots(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	lots, err := s.store.ListLots(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "holding not found"})
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lots)
+}
+
+func (s *Server) handleRealized(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, err := parseTimeParam(q.Get("from"), false)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid from: " + err.Error()})
+		return
+	}
+	to, err := parseTimeParam(q.Get("to"), true)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid to: " + err.Error()})
+		return
+	}
+
+	pid, ok := s.incomePortfolio(w, r)
+	if !ok {
+		return
+	}
+
+	filter := store.TransactionFilter{
+		PortfolioID: pid,
+		Ticker:      q.Get("ticker"),
+		AssetType:   models.AssetType(q.Get("assetType")),
+		From:        from,
+		To:          to,
+	}
+
+	gains, err := s.store.ListRealizedGains(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	report := models.RealizedReport{Gains: make([]models.RealizedGain, 0, len(gains))}
+	if !from.IsZero() {
+		report.From = &from
+	}
+	if !to.IsZero() {
+		report.To = &to
+	}
+	for _, g := range gains {
+		report.TotalProceeds += g.Proceeds
+		report.TotalCost += g.CostBasis
+		report.TotalGain += g.Gain
+		g.Proceeds = round2(g.Proceeds)
+		g.CostBasis = round2(g.CostBasis)
+		g.Gain = round2(g.Gain)
+		report.Gains = append(report.Gains, g)
+	}
+	report.TotalProceeds = round2(report.TotalProceeds)
+	report.TotalCost = round2(report.TotalCost)
+	report.TotalGain = round2(report.TotalGain)
+	writeJSON(w, http.StatusOK, report)
+}
+
+// parseTimeParam accepts RFC 3339 or a bare YYYY-MM-DD date. A bare date
+// used as an upper bound covers the whole day.
+func parseTimeParam(raw string, endOfDay bool) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return time.Time{}, errors.New("expected RFC 3339 or YYYY-MM-DD")
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+func writeTransactionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "transaction, holding or portfolio not found"})
+	case errors.Is(err, ledger.ErrInsufficientQuantity):
+		writeError(w, http.StatusConflict, ledger.ErrInsufficientQuantity)
+	case errors.Is(err, ledger.ErrInvalidLotSelection):
+		writeError(w, http.StatusConflict, ledger.ErrInvalidLotSelection)
+	case errors.Is(err, store.ErrNoCashAccount):
+		writeError(w, http.StatusConflict, store.ErrNoCashAccount)
+	case errors.Is(err, ledger.ErrUnknownCostMethod):
+		writeError(w, http.StatusBadRequest, ledger.ErrUnknownCostMethod)
+	case errors.Is(err, store.ErrHoldingPortfolio):
+		writeError(w, http.StatusBadRequest, store.ErrHoldingPortfolio)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
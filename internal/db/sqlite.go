@@ -3,12 +3,13 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func Open(path string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", path)
+	db, err := sql.Open("sqlite3", withForeignKeys(path))
 	if err != nil {
 		return nil, fmt.Errorf("open sqlite: %w", err)
 	}
@@ -24,12 +25,32 @@ func Open(path string) (*sql.DB, error) {
 	return db, nil
 }
 
+// withForeignKeys enables FK enforcement on every pooled connection so
+// ON DELETE CASCADE clauses actually fire.
+func withForeignKeys(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "_foreign_keys=on"
+}
+
 func migrate(db *sql.DB) error {
 	schema := `
+	CREATE TABLE IF NOT EXISTS portfolios (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	INSERT OR IGNORE INTO portfolios(id, name) VALUES (1, 'Default');
+
 	CREATE TABLE IF NOT EXISTS holdings (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		portfolio_id INTEGER NOT NULL DEFAULT 1,
 		ticker TEXT NOT NULL,
 		asset_type TEXT NOT NULL,
+		currency TEXT NOT NULL DEFAULT 'USD',
 		quantity REAL NOT NULL,
 		avg_cost REAL NOT NULL,
 		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
@@ -37,18 +58,363 @@ func migrate(db *sql.DB) error {
 
 	CREATE TABLE IF NOT EXISTS price_alerts (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		portfolio_id INTEGER NOT NULL DEFAULT 1,
+		scope TEXT NOT NULL DEFAULT 'ticker',
 		ticker TEXT NOT NULL,
 		asset_type TEXT NOT NULL,
+		kind TEXT NOT NULL DEFAULT 'price',
 		direction TEXT NOT NULL,
 		threshold REAL NOT NULL,
+		window_minutes INTEGER NOT NULL DEFAULT 0,
+		trail TEXT NOT NULL DEFAULT '',
+		high_water REAL NOT NULL DEFAULT 0,
+		high_water_at DATETIME,
+		mode TEXT NOT NULL DEFAULT 'once',
+		hysteresis REAL NOT NULL DEFAULT 0,
+		cooldown_minutes INTEGER NOT NULL DEFAULT 0,
+		severity TEXT NOT NULL DEFAULT 'info',
+		expression TEXT NOT NULL DEFAULT '',
 		triggered INTEGER NOT NULL DEFAULT 0,
 		triggered_at DATETIME,
 		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 	);
+
+	CREATE TABLE IF NOT EXISTS holding_tags (
+		holding_id INTEGER NOT NULL REFERENCES holdings(id) ON DELETE CASCADE,
+		tag TEXT NOT NULL,
+		PRIMARY KEY (holding_id, tag)
+	);
+
+	CREATE TABLE IF NOT EXISTS allocation_targets (
+		portfolio_id INTEGER NOT NULL REFERENCES portfolios(id) ON DELETE CASCADE,
+		bucket TEXT NOT NULL,
+		asset_type TEXT NOT NULL DEFAULT '',
+		key TEXT NOT NULL,
+		weight_pct REAL NOT NULL,
+		PRIMARY KEY (portfolio_id, bucket, asset_type, key)
+	);
+
+	CREATE TABLE IF NOT EXISTS alert_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		alert_id INTEGER NOT NULL REFERENCES price_alerts(id) ON DELETE CASCADE,
+		fired_at DATETIME NOT NULL,
+		price REAL NOT NULL DEFAULT 0,
+		total_value REAL NOT NULL DEFAULT 0,
+		note TEXT NOT NULL DEFAULT '',
+		acknowledged_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_alert_events_alert ON alert_events(alert_id, fired_at);
+
+	CREATE TABLE IF NOT EXISTS notification_channels (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		type TEXT NOT NULL,
+		url TEXT NOT NULL,
+		chat_id TEXT NOT NULL DEFAULT '',
+		secret TEXT NOT NULL DEFAULT '',
+		template TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS channel_headers (
+		channel_id INTEGER NOT NULL REFERENCES notification_channels(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (channel_id, name)
+	);
+
+	CREATE TABLE IF NOT EXISTS alert_channels (
+		alert_id INTEGER NOT NULL REFERENCES price_alerts(id) ON DELETE CASCADE,
+		channel_id INTEGER NOT NULL REFERENCES notification_channels(id) ON DELETE CASCADE,
+		PRIMARY KEY (alert_id, channel_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS channel_rules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		channel_id INTEGER NOT NULL REFERENCES notification_channels(id) ON DELETE CASCADE,
+		ticker TEXT NOT NULL DEFAULT '',
+		asset_type TEXT NOT NULL DEFAULT '',
+		min_severity TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE TABLE IF NOT EXISTS notification_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		channel TEXT NOT NULL,
+		channel_type TEXT NOT NULL,
+		event TEXT NOT NULL,
+		alert_id INTEGER NOT NULL DEFAULT 0,
+		event_id INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		response_code INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		delivered_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_notification_deliveries_alert ON notification_deliveries(alert_id);
+
+	CREATE TABLE IF NOT EXISTS transactions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		holding_id INTEGER NOT NULL REFERENCES holdings(id) ON DELETE CASCADE,
+		type TEXT NOT NULL,
+		quantity REAL NOT NULL DEFAULT 0,
+		price REAL NOT NULL DEFAULT 0,
+		fee REAL NOT NULL DEFAULT 0,
+		fx_rate REAL NOT NULL DEFAULT 0,
+		cost_method TEXT NOT NULL DEFAULT '',
+		cash_settled INTEGER NOT NULL DEFAULT 0,
+		executed_at DATETIME NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_transactions_holding ON transactions(holding_id, executed_at);
+
+	CREATE TABLE IF NOT EXISTS transaction_lots (
+		transaction_id INTEGER NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+		lot_id INTEGER NOT NULL,
+		quantity REAL NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_transaction_lots_tx ON transaction_lots(transaction_id);
+
+	CREATE TABLE IF NOT EXISTS cash_accounts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		portfolio_id INTEGER NOT NULL,
+		currency TEXT NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(portfolio_id, currency)
+	);
+
+	CREATE TABLE IF NOT EXISTS cash_movements (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account_id INTEGER NOT NULL REFERENCES cash_accounts(id) ON DELETE CASCADE,
+		type TEXT NOT NULL,
+		amount REAL NOT NULL,
+		fx_rate REAL NOT NULL DEFAULT 0,
+		executed_at DATETIME NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_cash_movements_account ON cash_movements(account_id, executed_at);
+
+	CREATE TABLE IF NOT EXISTS income_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		holding_id INTEGER NOT NULL REFERENCES holdings(id) ON DELETE CASCADE,
+		type TEXT NOT NULL,
+		amount REAL NOT NULL,
+		reinvested INTEGER NOT NULL DEFAULT 0,
+		quantity REAL NOT NULL DEFAULT 0,
+		price REAL NOT NULL DEFAULT 0,
+		transaction_id INTEGER REFERENCES transactions(id) ON DELETE SET NULL,
+		cash_settled INTEGER NOT NULL DEFAULT 0,
+		fx_rate REAL NOT NULL DEFAULT 0,
+		paid_at DATETIME NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_income_events_holding ON income_events(holding_id, paid_at);
+
+	CREATE TABLE IF NOT EXISTS corporate_actions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		type TEXT NOT NULL,
+		asset_type TEXT NOT NULL,
+		ticker TEXT NOT NULL,
+		new_ticker TEXT NOT NULL DEFAULT '',
+		ratio REAL NOT NULL DEFAULT 0,
+		cost_fraction REAL NOT NULL DEFAULT 0,
+		effective_at DATETIME NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS corporate_action_changes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		action_id INTEGER NOT NULL REFERENCES corporate_actions(id) ON DELETE CASCADE,
+		entity TEXT NOT NULL,
+		entity_id INTEGER NOT NULL DEFAULT 0,
+		field TEXT NOT NULL,
+		old_value TEXT NOT NULL DEFAULT '',
+		new_value TEXT NOT NULL DEFAULT '',
+		factor REAL NOT NULL DEFAULT 0,
+		row_count INTEGER NOT NULL DEFAULT 1
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_corporate_action_changes ON corporate_action_changes(action_id);
+
+	CREATE TABLE IF NOT EXISTS price_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		asset_type TEXT NOT NULL,
+		ticker TEXT NOT NULL,
+		price REAL NOT NULL,
+		source TEXT NOT NULL DEFAULT '',
+		fetched_at DATETIME NOT NULL,
+		UNIQUE(asset_type, ticker, fetched_at)
+	);
+
+	CREATE TABLE IF NOT EXISTS price_bars (
+		asset_type TEXT NOT NULL,
+		ticker TEXT NOT NULL,
+		interval TEXT NOT NULL,
+		bucket_start DATETIME NOT NULL,
+		open REAL NOT NULL,
+		high REAL NOT NULL,
+		low REAL NOT NULL,
+		close REAL NOT NULL,
+		close_at DATETIME NOT NULL,
+		ticks INTEGER NOT NULL DEFAULT 1,
+		PRIMARY KEY (asset_type, ticker, interval, bucket_start)
+	);
+
+	CREATE TABLE IF NOT EXISTS portfolio_snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		portfolio_id INTEGER NOT NULL DEFAULT 0,
+		kind TEXT NOT NULL,
+		day TEXT NOT NULL,
+		taken_at DATETIME NOT NULL,
+		total_value REAL NOT NULL,
+		total_cost REAL NOT NULL,
+		total_pnl REAL NOT NULL,
+		total_realized_pnl REAL NOT NULL DEFAULT 0
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_portfolio_snapshots_taken ON portfolio_snapshots(kind, taken_at);
+
+	CREATE TABLE IF NOT EXISTS portfolio_snapshot_holdings (
+		snapshot_id INTEGER NOT NULL REFERENCES portfolio_snapshots(id) ON DELETE CASCADE,
+		holding_id INTEGER NOT NULL,
+		ticker TEXT NOT NULL,
+		asset_type TEXT NOT NULL,
+		quantity REAL NOT NULL,
+		price REAL NOT NULL,
+		market_value REAL NOT NULL,
+		cost_basis REAL NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_portfolio_snapshot_holdings ON portfolio_snapshot_holdings(snapshot_id);
 	`
 
 	if _, err := db.Exec(schema); err != nil {
 		return fmt.Errorf("migrate sqlite: %w", err)
 	}
+
+	// Columns added after a table first shipped. CREATE TABLE above already
+	// includes them for fresh databases; these bring older files up to date.
+	columns := []struct{ table, column, definition string }{
+		{"transactions", "cost_method", "TEXT NOT NULL DEFAULT ''"},
+		{"holdings", "portfolio_id", "INTEGER NOT NULL DEFAULT 1"},
+		{"price_alerts", "portfolio_id", "INTEGER NOT NULL DEFAULT 1"},
+		{"holdings", "currency", "TEXT NOT NULL DEFAULT 'USD'"},
+		{"transactions", "fx_rate", "REAL NOT NULL DEFAULT 0"},
+		{"transactions", "cash_settled", "INTEGER NOT NULL DEFAULT 0"},
+		{"price_alerts", "kind", "TEXT NOT NULL DEFAULT 'price'"},
+		{"price_alerts", "window_minutes", "INTEGER NOT NULL DEFAULT 0"},
+		{"price_alerts", "trail", "TEXT NOT NULL DEFAULT ''"},
+		{"price_alerts", "high_water", "REAL NOT NULL DEFAULT 0"},
+		{"price_alerts", "high_water_at", "DATETIME"},
+		{"price_alerts", "mode", "TEXT NOT NULL DEFAULT 'once'"},
+		{"price_alerts", "hysteresis", "REAL NOT NULL DEFAULT 0"},
+		{"price_alerts", "cooldown_minutes", "INTEGER NOT NULL DEFAULT 0"},
+		{"price_alerts", "scope", "TEXT NOT NULL DEFAULT 'ticker'"},
+		{"price_alerts", "severity", "TEXT NOT NULL DEFAULT 'info'"},
+		{"price_alerts", "expression", "TEXT NOT NULL DEFAULT ''"},
+		{"alert_events", "price", "REAL NOT NULL DEFAULT 0"},
+		{"alert_events", "total_value", "REAL NOT NULL DEFAULT 0"},
+		{"alert_events", "note", "TEXT NOT NULL DEFAULT ''"},
+		{"alert_events", "acknowledged_at", "DATETIME"},
+		{"notification_deliveries", "event_id", "INTEGER NOT NULL DEFAULT 0"},
+		{"portfolio_snapshots", "portfolio_id", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, c := range columns {
+		if err := addColumn(db, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+	// The event_id and portfolio_id indexes wait for their columns on
+	// upgraded databases, which also had one end-of-day snapshot per day
+	// rather than per day and portfolio.
+	if _, err := db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_notification_deliveries_event ON notification_deliveries(event_id);
+		DROP INDEX IF EXISTS idx_portfolio_snapshots_eod;
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_portfolio_snapshots_eod_portfolio
+			ON portfolio_snapshots(portfolio_id, day) WHERE kind = 'eod'`); err != nil {
+		return fmt.Errorf("migrate sqlite: %w", err)
+	}
+
+	if err := seedLedgerFromHoldings(db); err != nil {
+		return err
+	}
+	if err := seedAlertEvents(db); err != nil {
+		return err
+	}
+	return nil
+}
+
+func addColumn(db *sql.DB, table, column, definition string) error {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("inspect %s.%s: %w", table, column, err)
+	}
+	if count > 0 {
+		return nil
+	}
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+// seedLedgerFromHoldings converts holdings created before the transaction
+// ledger existed into an opening buy, then zeroes the legacy quantity and
+// avg_cost columns so the conversion only ever happens once.
+func seedLedgerFromHoldings(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin ledger seed: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO transactions(holding_id, type, quantity, price, executed_at, note)
+		SELECT id, 'buy', quantity, avg_cost, created_at, 'opening balance'
+		FROM holdings WHERE quantity > 0`); err != nil {
+		return fmt.Errorf("seed ledger: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE holdings SET quantity = 0, avg_cost = 0 WHERE quantity <> 0 OR avg_cost <> 0`); err != nil {
+		return fmt.Errorf("clear legacy holding columns: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit ledger seed: %w", err)
+	}
+	return nil
+}
+
+// seedAlertEvents moves the single triggered_at of alerts fired before the
+// alert_events history existed into a first event, then clears the legacy
+// column so the conversion only ever happens once.
+func seedAlertEvents(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin alert event seed: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO alert_events(alert_id, fired_at)
+		SELECT id, triggered_at FROM price_alerts WHERE triggered_at IS NOT NULL`); err != nil {
+		return fmt.Errorf("seed alert events: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE price_alerts SET triggered_at = NULL WHERE triggered_at IS NOT NULL`); err != nil {
+		return fmt.Errorf("clear legacy alert column: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit alert event seed: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,293 @@
+package ledger
+
+import (
+	"errors"
+	"sort"
+
+	"portfoliopulse/internal/models"
+)
+
+// epsilon absorbs float drift so selling an entire position built from
+// fractional buys does not trip ErrInsufficientQuantity.
+const epsilon = 1e-9
+
+var (
+	ErrInsufficientQuantity = errors.New("sell quantity exceeds position")
+	ErrInvalidLotSelection  = errors.New("lot selection does not match open lots")
+	ErrUnknownCostMethod    = errors.New("unknown cost method")
+)
+
+// Position is the result of replaying one holding's ledger: the open lots
+// that remain and every realized gain booked along the way.
+type Position struct {
+	Quantity  float64
+	CostBasis float64
+	Lots      []models.Lot
+	Realized  []models.RealizedGain
+}
+
+// CostFXRate is the cost-weighted FX rate of the open lots that recorded
+// one, or zero when none did.
+func (p Position) CostFXRate() float64 {
+	cost, weighted := 0.0, 0.0
+	for _, l := range p.Lots {
+		if l.FXRate > 0 {
+			c := l.Remaining * l.CostPerUnit
+			cost += c
+			weighted += c * l.FXRate
+		}
+	}
+	if cost <= epsilon {
+		return 0
+	}
+	return weighted / cost
+}
+
+func (p Position) AvgCost() float64 {
+	if p.Quantity <= epsilon {
+		return 0
+	}
+	return p.CostBasis / p.Quantity
+}
+
+func (p Position) RealizedGain() float64 {
+	total := 0.0
+	for _, g := range p.Realized {
+		total += g.Gain
+	}
+	return total
+}
+
+// Sorted returns a copy of txs in replay order: execution time, then ID so
+// same-timestamp entries keep their insertion order.
+func Sorted(txs []models.Transaction) []models.Transaction {
+	out := make([]models.Transaction, len(txs))
+	copy(out, txs)
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].ExecutedAt.Equal(out[j].ExecutedAt) {
+			return out[i].ExecutedAt.Before(out[j].ExecutedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// ValidMethod reports whether m can be stored on a sell.
+func ValidMethod(m models.CostMethod) bool {
+	switch m {
+	case models.CostFIFO, models.CostLIFO, models.CostHIFO, models.CostAverage, models.CostSpecific:
+		return true
+	}
+	return false
+}
+
+// Replay folds a holding's transactions into open lots and realized gains.
+// Buys and transfer-ins open a lot with their fee capitalised into the unit
+// cost. Sells and transfer-outs close lots according to the transaction's
+// CostMethod; an empty method means average cost, which is how sells were
+// booked before lot tracking existed. Standalone fees are spread across the
+// open lots, or realized as a loss when nothing is open, and cost
+// adjustments re-price the open lots they select.
+func Replay(txs []models.Transaction) (Position, error) {
+	lots := make([]*models.Lot, 0)
+	realized := make([]models.RealizedGain, 0)
+
+	for _, tx := range Sorted(txs) {
+		switch tx.Type {
+		case models.TxBuy, models.TxTransferIn, models.TxSpinOff:
+			unitCost := tx.Price
+			if tx.Quantity > 0 {
+				unitCost += tx.Fee / tx.Quantity
+			}
+			lots = append(lots, &models.Lot{
+				ID:          tx.ID,
+				HoldingID:   tx.HoldingID,
+				Ticker:      tx.Ticker,
+				AssetType:   tx.AssetType,
+				AcquiredAt:  tx.ExecutedAt,
+				Quantity:    tx.Quantity,
+				Remaining:   tx.Quantity,
+				CostPerUnit: unitCost,
+				FXRate:      tx.FXRate,
+			})
+		case models.TxSell, models.TxTransferOut:
+			closures, err := closeLots(lots, tx)
+			if err != nil {
+				return Position{}, err
+			}
+			if tx.Type == models.TxSell {
+				realized = append(realized, realize(tx, closures)...)
+			}
+			lots = openLots(lots)
+		case models.TxCostAdjust:
+			for _, sel := range tx.Lots {
+				for _, l := range lots {
+					if l.ID == sel.LotID {
+						l.CostPerUnit *= 1 - tx.Price
+					}
+				}
+			}
+		case models.TxFee:
+			open := 0.0
+			for _, l := range lots {
+				open += l.Remaining
+			}
+			if open > epsilon {
+				for _, l := range lots {
+					l.CostPerUnit += tx.Fee / open
+				}
+				continue
+			}
+			realized = append(realized, models.RealizedGain{
+				TransactionID: tx.ID,
+				HoldingID:     tx.HoldingID,
+				Ticker:        tx.Ticker,
+				AssetType:     tx.AssetType,
+				Currency:      tx.Currency,
+				CostBasis:     tx.Fee,
+				Gain:          -tx.Fee,
+				SoldAt:        tx.ExecutedAt,
+			})
+		}
+	}
+
+	pos := Position{Lots: make([]models.Lot, 0, len(lots)), Realized: realized}
+	for _, l := range lots {
+		pos.Quantity += l.Remaining
+		pos.CostBasis += l.Remaining * l.CostPerUnit
+		pos.Lots = append(pos.Lots, *l)
+	}
+	return pos, nil
+}
+
+type closure struct {
+	lot      *models.Lot
+	quantity float64
+	// costPerUnit is captured before any later fee re-prices the lot.
+	costPerUnit float64
+}
+
+func closeLots(lots []*models.Lot, tx models.Transaction) ([]closure, error) {
+	open := 0.0
+	for _, l := range lots {
+		open += l.Remaining
+	}
+	if tx.Quantity > open+epsilon {
+		return nil, ErrInsufficientQuantity
+	}
+
+	method := tx.CostMethod
+	if method == "" {
+		method = models.CostAverage
+	}
+
+	closures := make([]closure, 0)
+	take := func(l *models.Lot, qty float64) {
+		if qty <= epsilon {
+			return
+		}
+		closures = append(closures, closure{lot: l, quantity: qty, costPerUnit: l.CostPerUnit})
+		l.Remaining -= qty
+		if l.Remaining < epsilon {
+			l.Remaining = 0
+		}
+	}
+
+	switch method {
+	case models.CostAverage:
+		ratio := 0.0
+		if open > epsilon {
+			ratio = tx.Quantity / open
+		}
+		for _, l := range lots {
+			take(l, l.Remaining*ratio)
+		}
+	case models.CostSpecific:
+		byID := make(map[int64]*models.Lot, len(lots))
+		for _, l := range lots {
+			byID[l.ID] = l
+		}
+		selected := 0.0
+		for _, sel := range tx.Lots {
+			l, ok := byID[sel.LotID]
+			if !ok || sel.Quantity <= 0 || sel.Quantity > l.Remaining+epsilon {
+				return nil, ErrInvalidLotSelection
+			}
+			take(l, min(sel.Quantity, l.Remaining))
+			selected += sel.Quantity
+		}
+		if diff := selected - tx.Quantity; diff > epsilon || diff < -epsilon {
+			return nil, ErrInvalidLotSelection
+		}
+	case models.CostFIFO, models.CostLIFO, models.CostHIFO:
+		ordered := make([]*models.Lot, len(lots))
+		copy(ordered, lots)
+		switch method {
+		case models.CostLIFO:
+			for i, j := 0, len(ordered)-1; i < j; i, j = i+1, j-1 {
+				ordered[i], ordered[j] = ordered[j], ordered[i]
+			}
+		case models.CostHIFO:
+			sort.SliceStable(ordered, func(i, j int) bool {
+				return ordered[i].CostPerUnit > ordered[j].CostPerUnit
+			})
+		}
+		left := tx.Quantity
+		for _, l := range ordered {
+			if left <= epsilon {
+				break
+			}
+			qty := min(left, l.Remaining)
+			take(l, qty)
+			left -= qty
+		}
+	default:
+		return nil, ErrUnknownCostMethod
+	}
+	return closures, nil
+}
+
+// realize turns a sell's lot closures into realized gains, allocating the
+// sell fee across lots in proportion to quantity.
+func realize(tx models.Transaction, closures []closure) []models.RealizedGain {
+	method := tx.CostMethod
+	if method == "" {
+		method = models.CostAverage
+	}
+	out := make([]models.RealizedGain, 0, len(closures))
+	for _, c := range closures {
+		fee := 0.0
+		if tx.Quantity > 0 {
+			fee = tx.Fee * c.quantity / tx.Quantity
+		}
+		proceeds := c.quantity*tx.Price - fee
+		cost := c.quantity * c.costPerUnit
+		acquiredAt := c.lot.AcquiredAt
+		out = append(out, models.RealizedGain{
+			TransactionID: tx.ID,
+			LotID:         c.lot.ID,
+			HoldingID:     tx.HoldingID,
+			Ticker:        tx.Ticker,
+			AssetType:     tx.AssetType,
+			Currency:      tx.Currency,
+			Method:        method,
+			Quantity:      c.quantity,
+			Proceeds:      proceeds,
+			CostBasis:     cost,
+			Gain:          proceeds - cost,
+			AcquiredAt:    &acquiredAt,
+			SoldAt:        tx.ExecutedAt,
+		})
+	}
+	return out
+}
+
+func openLots(lots []*models.Lot) []*models.Lot {
+	out := lots[:0]
+	for _, l := range lots {
+		if l.Remaining > epsilon {
+			out = append(out, l)
+		}
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+package ledger
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"portfoliopulse/internal/models"
+)
+
+func TestReplayAverageCost(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	txs := []models.Transaction{
+		{ID: 3, Type: models.TxSell, Quantity: 5, Price: 30, ExecutedAt: base.Add(48 * time.Hour)},
+		{ID: 1, Type: models.TxBuy, Quantity: 10, Price: 10, Fee: 1, ExecutedAt: base},
+		{ID: 2, Type: models.TxBuy, Quantity: 10, Price: 20, Fee: 1, ExecutedAt: base.Add(24 * time.Hour)},
+		{ID: 4, Type: models.TxFee, Fee: 3, ExecutedAt: base.Add(72 * time.Hour)},
+	}
+
+	pos, err := Replay(txs)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if pos.Quantity != 15 {
+		t.Fatalf("expected quantity 15, got %v", pos.Quantity)
+	}
+	// 302 basis over 20 units, 5 sold at 15.1 avg, then a 3 fee.
+	if math.Abs(pos.CostBasis-229.5) > 1e-9 {
+		t.Fatalf("expected cost basis 229.5, got %v", pos.CostBasis)
+	}
+}
+
+func TestReplayRejectsOversell(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	txs := []models.Transaction{
+		{ID: 1, Type: models.TxBuy, Quantity: 1, Price: 10, ExecutedAt: base},
+		{ID: 2, Type: models.TxTransferOut, Quantity: 2, ExecutedAt: base.Add(time.Hour)},
+	}
+	if _, err := Replay(txs); !errors.Is(err, ErrInsufficientQuantity) {
+		t.Fatalf("expected ErrInsufficientQuantity, got %v", err)
+	}
+}
+
+func TestReplayLotMethods(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	buys := []models.Transaction{
+		{ID: 1, Type: models.TxBuy, Quantity: 10, Price: 10, ExecutedAt: base},
+		{ID: 2, Type: models.TxBuy, Quantity: 10, Price: 30, ExecutedAt: base.Add(24 * time.Hour)},
+		{ID: 3, Type: models.TxBuy, Quantity: 10, Price: 20, ExecutedAt: base.Add(48 * time.Hour)},
+	}
+	sell := models.Transaction{ID: 4, Type: models.TxSell, Quantity: 15, Price: 40, Fee: 3, ExecutedAt: base.Add(72 * time.Hour)}
+
+	cases := []struct {
+		method    models.CostMethod
+		lots      []models.LotSelection
+		wantGain  float64
+		wantBasis float64
+	}{
+		{method: models.CostFIFO, wantGain: 600 - 3 - (100 + 150), wantBasis: 150 + 200},
+		{method: models.CostLIFO, wantGain: 600 - 3 - (200 + 150), wantBasis: 100 + 150},
+		{method: models.CostHIFO, wantGain: 600 - 3 - (300 + 100), wantBasis: 100 + 100},
+		{method: models.CostAverage, wantGain: 600 - 3 - 300, wantBasis: 300},
+		{
+			method:    models.CostSpecific,
+			lots:      []models.LotSelection{{LotID: 3, Quantity: 10}, {LotID: 1, Quantity: 5}},
+			wantGain:  600 - 3 - (200 + 50),
+			wantBasis: 50 + 300,
+		},
+	}
+
+	for _, tc := range cases {
+		s := sell
+		s.CostMethod = tc.method
+		s.Lots = tc.lots
+		pos, err := Replay(append(append([]models.Transaction{}, buys...), s))
+		if err != nil {
+			t.Fatalf("%s: replay: %v", tc.method, err)
+		}
+		if pos.Quantity != 15 {
+			t.Fatalf("%s: expected 15 remaining, got %v", tc.method, pos.Quantity)
+		}
+		if math.Abs(pos.RealizedGain()-tc.wantGain) > 1e-9 {
+			t.Fatalf("%s: expected gain %v, got %v", tc.method, tc.wantGain, pos.RealizedGain())
+		}
+		if math.Abs(pos.CostBasis-tc.wantBasis) > 1e-9 {
+			t.Fatalf("%s: expected basis %v, got %v", tc.method, tc.wantBasis, pos.CostBasis)
+		}
+	}
+}
+
+func TestReplayRejectsBadLotSelection(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	txs := []models.Transaction{
+		{ID: 1, Type: models.TxBuy, Quantity: 5, Price: 10, ExecutedAt: base},
+		{ID: 2, Type: models.TxSell, Quantity: 5, Price: 12, CostMethod: models.CostSpecific,
+			Lots: []models.LotSelection{{LotID: 1, Quantity: 4}}, ExecutedAt: base.Add(time.Hour)},
+	}
+	if _, err := Replay(txs); !errors.Is(err, ErrInvalidLotSelection) {
+		t.Fatalf("expected ErrInvalidLotSelection, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package market
+
+import (
+	"sync"
+	"time"
+
+	"portfoliopulse/internal/models"
+)
+
+const (
+	defaultBreakerThreshold = 3
+	defaultBreakerCooldown  = time.Minute
+)
+
+// Breaker is a consecutive-failure circuit breaker. After threshold failures
+// in a row it opens and rejects calls until cooldown has passed, then lets a
+// single half-open probe through: success closes it, failure re-opens it for
+// another cooldown.
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	state       models.BreakerState
+	failures    int
+	openedAt    time.Time
+	probing     bool
+	lastErr     string
+	lastFailure time.Time
+	lastSuccess time.Time
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	return &Breaker{threshold: threshold, cooldown: cooldown, now: time.Now, state: models.BreakerClosed}
+}
+
+// Allow reports whether a call may proceed. In the half-open state only one
+// caller is admitted until it reports back.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case models.BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = models.BreakerHalfOpen
+		b.probing = true
+		return true
+	case models.BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = models.BreakerClosed
+	b.failures = 0
+	b.probing = false
+	b.lastSuccess = b.now().UTC()
+}
+
+func (b *Breaker) Failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	b.lastFailure = b.now().UTC()
+	if err != nil {
+		b.lastErr = err.Error()
+	}
+	if b.state == models.BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = models.BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// Status fills the breaker fields of a SourceStatus.
+func (b *Breaker) Status() models.SourceStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := models.SourceStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastErr,
+	}
+	if !b.lastFailure.IsZero() {
+		t := b.lastFailure
+		st.LastFailureAt = &t
+	}
+	if !b.lastSuccess.IsZero() {
+		t := b.lastSuccess
+		st.LastSuccessAt = &t
+	}
+	if b.state == models.BreakerOpen {
+		t := b.openedAt.Add(b.cooldown).UTC()
+		st.RetryAt = &t
+	}
+	return st
+}
@@ -0,0 +1,120 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"portfoliopulse/internal/models"
+)
+
+const coinGeckoPriceURL = "https://api.coingecko.com/api/v3/simple/price"
+
+// CoinGeckoSource prices crypto tickers it has an ID mapping for, in
+// vsCurrency (USD unless configured as e.g. "coingecko:eur").
+type CoinGeckoSource struct {
+	httpClient *http.Client
+	baseURL    string
+	vsCurrency string
+}
+
+func NewCoinGeckoSource(client *http.Client, vsCurrency string) *CoinGeckoSource {
+	vsCurrency = strings.ToLower(strings.TrimSpace(vsCurrency))
+	if vsCurrency == "" {
+		vsCurrency = "usd"
+	}
+	return &CoinGeckoSource{httpClient: client, baseURL: coinGeckoPriceURL, vsCurrency: vsCurrency}
+}
+
+func (c *CoinGeckoSource) Name() string { return "coingecko" }
+
+func (c *CoinGeckoSource) Fetch(ctx context.Context, assetType models.AssetType, tickers []string) (map[string]models.Quote, error) {
+	updates := make(map[string]models.Quote)
+	if assetType != models.AssetCrypto {
+		return updates, nil
+	}
+
+	idTickers := make(map[string][]string)
+	ids := make([]string, 0, len(tickers))
+	for _, ticker := range tickers {
+		id, ok := coinGeckoIDs[ticker]
+		if !ok {
+			continue
+		}
+		if _, seen := idTickers[id]; !seen {
+			ids = append(ids, id)
+		}
+		idTickers[id] = append(idTickers[id], ticker)
+	}
+	if len(ids) == 0 {
+		return updates, nil
+	}
+
+	values := url.Values{}
+	values.Set("ids", strings.Join(ids, ","))
+	values.Set("vs_currencies", c.vsCurrency)
+	values.Set("include_24hr_change", "true")
+	values.Set("include_last_updated_at", "true")
+	endpoint := c.baseURL + "?" + values.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create coingecko request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch coingecko prices: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("coingecko status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	// Fields are named after the vs currency, e.g. "eur" and "eur_24h_change".
+	var payload map[string]map[string]float64
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("decode coingecko prices: %w", err)
+	}
+
+	for id, val := range payload {
+		price, change := val[c.vsCurrency], val[c.vsCurrency+"_24h_change"]
+		// Crypto never closes, so the price 24h ago stands in for the
+		// previous close.
+		q := models.Quote{Price: price, Currency: strings.ToUpper(c.vsCurrency)}
+		if change > -100 && change != 0 {
+			q.PreviousClose = price / (1 + change/100)
+		}
+		if updated := int64(val["last_updated_at"]); updated > 0 {
+			t := time.Unix(updated, 0).UTC()
+			q.MarketTime = &t
+		}
+		for _, ticker := range idTickers[id] {
+			updates[ticker] = q
+		}
+	}
+	return updates, nil
+}
+
+var coinGeckoIDs = map[string]string{
+	"BTC":      "bitcoin",
+	"BITCOIN":  "bitcoin",
+	"ETH":      "ethereum",
+	"ETHEREUM": "ethereum",
+	"SOL":      "solana",
+	"SOLANA":   "solana",
+	"DOGE":     "dogecoin",
+	"ADA":      "cardano",
+	"XRP":      "ripple",
+	"DOT":      "polkadot",
+	"AVAX":     "avalanche-2",
+	"MATIC":    "matic-network",
+	"LINK":     "chainlink",
+}
@@ -0,0 +1,131 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// FXSource converts currencies into a base currency. Rates maps each
+// requested currency to how many units of base one unit of it is worth;
+// currencies the source does not know are omitted.
+type FXSource interface {
+	Name() string
+	Rates(ctx context.Context, base string, currencies []string) (map[string]float64, error)
+}
+
+// FXFactory builds an FXSource from whatever followed "name:" in the spec.
+type FXFactory func(arg string, client *http.Client) (FXSource, error)
+
+// DefaultFXSpec uses the ECB reference rates published by Frankfurter.
+const DefaultFXSpec = "frankfurter"
+
+// StaticFXSource reads rates from a JSON file such as
+//
+//	{"base": "USD", "rates": {"EUR": 0.92, "JPY": 151.3}}
+//
+// quoted the usual way: one unit of base buys that many units of each
+// currency. The file is re-read on every call so edits apply without a
+// restart, which makes it a convenient stand-in offline and in tests.
+type StaticFXSource struct {
+	path string
+}
+
+func NewStaticFXSource(path string) (*StaticFXSource, error) {
+	if path == "" {
+		return nil, errors.New("static fx source needs a file, e.g. static:/etc/portfoliopulse/rates.json")
+	}
+	return &StaticFXSource{path: path}, nil
+}
+
+func (s *StaticFXSource) Name() string { return "static" }
+
+func (s *StaticFXSource) Rates(_ context.Context, base string, currencies []string) (map[string]float64, error) {
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("read fx rates: %w", err)
+	}
+	var file struct {
+		Base  string             `json:"base"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("decode fx rates: %w", err)
+	}
+	return crossRates(file.Base, file.Rates, base, currencies), nil
+}
+
+const frankfurterURL = "https://api.frankfurter.app/latest"
+
+// FrankfurterFXSource reads the European Central Bank's daily reference
+// rates through the free Frankfurter API.
+type FrankfurterFXSource struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+func NewFrankfurterFXSource(client *http.Client) *FrankfurterFXSource {
+	return &FrankfurterFXSource{httpClient: client, baseURL: frankfurterURL}
+}
+
+func (f *FrankfurterFXSource) Name() string { return "frankfurter" }
+
+func (f *FrankfurterFXSource) Rates(ctx context.Context, base string, currencies []string) (map[string]float64, error) {
+	values := url.Values{}
+	values.Set("from", base)
+	values.Set("to", strings.Join(currencies, ","))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.baseURL+"?"+values.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("create frankfurter request: %w", err)
+	}
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch frankfurter rates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("frankfurter status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var payload struct {
+		Base  string             `json:"base"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("decode frankfurter rates: %w", err)
+	}
+	return crossRates(payload.Base, payload.Rates, base, currencies), nil
+}
+
+// crossRates turns "one quoteBase buys N units" quotes into "one unit is
+// worth N base" rates for the requested currencies, going through quoteBase
+// when it differs from base.
+func crossRates(quoteBase string, quotes map[string]float64, base string, currencies []string) map[string]float64 {
+	perQuoteBase := map[string]float64{strings.ToUpper(quoteBase): 1}
+	for cur, v := range quotes {
+		if v > 0 {
+			perQuoteBase[strings.ToUpper(cur)] = v
+		}
+	}
+	baseRate, ok := perQuoteBase[strings.ToUpper(base)]
+	if !ok {
+		return map[string]float64{}
+	}
+
+	out := make(map[string]float64, len(currencies))
+	for _, cur := range currencies {
+		if v, ok := perQuoteBase[strings.ToUpper(cur)]; ok {
+			out[strings.ToUpper(cur)] = baseRate / v
+		}
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"portfoliopulse/internal/models"
+)
+
+// JSONHTTPSource is a generic adapter for in-house quote services. It calls
+//
+//	GET <baseURL>?assetType=stock&symbols=AAPL,MSFT
+//
+// and expects a JSON object mapping each symbol to either a bare price or
+// {"price": 190.1, "currency": "USD", "marketTime": "2024-03-01T21:00:00Z",
+// "previousClose": 188.2}.
+type JSONHTTPSource struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+func NewJSONHTTPSource(baseURL string, client *http.Client) (*JSONHTTPSource, error) {
+	if baseURL == "" {
+		return nil, errors.New("jsonhttp source needs a URL, e.g. jsonhttp:https://quotes.internal/prices")
+	}
+	if _, err := url.Parse(baseURL); err != nil {
+		return nil, fmt.Errorf("parse jsonhttp url: %w", err)
+	}
+	return &JSONHTTPSource{httpClient: client, baseURL: baseURL}, nil
+}
+
+func (j *JSONHTTPSource) Name() string { return "jsonhttp" }
+
+func (j *JSONHTTPSource) Fetch(ctx context.Context, assetType models.AssetType, tickers []string) (map[string]models.Quote, error) {
+	u, err := url.Parse(j.baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse jsonhttp url: %w", err)
+	}
+	values := u.Query()
+	values.Set("assetType", string(assetType))
+	values.Set("symbols", strings.Join(tickers, ","))
+	u.RawQuery = values.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("create jsonhttp request: %w", err)
+	}
+
+	resp, err := j.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch jsonhttp prices: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("jsonhttp status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var payload map[string]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("decode jsonhttp prices: %w", err)
+	}
+
+	updates := make(map[string]models.Quote, len(payload))
+	for symbol, raw := range payload {
+		var q models.Quote
+		if err := json.Unmarshal(raw, &q.Price); err != nil {
+			var full struct {
+				Price         float64    `json:"price"`
+				Currency      string     `json:"currency"`
+				MarketTime    *time.Time `json:"marketTime"`
+				PreviousClose float64    `json:"previousClose"`
+			}
+			if err := json.Unmarshal(raw, &full); err != nil {
+				return nil, fmt.Errorf("decode jsonhttp quote %s: %w", symbol, err)
+			}
+			q = models.Quote{Price: full.Price, Currency: strings.ToUpper(full.Currency), MarketTime: full.MarketTime, PreviousClose: full.PreviousClose}
+		}
+		updates[strings.ToUpper(strings.TrimSpace(symbol))] = q
+	}
+	return updates, nil
+}
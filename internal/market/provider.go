@@ -2,12 +2,10 @@ package market
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"math"
-	"net/http"
-	"net/url"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -16,16 +14,75 @@ import (
 )
 
 type Provider struct {
-	httpClient *http.Client
-	mu         sync.RWMutex
-	prices     map[string]float64
+	chains map[models.AssetType][]guardedSource
+	mu     sync.RWMutex
+	prices map[string]models.Quote
+
+	breakerThreshold int
+	breakerCooldown  time.Duration
+
+	fx        FXSource
+	fxBreaker *Breaker
+	fxEvery   time.Duration
+	base      string
+	rates     map[string]float64
+	ratesAt   time.Time
+}
+
+// guardedSource pairs a chain entry with its own breaker, so the same
+// upstream tripping for crypto does not also trip it for stocks.
+type guardedSource struct {
+	source  Source
+	breaker *Breaker
+}
+
+// ProviderOption customises a Provider at construction time.
+type ProviderOption func(*Provider)
+
+// WithBreaker sets how many consecutive failures open a source's breaker
+// and how long it stays open before a half-open probe.
+func WithBreaker(threshold int, cooldown time.Duration) ProviderOption {
+	return func(p *Provider) {
+		p.breakerThreshold = threshold
+		p.breakerCooldown = cooldown
+	}
+}
+
+// WithFX converts into base using src. Rates are refetched every hour, or
+// sooner when a currency without a rate shows up. Without an FX source
+// only base-currency amounts can be valued.
+func WithFX(src FXSource, base string) ProviderOption {
+	return func(p *Provider) {
+		p.fx = src
+		p.base = strings.ToUpper(strings.TrimSpace(base))
+	}
 }
 
-func NewProvider() *Provider {
-	return &Provider{
-		httpClient: &http.Client{Timeout: 10 * time.Second},
-		prices:     make(map[string]float64),
+func NewProvider(chains Chains, opts ...ProviderOption) *Provider {
+	p := &Provider{
+		chains:           make(map[models.AssetType][]guardedSource, len(chains)),
+		prices:           make(map[string]models.Quote),
+		breakerThreshold: defaultBreakerThreshold,
+		breakerCooldown:  defaultBreakerCooldown,
+		fxEvery:          time.Hour,
+		base:             models.DefaultCurrency,
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	p.rates = map[string]float64{p.base: 1}
+	if p.fx != nil {
+		p.fxBreaker = NewBreaker(p.breakerThreshold, p.breakerCooldown)
+	}
+	for assetType, chain := range chains {
+		for _, src := range chain {
+			p.chains[assetType] = append(p.chains[assetType], guardedSource{
+				source:  src,
+				breaker: NewBreaker(p.breakerThreshold, p.breakerCooldown),
+			})
+		}
+	}
+	return p
 }
 
 func key(assetType models.AssetType, ticker string) string {
@@ -33,174 +90,239 @@ func key(assetType models.AssetType, ticker string) string {
 }
 
 func (p *Provider) GetPrice(assetType models.AssetType, ticker string) (float64, bool) {
+	q, ok := p.GetQuote(assetType, ticker)
+	return q.Price, ok
+}
+
+func (p *Provider) GetQuote(assetType models.AssetType, ticker string) (models.Quote, bool) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
-	price, ok := p.prices[key(assetType, ticker)]
-	return price, ok
+	q, ok := p.prices[key(assetType, ticker)]
+	return q, ok
 }
 
-func (p *Provider) Snapshot() map[string]float64 {
+func (p *Provider) Snapshot() map[string]models.Quote {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
-	out := make(map[string]float64, len(p.prices))
+	out := make(map[string]models.Quote, len(p.prices))
 	for k, v := range p.prices {
 		out[k] = v
 	}
 	return out
 }
 
+// FXRates returns the latest conversion rates into the base currency.
+func (p *Provider) FXRates() models.FXRates {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	out := models.FXRates{Base: p.base, Rates: make(map[string]float64, len(p.rates))}
+	for cur, rate := range p.rates {
+		out.Rates[cur] = rate
+	}
+	if p.fx != nil && !p.ratesAt.IsZero() {
+		at := p.ratesAt
+		out.Source = p.fx.Name()
+		out.FetchedAt = &at
+	}
+	return out
+}
+
+// Sources lists the configured chain for each asset type, primary first.
+func (p *Provider) Sources() map[models.AssetType][]string {
+	out := make(map[models.AssetType][]string, len(p.chains))
+	for assetType, chain := range p.chains {
+		names := make([]string, 0, len(chain))
+		for _, g := range chain {
+			names = append(names, g.source.Name())
+		}
+		out[assetType] = names
+	}
+	return out
+}
+
+// SourceHealth reports every chain entry's breaker, ordered by asset type
+// then priority.
+func (p *Provider) SourceHealth() []models.SourceStatus {
+	assetTypes := make([]string, 0, len(p.chains))
+	for assetType := range p.chains {
+		assetTypes = append(assetTypes, string(assetType))
+	}
+	sort.Strings(assetTypes)
+
+	out := make([]models.SourceStatus, 0)
+	for _, at := range assetTypes {
+		for i, g := range p.chains[models.AssetType(at)] {
+			st := g.breaker.Status()
+			st.AssetType = models.AssetType(at)
+			st.Source = g.source.Name()
+			st.Priority = i
+			out = append(out, st)
+		}
+	}
+	if p.fx != nil {
+		st := p.fxBreaker.Status()
+		st.AssetType = fxAssetType
+		st.Source = p.fx.Name()
+		out = append(out, st)
+	}
+	return out
+}
+
+// fxAssetType labels the FX source in SourceHealth.
+const fxAssetType models.AssetType = "fx"
+
+// Refresh updates prices for every holding's ticker, then FX rates for
+// every currency in play. Each asset type's chain is tried independently and
+// whatever was fetched is always applied; the returned error only describes
+// the chains that left tickers unpriced and any FX failure. Cash positions
+// are never priced; only their currency is converted.
 func (p *Provider) Refresh(ctx context.Context, holdings []models.Holding) error {
-	stocks := make([]string, 0)
-	cryptos := make([]string, 0)
+	tickers := make(map[models.AssetType][]string)
 	seen := map[string]bool{}
 
 	for _, h := range holdings {
+		if h.AssetType == models.AssetCash {
+			continue
+		}
 		ticker := strings.ToUpper(strings.TrimSpace(h.Ticker))
 		k := key(h.AssetType, ticker)
 		if seen[k] {
 			continue
 		}
 		seen[k] = true
-		switch h.AssetType {
-		case models.AssetCrypto:
-			if id, ok := coinGeckoIDs[ticker]; ok {
-				cryptos = append(cryptos, id)
-			}
-		default:
-			stocks = append(stocks, ticker)
-		}
-	}
-
-	updates := make(map[string]float64)
-	if len(stocks) > 0 {
-		stockUpdates, err := p.fetchYahooQuotes(ctx, stocks)
-		if err != nil {
-			return err
-		}
-		for k, v := range stockUpdates {
-			updates[k] = v
-		}
+		tickers[h.AssetType] = append(tickers[h.AssetType], ticker)
 	}
 
-	if len(cryptos) > 0 {
-		cryptoUpdates, err := p.fetchCoinGeckoPrices(ctx, cryptos)
+	updates := make(map[string]models.Quote)
+	var errs []error
+	for assetType, list := range tickers {
+		prices, err := p.fetchChain(ctx, assetType, list)
 		if err != nil {
-			return err
+			errs = append(errs, fmt.Errorf("%s prices: %w", assetType, err))
 		}
-		for k, v := range cryptoUpdates {
-			updates[k] = v
+		for ticker, q := range prices {
+			updates[key(assetType, ticker)] = q
 		}
 	}
 
 	p.mu.Lock()
-	for k, v := range updates {
-		if !math.IsNaN(v) && v > 0 {
-			p.prices[k] = v
-		}
+	for k, q := range updates {
+		p.prices[k] = q
 	}
 	p.mu.Unlock()
 
-	return nil
+	if err := p.refreshFX(ctx, holdings); err != nil {
+		errs = append(errs, fmt.Errorf("fx rates: %w", err))
+	}
+	return errors.Join(errs...)
 }
 
-func (p *Provider) fetchYahooQuotes(ctx context.Context, symbols []string) (map[string]float64, error) {
-	updates := make(map[string]float64)
-
-	for _, symbol := range symbols {
-		endpoint := fmt.Sprintf("https://query2.finance.yahoo.com/v8/finance/chart/%s?interval=1d&range=1d", url.PathEscape(symbol))
-
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
-		if err != nil {
-			continue
-		}
-		req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36")
-
-		resp, err := p.httpClient.Do(req)
-		if err != nil {
-			continue
-		}
-
-		if resp.StatusCode != http.StatusOK {
-			resp.Body.Close()
-			continue
-		}
-
-		var payload struct {
-			Chart struct {
-				Result []struct {
-					Meta struct {
-						Symbol             string  `json:"symbol"`
-						RegularMarketPrice float64 `json:"regularMarketPrice"`
-					} `json:"meta"`
-				} `json:"result"`
-			} `json:"chart"`
-		}
-
-		if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-			resp.Body.Close()
+func (p *Provider) refreshFX(ctx context.Context, holdings []models.Holding) error {
+	p.mu.RLock()
+	wanted := make(map[string]bool)
+	for _, h := range holdings {
+		wanted[strings.ToUpper(h.Currency)] = true
+	}
+	for _, q := range p.prices {
+		wanted[q.Currency] = true
+	}
+	currencies := make([]string, 0, len(wanted))
+	missing := false
+	for cur := range wanted {
+		if cur == "" || cur == p.base {
 			continue
 		}
-		resp.Body.Close()
-
-		if len(payload.Chart.Result) > 0 {
-			meta := payload.Chart.Result[0].Meta
-			updates[key(models.AssetStock, meta.Symbol)] = meta.RegularMarketPrice
+		currencies = append(currencies, cur)
+		if _, ok := p.rates[cur]; !ok {
+			missing = true
 		}
 	}
+	due := time.Since(p.ratesAt) >= p.fxEvery
+	p.mu.RUnlock()
 
-	return updates, nil
-}
-
-func (p *Provider) fetchCoinGeckoPrices(ctx context.Context, ids []string) (map[string]float64, error) {
-	values := url.Values{}
-	values.Set("ids", strings.Join(ids, ","))
-	values.Set("vs_currencies", "usd")
-	endpoint := "https://api.coingecko.com/api/v3/simple/price?" + values.Encode()
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
-	if err != nil {
-		return nil, fmt.Errorf("create coingecko request: %w", err)
+	if len(currencies) == 0 || (!missing && !due) {
+		return nil
 	}
-
-	resp, err := p.httpClient.Do(req)
+	if p.fx == nil {
+		return fmt.Errorf("no fx source configured to convert %s into %s", strings.Join(currencies, ", "), p.base)
+	}
+	if !p.fxBreaker.Allow() {
+		return fmt.Errorf("%s: circuit open", p.fx.Name())
+	}
+	sort.Strings(currencies)
+	rates, err := p.fx.Rates(ctx, p.base, currencies)
 	if err != nil {
-		return nil, fmt.Errorf("fetch coingecko prices: %w", err)
+		p.fxBreaker.Failure(err)
+		return fmt.Errorf("%s: %w", p.fx.Name(), err)
 	}
-	defer resp.Body.Close()
+	p.fxBreaker.Success()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
-		return nil, fmt.Errorf("coingecko status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	p.mu.Lock()
+	for cur, rate := range rates {
+		if rate > 0 && !math.IsInf(rate, 0) {
+			p.rates[cur] = rate
+		}
 	}
+	p.ratesAt = time.Now().UTC()
+	p.mu.Unlock()
 
-	var payload map[string]struct {
-		USD float64 `json:"usd"`
+	unknown := make([]string, 0)
+	for _, cur := range currencies {
+		if _, ok := rates[cur]; !ok {
+			unknown = append(unknown, cur)
+		}
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-		return nil, fmt.Errorf("decode coingecko prices: %w", err)
+	if len(unknown) > 0 {
+		return fmt.Errorf("%s has no rate for %s", p.fx.Name(), strings.Join(unknown, ", "))
 	}
+	return nil
+}
 
-	updates := make(map[string]float64)
-	for ticker, id := range coinGeckoIDs {
-		if val, ok := payload[id]; ok {
-			updates[key(models.AssetCrypto, ticker)] = val.USD
+// fetchChain asks each source whose breaker allows it for the tickers still
+// unpriced. Prices gathered so far are returned even when it also reports
+// an error for tickers no source could serve.
+func (p *Provider) fetchChain(ctx context.Context, assetType models.AssetType, tickers []string) (map[string]models.Quote, error) {
+	out := make(map[string]models.Quote)
+	pending := tickers
+	var errs []error
+
+	for _, g := range p.chains[assetType] {
+		if len(pending) == 0 {
+			break
+		}
+		if !g.breaker.Allow() {
+			errs = append(errs, fmt.Errorf("%s: circuit open", g.source.Name()))
+			continue
+		}
+		prices, err := g.source.Fetch(ctx, assetType, pending)
+		if err != nil {
+			g.breaker.Failure(err)
+			errs = append(errs, fmt.Errorf("%s: %w", g.source.Name(), err))
+			continue
 		}
+		g.breaker.Success()
+
+		fetchedAt := time.Now().UTC()
+		next := pending[:0:0]
+		for _, ticker := range pending {
+			if q, ok := prices[ticker]; ok && !math.IsNaN(q.Price) && q.Price > 0 {
+				q.Source = g.source.Name()
+				if q.Currency == "" {
+					q.Currency = models.DefaultCurrency
+				}
+				if q.FetchedAt.IsZero() {
+					q.FetchedAt = fetchedAt
+				}
+				out[ticker] = q
+				continue
+			}
+			next = append(next, ticker)
+		}
+		pending = next
 	}
-	return updates, nil
-}
 
-var coinGeckoIDs = map[string]string{
-	"BTC":     "bitcoin",
-	"BITCOIN": "bitcoin",
-	"ETH":     "ethereum",
-	"ETHEREUM":"ethereum",
-	"SOL":     "solana",
-	"SOLANA":  "solana",
-	"DOGE":    "dogecoin",
-	"ADA":     "cardano",
-	"XRP":     "ripple",
-	"DOT":     "polkadot",
-	"AVAX":    "avalanche-2",
-	"MATIC":   "matic-network",
-	"LINK":    "chainlink",
+	if len(pending) > 0 && len(errs) > 0 {
+		return out, errors.Join(errs...)
+	}
+	return out, nil
 }
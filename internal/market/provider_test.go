@@ -0,0 +1,210 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"portfoliopulse/internal/models"
+)
+
+type stubSource struct {
+	name   string
+	prices map[string]float64
+	err    error
+	calls  [][]string
+}
+
+func (s *stubSource) Name() string { return s.name }
+
+func (s *stubSource) Fetch(_ context.Context, _ models.AssetType, tickers []string) (map[string]models.Quote, error) {
+	s.calls = append(s.calls, append([]string(nil), tickers...))
+	if s.err != nil {
+		return nil, s.err
+	}
+	out := make(map[string]models.Quote)
+	for _, t := range tickers {
+		if v, ok := s.prices[t]; ok {
+			out[t] = models.Quote{Price: v}
+		}
+	}
+	return out, nil
+}
+
+func TestRefreshFallsThroughChain(t *testing.T) {
+	primary := &stubSource{name: "primary", prices: map[string]float64{"AAPL": 190}}
+	secondary := &stubSource{name: "secondary", prices: map[string]float64{"AAPL": 1, "MSFT": 410}}
+	p := NewProvider(Chains{models.AssetStock: {primary, secondary}})
+
+	holdings := []models.Holding{
+		{Ticker: "aapl", AssetType: models.AssetStock},
+		{Ticker: "MSFT", AssetType: models.AssetStock},
+	}
+	if err := p.Refresh(context.Background(), holdings); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if q, _ := p.GetQuote(models.AssetStock, "AAPL"); q.Price != 190 || q.Source != "primary" || q.FetchedAt.IsZero() {
+		t.Fatalf("expected stamped primary quote for AAPL, got %+v", q)
+	}
+	if price, _ := p.GetPrice(models.AssetStock, "MSFT"); price != 410 {
+		t.Fatalf("expected fallback price for MSFT, got %v", price)
+	}
+	if len(secondary.calls) != 1 || len(secondary.calls[0]) != 1 || secondary.calls[0][0] != "MSFT" {
+		t.Fatalf("secondary should only be asked for MSFT, got %v", secondary.calls)
+	}
+}
+
+func TestRefreshFallsBackOnError(t *testing.T) {
+	primary := &stubSource{name: "primary", err: errors.New("boom")}
+	secondary := &stubSource{name: "secondary", prices: map[string]float64{"BTC": 60000}}
+	p := NewProvider(Chains{models.AssetCrypto: {primary, secondary}})
+
+	if err := p.Refresh(context.Background(), []models.Holding{{Ticker: "BTC", AssetType: models.AssetCrypto}}); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if price, _ := p.GetPrice(models.AssetCrypto, "BTC"); price != 60000 {
+		t.Fatalf("expected fallback price, got %v", price)
+	}
+}
+
+func TestRegistryBuild(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("symbols") != "NVDA,AMD" || r.URL.Query().Get("assetType") != "stock" {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"nvda": 120.5, "amd": {"price": 150, "previousClose": 148, "marketTime": "2024-03-01T21:00:00Z"}}`))
+	}))
+	defer srv.Close()
+
+	chains, err := DefaultRegistry.Build("stock=jsonhttp:"+srv.URL+",yahoo; crypto=coingecko", srv.Client())
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if len(chains[models.AssetStock]) != 2 || chains[models.AssetStock][1].Name() != "yahoo" {
+		t.Fatalf("unexpected stock chain: %+v", chains[models.AssetStock])
+	}
+
+	prices, err := chains[models.AssetStock][0].Fetch(context.Background(), models.AssetStock, []string{"NVDA", "AMD"})
+	if err != nil {
+		t.Fatalf("jsonhttp fetch: %v", err)
+	}
+	if prices["NVDA"].Price != 120.5 || prices["AMD"].PreviousClose != 148 || prices["AMD"].MarketTime == nil {
+		t.Fatalf("unexpected jsonhttp prices: %v", prices)
+	}
+
+	if _, err := DefaultRegistry.Build("stock=nope", nil); err == nil {
+		t.Fatalf("expected unknown source error")
+	}
+}
+
+func TestBreakerOpensAndProbes(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.Failure(errors.New("one"))
+	if !b.Allow() {
+		t.Fatalf("breaker should stay closed below threshold")
+	}
+	b.Failure(errors.New("two"))
+	if b.Allow() || b.Status().State != models.BreakerOpen {
+		t.Fatalf("breaker should open at threshold, got %+v", b.Status())
+	}
+
+	now = now.Add(time.Minute)
+	if !b.Allow() {
+		t.Fatalf("breaker should admit a probe after cooldown")
+	}
+	if b.Allow() {
+		t.Fatalf("only one half-open probe should be admitted")
+	}
+	b.Failure(errors.New("probe failed"))
+	if b.Status().State != models.BreakerOpen {
+		t.Fatalf("failed probe should re-open, got %+v", b.Status())
+	}
+
+	now = now.Add(time.Minute)
+	if !b.Allow() {
+		t.Fatalf("breaker should admit a second probe")
+	}
+	b.Success()
+	if st := b.Status(); st.State != models.BreakerClosed || st.ConsecutiveFailures != 0 {
+		t.Fatalf("successful probe should close, got %+v", st)
+	}
+}
+
+func TestRefreshIsolatesFailingChain(t *testing.T) {
+	stocks := &stubSource{name: "stocks", prices: map[string]float64{"AAPL": 190}}
+	crypto := &stubSource{name: "crypto", err: errors.New("503")}
+	p := NewProvider(Chains{
+		models.AssetStock:  {stocks},
+		models.AssetCrypto: {crypto},
+	}, WithBreaker(1, time.Hour))
+
+	holdings := []models.Holding{
+		{Ticker: "AAPL", AssetType: models.AssetStock},
+		{Ticker: "BTC", AssetType: models.AssetCrypto},
+	}
+	if err := p.Refresh(context.Background(), holdings); err == nil {
+		t.Fatalf("expected crypto error to be reported")
+	}
+	if price, _ := p.GetPrice(models.AssetStock, "AAPL"); price != 190 {
+		t.Fatalf("stock prices should still update, got %v", price)
+	}
+
+	_ = p.Refresh(context.Background(), holdings)
+	if len(crypto.calls) != 1 {
+		t.Fatalf("open breaker should skip the source, got %d calls", len(crypto.calls))
+	}
+
+	health := p.SourceHealth()
+	if len(health) != 2 || health[0].AssetType != models.AssetCrypto || health[0].State != models.BreakerOpen {
+		t.Fatalf("unexpected source health: %+v", health)
+	}
+}
+
+func TestRefreshLoadsStaticFXRates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	if err := os.WriteFile(path, []byte(`{"base": "EUR", "rates": {"USD": 1.1, "JPY": 160}}`), 0o600); err != nil {
+		t.Fatalf("write rates: %v", err)
+	}
+	fx, err := DefaultRegistry.BuildFX("static:"+path, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("build fx: %v", err)
+	}
+
+	src := &stubSource{name: "stub", prices: map[string]float64{"7203": 2500}}
+	p := NewProvider(Chains{models.AssetStock: {src}}, WithFX(fx, "usd"))
+	holdings := []models.Holding{{Ticker: "7203", AssetType: models.AssetStock, Currency: "JPY"}}
+	if err := p.Refresh(context.Background(), holdings); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	rates := p.FXRates()
+	if rates.Base != "USD" || rates.Rates["USD"] != 1 || rates.Source != "static" {
+		t.Fatalf("unexpected fx snapshot: %+v", rates)
+	}
+	if got := rates.Rates["JPY"]; math.Abs(got-1.1/160) > 1e-12 {
+		t.Fatalf("expected JPY crossed through EUR, got %v", got)
+	}
+	if q, _ := p.GetQuote(models.AssetStock, "7203"); q.Currency != "USD" {
+		t.Fatalf("expected quotes without a currency to default to USD, got %q", q.Currency)
+	}
+
+	holdings = append(holdings, models.Holding{Ticker: "X", AssetType: models.AssetStock, Currency: "CHF"})
+	if err := p.Refresh(context.Background(), holdings); err == nil {
+		t.Fatalf("expected an error for a currency the source cannot convert")
+	}
+
+	if _, err := DefaultRegistry.BuildFX("nope", http.DefaultClient); err == nil {
+		t.Fatalf("expected unknown fx source to fail")
+	}
+}
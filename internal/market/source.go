@@ -0,0 +1,155 @@
+package market
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"portfoliopulse/internal/models"
+)
+
+// Source fetches latest quotes for a set of tickers of one asset type.
+// Results are keyed by the upper-cased ticker as passed in; tickers the
+// source cannot price are simply omitted so the next source in the chain
+// gets a chance at them. Sources fill whatever metadata they have; the
+// Provider stamps Source and FetchedAt.
+type Source interface {
+	Name() string
+	Fetch(ctx context.Context, assetType models.AssetType, tickers []string) (map[string]models.Quote, error)
+}
+
+// Factory builds a Source. arg is whatever followed "name:" in the chain
+// spec (empty when there was none), e.g. a base URL.
+type Factory func(arg string, client *http.Client) (Source, error)
+
+// Chains maps each asset type to its sources in priority order.
+type Chains map[models.AssetType][]Source
+
+// DefaultSpec reproduces the original hardwired behaviour.
+const DefaultSpec = "stock=yahoo;crypto=coingecko"
+
+type Registry struct {
+	mu          sync.RWMutex
+	factories   map[string]Factory
+	fxFactories map[string]FXFactory
+}
+
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[string]Factory), fxFactories: make(map[string]FXFactory)}
+}
+
+// Register adds or replaces the factory for name.
+func (r *Registry) Register(name string, f Factory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[strings.ToLower(name)] = f
+}
+
+// RegisterFX adds or replaces the FX source factory for name.
+func (r *Registry) RegisterFX(name string, f FXFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fxFactories[strings.ToLower(name)] = f
+}
+
+// BuildFX parses an FX source spec: a registered name, optionally followed
+// by ":" and an argument, e.g. "static:/etc/portfoliopulse/rates.json".
+func (r *Registry) BuildFX(spec string, client *http.Client) (FXSource, error) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	r.mu.RLock()
+	factory, ok := r.fxFactories[strings.ToLower(name)]
+	names := make([]string, 0, len(r.fxFactories))
+	for n := range r.fxFactories {
+		names = append(names, n)
+	}
+	r.mu.RUnlock()
+	if !ok {
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown fx source %q (registered: %s)", name, strings.Join(names, ", "))
+	}
+	src, err := factory(arg, client)
+	if err != nil {
+		return nil, fmt.Errorf("build fx source %q: %w", name, err)
+	}
+	return src, nil
+}
+
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Build parses a chain spec such as
+//
+//	stock=jsonhttp:https://quotes.internal/prices,yahoo;crypto=coingecko,yahoo
+//
+// Entries are separated by ";", sources within a chain by ",", and the
+// first source listed is the primary.
+func (r *Registry) Build(spec string, client *http.Client) (Chains, error) {
+	chains := make(Chains)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		assetType, list, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("market source entry %q: expected assetType=source[,source...]", entry)
+		}
+		at := models.AssetType(strings.ToLower(strings.TrimSpace(assetType)))
+
+		for _, item := range strings.Split(list, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			name, arg, _ := strings.Cut(item, ":")
+			r.mu.RLock()
+			factory, ok := r.factories[strings.ToLower(name)]
+			r.mu.RUnlock()
+			if !ok {
+				return nil, fmt.Errorf("unknown market source %q (registered: %s)", name, strings.Join(r.Names(), ", "))
+			}
+			src, err := factory(arg, client)
+			if err != nil {
+				return nil, fmt.Errorf("build market source %q: %w", name, err)
+			}
+			chains[at] = append(chains[at], src)
+		}
+		if len(chains[at]) == 0 {
+			return nil, fmt.Errorf("market source entry %q lists no sources", entry)
+		}
+	}
+	return chains, nil
+}
+
+// DefaultRegistry holds the built-in sources. Programs embedding the
+// market package can Register their own before calling Build.
+var DefaultRegistry = NewRegistry()
+
+func init() {
+	DefaultRegistry.Register("yahoo", func(_ string, client *http.Client) (Source, error) {
+		return NewYahooSource(client), nil
+	})
+	DefaultRegistry.Register("coingecko", func(arg string, client *http.Client) (Source, error) {
+		return NewCoinGeckoSource(client, arg), nil
+	})
+	DefaultRegistry.Register("jsonhttp", func(arg string, client *http.Client) (Source, error) {
+		return NewJSONHTTPSource(arg, client)
+	})
+	DefaultRegistry.RegisterFX("frankfurter", func(_ string, client *http.Client) (FXSource, error) {
+		return NewFrankfurterFXSource(client), nil
+	})
+	DefaultRegistry.RegisterFX("static", func(arg string, _ *http.Client) (FXSource, error) {
+		return NewStaticFXSource(arg)
+	})
+}
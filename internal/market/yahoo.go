@@ -0,0 +1,117 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"portfoliopulse/internal/models"
+)
+
+const yahooChartURL = "https://query2.finance.yahoo.com/v8/finance/chart/"
+
+// YahooSource reads Yahoo Finance chart metadata one symbol at a time. Crypto
+// tickers are quoted against USD using Yahoo's "BTC-USD" convention.
+type YahooSource struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+func NewYahooSource(client *http.Client) *YahooSource {
+	return &YahooSource{httpClient: client, baseURL: yahooChartURL}
+}
+
+func (y *YahooSource) Name() string { return "yahoo" }
+
+func (y *YahooSource) Fetch(ctx context.Context, assetType models.AssetType, tickers []string) (map[string]models.Quote, error) {
+	updates := make(map[string]models.Quote)
+	var lastErr error
+
+	for _, ticker := range tickers {
+		symbol := ticker
+		if assetType == models.AssetCrypto {
+			symbol = ticker + "-USD"
+		}
+		endpoint := fmt.Sprintf("%s%s?interval=1d&range=1d", y.baseURL, url.PathEscape(symbol))
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			continue
+		}
+		req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36")
+
+		resp, err := y.httpClient.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("fetch yahoo quote %s: %w", symbol, err)
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("yahoo status %d for %s", resp.StatusCode, symbol)
+			continue
+		}
+
+		var payload struct {
+			Chart struct {
+				Result []struct {
+					Meta struct {
+						Symbol             string  `json:"symbol"`
+						Currency           string  `json:"currency"`
+						RegularMarketPrice float64 `json:"regularMarketPrice"`
+						RegularMarketTime  int64   `json:"regularMarketTime"`
+						PreviousClose      float64 `json:"previousClose"`
+						ChartPreviousClose float64 `json:"chartPreviousClose"`
+					} `json:"meta"`
+				} `json:"result"`
+			} `json:"chart"`
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+			resp.Body.Close()
+			continue
+		}
+		resp.Body.Close()
+
+		if len(payload.Chart.Result) > 0 {
+			meta := payload.Chart.Result[0].Meta
+			if strings.EqualFold(meta.Symbol, symbol) {
+				q := models.Quote{Price: meta.RegularMarketPrice, PreviousClose: meta.PreviousClose}
+				if q.PreviousClose == 0 {
+					q.PreviousClose = meta.ChartPreviousClose
+				}
+				q.Currency = meta.Currency
+				if major, ok := minorUnits[meta.Currency]; ok {
+					// London and Johannesburg quote in pence and cents.
+					q.Currency = major
+					q.Price /= 100
+					q.PreviousClose /= 100
+				}
+				if meta.RegularMarketTime > 0 {
+					t := time.Unix(meta.RegularMarketTime, 0).UTC()
+					q.MarketTime = &t
+				}
+				updates[ticker] = q
+			}
+		}
+	}
+
+	// Individual misses fall through to the next source, but if nothing at
+	// all came back the upstream itself is likely down.
+	if len(updates) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return updates, nil
+}
+
+// minorUnits maps Yahoo's sub-unit currency codes to their main currency.
+var minorUnits = map[string]string{
+	"GBp": "GBP",
+	"GBX": "GBP",
+	"ZAc": "ZAR",
+	"ILA": "ILS",
+}
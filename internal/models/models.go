@@ -1,55 +1,958 @@
 package models
 
-import "time"
+import (
+	"slices"
+	"time"
+)
 
 type AssetType string
 
 const (
 	AssetStock  AssetType = "stock"
 	AssetCrypto AssetType = "crypto"
+	// AssetCash marks uninvested money. It is never priced by a market
+	// source; one unit is worth one unit of its currency.
+	AssetCash AssetType = "cash"
 )
 
-type Holding struct {
+// DefaultPortfolioID is the portfolio that always exists. Holdings and
+// alerts created without a portfolio land in it.
+const DefaultPortfolioID int64 = 1
+
+type Portfolio struct {
 	ID        int64     `json:"id"`
-	Ticker    string    `json:"ticker"`
-	AssetType AssetType `json:"assetType"`
-	Quantity  float64   `json:"quantity"`
-	AvgCost   float64   `json:"avgCost"`
+	Name      string    `json:"name"`
 	CreatedAt time.Time `json:"createdAt"`
 }
 
+// DefaultCurrency is what prices were assumed to be in before currencies
+// were tracked, and what a holding or quote without one is taken to be in.
+const DefaultCurrency = "USD"
+
+// Holding amounts (AvgCost, RealizedPnL) are in the holding's own Currency.
+// CostFXRate is the cost-weighted base-currency rate the open lots were
+// bought at; zero when no lot recorded one.
+type Holding struct {
+	ID          int64     `json:"id"`
+	PortfolioID int64     `json:"portfolioId"`
+	Ticker      string    `json:"ticker"`
+	AssetType   AssetType `json:"assetType"`
+	Currency    string    `json:"currency"`
+	Quantity    float64   `json:"quantity"`
+	AvgCost     float64   `json:"avgCost"`
+	CostFXRate  float64   `json:"costFxRate,omitempty"`
+	RealizedPnL float64   `json:"realizedPnl"`
+	Tags        []string  `json:"tags,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type TransactionType string
+
+const (
+	TxBuy         TransactionType = "buy"
+	TxSell        TransactionType = "sell"
+	TxFee         TransactionType = "fee"
+	TxTransferIn  TransactionType = "transfer_in"
+	TxTransferOut TransactionType = "transfer_out"
+	// TxSpinOff opens a lot like a buy but moves no cash: it is cost
+	// carried over from a spin-off parent.
+	TxSpinOff TransactionType = "spin_off"
+	// TxCostAdjust takes the fraction Price off the unit cost of each lot
+	// in Lots that is still open at its time. Spin-offs record one on the
+	// parent so the cost they move leaves earlier sales alone.
+	TxCostAdjust TransactionType = "cost_adjustment"
+)
+
+// CostMethod selects which lots a sell or transfer-out closes.
+type CostMethod string
+
+const (
+	CostFIFO     CostMethod = "fifo"
+	CostLIFO     CostMethod = "lifo"
+	CostHIFO     CostMethod = "hifo"
+	CostAverage  CostMethod = "average"
+	CostSpecific CostMethod = "specific"
+)
+
+type LotSelection struct {
+	LotID    int64   `json:"lotId"`
+	Quantity float64 `json:"quantity"`
+}
+
+// Transaction amounts are in the holding's Currency. FXRate is how many
+// units of the base currency one unit of it was worth when executed; zero
+// means unknown. CashSettled trades are paid from, or paid into, the
+// portfolio's cash account in that currency.
+type Transaction struct {
+	ID          int64           `json:"id"`
+	PortfolioID int64           `json:"portfolioId"`
+	HoldingID   int64           `json:"holdingId"`
+	Ticker      string          `json:"ticker"`
+	AssetType   AssetType       `json:"assetType"`
+	Currency    string          `json:"currency"`
+	Type        TransactionType `json:"type"`
+	Quantity    float64         `json:"quantity"`
+	Price       float64         `json:"price"`
+	Fee         float64         `json:"fee"`
+	FXRate      float64         `json:"fxRate,omitempty"`
+	CostMethod  CostMethod      `json:"costMethod,omitempty"`
+	Lots        []LotSelection  `json:"lots,omitempty"`
+	CashSettled bool            `json:"cashSettled"`
+	ExecutedAt  time.Time       `json:"executedAt"`
+	Note        string          `json:"note,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+}
+
+// Lot is an open tax lot. Its ID is the ID of the buy or transfer-in that
+// opened it, which is also what specific-lot sells reference.
+type Lot struct {
+	ID          int64     `json:"id"`
+	HoldingID   int64     `json:"holdingId"`
+	Ticker      string    `json:"ticker"`
+	AssetType   AssetType `json:"assetType"`
+	AcquiredAt  time.Time `json:"acquiredAt"`
+	Quantity    float64   `json:"quantity"`
+	Remaining   float64   `json:"remaining"`
+	CostPerUnit float64   `json:"costPerUnit"`
+	FXRate      float64   `json:"fxRate,omitempty"`
+}
+
+// RealizedGain is the slice of one sell that closed (part of) one lot.
+// Standalone fees with no open lot to absorb them appear with LotID 0.
+type RealizedGain struct {
+	TransactionID int64      `json:"transactionId"`
+	LotID         int64      `json:"lotId"`
+	HoldingID     int64      `json:"holdingId"`
+	Ticker        string     `json:"ticker"`
+	AssetType     AssetType  `json:"assetType"`
+	Currency      string     `json:"currency,omitempty"`
+	Method        CostMethod `json:"method,omitempty"`
+	Quantity      float64    `json:"quantity"`
+	Proceeds      float64    `json:"proceeds"`
+	CostBasis     float64    `json:"costBasis"`
+	Gain          float64    `json:"gain"`
+	AcquiredAt    *time.Time `json:"acquiredAt,omitempty"`
+	SoldAt        time.Time  `json:"soldAt"`
+}
+
+type RealizedReport struct {
+	From          *time.Time     `json:"from,omitempty"`
+	To            *time.Time     `json:"to,omitempty"`
+	Gains         []RealizedGain `json:"gains"`
+	TotalProceeds float64        `json:"totalProceeds"`
+	TotalCost     float64        `json:"totalCost"`
+	TotalGain     float64        `json:"totalGain"`
+}
+
+// HoldingTerm is how long a lot has been held for tax purposes: long term
+// after more than a year.
+type HoldingTerm string
+
+const (
+	TermShort HoldingTerm = "short"
+	TermLong  HoldingTerm = "long"
+)
+
+// HarvestLot is an open lot currently worth less than it cost. Quantity,
+// CostPerUnit and Price are in the holding's currency; CostBasis (at the
+// lot's own rate), MarketValue, Loss and EstimatedSavings are in the base
+// currency. WashSale flags another buy of the same ticker, in any
+// portfolio, within the last WashSaleDays, the latest at LastBuyAt.
+type HarvestLot struct {
+	LotID            int64       `json:"lotId"`
+	HoldingID        int64       `json:"holdingId"`
+	PortfolioID      int64       `json:"portfolioId"`
+	Ticker           string      `json:"ticker"`
+	AssetType        AssetType   `json:"assetType"`
+	Currency         string      `json:"currency"`
+	AcquiredAt       time.Time   `json:"acquiredAt"`
+	DaysHeld         int         `json:"daysHeld"`
+	Term             HoldingTerm `json:"term"`
+	Quantity         float64     `json:"quantity"`
+	CostPerUnit      float64     `json:"costPerUnit"`
+	Price            float64     `json:"price"`
+	CostBasis        float64     `json:"costBasis"`
+	MarketValue      float64     `json:"marketValue"`
+	Loss             float64     `json:"loss"`
+	EstimatedSavings float64     `json:"estimatedSavings"`
+	WashSale         bool        `json:"washSale"`
+	LastBuyAt        *time.Time  `json:"lastBuyAt,omitempty"`
+}
+
+// WashSaleDays is how far back a buy of the same ticker makes selling a lot
+// at a loss a wash sale.
+const WashSaleDays = 30
+
+// HarvestReport lists every lot that could be sold at a loss, largest loss
+// first. Losses are negative; savings apply each term's tax rate to them.
+type HarvestReport struct {
+	AsOf             time.Time    `json:"asOf"`
+	BaseCurrency     string       `json:"baseCurrency"`
+	ShortTermRatePct float64      `json:"shortTermRatePct"`
+	LongTermRatePct  float64      `json:"longTermRatePct"`
+	Lots             []HarvestLot `json:"lots"`
+	ShortTermLoss    float64      `json:"shortTermLoss"`
+	LongTermLoss     float64      `json:"longTermLoss"`
+	TotalLoss        float64      `json:"totalLoss"`
+	EstimatedSavings float64      `json:"estimatedSavings"`
+}
+
+// CashAccount holds one currency of uninvested money in a portfolio. Its
+// Balance is derived from its movements and the trades settled against it,
+// and may go negative when trades outrun deposits.
+type CashAccount struct {
+	ID          int64     `json:"id"`
+	PortfolioID int64     `json:"portfolioId"`
+	Currency    string    `json:"currency"`
+	Balance     float64   `json:"balance"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type CashMovementType string
+
+const (
+	CashDeposit    CashMovementType = "deposit"
+	CashWithdrawal CashMovementType = "withdrawal"
+	CashDividend   CashMovementType = "dividend"
+	CashInterest   CashMovementType = "interest"
+	CashFee        CashMovementType = "fee"
+	// CashTrade is a settled buy, sell or fee transaction as seen from the
+	// cash account. It has no ID of its own; TransactionID points at it.
+	CashTrade CashMovementType = "trade"
+)
+
+// Credits reports whether a movement of this type adds to the balance.
+func (t CashMovementType) Credits() bool {
+	return t == CashDeposit || t == CashDividend || t == CashInterest
+}
+
+// CashMovement changes a cash account's balance. Amount is signed:
+// positive credits the account. FXRate is the base-currency rate when it
+// was booked, as on transactions. Income paid into the account appears as
+// a dividend or interest movement with its IncomeID and no ID of its own.
+type CashMovement struct {
+	ID            int64            `json:"id,omitempty"`
+	AccountID     int64            `json:"accountId"`
+	PortfolioID   int64            `json:"portfolioId"`
+	Currency      string           `json:"currency"`
+	Type          CashMovementType `json:"type"`
+	Amount        float64          `json:"amount"`
+	FXRate        float64          `json:"fxRate,omitempty"`
+	TransactionID int64            `json:"transactionId,omitempty"`
+	IncomeID      int64            `json:"incomeId,omitempty"`
+	ExecutedAt    time.Time        `json:"executedAt"`
+	Note          string           `json:"note,omitempty"`
+	CreatedAt     time.Time        `json:"createdAt"`
+}
+
+type IncomeType string
+
+const (
+	IncomeDividend IncomeType = "dividend"
+	IncomeInterest IncomeType = "interest"
+	IncomeStaking  IncomeType = "staking"
+)
+
+// IncomeEvent is income a holding paid. Amount is its value in the holding's
+// currency. A reinvested event bought Quantity units at Price through the
+// buy transaction TransactionID, which opens a lot like any other buy;
+// staking rewards are always received this way. Income that was not
+// reinvested is CashSettled when it was paid into a cash account.
+type IncomeEvent struct {
+	ID            int64      `json:"id"`
+	PortfolioID   int64      `json:"portfolioId"`
+	HoldingID     int64      `json:"holdingId"`
+	Ticker        string     `json:"ticker"`
+	AssetType     AssetType  `json:"assetType"`
+	Currency      string     `json:"currency"`
+	Type          IncomeType `json:"type"`
+	Amount        float64    `json:"amount"`
+	Reinvested    bool       `json:"reinvested"`
+	Quantity      float64    `json:"quantity,omitempty"`
+	Price         float64    `json:"price,omitempty"`
+	TransactionID int64      `json:"transactionId,omitempty"`
+	CashSettled   bool       `json:"cashSettled"`
+	FXRate        float64    `json:"fxRate,omitempty"`
+	PaidAt        time.Time  `json:"paidAt"`
+	Note          string     `json:"note,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+// HoldingIncome is one holding's trailing-twelve-month income in the base
+// currency. YieldOnCostPct divides it by what the open position cost;
+// CurrentYieldPct by what it is worth today.
+type HoldingIncome struct {
+	HoldingID       int64      `json:"holdingId"`
+	PortfolioID     int64      `json:"portfolioId"`
+	Ticker          string     `json:"ticker"`
+	AssetType       AssetType  `json:"assetType"`
+	TTMIncome       float64    `json:"ttmIncome"`
+	CostBasis       float64    `json:"costBasis"`
+	MarketValue     float64    `json:"marketValue"`
+	YieldOnCostPct  float64    `json:"yieldOnCostPct"`
+	CurrentYieldPct float64    `json:"currentYieldPct"`
+	LastPaidAt      *time.Time `json:"lastPaidAt,omitempty"`
+}
+
+type IncomeSummary struct {
+	From            time.Time              `json:"from"`
+	To              time.Time              `json:"to"`
+	BaseCurrency    string                 `json:"baseCurrency"`
+	TTMIncome       float64                `json:"ttmIncome"`
+	ByType          map[IncomeType]float64 `json:"byType"`
+	YieldOnCostPct  float64                `json:"yieldOnCostPct"`
+	CurrentYieldPct float64                `json:"currentYieldPct"`
+	Holdings        []HoldingIncome        `json:"holdings"`
+}
+
+// IncomeMonth totals one calendar month of income in the base currency.
+type IncomeMonth struct {
+	Month  string                 `json:"month"`
+	Total  float64                `json:"total"`
+	ByType map[IncomeType]float64 `json:"byType"`
+	Events []IncomeEvent          `json:"events"`
+}
+
+type IncomeCalendar struct {
+	Year         int           `json:"year"`
+	BaseCurrency string        `json:"baseCurrency"`
+	Total        float64       `json:"total"`
+	Months       []IncomeMonth `json:"months"`
+}
+
+type CorporateActionType string
+
+const (
+	ActionSplit        CorporateActionType = "split"
+	ActionReverseSplit CorporateActionType = "reverse_split"
+	ActionTickerChange CorporateActionType = "ticker_change"
+	ActionSpinOff      CorporateActionType = "spin_off"
+	ActionMerger       CorporateActionType = "merger"
+)
+
+// CorporateAction is an applied split, reverse split, ticker change, spin-off
+// or merger of Ticker. Ratio is new shares per old share (for spin-offs, new
+// NewTicker shares per Ticker share) and CostFraction is the share of the
+// parent's cost basis a spin-off moves to NewTicker.
+type CorporateAction struct {
+	ID           int64                   `json:"id"`
+	Type         CorporateActionType     `json:"type"`
+	AssetType    AssetType               `json:"assetType"`
+	Ticker       string                  `json:"ticker"`
+	NewTicker    string                  `json:"newTicker,omitempty"`
+	Ratio        float64                 `json:"ratio,omitempty"`
+	CostFraction float64                 `json:"costFraction,omitempty"`
+	EffectiveAt  time.Time               `json:"effectiveAt"`
+	Note         string                  `json:"note,omitempty"`
+	AppliedAt    time.Time               `json:"appliedAt"`
+	Changes      []CorporateActionChange `json:"changes,omitempty"`
+}
+
+// CorporateActionChange is one audit entry of what applying an action
+// rewrote. Row-level entries carry the old and new value (an empty OldValue
+// marks a row the action created); bulk price history rewrites carry the
+// Factor prices were multiplied by and how many Rows it touched.
+type CorporateActionChange struct {
+	Entity   string  `json:"entity"`
+	EntityID int64   `json:"entityId,omitempty"`
+	Field    string  `json:"field"`
+	OldValue string  `json:"oldValue,omitempty"`
+	NewValue string  `json:"newValue,omitempty"`
+	Factor   float64 `json:"factor,omitempty"`
+	Rows     int64   `json:"rows"`
+}
+
 type AlertDirection string
 
 const (
 	AlertAbove AlertDirection = "above"
 	AlertBelow AlertDirection = "below"
+	// AlertEither fires on a move of at least the threshold either way and
+	// only applies to percent alerts.
+	AlertEither AlertDirection = "either"
+	// AlertTrailing fires when the price falls Threshold (a percent or an
+	// amount, per Trail) below the highest price seen since creation.
+	AlertTrailing AlertDirection = "trailing"
+)
+
+// TrailUnit says whether a trailing alert's threshold is a percent of the
+// peak or an absolute price amount.
+type TrailUnit string
+
+const (
+	TrailPercent TrailUnit = "percent"
+	TrailAmount  TrailUnit = "amount"
+)
+
+// AlertMode says what happens after an alert fires: once stays triggered
+// until re-armed by hand, rearm re-arms itself when the value crosses back
+// past the threshold by Hysteresis, and cooldown fires again whenever the
+// condition holds, at most every CooldownMinutes.
+type AlertMode string
+
+const (
+	AlertOnce     AlertMode = "once"
+	AlertRearm    AlertMode = "rearm"
+	AlertCooldown AlertMode = "cooldown"
+)
+
+// AlertSeverity grades an alert for routing to notification channels.
+type AlertSeverity string
+
+const (
+	SeverityInfo     AlertSeverity = "info"
+	SeverityWarning  AlertSeverity = "warning"
+	SeverityCritical AlertSeverity = "critical"
+)
+
+// Rank orders severities from info (1) to critical (3); unknown ones rank 0.
+func (s AlertSeverity) Rank() int {
+	switch s {
+	case SeverityInfo:
+		return 1
+	case SeverityWarning:
+		return 2
+	case SeverityCritical:
+		return 3
+	}
+	return 0
+}
+
+// AlertScope says whether an alert watches one ticker or the combined
+// portfolio snapshot.
+type AlertScope string
+
+const (
+	ScopeTicker    AlertScope = "ticker"
+	ScopePortfolio AlertScope = "portfolio"
+)
+
+// AlertKind selects what an alert's threshold is compared with: the price
+// itself, or the percent move from a reference price. Portfolio-scoped
+// alerts use the Total and portfolio percent kinds instead.
+type AlertKind string
+
+const (
+	AlertPrice AlertKind = "price"
+	// AlertChange compares with the recorded price WindowMinutes ago.
+	AlertChange AlertKind = "change"
+	// AlertFromCost compares with the holding's average cost.
+	AlertFromCost AlertKind = "cost"
+	// AlertFromClose compares with the previous daily close.
+	AlertFromClose AlertKind = "close"
+
+	// AlertTotalValue and AlertTotalPnL compare with the snapshot's total
+	// value and unrealized P&L, in the base currency.
+	AlertTotalValue AlertKind = "total_value"
+	AlertTotalPnL   AlertKind = "total_pnl"
+	// AlertDayChange compares with the last end-of-day total value.
+	AlertDayChange AlertKind = "day_change"
+	// AlertDrawdown compares with the highest total value seen.
+	AlertDrawdown AlertKind = "drawdown"
+	// AlertDrift compares the alert's portfolio with its target weights,
+	// in percentage points.
+	AlertDrift AlertKind = "drift"
+
+	// AlertExpression fires while its Expression holds; it has no
+	// direction or threshold.
+	AlertExpression AlertKind = "expression"
 )
 
+// Percent reports whether the alert's threshold is a percent move.
+func (k AlertKind) Percent() bool {
+	switch k {
+	case AlertChange, AlertFromCost, AlertFromClose, AlertDayChange, AlertDrawdown, AlertDrift:
+		return true
+	}
+	return false
+}
+
+// Portfolio reports whether the kind applies to portfolio-scoped alerts.
+func (k AlertKind) Portfolio() bool {
+	switch k {
+	case AlertTotalValue, AlertTotalPnL, AlertDayChange, AlertDrawdown, AlertDrift:
+		return true
+	}
+	return false
+}
+
+// PriceAlert is a ticker alert, or with Scope portfolio an alert on the
+// combined portfolio snapshot, which has no Ticker or AssetType. Expression
+// alerts are portfolio-scoped too, whatever tickers they read.
 type PriceAlert struct {
-	ID         int64          `json:"id"`
-	Ticker     string         `json:"ticker"`
-	AssetType  AssetType      `json:"assetType"`
-	Direction  AlertDirection `json:"direction"`
-	Threshold  float64        `json:"threshold"`
-	CreatedAt  time.Time      `json:"createdAt"`
-	Triggered  bool           `json:"triggered"`
-	TriggeredAt *time.Time    `json:"triggeredAt,omitempty"`
+	ID          int64          `json:"id"`
+	PortfolioID int64          `json:"portfolioId"`
+	Scope       AlertScope     `json:"scope"`
+	Ticker      string         `json:"ticker"`
+	AssetType   AssetType      `json:"assetType"`
+	Kind        AlertKind      `json:"kind"`
+	Direction   AlertDirection `json:"direction"`
+	// Threshold is a price or portfolio amount, or for percent kinds a
+	// positive percentage ("below" 10 fires on a drop of 10% or more).
+	Threshold float64 `json:"threshold"`
+	// Expression is an expression alert's condition in canonical form,
+	// e.g. price("BTC", "crypto") / price("ETH", "crypto") > 20.
+	Expression    string    `json:"expression,omitempty"`
+	WindowMinutes int       `json:"windowMinutes,omitempty"`
+	Trail         TrailUnit `json:"trail,omitempty"`
+	// HighWaterMark is the highest price a trailing alert has seen (the
+	// highest total value for a drawdown alert), kept across restarts, and
+	// StopPrice the level a trailing alert fires at.
+	HighWaterMark float64    `json:"highWaterMark,omitempty"`
+	HighWaterAt   *time.Time `json:"highWaterAt,omitempty"`
+	StopPrice     float64    `json:"stopPrice,omitempty"`
+	Mode          AlertMode  `json:"mode"`
+	// Hysteresis is in the threshold's units (a price, or percentage
+	// points for percent kinds and percent trails).
+	Hysteresis      float64       `json:"hysteresis,omitempty"`
+	CooldownMinutes int           `json:"cooldownMinutes,omitempty"`
+	Severity        AlertSeverity `json:"severity"`
+	// Channels names the stored channels the alert goes to, in place of
+	// the ones whose rules match it.
+	Channels  []string  `json:"channels,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Triggered means the alert is disarmed; TriggeredAt is when it last
+	// fired and FireCount how often, per its alert_events history.
+	Triggered   bool       `json:"triggered"`
+	TriggeredAt *time.Time `json:"triggeredAt,omitempty"`
+	FireCount   int        `json:"fireCount"`
+	// Reference and ChangePct are set on fired percent alerts: the price
+	// the move was measured from and the move itself.
+	Reference float64 `json:"reference,omitempty"`
+	ChangePct float64 `json:"changePct,omitempty"`
+	// Drift is set on fired drift alerts: every bucket past the threshold.
+	Drift []AllocationDrift `json:"drift,omitempty"`
+	// Values is set on fired expression alerts: every function and field
+	// the expression read, keyed as written.
+	Values map[string]float64 `json:"values,omitempty"`
+	// EventID is set on fired alerts: the alert_events entry of this
+	// firing.
+	EventID int64 `json:"eventId,omitempty"`
+}
+
+// AlertEvent is one firing of an alert, with what was observed when it
+// fired: Price for ticker alerts (zero for portfolio and expression
+// alerts) and the TotalValue of the alert's portfolio. Deliveries are the
+// notifications sent for it. An event stays unacknowledged until
+// AcknowledgedAt is set.
+type AlertEvent struct {
+	ID             int64                  `json:"id"`
+	AlertID        int64                  `json:"alertId"`
+	PortfolioID    int64                  `json:"portfolioId"`
+	FiredAt        time.Time              `json:"firedAt"`
+	Price          float64                `json:"price,omitempty"`
+	TotalValue     float64                `json:"totalValue"`
+	Note           string                 `json:"note"`
+	AcknowledgedAt *time.Time             `json:"acknowledgedAt,omitempty"`
+	Deliveries     []NotificationDelivery `json:"deliveries"`
+}
+
+// ChannelType is the payload format a notification channel posts.
+type ChannelType string
+
+const (
+	// ChannelWebhook posts the event itself, or a custom template.
+	ChannelWebhook  ChannelType = "webhook"
+	ChannelSlack    ChannelType = "slack"
+	ChannelDiscord  ChannelType = "discord"
+	ChannelTelegram ChannelType = "telegram"
+	ChannelNtfy     ChannelType = "ntfy"
+)
+
+// NotificationChannel is a named destination for fired alerts, kept in
+// SQLite. ChatID is the Telegram chat and Template only applies to webhook
+// channels. The channel receives the alerts any of its Rules match, or
+// every alert when it has none. API responses leave Secret out, setting
+// HasSecret instead, and mask header values.
+type NotificationChannel struct {
+	ID        int64             `json:"id"`
+	Name      string            `json:"name"`
+	Type      ChannelType       `json:"type"`
+	URL       string            `json:"url"`
+	ChatID    string            `json:"chatId,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Secret    string            `json:"secret,omitempty"`
+	HasSecret bool              `json:"hasSecret"`
+	Template  string            `json:"template,omitempty"`
+	Rules     []ChannelRule     `json:"rules"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// ChannelRule matches alerts on the ticker, the asset type and a minimum
+// severity. Empty fields match any alert.
+type ChannelRule struct {
+	Ticker      string        `json:"ticker,omitempty"`
+	AssetType   AssetType     `json:"assetType,omitempty"`
+	MinSeverity AlertSeverity `json:"minSeverity,omitempty"`
+}
+
+func (r ChannelRule) Matches(a PriceAlert) bool {
+	return (r.Ticker == "" || r.Ticker == a.Ticker) &&
+		(r.AssetType == "" || r.AssetType == a.AssetType) &&
+		(r.MinSeverity == "" || a.Severity.Rank() >= r.MinSeverity.Rank())
+}
+
+// Routes reports whether alert a goes to channel c: whether a names c, or
+// for an alert naming no channels whether one of c's rules matches it.
+func (c NotificationChannel) Routes(a PriceAlert) bool {
+	if len(a.Channels) > 0 {
+		return slices.Contains(a.Channels, c.Name)
+	}
+	if len(c.Rules) == 0 {
+		return true
+	}
+	for _, r := range c.Rules {
+		if r.Matches(a) {
+			return true
+		}
+	}
+	return false
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// NotificationDelivery logs sending one event to one notification channel.
+// It stays pending while retries remain; ResponseCode and Error describe
+// the latest attempt.
+type NotificationDelivery struct {
+	ID           int64          `json:"id"`
+	Channel      string         `json:"channel"`
+	ChannelType  string         `json:"channelType"`
+	Event        string         `json:"event"`
+	AlertID      int64          `json:"alertId,omitempty"`
+	EventID      int64          `json:"eventId,omitempty"`
+	Status       DeliveryStatus `json:"status"`
+	Attempts     int            `json:"attempts"`
+	ResponseCode int            `json:"responseCode,omitempty"`
+	Error        string         `json:"error,omitempty"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	UpdatedAt    time.Time      `json:"updatedAt"`
+	DeliveredAt  *time.Time     `json:"deliveredAt,omitempty"`
+}
+
+// TrailingStop is the price a trailing alert fires at given its current
+// high-water mark, or zero for other alerts and before a peak is seen.
+func (a PriceAlert) TrailingStop() float64 {
+	if a.Direction != AlertTrailing || a.HighWaterMark <= 0 {
+		return 0
+	}
+	if a.Trail == TrailAmount {
+		return a.HighWaterMark - a.Threshold
+	}
+	return a.HighWaterMark * (1 - a.Threshold/100)
+}
+
+// Quote is the latest price for one ticker along with where and when it
+// came from. MarketTime is the exchange's own timestamp when the source
+// reports one; FetchedAt is when we received it. Price and PreviousClose
+// are in Currency.
+type Quote struct {
+	Price         float64    `json:"price"`
+	Currency      string     `json:"currency,omitempty"`
+	Source        string     `json:"source"`
+	FetchedAt     time.Time  `json:"fetchedAt"`
+	MarketTime    *time.Time `json:"marketTime,omitempty"`
+	PreviousClose float64    `json:"previousClose,omitempty"`
+}
+
+// PriceTick is one observed price, as persisted to price history.
+type PriceTick struct {
+	AssetType AssetType `json:"assetType"`
+	Ticker    string    `json:"ticker"`
+	Price     float64   `json:"price"`
+	Source    string    `json:"source,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// BarInterval is a price history resolution. BarTick means raw ticks.
+type BarInterval string
+
+const (
+	BarTick   BarInterval = "tick"
+	BarMinute BarInterval = "1m"
+	BarHour   BarInterval = "1h"
+	BarDay    BarInterval = "1d"
+)
+
+// Duration is the bucket width of a rolled-up interval, or zero for ticks.
+func (b BarInterval) Duration() time.Duration {
+	switch b {
+	case BarMinute:
+		return time.Minute
+	case BarHour:
+		return time.Hour
+	case BarDay:
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+type PriceBar struct {
+	Start time.Time `json:"start"`
+	Open  float64   `json:"open"`
+	High  float64   `json:"high"`
+	Low   float64   `json:"low"`
+	Close float64   `json:"close"`
+	Ticks int       `json:"ticks"`
+}
+
+type PriceHistory struct {
+	AssetType AssetType   `json:"assetType"`
+	Ticker    string      `json:"ticker"`
+	Interval  BarInterval `json:"interval"`
+	From      time.Time   `json:"from"`
+	To        time.Time   `json:"to"`
+	Bars      []PriceBar  `json:"bars"`
 }
 
+// HoldingWithPrice values a holding. Price and the Local* fields are in the
+// holding's currency; MarketValue, CostBasis and the P&L fields are in the
+// base currency. PnL splits into PricePnL, from the asset moving in its own
+// currency, and FXPnL, from that currency moving against the base since the
+// open lots were bought.
 type HoldingWithPrice struct {
 	Holding
-	Price      float64 `json:"price"`
-	MarketValue float64 `json:"marketValue"`
-	CostBasis  float64 `json:"costBasis"`
-	PnL        float64 `json:"pnl"`
-	PnLPct     float64 `json:"pnlPct"`
+	Price            float64    `json:"price"`
+	FXRate           float64    `json:"fxRate"`
+	LocalMarketValue float64    `json:"localMarketValue"`
+	LocalCostBasis   float64    `json:"localCostBasis"`
+	MarketValue      float64    `json:"marketValue"`
+	CostBasis        float64    `json:"costBasis"`
+	PnL              float64    `json:"pnl"`
+	PnLPct           float64    `json:"pnlPct"`
+	PricePnL         float64    `json:"pricePnl"`
+	FXPnL            float64    `json:"fxPnl"`
+	PriceAsOf        *time.Time `json:"priceAsOf,omitempty"`
+	Source           string     `json:"source,omitempty"`
+	Stale            bool       `json:"stale"`
 }
 
+// CashValue is a cash account's balance converted to the base currency.
+type CashValue struct {
+	AccountID   int64   `json:"accountId"`
+	PortfolioID int64   `json:"portfolioId"`
+	Currency    string  `json:"currency"`
+	Balance     float64 `json:"balance"`
+	FXRate      float64 `json:"fxRate"`
+	Value       float64 `json:"value"`
+	Stale       bool    `json:"stale"`
+}
+
+// AllocationSlice is one position's share of a snapshot's TotalValue.
+// Holdings of the same ticker are merged, and cash appears once per
+// currency with AssetType cash and the currency as its Label.
+type AllocationSlice struct {
+	Label     string    `json:"label"`
+	AssetType AssetType `json:"assetType"`
+	Value     float64   `json:"value"`
+	WeightPct float64   `json:"weightPct"`
+}
+
+// TargetBucket says what an allocation target groups holdings by.
+type TargetBucket string
+
+const (
+	BucketTicker    TargetBucket = "ticker"
+	BucketAssetType TargetBucket = "asset_type"
+	BucketTag       TargetBucket = "tag"
+)
+
+// AllocationTarget is the weight a portfolio aims to hold in one bucket: a
+// ticker (with its AssetType), an asset type (Key is the type, cash
+// included) or a holding tag.
+type AllocationTarget struct {
+	PortfolioID int64        `json:"portfolioId"`
+	Bucket      TargetBucket `json:"bucket"`
+	AssetType   AssetType    `json:"assetType,omitempty"`
+	Key         string       `json:"key"`
+	WeightPct   float64      `json:"weightPct"`
+}
+
+// AllocationDrift compares a target with the bucket's current share of the
+// portfolio's TotalValue. DriftPct is CurrentPct - TargetPct.
+type AllocationDrift struct {
+	Bucket     TargetBucket `json:"bucket"`
+	AssetType  AssetType    `json:"assetType,omitempty"`
+	Key        string       `json:"key"`
+	TargetPct  float64      `json:"targetPct"`
+	CurrentPct float64      `json:"currentPct"`
+	DriftPct   float64      `json:"driftPct"`
+	Value      float64      `json:"value"`
+}
+
+// RebalanceTrade is one proposed buy or sell of a holding. Quantity is in
+// the holding's units and Price in its currency; Value is in the base
+// currency.
+type RebalanceTrade struct {
+	HoldingID int64           `json:"holdingId"`
+	Ticker    string          `json:"ticker"`
+	AssetType AssetType       `json:"assetType"`
+	Currency  string          `json:"currency"`
+	Side      TransactionType `json:"side"`
+	Quantity  float64         `json:"quantity"`
+	Price     float64         `json:"price"`
+	Value     float64         `json:"value"`
+}
+
+// RebalancePlan is a dry run of the trades that move a portfolio toward its
+// targets; nothing is recorded. Amounts are in BaseCurrency. TotalValue
+// includes Contribution, and Before and After compare each target with the
+// portfolio now and once the trades are done.
+type RebalancePlan struct {
+	PortfolioID  int64             `json:"portfolioId"`
+	BaseCurrency string            `json:"baseCurrency"`
+	DryRun       bool              `json:"dryRun"`
+	TotalValue   float64           `json:"totalValue"`
+	Contribution float64           `json:"contribution"`
+	CashBefore   float64           `json:"cashBefore"`
+	CashAfter    float64           `json:"cashAfter"`
+	Trades       []RebalanceTrade  `json:"trades"`
+	Before       []AllocationDrift `json:"before"`
+	After        []AllocationDrift `json:"after"`
+	Warnings     []string          `json:"warnings,omitempty"`
+}
+
+// PortfolioSnapshot values one portfolio, or every portfolio combined when
+// PortfolioID is zero. The combined view breaks its totals down per
+// portfolio in Portfolios. TotalValue includes TotalCash; TotalCost and
+// TotalPnL cover holdings only.
 type PortfolioSnapshot struct {
-	Holdings   []HoldingWithPrice `json:"holdings"`
-	TotalValue float64            `json:"totalValue"`
-	TotalCost  float64            `json:"totalCost"`
-	TotalPnL   float64            `json:"totalPnl"`
-	UpdatedAt  time.Time          `json:"updatedAt"`
-	AlertsFired []PriceAlert      `json:"alertsFired,omitempty"`
+	PortfolioID      int64              `json:"portfolioId"`
+	PortfolioName    string             `json:"portfolioName,omitempty"`
+	BaseCurrency     string             `json:"baseCurrency"`
+	Holdings         []HoldingWithPrice `json:"holdings"`
+	Cash             []CashValue        `json:"cash"`
+	Allocation       []AllocationSlice  `json:"allocation"`
+	TotalValue       float64            `json:"totalValue"`
+	TotalCash        float64            `json:"totalCash"`
+	TotalCost        float64            `json:"totalCost"`
+	TotalPnL         float64            `json:"totalPnl"`
+	TotalFXPnL       float64            `json:"totalFxPnl"`
+	TotalRealizedPnL float64            `json:"totalRealizedPnl"`
+	Portfolios       []PortfolioTotals  `json:"portfolios,omitempty"`
+	UpdatedAt        time.Time          `json:"updatedAt"`
+	AlertsFired      []PriceAlert       `json:"alertsFired,omitempty"`
+	// UnacknowledgedEvents is only set on the first message of a WebSocket
+	// connection, so a reconnecting client sees the firings it missed.
+	UnacknowledgedEvents []AlertEvent `json:"unacknowledgedEvents,omitempty"`
+}
+
+type PortfolioTotals struct {
+	PortfolioID      int64   `json:"portfolioId"`
+	Name             string  `json:"name"`
+	TotalValue       float64 `json:"totalValue"`
+	TotalCash        float64 `json:"totalCash"`
+	TotalCost        float64 `json:"totalCost"`
+	TotalPnL         float64 `json:"totalPnl"`
+	TotalFXPnL       float64 `json:"totalFxPnl"`
+	TotalRealizedPnL float64 `json:"totalRealizedPnl"`
+}
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// SourceStatus reports the circuit breaker guarding one price source in one
+// asset type's chain. Priority 0 is the primary.
+type SourceStatus struct {
+	AssetType           AssetType    `json:"assetType"`
+	Source              string       `json:"source"`
+	Priority            int          `json:"priority"`
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutiveFailures"`
+	LastError           string       `json:"lastError,omitempty"`
+	LastFailureAt       *time.Time   `json:"lastFailureAt,omitempty"`
+	LastSuccessAt       *time.Time   `json:"lastSuccessAt,omitempty"`
+	RetryAt             *time.Time   `json:"retryAt,omitempty"`
+}
+
+type SnapshotKind string
+
+const (
+	SnapshotEOD      SnapshotKind = "eod"
+	SnapshotIntraday SnapshotKind = "intraday"
+)
+
+// ValueSnapshot is a persisted point on the equity curve of one portfolio,
+// or with a zero PortfolioID of all of them combined. There is at most one
+// end-of-day snapshot per portfolio per UTC day.
+type ValueSnapshot struct {
+	ID               int64          `json:"id"`
+	PortfolioID      int64          `json:"portfolioId"`
+	Kind             SnapshotKind   `json:"kind"`
+	Day              string         `json:"day"`
+	TakenAt          time.Time      `json:"takenAt"`
+	TotalValue       float64        `json:"totalValue"`
+	TotalCost        float64        `json:"totalCost"`
+	TotalPnL         float64        `json:"totalPnl"`
+	TotalRealizedPnL float64        `json:"totalRealizedPnl"`
+	Holdings         []HoldingValue `json:"holdings,omitempty"`
+}
+
+type HoldingValue struct {
+	HoldingID   int64     `json:"holdingId"`
+	Ticker      string    `json:"ticker"`
+	AssetType   AssetType `json:"assetType"`
+	Quantity    float64   `json:"quantity"`
+	Price       float64   `json:"price"`
+	MarketValue float64   `json:"marketValue"`
+	CostBasis   float64   `json:"costBasis"`
+}
+
+type EquityCurve struct {
+	From   time.Time       `json:"from"`
+	To     time.Time       `json:"to"`
+	Points []ValueSnapshot `json:"points"`
+}
+
+type ReturnPeriod string
+
+const (
+	Period1M  ReturnPeriod = "1M"
+	Period3M  ReturnPeriod = "3M"
+	PeriodYTD ReturnPeriod = "YTD"
+	Period1Y  ReturnPeriod = "1Y"
+	PeriodAll ReturnPeriod = "ALL"
+)
+
+// Returns measures performance over a window. TWRPct ignores the size and
+// timing of cash flows; MWRPct is the money-weighted return (XIRR),
+// annualised only for windows of a year or more, and is null when the flows
+// have no solution.
+type Returns struct {
+	HoldingID  int64     `json:"holdingId,omitempty"`
+	Ticker     string    `json:"ticker,omitempty"`
+	AssetType  AssetType `json:"assetType,omitempty"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	StartValue float64   `json:"startValue"`
+	EndValue   float64   `json:"endValue"`
+	NetFlows   float64   `json:"netFlows"`
+	TWRPct     float64   `json:"twrPct"`
+	MWRPct     *float64  `json:"mwrPct"`
+}
+
+type ReturnsReport struct {
+	Period    ReturnPeriod `json:"period"`
+	Portfolio Returns      `json:"portfolio"`
+	Holdings  []Returns    `json:"holdings"`
+}
+
+// FXRates maps each currency to how many units of Base one unit of it is
+// worth. Base itself is always present at 1.
+type FXRates struct {
+	Base      string             `json:"base"`
+	Rates     map[string]float64 `json:"rates"`
+	Source    string             `json:"source,omitempty"`
+	FetchedAt *time.Time         `json:"fetchedAt,omitempty"`
 }
@@ -0,0 +1,326 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// EmailTLS says how the SMTP connection is secured.
+type EmailTLS string
+
+const (
+	// TLSStartTLS upgrades a plain connection and refuses servers that do
+	// not offer STARTTLS.
+	TLSStartTLS EmailTLS = "starttls"
+	// TLSImplicit connects over TLS from the start, usually on port 465.
+	TLSImplicit EmailTLS = "tls"
+	// TLSNone sends in the clear, e.g. to a local SMTP sink.
+	TLSNone EmailTLS = "none"
+)
+
+// smtpOK is the reply code recorded for accepted messages.
+const smtpOK = 250
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// EmailConfig configures the SMTP channel. Port defaults to 587, or 465
+// with TLSImplicit and 25 with TLSNone. Username enables PLAIN auth.
+//
+// TemplateDir may hold alert.txt.tmpl, alert.html.tmpl, digest.txt.tmpl and
+// digest.html.tmpl; each file found replaces the built-in template of that
+// name. The text templates define a "subject" template too, which an
+// override keeps unless it defines its own.
+type EmailConfig struct {
+	Host        string
+	Port        int
+	Username    string
+	Password    string
+	TLS         EmailTLS
+	From        string
+	To          []string
+	TemplateDir string
+	Timeout     time.Duration
+}
+
+type emailTemplates struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Email sends alert and digest events as multipart text and HTML mail.
+type Email struct {
+	cfg       EmailConfig
+	from      *mail.Address
+	to        []*mail.Address
+	templates map[string]emailTemplates
+}
+
+func NewEmail(cfg EmailConfig) (*Email, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("smtp host is required")
+	}
+	switch cfg.TLS {
+	case "":
+		cfg.TLS = TLSStartTLS
+	case TLSStartTLS, TLSImplicit, TLSNone:
+	default:
+		return nil, fmt.Errorf("smtp tls %q must be starttls, tls or none", cfg.TLS)
+	}
+	if cfg.Port == 0 {
+		switch cfg.TLS {
+		case TLSImplicit:
+			cfg.Port = 465
+		case TLSNone:
+			cfg.Port = 25
+		default:
+			cfg.Port = 587
+		}
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+
+	e := &Email{cfg: cfg}
+	var err error
+	if e.from, err = mail.ParseAddress(cfg.From); err != nil {
+		return nil, fmt.Errorf("email from %q: %w", cfg.From, err)
+	}
+	if len(cfg.To) == 0 {
+		return nil, errors.New("email needs at least one recipient")
+	}
+	for _, raw := range cfg.To {
+		addr, err := mail.ParseAddress(raw)
+		if err != nil {
+			return nil, fmt.Errorf("email to %q: %w", raw, err)
+		}
+		e.to = append(e.to, addr)
+	}
+	if e.templates, err = loadEmailTemplates(cfg.TemplateDir); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func loadEmailTemplates(dir string) (map[string]emailTemplates, error) {
+	out := make(map[string]emailTemplates, 2)
+	for _, name := range []string{"alert", "digest"} {
+		textName, htmlName := name+".txt.tmpl", name+".html.tmpl"
+		text, err := texttemplate.New(textName).Funcs(texttemplate.FuncMap{"summary": Summary}).
+			ParseFS(defaultTemplates, "templates/"+textName)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", textName, err)
+		}
+		html, err := htmltemplate.New(htmlName).Funcs(htmltemplate.FuncMap{"summary": Summary}).
+			ParseFS(defaultTemplates, "templates/"+htmlName)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", htmlName, err)
+		}
+
+		if dir != "" {
+			if raw, err := readOverride(dir, textName); err != nil {
+				return nil, err
+			} else if raw != "" {
+				if _, err := text.Parse(raw); err != nil {
+					return nil, fmt.Errorf("parse %s: %w", filepath.Join(dir, textName), err)
+				}
+			}
+			if raw, err := readOverride(dir, htmlName); err != nil {
+				return nil, err
+			} else if raw != "" {
+				if _, err := html.Parse(raw); err != nil {
+					return nil, fmt.Errorf("parse %s: %w", filepath.Join(dir, htmlName), err)
+				}
+			}
+		}
+		out[name] = emailTemplates{text: text, html: html}
+	}
+	return out, nil
+}
+
+// readOverride returns the contents of dir/name, or "" when there is no
+// such file.
+func readOverride(dir, name string) (string, error) {
+	raw, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read email template: %w", err)
+	}
+	return string(raw), nil
+}
+
+func (e *Email) Name() string { return "email" }
+
+func (e *Email) Type() string { return "email" }
+
+// Accepts takes alert firings and daily digests.
+func (e *Email) Accepts(eventType string) bool {
+	return eventType == EventAlertFired || eventType == EventDigest
+}
+
+// Send returns the SMTP reply code of a refused message; 5xx replies are
+// permanent, 4xx ones are retried.
+func (e *Email) Send(ctx context.Context, ev Event) (int, error) {
+	msg, err := e.message(ev)
+	if err != nil {
+		return 0, Permanent(err)
+	}
+	err = e.deliver(ctx, msg)
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		if reply.Code >= 500 {
+			return reply.Code, Permanent(err)
+		}
+		return reply.Code, err
+	}
+	if err != nil {
+		return 0, err
+	}
+	return smtpOK, nil
+}
+
+func (e *Email) message(ev Event) ([]byte, error) {
+	name := "alert"
+	if ev.Type == EventDigest {
+		name = "digest"
+	}
+	tmpl := e.templates[name]
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", ev); err != nil {
+		return nil, fmt.Errorf("render email subject: %w", err)
+	}
+	if err := tmpl.text.Execute(&text, ev); err != nil {
+		return nil, fmt.Errorf("render email text: %w", err)
+	}
+	if err := tmpl.html.Execute(&html, ev); err != nil {
+		return nil, fmt.Errorf("render email html: %w", err)
+	}
+
+	to := make([]string, 0, len(e.to))
+	for _, addr := range e.to {
+		to = append(to, addr.String())
+	}
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	header := func(k, v string) { fmt.Fprintf(&buf, "%s: %s\r\n", k, v) }
+	header("From", e.from.String())
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(subject.String()), " ")))
+	header("Date", ev.At.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `multipart/alternative; boundary="`+mw.Boundary()+`"`)
+	header("X-PortfolioPulse-Event", ev.Type)
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct {
+		contentType string
+		body        []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write(part.body); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (e *Email) deliver(ctx context.Context, msg []byte) error {
+	addr := net.JoinHostPort(e.cfg.Host, strconv.Itoa(e.cfg.Port))
+	dialer := &net.Dialer{Timeout: e.cfg.Timeout}
+	var conn net.Conn
+	var err error
+	if e.cfg.TLS == TLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: e.cfg.Host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("dial smtp %s: %w", addr, err)
+	}
+	// Closing the connection unblocks whichever command is in flight.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	if err := conn.SetDeadline(time.Now().Add(e.cfg.Timeout)); err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp deadline: %w", err)
+	}
+
+	c, err := smtp.NewClient(conn, e.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp greeting: %w", err)
+	}
+	defer c.Close()
+	if e.cfg.TLS == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return Permanent(fmt.Errorf("smtp server %s does not offer STARTTLS", addr))
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: e.cfg.Host}); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+	if e.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.Host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := c.Mail(e.from.Address); err != nil {
+		return fmt.Errorf("smtp mail from: %w", err)
+	}
+	for _, addr := range e.to {
+		if err := c.Rcpt(addr.Address); err != nil {
+			return fmt.Errorf("smtp rcpt to %s: %w", addr.Address, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("smtp write: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	// The message is accepted once DATA completes; a failed QUIT does not
+	// undo that.
+	_ = c.Quit()
+	return nil
+}
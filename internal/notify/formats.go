@@ -0,0 +1,118 @@
+package notify
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"portfoliopulse/internal/models"
+)
+
+// Chat formats share a title (Summary) and these detail lines, with the
+// alert's severity picking an emoji, colour or priority.
+
+var severityEmoji = map[models.AlertSeverity]string{
+	models.SeverityInfo:     "information_source",
+	models.SeverityWarning:  "warning",
+	models.SeverityCritical: "rotating_light",
+}
+
+var discordColors = map[models.AlertSeverity]int{
+	models.SeverityInfo:     0x3498db,
+	models.SeverityWarning:  0xf1c40f,
+	models.SeverityCritical: 0xe74c3c,
+}
+
+var ntfyPriorities = map[models.AlertSeverity]string{
+	models.SeverityInfo:     "default",
+	models.SeverityWarning:  "high",
+	models.SeverityCritical: "urgent",
+}
+
+func severityOf(ev Event) models.AlertSeverity {
+	if ev.Alert != nil && ev.Alert.Severity.Rank() > 0 {
+		return ev.Alert.Severity
+	}
+	return models.SeverityInfo
+}
+
+// details describes a fired alert beyond its Summary.
+func details(ev Event) []string {
+	a := ev.Alert
+	if a == nil {
+		return nil
+	}
+	lines := []string{fmt.Sprintf("Fired at %s (%s), firing #%d.", ev.At.Format("2006-01-02 15:04 MST"), severityOf(ev), a.FireCount)}
+	if a.Reference != 0 {
+		lines = append(lines, fmt.Sprintf("Moved %+.2f%% from %v.", a.ChangePct, a.Reference))
+	}
+	if a.StopPrice != 0 {
+		lines = append(lines, fmt.Sprintf("Stop price %v after a peak of %v.", a.StopPrice, a.HighWaterMark))
+	}
+	for _, d := range a.Drift {
+		lines = append(lines, fmt.Sprintf("%s: %.2f%% held against a %.2f%% target (%+.2f points)", d.Key, d.CurrentPct, d.TargetPct, d.DriftPct))
+	}
+	names := make([]string, 0, len(a.Values))
+	for name := range a.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%s = %.6g", name, a.Values[name]))
+	}
+	return lines
+}
+
+// slackMessage is an incoming-webhook message in Slack's mrkdwn, which
+// also suits Mattermost and Rocket.Chat.
+func slackMessage(ev Event) map[string]any {
+	escape := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
+	text := fmt.Sprintf(":%s: *%s*", severityEmoji[severityOf(ev)], escape(Summary(ev)))
+	for _, line := range details(ev) {
+		text += "\n" + escape(line)
+	}
+	return map[string]any{"text": text}
+}
+
+// discordMessage is a Discord webhook message with one embed.
+func discordMessage(ev Event) map[string]any {
+	return map[string]any{
+		"username": "PortfolioPulse",
+		"embeds": []map[string]any{{
+			"title":       Summary(ev),
+			"description": strings.Join(details(ev), "\n"),
+			"color":       discordColors[severityOf(ev)],
+			"timestamp":   ev.At.UTC().Format(time.RFC3339),
+		}},
+	}
+}
+
+// telegramMessage is a Bot API sendMessage request in Telegram's HTML mode.
+func telegramMessage(ev Event, chatID string) map[string]any {
+	text := "<b>" + html.EscapeString(Summary(ev)) + "</b>"
+	for _, line := range details(ev) {
+		text += "\n" + html.EscapeString(line)
+	}
+	return map[string]any{
+		"chat_id":                  chatID,
+		"text":                     text,
+		"parse_mode":               "HTML",
+		"disable_web_page_preview": true,
+	}
+}
+
+// ntfyMessage publishes the details as a plain-text ntfy message, with the
+// summary as its title.
+func ntfyMessage(ev Event) ([]byte, http.Header) {
+	sev := severityOf(ev)
+	header := http.Header{
+		"Content-Type": {"text/plain; charset=utf-8"},
+		"Title":        {"PortfolioPulse: " + Summary(ev)},
+		"Priority":     {ntfyPriorities[sev]},
+		"Tags":         {severityEmoji[sev]},
+	}
+	return []byte(strings.Join(details(ev), "\n")), header
+}
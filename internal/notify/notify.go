@@ -0,0 +1,249 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"portfoliopulse/internal/models"
+)
+
+const (
+	// EventAlertFired is sent once for every alert firing.
+	EventAlertFired = "alert.fired"
+	// EventDigest carries the daily portfolio digest.
+	EventDigest = "portfolio.digest"
+)
+
+// Event is what channels deliver. Alert is set for alert events and
+// Snapshot for digests.
+type Event struct {
+	Type     string                    `json:"event"`
+	At       time.Time                 `json:"at"`
+	Alert    *models.PriceAlert        `json:"alert,omitempty"`
+	Snapshot *models.PortfolioSnapshot `json:"snapshot,omitempty"`
+}
+
+// Summary describes ev in one line, e.g. "BTC above 100000" or
+// "Portfolio drawdown below 15%"; an expression alert is its expression.
+func Summary(ev Event) string {
+	switch {
+	case ev.Alert != nil:
+		a := ev.Alert
+		if a.Kind == models.AlertExpression {
+			return a.Expression
+		}
+		subject := a.Ticker
+		if a.Scope == models.ScopePortfolio {
+			subject = "Portfolio"
+		}
+		if a.Kind != "" && a.Kind != models.AlertPrice {
+			subject += " " + strings.ReplaceAll(string(a.Kind), "_", " ")
+		}
+		threshold := strconv.FormatFloat(a.Threshold, 'f', -1, 64)
+		if a.Kind.Percent() || (a.Direction == models.AlertTrailing && a.Trail != models.TrailAmount) {
+			threshold += "%"
+		}
+		return fmt.Sprintf("%s %s %s", subject, a.Direction, threshold)
+	case ev.Snapshot != nil:
+		return fmt.Sprintf("Portfolio %.2f %s, P&L %+.2f", ev.Snapshot.TotalValue, ev.Snapshot.BaseCurrency, ev.Snapshot.TotalPnL)
+	}
+	return ev.Type
+}
+
+// Channel sends events to one destination. Send returns the protocol's
+// status code when there was a response (an HTTP status for webhooks), and
+// an error when the event was not delivered; errors wrapped with Permanent
+// are not retried.
+type Channel interface {
+	Name() string
+	Type() string
+	Send(ctx context.Context, ev Event) (int, error)
+}
+
+// Subscriber is implemented by channels that take only some event types.
+// Channels without it are sent every event.
+type Subscriber interface {
+	Accepts(eventType string) bool
+}
+
+// Router picks further channels for an event, on top of the dispatcher's
+// fixed ones.
+type Router interface {
+	Route(ctx context.Context, ev Event) ([]Channel, error)
+}
+
+// DeliveryLog records every delivery and its attempts.
+type DeliveryLog interface {
+	CreateDelivery(ctx context.Context, d models.NotificationDelivery) (models.NotificationDelivery, error)
+	UpdateDelivery(ctx context.Context, d models.NotificationDelivery) error
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, e.g. a rejected payload.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+const (
+	defaultAttempts   = 5
+	defaultBackoff    = 2 * time.Second
+	defaultMaxBackoff = 5 * time.Minute
+)
+
+// Dispatcher delivers each event to every channel in the background. A
+// failed attempt is retried after a delay that doubles each time, up to a
+// cap, until the attempts run out.
+type Dispatcher struct {
+	log        DeliveryLog
+	channels   []Channel
+	router     Router
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Option customises a Dispatcher at construction time.
+type Option func(*Dispatcher)
+
+// WithRetry sets how many attempts a delivery gets and the delay before the
+// first retry. The defaults are 5 attempts starting at 2s.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.attempts = attempts
+		d.backoff = backoff
+	}
+}
+
+// WithRouter adds the channels r picks to each event's fixed channels.
+func WithRouter(r Router) Option {
+	return func(d *Dispatcher) { d.router = r }
+}
+
+func NewDispatcher(log DeliveryLog, channels []Channel, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		log:        log,
+		channels:   channels,
+		attempts:   defaultAttempts,
+		backoff:    defaultBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.attempts < 1 {
+		d.attempts = 1
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	return d
+}
+
+// Notify queues ev for every channel that accepts it and returns straight
+// away. Routing happens in the background too.
+func (d *Dispatcher) Notify(ev Event) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		channels := d.channels
+		if d.router != nil {
+			routed, err := d.router.Route(d.ctx, ev)
+			if err != nil {
+				log.Printf("route %s: %v", ev.Type, err)
+			}
+			channels = append(channels[:len(channels):len(channels)], routed...)
+		}
+		for _, ch := range channels {
+			if sub, ok := ch.(Subscriber); ok && !sub.Accepts(ev.Type) {
+				continue
+			}
+			d.wg.Add(1)
+			go func(ch Channel) {
+				defer d.wg.Done()
+				d.deliver(ch, ev)
+			}(ch)
+		}
+	}()
+}
+
+// Wait blocks until every queued delivery has finished, retries included.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// Close gives up on pending retries, marking those deliveries failed, and
+// waits for in-flight attempts to finish.
+func (d *Dispatcher) Close() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) deliver(ch Channel, ev Event) {
+	// The log outlives the dispatcher's context so that cancelled
+	// deliveries are still recorded as failed.
+	logCtx := context.Background()
+	rec := models.NotificationDelivery{
+		Channel:     ch.Name(),
+		ChannelType: ch.Type(),
+		Event:       ev.Type,
+		Status:      models.DeliveryPending,
+	}
+	if ev.Alert != nil {
+		rec.AlertID, rec.EventID = ev.Alert.ID, ev.Alert.EventID
+	}
+	rec, err := d.log.CreateDelivery(logCtx, rec)
+	if err != nil {
+		log.Printf("log %s delivery to %s: %v", ev.Type, ch.Name(), err)
+	}
+
+	delay := d.backoff
+	for attempt := 1; ; attempt++ {
+		code, err := ch.Send(d.ctx, ev)
+		rec.Attempts, rec.ResponseCode, rec.Error = attempt, code, ""
+		done := err == nil || IsPermanent(err) || attempt >= d.attempts || d.ctx.Err() != nil
+		switch {
+		case err == nil:
+			now := time.Now().UTC()
+			rec.Status, rec.DeliveredAt = models.DeliveryDelivered, &now
+		case done:
+			rec.Status, rec.Error = models.DeliveryFailed, err.Error()
+		default:
+			rec.Error = err.Error()
+		}
+		if rec.ID != 0 {
+			if err := d.log.UpdateDelivery(logCtx, rec); err != nil {
+				log.Printf("update delivery %d: %v", rec.ID, err)
+			}
+		}
+		if done {
+			return
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-d.ctx.Done():
+		}
+		delay *= 2
+		if delay > d.maxBackoff {
+			delay = d.maxBackoff
+		}
+	}
+}
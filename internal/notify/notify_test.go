@@ -0,0 +1,571 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"portfoliopulse/internal/models"
+)
+
+type memoryLog struct {
+	mu         sync.Mutex
+	deliveries map[int64]models.NotificationDelivery
+	updates    int
+}
+
+func (m *memoryLog) CreateDelivery(_ context.Context, d models.NotificationDelivery) (models.NotificationDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.deliveries == nil {
+		m.deliveries = make(map[int64]models.NotificationDelivery)
+	}
+	d.ID = int64(len(m.deliveries) + 1)
+	m.deliveries[d.ID] = d
+	return d, nil
+}
+
+func (m *memoryLog) UpdateDelivery(_ context.Context, d models.NotificationDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries[d.ID] = d
+	m.updates++
+	return nil
+}
+
+func (m *memoryLog) only(t *testing.T) models.NotificationDelivery {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.deliveries) != 1 {
+		t.Fatalf("expected one delivery, got %+v", m.deliveries)
+	}
+	return m.deliveries[1]
+}
+
+func firedEvent() Event {
+	return Event{
+		Type:  EventAlertFired,
+		At:    time.Date(2026, 3, 2, 15, 0, 0, 0, time.UTC),
+		Alert: &models.PriceAlert{ID: 7, Ticker: "BTC", AssetType: models.AssetCrypto, Direction: models.AlertAbove, Threshold: 100000},
+	}
+}
+
+func TestWebhookSignsAndRetries(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		calls  int
+		bodies [][]byte
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		bodies = append(bodies, body)
+		if r.Header.Get(SignatureHeader) != Sign("s3cret", body) || r.Header.Get("X-Team") != "ops" ||
+			r.Header.Get("X-PortfolioPulse-Event") != EventAlertFired {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	hook, err := NewWebhook(WebhookConfig{
+		Name:     "ops",
+		URL:      receiver.URL,
+		Headers:  map[string]string{"X-Team": "ops"},
+		Secret:   "s3cret",
+		Template: `{"text": {{json (printf "%s above %v" .Alert.Ticker .Alert.Threshold)}}, "at": {{json .At}}}`,
+	}, receiver.Client())
+	if err != nil {
+		t.Fatalf("new webhook: %v", err)
+	}
+	log := &memoryLog{}
+	d := NewDispatcher(log, []Channel{hook}, WithRetry(5, time.Millisecond))
+	d.Notify(firedEvent())
+	d.Wait()
+
+	got := log.only(t)
+	if got.Status != models.DeliveryDelivered || got.Attempts != 3 || got.ResponseCode != http.StatusNoContent ||
+		got.AlertID != 7 || got.Channel != "ops" || got.ChannelType != "webhook" || got.DeliveredAt == nil || got.Error != "" {
+		t.Fatalf("unexpected delivery: %+v", got)
+	}
+	var payload map[string]string
+	if err := json.Unmarshal(bodies[2], &payload); err != nil || payload["text"] != "BTC above 100000" || payload["at"] != "2026-03-02T15:00:00Z" {
+		t.Fatalf("unexpected templated body %s: %v", bodies[2], err)
+	}
+}
+
+func TestWebhookGivesUp(t *testing.T) {
+	status := http.StatusBadRequest
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+	hook, err := NewWebhook(WebhookConfig{URL: receiver.URL}, receiver.Client())
+	if err != nil {
+		t.Fatalf("new webhook: %v", err)
+	}
+
+	// A rejected payload is not retried.
+	rejected := &memoryLog{}
+	d := NewDispatcher(rejected, []Channel{hook}, WithRetry(5, time.Millisecond))
+	d.Notify(firedEvent())
+	d.Wait()
+	if got := rejected.only(t); got.Status != models.DeliveryFailed || got.Attempts != 1 || got.ResponseCode != http.StatusBadRequest {
+		t.Fatalf("expected one failed attempt, got %+v", got)
+	}
+
+	// Server errors are retried until the attempts run out.
+	status = http.StatusServiceUnavailable
+	exhausted := &memoryLog{}
+	d = NewDispatcher(exhausted, []Channel{hook}, WithRetry(3, time.Millisecond))
+	d.Notify(firedEvent())
+	d.Wait()
+	if got := exhausted.only(t); got.Status != models.DeliveryFailed || got.Attempts != 3 || got.Error == "" {
+		t.Fatalf("expected three failed attempts, got %+v", got)
+	}
+
+	// Closing the dispatcher abandons a retry it is waiting on.
+	abandoned := &memoryLog{}
+	d = NewDispatcher(abandoned, []Channel{hook}, WithRetry(5, time.Hour))
+	d.Notify(firedEvent())
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		abandoned.mu.Lock()
+		updates := abandoned.updates
+		abandoned.mu.Unlock()
+		if updates > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	d.Close()
+	if got := abandoned.only(t); got.Status != models.DeliveryFailed || got.Attempts != 2 {
+		t.Fatalf("expected the retry cancelled, got %+v", got)
+	}
+}
+
+func TestLoadWebhooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write webhooks: %v", err)
+		}
+	}
+
+	write(`[{"url": "https://hooks.example.com/a"}, {"name": "b", "url": "http://localhost:9000/b", "secret": "x"}]`)
+	hooks, err := LoadWebhooks(path, http.DefaultClient)
+	if err != nil || len(hooks) != 2 || hooks[0].Name() != "hooks.example.com" || hooks[1].Name() != "b" {
+		t.Fatalf("unexpected webhooks: %v %v", hooks, err)
+	}
+	for _, bad := range []string{
+		`[{"url": "ftp://example.com"}]`,
+		`[{"url": "https://example.com", "template": "{{.Nope"}]`,
+		`[{"name": "a", "url": "https://example.com"}, {"name": "a", "url": "https://example.org"}]`,
+	} {
+		write(bad)
+		if _, err := LoadWebhooks(path, http.DefaultClient); err == nil {
+			t.Fatalf("expected an error for %s", bad)
+		}
+	}
+
+	// A template that renders invalid JSON fails without a request.
+	hook, err := NewWebhook(WebhookConfig{URL: "http://127.0.0.1:1", Template: `{"text": {{.Alert.Ticker}}}`}, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("new webhook: %v", err)
+	}
+	if _, err := hook.Send(context.Background(), firedEvent()); !IsPermanent(err) {
+		t.Fatalf("expected a permanent error, got %v", err)
+	}
+}
+
+type sunkMessage struct {
+	From string
+	To   []string
+	Auth string
+	Data []byte
+}
+
+// smtpSink is a minimal SMTP server that keeps every message it accepts and
+// answers DATA with reject when that is set.
+type smtpSink struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	reject   int
+	messages []sunkMessage
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &smtpSink{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpSink) port() int { return s.ln.Addr().(*net.TCPAddr).Port }
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 sink ready")
+	var msg sunkMessage
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			_ = tp.PrintfLine("250-sink")
+			_ = tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			msg.Auth = arg
+			_ = tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			msg.From = arg
+			_ = tp.PrintfLine("250 ok")
+		case "RCPT":
+			msg.To = append(msg.To, arg)
+			_ = tp.PrintfLine("250 ok")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			reject := s.reject
+			if reject == 0 {
+				msg.Data = data
+				s.messages = append(s.messages, msg)
+			}
+			s.mu.Unlock()
+			if reject != 0 {
+				_ = tp.PrintfLine("%d rejected", reject)
+			} else {
+				_ = tp.PrintfLine("250 queued")
+			}
+			msg = sunkMessage{}
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+// readMail returns the decoded subject and the text and HTML parts of raw.
+func readMail(t *testing.T, raw []byte) (subject, text, html string) {
+	t.Helper()
+	m, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("read message: %v", err)
+	}
+	subject, err = new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("decode subject: %v", err)
+	}
+	_, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("content type: %v", err)
+	}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("next part: %v", err)
+		}
+		body, _ := io.ReadAll(part)
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/html") {
+			html = string(body)
+		} else {
+			text = string(body)
+		}
+	}
+	return subject, text, html
+}
+
+func TestEmailAlertsAndDigest(t *testing.T) {
+	sink := newSMTPSink(t)
+	dir := t.TempDir()
+	// Only the digest's text body is overridden; its subject and HTML
+	// stay built in.
+	if err := os.WriteFile(filepath.Join(dir, "digest.txt.tmpl"), []byte(`Total {{printf "%.0f" .Snapshot.TotalValue}}`), 0o600); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+	email, err := NewEmail(EmailConfig{
+		Host:        "127.0.0.1",
+		Port:        sink.port(),
+		TLS:         TLSNone,
+		Username:    "pulse",
+		Password:    "hunter2",
+		From:        "PortfolioPulse <pulse@example.com>",
+		To:          []string{"a@example.com", "Bea <b@example.com>"},
+		TemplateDir: dir,
+	})
+	if err != nil {
+		t.Fatalf("new email: %v", err)
+	}
+	var hookCalls int
+	receiver := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { hookCalls++ }))
+	defer receiver.Close()
+	hook, err := NewWebhook(WebhookConfig{URL: receiver.URL}, receiver.Client())
+	if err != nil {
+		t.Fatalf("new webhook: %v", err)
+	}
+
+	log := &memoryLog{}
+	d := NewDispatcher(log, []Channel{email, hook}, WithRetry(1, time.Millisecond))
+	d.Notify(firedEvent())
+	d.Wait()
+	d.Notify(Event{
+		Type:     EventDigest,
+		At:       time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC),
+		Snapshot: &models.PortfolioSnapshot{BaseCurrency: "USD", TotalValue: 1234.5, TotalPnL: 34.5},
+	})
+	d.Wait()
+
+	// Webhooks only take alert events.
+	if hookCalls != 1 || len(log.deliveries) != 3 {
+		t.Fatalf("expected 1 webhook call and 3 deliveries, got %d %+v", hookCalls, log.deliveries)
+	}
+	for _, got := range log.deliveries {
+		if got.Status != models.DeliveryDelivered {
+			t.Fatalf("unexpected delivery: %+v", got)
+		}
+	}
+	if len(sink.messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(sink.messages))
+	}
+
+	alert := sink.messages[0]
+	if alert.From != "FROM:<pulse@example.com>" || len(alert.To) != 2 || alert.To[1] != "TO:<b@example.com>" ||
+		alert.Auth != "PLAIN "+base64.StdEncoding.EncodeToString([]byte("\x00pulse\x00hunter2")) {
+		t.Fatalf("unexpected envelope: %+v", alert)
+	}
+	subject, text, html := readMail(t, alert.Data)
+	if subject != "PortfolioPulse alert: BTC above 100000" || !strings.HasPrefix(text, "BTC above 100000\n") ||
+		!strings.Contains(html, "<h2>BTC above 100000</h2>") {
+		t.Fatalf("unexpected alert mail %q:\n%s\n%s", subject, text, html)
+	}
+
+	subject, text, html = readMail(t, sink.messages[1].Data)
+	if subject != "PortfolioPulse digest 2026-03-02: 1234.50 USD" || text != "Total 1234" ||
+		!strings.Contains(html, "<h2>Portfolio digest for Monday 2 March 2026</h2>") {
+		t.Fatalf("unexpected digest mail %q:\n%s\n%s", subject, text, html)
+	}
+}
+
+func TestEmailRefused(t *testing.T) {
+	sink := newSMTPSink(t)
+	email, err := NewEmail(EmailConfig{Host: "127.0.0.1", Port: sink.port(), TLS: TLSNone, From: "pulse@example.com", To: []string{"a@example.com"}})
+	if err != nil {
+		t.Fatalf("new email: %v", err)
+	}
+
+	for _, tc := range []struct {
+		reject   int
+		attempts int
+	}{
+		{reject: 550, attempts: 1},
+		{reject: 451, attempts: 3},
+	} {
+		sink.mu.Lock()
+		sink.reject = tc.reject
+		sink.mu.Unlock()
+		log := &memoryLog{}
+		d := NewDispatcher(log, []Channel{email}, WithRetry(3, time.Millisecond))
+		d.Notify(firedEvent())
+		d.Wait()
+		if got := log.only(t); got.Status != models.DeliveryFailed || got.Attempts != tc.attempts || got.ResponseCode != tc.reject {
+			t.Fatalf("reply %d: unexpected delivery %+v", tc.reject, got)
+		}
+	}
+
+	// A server without STARTTLS is refused rather than sent to in the clear.
+	email, err = NewEmail(EmailConfig{Host: "127.0.0.1", Port: sink.port(), From: "pulse@example.com", To: []string{"a@example.com"}})
+	if err != nil {
+		t.Fatalf("new email: %v", err)
+	}
+	if _, err := email.Send(context.Background(), firedEvent()); !IsPermanent(err) || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("expected a permanent STARTTLS error, got %v", err)
+	}
+
+	for _, cfg := range []EmailConfig{
+		{From: "pulse@example.com", To: []string{"a@example.com"}},
+		{Host: "127.0.0.1", From: "nope", To: []string{"a@example.com"}},
+		{Host: "127.0.0.1", From: "pulse@example.com"},
+		{Host: "127.0.0.1", TLS: "ssl", From: "pulse@example.com", To: []string{"a@example.com"}},
+	} {
+		if _, err := NewEmail(cfg); err == nil {
+			t.Fatalf("expected an error for %+v", cfg)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	for _, tc := range []struct {
+		alert models.PriceAlert
+		want  string
+	}{
+		{models.PriceAlert{Ticker: "BTC", Kind: models.AlertPrice, Direction: models.AlertAbove, Threshold: 100000}, "BTC above 100000"},
+		{models.PriceAlert{Ticker: "SOL", Kind: models.AlertChange, Direction: models.AlertEither, Threshold: 5}, "SOL change either 5%"},
+		{models.PriceAlert{Ticker: "TSLA", Kind: models.AlertPrice, Direction: models.AlertTrailing, Trail: models.TrailPercent, Threshold: 8}, "TSLA trailing 8%"},
+		{models.PriceAlert{Scope: models.ScopePortfolio, Kind: models.AlertTotalValue, Direction: models.AlertBelow, Threshold: 50000.5}, "Portfolio total value below 50000.5"},
+	} {
+		alert := tc.alert
+		if got := Summary(Event{Type: EventAlertFired, Alert: &alert}); got != tc.want {
+			t.Fatalf("summary = %q, want %q", got, tc.want)
+		}
+	}
+	if got := Summary(Event{Type: EventDigest, Snapshot: &models.PortfolioSnapshot{BaseCurrency: "EUR", TotalValue: 10, TotalPnL: -2}}); got != "Portfolio 10.00 EUR, P&L -2.00" {
+		t.Fatalf("unexpected digest summary %q", got)
+	}
+}
+
+func TestChatFormats(t *testing.T) {
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan request, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{header: r.Header, body: body}
+	}))
+	defer receiver.Close()
+
+	ev := firedEvent()
+	ev.Alert.Severity = models.SeverityCritical
+	ev.Alert.FireCount = 1
+	send := func(cfg WebhookConfig) request {
+		t.Helper()
+		cfg.URL = receiver.URL
+		hook, err := NewWebhook(cfg, receiver.Client())
+		if err != nil {
+			t.Fatalf("new %s webhook: %v", cfg.Type, err)
+		}
+		if _, err := hook.Send(context.Background(), ev); err != nil {
+			t.Fatalf("send %s: %v", cfg.Type, err)
+		}
+		return <-requests
+	}
+
+	var slack struct{ Text string }
+	_ = json.Unmarshal(send(WebhookConfig{Type: models.ChannelSlack}).body, &slack)
+	if slack.Text != ":rotating_light: *BTC above 100000*\nFired at 2026-03-02 15:00 UTC (critical), firing #1." {
+		t.Fatalf("unexpected slack text %q", slack.Text)
+	}
+
+	var discord struct {
+		Embeds []struct {
+			Title string
+			Color int
+		}
+	}
+	_ = json.Unmarshal(send(WebhookConfig{Type: models.ChannelDiscord}).body, &discord)
+	if len(discord.Embeds) != 1 || discord.Embeds[0].Title != "BTC above 100000" || discord.Embeds[0].Color != 0xe74c3c {
+		t.Fatalf("unexpected discord message %+v", discord)
+	}
+
+	var telegram map[string]any
+	_ = json.Unmarshal(send(WebhookConfig{Type: models.ChannelTelegram, ChatID: "-100123"}).body, &telegram)
+	if telegram["chat_id"] != "-100123" || telegram["parse_mode"] != "HTML" || !strings.HasPrefix(telegram["text"].(string), "<b>BTC above 100000</b>\n") {
+		t.Fatalf("unexpected telegram message %+v", telegram)
+	}
+
+	ntfy := send(WebhookConfig{Type: models.ChannelNtfy})
+	if ntfy.header.Get("Title") != "PortfolioPulse: BTC above 100000" || ntfy.header.Get("Priority") != "urgent" ||
+		!strings.HasPrefix(ntfy.header.Get("Content-Type"), "text/plain") || !strings.HasPrefix(string(ntfy.body), "Fired at") {
+		t.Fatalf("unexpected ntfy request %v %s", ntfy.header, ntfy.body)
+	}
+
+	for _, bad := range []WebhookConfig{
+		{Type: "teams"},
+		{Type: models.ChannelSlack, Template: `{"text": "x"}`},
+		{Type: models.ChannelTelegram},
+		{Type: models.ChannelDiscord, ChatID: "1"},
+	} {
+		bad.URL = receiver.URL
+		if _, err := NewWebhook(bad, receiver.Client()); err == nil {
+			t.Fatalf("expected an error for %+v", bad)
+		}
+	}
+}
+
+type channelList []models.NotificationChannel
+
+func (l channelList) ListChannels(context.Context) ([]models.NotificationChannel, error) {
+	return l, nil
+}
+
+func TestStoredChannelsRouting(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	receiver := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		hits[r.URL.Path]++
+	}))
+	defer receiver.Close()
+
+	channels := channelList{
+		{Name: "all", Type: models.ChannelWebhook, URL: receiver.URL + "/all"},
+		{Name: "btc", Type: models.ChannelSlack, URL: receiver.URL + "/btc", Rules: []models.ChannelRule{{Ticker: "BTC"}}},
+		{Name: "stocks", Type: models.ChannelSlack, URL: receiver.URL + "/stocks", Rules: []models.ChannelRule{{AssetType: models.AssetStock}}},
+		{Name: "pager", Type: models.ChannelNtfy, URL: receiver.URL + "/pager", Rules: []models.ChannelRule{{MinSeverity: models.SeverityWarning}}},
+	}
+	log := &memoryLog{}
+	d := NewDispatcher(log, nil, WithRouter(NewStoredChannels(channels, receiver.Client())), WithRetry(1, time.Millisecond))
+
+	info := firedEvent()
+	d.Notify(info)
+	critical := firedEvent()
+	critical.Alert.Severity = models.SeverityCritical
+	d.Notify(critical)
+	// Digests are not routed to stored channels.
+	d.Notify(Event{Type: EventDigest, Snapshot: &models.PortfolioSnapshot{}})
+	d.Wait()
+
+	if hits["/all"] != 2 || hits["/btc"] != 2 || hits["/stocks"] != 0 || hits["/pager"] != 1 || len(log.deliveries) != 5 {
+		t.Fatalf("unexpected routing: %v, %d deliveries", hits, len(log.deliveries))
+	}
+}
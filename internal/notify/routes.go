@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"portfoliopulse/internal/models"
+)
+
+// ChannelSource lists the stored notification channels.
+type ChannelSource interface {
+	ListChannels(ctx context.Context) ([]models.NotificationChannel, error)
+}
+
+// StoredChannels routes each fired alert to the stored channels it names,
+// or when it names none to those whose rules match it. Channels are read
+// per event, so changes apply straight away.
+type StoredChannels struct {
+	source     ChannelSource
+	httpClient *http.Client
+}
+
+func NewStoredChannels(source ChannelSource, client *http.Client) *StoredChannels {
+	return &StoredChannels{source: source, httpClient: client}
+}
+
+func (r *StoredChannels) Route(ctx context.Context, ev Event) ([]Channel, error) {
+	if ev.Alert == nil {
+		return nil, nil
+	}
+	stored, err := r.source.ListChannels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []Channel
+	for _, c := range stored {
+		if !c.Routes(*ev.Alert) {
+			continue
+		}
+		hook, err := NewWebhook(ConfigFor(c), r.httpClient)
+		if err != nil {
+			// The API validates channels, so this only catches rows
+			// edited by hand.
+			log.Printf("channel %s: %v", c.Name, err)
+			continue
+		}
+		out = append(out, hook)
+	}
+	return out, nil
+}
@@ -0,0 +1,213 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+
+	"portfoliopulse/internal/models"
+)
+
+// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the request
+// body, keyed with the webhook's secret.
+const SignatureHeader = "X-PortfolioPulse-Signature"
+
+// WebhookConfig is one entry of the webhooks file. Type picks the payload:
+// a webhook (the default) posts the Event itself, or with Template set a
+// text/template rendering the JSON body from the Event; the "json" function
+// encodes any value and "summary" describes the event, e.g.
+//
+//	{"text": {{json (printf "%s crossed %v" .Alert.Ticker .Alert.Threshold)}}}
+//
+// The slack, discord, telegram and ntfy types post that service's message
+// format instead, and telegram needs the ChatID to post to.
+type WebhookConfig struct {
+	Name     string             `json:"name"`
+	Type     models.ChannelType `json:"type,omitempty"`
+	URL      string             `json:"url"`
+	ChatID   string             `json:"chatId,omitempty"`
+	Headers  map[string]string  `json:"headers,omitempty"`
+	Secret   string             `json:"secret,omitempty"`
+	Template string             `json:"template,omitempty"`
+}
+
+// ConfigFor converts a stored channel into the config of its Webhook.
+func ConfigFor(c models.NotificationChannel) WebhookConfig {
+	return WebhookConfig{
+		Name:     c.Name,
+		Type:     c.Type,
+		URL:      c.URL,
+		ChatID:   c.ChatID,
+		Headers:  c.Headers,
+		Secret:   c.Secret,
+		Template: c.Template,
+	}
+}
+
+// Webhook POSTs events to a URL, as JSON or in a chat service's format.
+type Webhook struct {
+	cfg        WebhookConfig
+	tmpl       *template.Template
+	httpClient *http.Client
+}
+
+func NewWebhook(cfg WebhookConfig, client *http.Client) (*Webhook, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("webhook url %q must be an http or https URL", cfg.URL)
+	}
+	if cfg.Name == "" {
+		cfg.Name = u.Host
+	}
+	switch cfg.Type {
+	case "":
+		cfg.Type = models.ChannelWebhook
+	case models.ChannelWebhook, models.ChannelSlack, models.ChannelDiscord, models.ChannelTelegram, models.ChannelNtfy:
+	default:
+		return nil, fmt.Errorf("webhook %s type %q must be webhook, slack, discord, telegram or ntfy", cfg.Name, cfg.Type)
+	}
+	if cfg.Template != "" && cfg.Type != models.ChannelWebhook {
+		return nil, fmt.Errorf("webhook %s: template only applies to the webhook type", cfg.Name)
+	}
+	if (cfg.ChatID != "") != (cfg.Type == models.ChannelTelegram) {
+		return nil, fmt.Errorf("webhook %s: chatId is required for, and only applies to, the telegram type", cfg.Name)
+	}
+	w := &Webhook{cfg: cfg, httpClient: client}
+	if cfg.Template != "" {
+		w.tmpl, err = template.New(cfg.Name).Funcs(template.FuncMap{"json": toJSON, "summary": Summary}).Parse(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %s template: %w", cfg.Name, err)
+		}
+	}
+	return w, nil
+}
+
+// LoadWebhooks reads a JSON array of WebhookConfig from path.
+func LoadWebhooks(path string, client *http.Client) ([]*Webhook, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read webhooks: %w", err)
+	}
+	var configs []WebhookConfig
+	if err := json.Unmarshal(raw, &configs); err != nil {
+		return nil, fmt.Errorf("decode webhooks: %w", err)
+	}
+	hooks := make([]*Webhook, 0, len(configs))
+	seen := make(map[string]bool, len(configs))
+	for _, cfg := range configs {
+		w, err := NewWebhook(cfg, client)
+		if err != nil {
+			return nil, err
+		}
+		if seen[w.Name()] {
+			return nil, fmt.Errorf("duplicate webhook name %q", w.Name())
+		}
+		seen[w.Name()] = true
+		hooks = append(hooks, w)
+	}
+	return hooks, nil
+}
+
+func (w *Webhook) Name() string { return w.cfg.Name }
+
+func (w *Webhook) Type() string { return string(w.cfg.Type) }
+
+// Accepts limits webhooks to alert events.
+func (w *Webhook) Accepts(eventType string) bool { return eventType == EventAlertFired }
+
+// Send treats any 2xx as delivered. Other 4xx responses, apart from
+// timeouts and rate limiting, mean the receiver rejected the payload and
+// are not retried.
+func (w *Webhook) Send(ctx context.Context, ev Event) (int, error) {
+	body, header, err := w.payload(ev)
+	if err != nil {
+		return 0, Permanent(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, Permanent(fmt.Errorf("create webhook request: %w", err))
+	}
+	req.Header = header
+	req.Header.Set("User-Agent", "PortfolioPulse")
+	req.Header.Set("X-PortfolioPulse-Event", ev.Type)
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if w.cfg.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.cfg.Secret, body))
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, nil
+	}
+	err = fmt.Errorf("webhook status %d: %s", resp.StatusCode, strings.TrimSpace(string(snippet)))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return resp.StatusCode, Permanent(err)
+	}
+	return resp.StatusCode, err
+}
+
+// payload renders the request body and its headers for w's type.
+func (w *Webhook) payload(ev Event) ([]byte, http.Header, error) {
+	header := http.Header{"Content-Type": {"application/json"}}
+	var body []byte
+	var err error
+	switch w.cfg.Type {
+	case models.ChannelSlack:
+		body, err = json.Marshal(slackMessage(ev))
+	case models.ChannelDiscord:
+		body, err = json.Marshal(discordMessage(ev))
+	case models.ChannelTelegram:
+		body, err = json.Marshal(telegramMessage(ev, w.cfg.ChatID))
+	case models.ChannelNtfy:
+		body, header = ntfyMessage(ev)
+	default:
+		body, err = w.render(ev)
+	}
+	return body, header, err
+}
+
+func (w *Webhook) render(ev Event) ([]byte, error) {
+	if w.tmpl == nil {
+		return json.Marshal(ev)
+	}
+	var buf bytes.Buffer
+	if err := w.tmpl.Execute(&buf, ev); err != nil {
+		return nil, fmt.Errorf("render webhook %s: %w", w.cfg.Name, err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, errors.New("webhook " + w.cfg.Name + " template did not render valid JSON")
+	}
+	return buf.Bytes(), nil
+}
+
+// Sign returns the SignatureHeader value for body, so receivers can check
+// it with hmac.Equal.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func toJSON(v any) (string, error) {
+	raw, err := json.Marshal(v)
+	return string(raw), err
+}
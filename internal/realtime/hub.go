@@ -6,18 +6,24 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// Hub fans messages out to WebSocket clients. Each client subscribes to one
+// topic; AddClient subscribes to the empty topic.
 type Hub struct {
 	mu      sync.RWMutex
-	clients map[*websocket.Conn]struct{}
+	clients map[*websocket.Conn]string
 }
 
 func NewHub() *Hub {
-	return &Hub{clients: make(map[*websocket.Conn]struct{})}
+	return &Hub{clients: make(map[*websocket.Conn]string)}
 }
 
 func (h *Hub) AddClient(conn *websocket.Conn) {
+	h.Subscribe(conn, "")
+}
+
+func (h *Hub) Subscribe(conn *websocket.Conn, topic string) {
 	h.mu.Lock()
-	h.clients[conn] = struct{}{}
+	h.clients[conn] = topic
 	h.mu.Unlock()
 }
 
@@ -28,11 +34,23 @@ func (h *Hub) RemoveClient(conn *websocket.Conn) {
 	_ = conn.Close()
 }
 
+// BroadcastJSON sends v to every client regardless of topic.
 func (h *Hub) BroadcastJSON(v any) {
+	h.send(v, func(string) bool { return true })
+}
+
+// PublishJSON sends v to the clients subscribed to topic.
+func (h *Hub) PublishJSON(topic string, v any) {
+	h.send(v, func(t string) bool { return t == topic })
+}
+
+func (h *Hub) send(v any, match func(topic string) bool) {
 	h.mu.RLock()
 	clients := make([]*websocket.Conn, 0, len(h.clients))
-	for conn := range h.clients {
-		clients = append(clients, conn)
+	for conn, topic := range h.clients {
+		if match(topic) {
+			clients = append(clients, conn)
+		}
 	}
 	h.mu.RUnlock()
 
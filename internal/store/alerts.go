@@ -0,0 +1,506 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"portfoliopulse/internal/models"
+)
+
+// alertColumns and alertFrom read an alert joined with its latest event,
+// which supplies TriggeredAt.
+const alertColumns = `
+	a.id, a.portfolio_id, a.scope, a.ticker, a.asset_type, a.kind, a.direction, a.threshold, a.window_minutes, a.trail,
+	a.high_water, a.high_water_at, a.mode, a.hysteresis, a.cooldown_minutes, a.severity, a.expression, a.created_at, a.triggered, le.fired_at,
+	(SELECT COUNT(*) FROM alert_events c WHERE c.alert_id = a.id)`
+
+const alertFrom = `
+	FROM price_alerts a
+	LEFT JOIN alert_events le ON le.id = (
+		SELECT e.id FROM alert_events e WHERE e.alert_id = a.id ORDER BY e.fired_at DESC, e.id DESC LIMIT 1)`
+
+func (s *SQLiteStore) ListAlerts(ctx context.Context) ([]models.PriceAlert, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+alertColumns+alertFrom+` ORDER BY a.id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("query alerts: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := make([]models.PriceAlert, 0)
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate alerts: %w", err)
+	}
+	rows.Close()
+
+	channels, err := listAlertChannels(ctx, s.db, 0)
+	if err != nil {
+		return nil, err
+	}
+	for i := range alerts {
+		alerts[i].Channels = channels[alerts[i].ID]
+	}
+	return alerts, nil
+}
+
+func (s *SQLiteStore) GetAlert(ctx context.Context, id int64) (models.PriceAlert, error) {
+	return getAlert(ctx, s.db, id)
+}
+
+func getAlert(ctx context.Context, q querier, id int64) (models.PriceAlert, error) {
+	a, err := scanAlert(q.QueryRowContext(ctx, `SELECT `+alertColumns+alertFrom+` WHERE a.id = ?`, id))
+	if err != nil {
+		return models.PriceAlert{}, err
+	}
+	channels, err := listAlertChannels(ctx, q, id)
+	if err != nil {
+		return models.PriceAlert{}, err
+	}
+	a.Channels = channels[id]
+	return a, nil
+}
+
+// CreateAlert stores an alert in alert.PortfolioID (the default portfolio
+// when unset). An empty Scope means a ticker alert, an empty Kind an
+// absolute price alert, an empty Mode a one-shot one and an empty Severity
+// an info one. Trailing and
+// drawdown alerts start from the given HighWaterMark, if any. Channels must
+// name stored channels, or ErrUnknownChannel is returned.
+func (s *SQLiteStore) CreateAlert(ctx context.Context, alert models.PriceAlert) (models.PriceAlert, error) {
+	alert.Ticker = strings.ToUpper(strings.TrimSpace(alert.Ticker))
+	if alert.Scope == "" {
+		alert.Scope = models.ScopeTicker
+	}
+	if alert.Kind == "" {
+		alert.Kind = models.AlertPrice
+	}
+	if alert.Mode == "" {
+		alert.Mode = models.AlertOnce
+	}
+	if alert.Severity == "" {
+		alert.Severity = models.SeverityInfo
+	}
+	dbtx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.PriceAlert{}, fmt.Errorf("begin create alert: %w", err)
+	}
+	defer dbtx.Rollback()
+
+	portfolioID, err := portfolioOrDefault(ctx, dbtx, alert.PortfolioID)
+	if err != nil {
+		return models.PriceAlert{}, err
+	}
+	res, err := dbtx.ExecContext(ctx, `
+		INSERT INTO price_alerts(portfolio_id, scope, ticker, asset_type, kind, direction, threshold, window_minutes, trail,
+			high_water, high_water_at, mode, hysteresis, cooldown_minutes, severity, expression)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		portfolioID, alert.Scope, alert.Ticker, alert.AssetType, alert.Kind, alert.Direction, alert.Threshold, alert.WindowMinutes,
+		alert.Trail, alert.HighWaterMark, alert.HighWaterAt, alert.Mode, alert.Hysteresis, alert.CooldownMinutes, alert.Severity,
+		alert.Expression)
+	if err != nil {
+		return models.PriceAlert{}, fmt.Errorf("insert alert: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.PriceAlert{}, fmt.Errorf("alert last insert id: %w", err)
+	}
+	if err := saveAlertChannels(ctx, dbtx, id, alert.Channels); err != nil {
+		return models.PriceAlert{}, err
+	}
+
+	out, err := getAlert(ctx, dbtx, id)
+	if err != nil {
+		return models.PriceAlert{}, fmt.Errorf("fetch inserted alert: %w", err)
+	}
+	if err := dbtx.Commit(); err != nil {
+		return models.PriceAlert{}, fmt.Errorf("commit create alert: %w", err)
+	}
+	return out, nil
+}
+
+// saveAlertChannels links alert id to the stored channels named in names.
+func saveAlertChannels(ctx context.Context, q querier, id int64, names []string) error {
+	for _, name := range names {
+		var channelID int64
+		err := q.QueryRowContext(ctx, `SELECT id FROM notification_channels WHERE name = ?`, strings.TrimSpace(name)).Scan(&channelID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %q", ErrUnknownChannel, name)
+		}
+		if err != nil {
+			return fmt.Errorf("find alert channel: %w", err)
+		}
+		if _, err := q.ExecContext(ctx, `
+			INSERT OR IGNORE INTO alert_channels(alert_id, channel_id) VALUES (?, ?)`, id, channelID); err != nil {
+			return fmt.Errorf("insert alert channel: %w", err)
+		}
+	}
+	return nil
+}
+
+// listAlertChannels returns channel names by alert ID, for one alert or for
+// all of them when id is zero.
+func listAlertChannels(ctx context.Context, q querier, id int64) (map[int64][]string, error) {
+	query := `SELECT ac.alert_id, c.name FROM alert_channels ac JOIN notification_channels c ON c.id = ac.channel_id`
+	args := make([]any, 0, 1)
+	if id != 0 {
+		query += ` WHERE ac.alert_id = ?`
+		args = append(args, id)
+	}
+	rows, err := q.QueryContext(ctx, query+` ORDER BY ac.alert_id ASC, c.name ASC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query alert channels: %w", err)
+	}
+	defer rows.Close()
+
+	channels := make(map[int64][]string)
+	for rows.Next() {
+		var alertID int64
+		var name string
+		if err := rows.Scan(&alertID, &name); err != nil {
+			return nil, fmt.Errorf("scan alert channel: %w", err)
+		}
+		channels[alertID] = append(channels[alertID], name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate alert channels: %w", err)
+	}
+	return channels, nil
+}
+
+func (s *SQLiteStore) DeleteAlert(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM price_alerts WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete alert: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("alert rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MarkAlertTriggered records ev, a firing of alert ev.AlertID, in its
+// history and disarms the alert, except for cooldown alerts, which stay
+// armed and are held back by the time of their last event instead. The
+// alert is only fired if it is still armed and out of its cooldown, so of
+// two concurrent refreshes just one records the event; fired is false for
+// the other, and for a missing alert.
+func (s *SQLiteStore) MarkAlertTriggered(ctx context.Context, ev models.AlertEvent) (models.AlertEvent, bool, error) {
+	dbtx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.AlertEvent{}, false, fmt.Errorf("begin mark alert triggered: %w", err)
+	}
+	defer dbtx.Rollback()
+
+	var cooldownMinutes int
+	if err := dbtx.QueryRowContext(ctx, `
+		SELECT CASE WHEN mode = ? THEN cooldown_minutes ELSE 0 END FROM price_alerts WHERE id = ?`,
+		models.AlertCooldown, ev.AlertID).Scan(&cooldownMinutes); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.AlertEvent{}, false, nil
+		}
+		return models.AlertEvent{}, false, fmt.Errorf("read alert cooldown: %w", err)
+	}
+	cooldownFrom := ev.FiredAt.UTC().Add(-time.Duration(cooldownMinutes) * time.Minute)
+	res, err := dbtx.ExecContext(ctx, `
+		UPDATE price_alerts
+		SET triggered = CASE WHEN mode = ? THEN 0 ELSE 1 END
+		WHERE id = ? AND triggered = 0
+			AND (mode <> ? OR NOT EXISTS (
+				SELECT 1 FROM alert_events WHERE alert_id = price_alerts.id AND fired_at > ?))`,
+		models.AlertCooldown, ev.AlertID, models.AlertCooldown, cooldownFrom)
+	if err != nil {
+		return models.AlertEvent{}, false, fmt.Errorf("mark alert triggered: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return models.AlertEvent{}, false, fmt.Errorf("alert rows affected: %w", err)
+	}
+	if rows == 0 {
+		return models.AlertEvent{}, false, nil
+	}
+	res, err = dbtx.ExecContext(ctx, `
+		INSERT INTO alert_events(alert_id, fired_at, price, total_value) VALUES (?, ?, ?, ?)`,
+		ev.AlertID, ev.FiredAt.UTC(), ev.Price, ev.TotalValue)
+	if err != nil {
+		return models.AlertEvent{}, false, fmt.Errorf("insert alert event: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.AlertEvent{}, false, fmt.Errorf("alert event last insert id: %w", err)
+	}
+	out, err := getAlertEvent(ctx, dbtx, id)
+	if err != nil {
+		return models.AlertEvent{}, false, err
+	}
+	if err := dbtx.Commit(); err != nil {
+		return models.AlertEvent{}, false, fmt.Errorf("commit mark alert triggered: %w", err)
+	}
+	return out, true, nil
+}
+
+// RearmAlert arms alert id again. A positive highWater restarts a trailing
+// alert's peak from that price.
+func (s *SQLiteStore) RearmAlert(ctx context.Context, id int64, highWater float64, at time.Time) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE price_alerts
+		SET triggered = 0,
+			high_water = CASE WHEN ? > 0 THEN ? ELSE high_water END,
+			high_water_at = CASE WHEN ? > 0 THEN ? ELSE high_water_at END
+		WHERE id = ?`, highWater, highWater, highWater, at.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("rearm alert: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("alert rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AlertEventFilter narrows ListEvents. Zero fields match everything; a
+// zero Limit returns the latest 100.
+type AlertEventFilter struct {
+	AlertID        int64
+	PortfolioID    int64
+	Unacknowledged bool
+	Limit          int
+}
+
+// eventColumns and eventFrom read an event with its alert's portfolio.
+const eventColumns = `
+	e.id, e.alert_id, a.portfolio_id, e.fired_at, e.price, e.total_value, e.note, e.acknowledged_at`
+
+const eventFrom = `
+	FROM alert_events e
+	JOIN price_alerts a ON a.id = e.alert_id`
+
+// ListAlertEvents returns the whole firing history of alert id, newest
+// first.
+func (s *SQLiteStore) ListAlertEvents(ctx context.Context, alertID int64) ([]models.AlertEvent, error) {
+	var exists int
+	if err := s.db.QueryRowContext(ctx, `SELECT 1 FROM price_alerts WHERE id = ?`, alertID).Scan(&exists); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("lookup alert: %w", err)
+	}
+	return listEvents(ctx, s.db, AlertEventFilter{AlertID: alertID})
+}
+
+// ListEvents returns the firings of every alert matching filter, newest
+// first.
+func (s *SQLiteStore) ListEvents(ctx context.Context, filter AlertEventFilter) ([]models.AlertEvent, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = 100
+	}
+	return listEvents(ctx, s.db, filter)
+}
+
+func (s *SQLiteStore) GetAlertEvent(ctx context.Context, id int64) (models.AlertEvent, error) {
+	return getAlertEvent(ctx, s.db, id)
+}
+
+// AcknowledgeAlertEvent marks event id as seen. Acknowledging it again
+// keeps the first time.
+func (s *SQLiteStore) AcknowledgeAlertEvent(ctx context.Context, id int64, at time.Time) (models.AlertEvent, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE alert_events SET acknowledged_at = COALESCE(acknowledged_at, ?) WHERE id = ?`, at.UTC(), id)
+	if err != nil {
+		return models.AlertEvent{}, fmt.Errorf("acknowledge alert event: %w", err)
+	}
+	return s.updatedAlertEvent(ctx, res, id)
+}
+
+// SetAlertEventNote replaces the note on event id; an empty note clears it.
+func (s *SQLiteStore) SetAlertEventNote(ctx context.Context, id int64, note string) (models.AlertEvent, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE alert_events SET note = ? WHERE id = ?`, strings.TrimSpace(note), id)
+	if err != nil {
+		return models.AlertEvent{}, fmt.Errorf("set alert event note: %w", err)
+	}
+	return s.updatedAlertEvent(ctx, res, id)
+}
+
+func (s *SQLiteStore) updatedAlertEvent(ctx context.Context, res sql.Result, id int64) (models.AlertEvent, error) {
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return models.AlertEvent{}, fmt.Errorf("alert event rows affected: %w", err)
+	}
+	if rows == 0 {
+		return models.AlertEvent{}, sql.ErrNoRows
+	}
+	return getAlertEvent(ctx, s.db, id)
+}
+
+func getAlertEvent(ctx context.Context, q querier, id int64) (models.AlertEvent, error) {
+	ev, err := scanAlertEvent(q.QueryRowContext(ctx, `SELECT `+eventColumns+eventFrom+` WHERE e.id = ?`, id))
+	if err != nil {
+		return models.AlertEvent{}, err
+	}
+	events := []models.AlertEvent{ev}
+	if err := loadEventDeliveries(ctx, q, events); err != nil {
+		return models.AlertEvent{}, err
+	}
+	return events[0], nil
+}
+
+// listEvents returns the events matching filter, newest first; a zero
+// Limit returns them all.
+func listEvents(ctx context.Context, q querier, filter AlertEventFilter) ([]models.AlertEvent, error) {
+	where := make([]string, 0, 3)
+	args := make([]any, 0, 4)
+	if filter.AlertID != 0 {
+		where = append(where, "e.alert_id = ?")
+		args = append(args, filter.AlertID)
+	}
+	if filter.PortfolioID != 0 {
+		where = append(where, "a.portfolio_id = ?")
+		args = append(args, filter.PortfolioID)
+	}
+	if filter.Unacknowledged {
+		where = append(where, "e.acknowledged_at IS NULL")
+	}
+
+	query := `SELECT ` + eventColumns + eventFrom
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY e.fired_at DESC, e.id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query alert events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]models.AlertEvent, 0)
+	for rows.Next() {
+		ev, err := scanAlertEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate alert events: %w", err)
+	}
+	rows.Close()
+
+	if err := loadEventDeliveries(ctx, q, events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func scanAlertEvent(sc scanner) (models.AlertEvent, error) {
+	var ev models.AlertEvent
+	var acknowledgedAt sql.NullTime
+	if err := sc.Scan(&ev.ID, &ev.AlertID, &ev.PortfolioID, &ev.FiredAt, &ev.Price, &ev.TotalValue, &ev.Note,
+		&acknowledgedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.AlertEvent{}, err
+		}
+		return models.AlertEvent{}, fmt.Errorf("scan alert event: %w", err)
+	}
+	if acknowledgedAt.Valid {
+		t := acknowledgedAt.Time
+		ev.AcknowledgedAt = &t
+	}
+	ev.Deliveries = make([]models.NotificationDelivery, 0)
+	return ev, nil
+}
+
+// loadEventDeliveries fills in the deliveries logged for each of events,
+// oldest first.
+func loadEventDeliveries(ctx context.Context, q querier, events []models.AlertEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	index := make(map[int64]int, len(events))
+	placeholders := make([]string, 0, len(events))
+	args := make([]any, 0, len(events))
+	for i, ev := range events {
+		index[ev.ID] = i
+		placeholders = append(placeholders, "?")
+		args = append(args, ev.ID)
+	}
+	rows, err := q.QueryContext(ctx, `
+		SELECT `+deliveryColumns+` FROM notification_deliveries
+		WHERE event_id IN (`+strings.Join(placeholders, ", ")+`) ORDER BY id ASC`, args...)
+	if err != nil {
+		return fmt.Errorf("query event deliveries: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return err
+		}
+		i := index[d.EventID]
+		events[i].Deliveries = append(events[i].Deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate event deliveries: %w", err)
+	}
+	return nil
+}
+
+// RaiseAlertHighWater moves a trailing alert's peak up to price. A lower
+// price leaves the stored peak alone, so concurrent evaluations cannot
+// lower it.
+func (s *SQLiteStore) RaiseAlertHighWater(ctx context.Context, id int64, price float64, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE price_alerts
+		SET high_water = ?, high_water_at = ?
+		WHERE id = ? AND high_water < ?`, price, at.UTC(), id, price)
+	if err != nil {
+		return fmt.Errorf("raise alert high water: %w", err)
+	}
+	return nil
+}
+
+func scanAlert(sc scanner) (models.PriceAlert, error) {
+	var a models.PriceAlert
+	var triggeredInt int
+	var highWaterAt, triggeredAt sql.NullTime
+	if err := sc.Scan(&a.ID, &a.PortfolioID, &a.Scope, &a.Ticker, &a.AssetType, &a.Kind, &a.Direction, &a.Threshold,
+		&a.WindowMinutes, &a.Trail, &a.HighWaterMark, &highWaterAt, &a.Mode, &a.Hysteresis, &a.CooldownMinutes,
+		&a.Severity, &a.Expression, &a.CreatedAt, &triggeredInt, &triggeredAt, &a.FireCount); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.PriceAlert{}, err
+		}
+		return models.PriceAlert{}, fmt.Errorf("scan alert: %w", err)
+	}
+	a.Triggered = triggeredInt == 1
+	if highWaterAt.Valid {
+		t := highWaterAt.Time
+		a.HighWaterAt = &t
+	}
+	a.StopPrice = a.TrailingStop()
+	if triggeredAt.Valid {
+		t := triggeredAt.Time
+		a.TriggeredAt = &t
+	}
+	return a, nil
+}
@@ -0,0 +1,380 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"portfoliopulse/internal/models"
+)
+
+var (
+	ErrCashAccountExists = errors.New("the portfolio already has a cash account in that currency")
+	ErrNoCashAccount     = errors.New("the portfolio has no cash account in the holding's currency")
+)
+
+// ListCashAccounts returns every cash account with its current balance.
+func (s *SQLiteStore) ListCashAccounts(ctx context.Context) ([]models.CashAccount, error) {
+	accounts, err := listCashAccounts(ctx, s.db, 0)
+	if err != nil {
+		return nil, err
+	}
+	movements, err := listCashMovements(ctx, s.db, accounts)
+	if err != nil {
+		return nil, err
+	}
+	applyBalances(accounts, movements)
+	return accounts, nil
+}
+
+func (s *SQLiteStore) GetCashAccount(ctx context.Context, id int64) (models.CashAccount, error) {
+	accounts, err := listCashAccounts(ctx, s.db, id)
+	if err != nil {
+		return models.CashAccount{}, err
+	}
+	if len(accounts) == 0 {
+		return models.CashAccount{}, sql.ErrNoRows
+	}
+	movements, err := listCashMovements(ctx, s.db, accounts)
+	if err != nil {
+		return models.CashAccount{}, err
+	}
+	applyBalances(accounts, movements)
+	return accounts[0], nil
+}
+
+// CreateCashAccount opens an account in a.PortfolioID (the default portfolio
+// when unset). A portfolio has at most one account per currency.
+func (s *SQLiteStore) CreateCashAccount(ctx context.Context, a models.CashAccount) (models.CashAccount, error) {
+	a.Currency = normalizeCurrency(a.Currency)
+
+	pid, err := portfolioOrDefault(ctx, s.db, a.PortfolioID)
+	if err != nil {
+		return models.CashAccount{}, err
+	}
+	if _, err := findCashAccount(ctx, s.db, pid, a.Currency); err == nil {
+		return models.CashAccount{}, ErrCashAccountExists
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return models.CashAccount{}, err
+	}
+
+	res, err := s.db.ExecContext(ctx, `INSERT INTO cash_accounts(portfolio_id, currency) VALUES (?, ?)`, pid, a.Currency)
+	if err != nil {
+		return models.CashAccount{}, fmt.Errorf("insert cash account: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.CashAccount{}, fmt.Errorf("cash account last insert id: %w", err)
+	}
+	return s.GetCashAccount(ctx, id)
+}
+
+// DeleteCashAccount removes an account and its movements. Trades and income
+// that were settled against it stay recorded but no longer touch cash.
+func (s *SQLiteStore) DeleteCashAccount(ctx context.Context, id int64) error {
+	dbtx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin delete cash account: %w", err)
+	}
+	defer dbtx.Rollback()
+
+	accounts, err := listCashAccounts(ctx, dbtx, id)
+	if err != nil {
+		return err
+	}
+	if len(accounts) == 0 {
+		return sql.ErrNoRows
+	}
+	a := accounts[0]
+	for _, table := range []string{"transactions", "income_events"} {
+		if _, err := dbtx.ExecContext(ctx, `
+			UPDATE `+table+` SET cash_settled = 0
+			WHERE holding_id IN (SELECT id FROM holdings WHERE portfolio_id = ? AND currency = ?)`,
+			a.PortfolioID, a.Currency); err != nil {
+			return fmt.Errorf("unsettle cash account %s: %w", table, err)
+		}
+	}
+	if _, err := dbtx.ExecContext(ctx, `DELETE FROM cash_accounts WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("delete cash account: %w", err)
+	}
+	if err := dbtx.Commit(); err != nil {
+		return fmt.Errorf("commit delete cash account: %w", err)
+	}
+	return nil
+}
+
+// ListCashMovements returns an account's deposits, withdrawals, income and
+// fees together with the trades settled against it, oldest first.
+func (s *SQLiteStore) ListCashMovements(ctx context.Context, accountID int64) ([]models.CashMovement, error) {
+	accounts, err := listCashAccounts(ctx, s.db, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if len(accounts) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return listCashMovements(ctx, s.db, accounts)
+}
+
+// CreateCashMovement books m against m.AccountID. m.Amount is given as a
+// positive number and stored with the sign its type implies.
+func (s *SQLiteStore) CreateCashMovement(ctx context.Context, m models.CashMovement) (models.CashMovement, error) {
+	if m.ExecutedAt.IsZero() {
+		m.ExecutedAt = time.Now().UTC()
+	}
+	accounts, err := listCashAccounts(ctx, s.db, m.AccountID)
+	if err != nil {
+		return models.CashMovement{}, err
+	}
+	if len(accounts) == 0 {
+		return models.CashMovement{}, sql.ErrNoRows
+	}
+
+	amount := m.Amount
+	if !m.Type.Credits() {
+		amount = -amount
+	}
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO cash_movements(account_id, type, amount, fx_rate, executed_at, note)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		m.AccountID, m.Type, amount, m.FXRate, m.ExecutedAt.UTC(), strings.TrimSpace(m.Note))
+	if err != nil {
+		return models.CashMovement{}, fmt.Errorf("insert cash movement: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.CashMovement{}, fmt.Errorf("cash movement last insert id: %w", err)
+	}
+	return getCashMovement(ctx, s.db, id)
+}
+
+func (s *SQLiteStore) DeleteCashMovement(ctx context.Context, accountID, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM cash_movements WHERE id = ? AND account_id = ?`, id, accountID)
+	if err != nil {
+		return fmt.Errorf("delete cash movement: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cash movement rows affected: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// listCashAccounts returns one account, or all of them when id is zero,
+// without balances.
+func listCashAccounts(ctx context.Context, q querier, id int64) ([]models.CashAccount, error) {
+	query := `SELECT id, portfolio_id, currency, created_at FROM cash_accounts`
+	args := make([]any, 0, 1)
+	if id != 0 {
+		query += ` WHERE id = ?`
+		args = append(args, id)
+	}
+	rows, err := q.QueryContext(ctx, query+` ORDER BY id ASC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query cash accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := make([]models.CashAccount, 0)
+	for rows.Next() {
+		var a models.CashAccount
+		if err := rows.Scan(&a.ID, &a.PortfolioID, &a.Currency, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan cash account: %w", err)
+		}
+		accounts = append(accounts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate cash accounts: %w", err)
+	}
+	return accounts, nil
+}
+
+func findCashAccount(ctx context.Context, q querier, portfolioID int64, currency string) (int64, error) {
+	var id int64
+	err := q.QueryRowContext(ctx, `SELECT id FROM cash_accounts WHERE portfolio_id = ? AND currency = ?`,
+		portfolioID, normalizeCurrency(currency)).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("find cash account: %w", err)
+	}
+	return id, nil
+}
+
+const cashMovementColumns = `
+	m.id, m.account_id, a.portfolio_id, a.currency, m.type, m.amount, m.fx_rate, m.executed_at, m.note, m.created_at`
+
+func getCashMovement(ctx context.Context, q querier, id int64) (models.CashMovement, error) {
+	var m models.CashMovement
+	err := q.QueryRowContext(ctx, `SELECT `+cashMovementColumns+`
+		FROM cash_movements m JOIN cash_accounts a ON a.id = m.account_id
+		WHERE m.id = ?`, id).
+		Scan(&m.ID, &m.AccountID, &m.PortfolioID, &m.Currency, &m.Type, &m.Amount, &m.FXRate, &m.ExecutedAt, &m.Note, &m.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.CashMovement{}, err
+		}
+		return models.CashMovement{}, fmt.Errorf("scan cash movement: %w", err)
+	}
+	return m, nil
+}
+
+// listCashMovements gathers the movements of accounts, including a CashTrade
+// entry for each settled transaction, and a dividend or interest entry for
+// each settled income event, of a holding with the account's portfolio and
+// currency.
+func listCashMovements(ctx context.Context, q querier, accounts []models.CashAccount) ([]models.CashMovement, error) {
+	byKey := make(map[string]models.CashAccount, len(accounts))
+	ids := make([]any, 0, len(accounts))
+	for _, a := range accounts {
+		byKey[cashKey(a.PortfolioID, a.Currency)] = a
+		ids = append(ids, a.ID)
+	}
+	movements := make([]models.CashMovement, 0)
+	if len(ids) == 0 {
+		return movements, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	rows, err := q.QueryContext(ctx, `SELECT `+cashMovementColumns+`
+		FROM cash_movements m JOIN cash_accounts a ON a.id = m.account_id
+		WHERE m.account_id IN (`+placeholders+`)`, ids...)
+	if err != nil {
+		return nil, fmt.Errorf("query cash movements: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m models.CashMovement
+		if err := rows.Scan(&m.ID, &m.AccountID, &m.PortfolioID, &m.Currency, &m.Type, &m.Amount, &m.FXRate,
+			&m.ExecutedAt, &m.Note, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan cash movement: %w", err)
+		}
+		movements = append(movements, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate cash movements: %w", err)
+	}
+	rows.Close()
+
+	txs, err := listTransactions(ctx, q, TransactionFilter{})
+	if err != nil {
+		return nil, err
+	}
+	for _, tx := range txs {
+		if !tx.CashSettled {
+			continue
+		}
+		a, ok := byKey[cashKey(tx.PortfolioID, tx.Currency)]
+		if !ok {
+			continue
+		}
+		movements = append(movements, models.CashMovement{
+			AccountID:     a.ID,
+			PortfolioID:   a.PortfolioID,
+			Currency:      a.Currency,
+			Type:          models.CashTrade,
+			Amount:        tradeCash(tx),
+			FXRate:        tx.FXRate,
+			TransactionID: tx.ID,
+			ExecutedAt:    tx.ExecutedAt,
+			Note:          tx.Note,
+			CreatedAt:     tx.CreatedAt,
+		})
+	}
+
+	income, err := listIncome(ctx, q, IncomeFilter{})
+	if err != nil {
+		return nil, err
+	}
+	for _, ev := range income {
+		if !ev.CashSettled {
+			continue
+		}
+		a, ok := byKey[cashKey(ev.PortfolioID, ev.Currency)]
+		if !ok {
+			continue
+		}
+		kind := models.CashDividend
+		if ev.Type != models.IncomeDividend {
+			kind = models.CashInterest
+		}
+		movements = append(movements, models.CashMovement{
+			AccountID:   a.ID,
+			PortfolioID: a.PortfolioID,
+			Currency:    a.Currency,
+			Type:        kind,
+			Amount:      ev.Amount,
+			FXRate:      ev.FXRate,
+			IncomeID:    ev.ID,
+			ExecutedAt:  ev.PaidAt,
+			Note:        ev.Note,
+			CreatedAt:   ev.CreatedAt,
+		})
+	}
+
+	sort.SliceStable(movements, func(i, j int) bool {
+		return movements[i].ExecutedAt.Before(movements[j].ExecutedAt)
+	})
+	return movements, nil
+}
+
+func applyBalances(accounts []models.CashAccount, movements []models.CashMovement) {
+	index := make(map[int64]int, len(accounts))
+	for i, a := range accounts {
+		index[a.ID] = i
+	}
+	for _, m := range movements {
+		if i, ok := index[m.AccountID]; ok {
+			accounts[i].Balance += m.Amount
+		}
+	}
+}
+
+// checkCashSettlement rejects settling a trade or payment of holdingID when
+// its portfolio has no cash account in the holding's currency.
+func checkCashSettlement(ctx context.Context, q querier, settled bool, holdingID int64) error {
+	if !settled {
+		return nil
+	}
+	var portfolioID int64
+	var currency string
+	err := q.QueryRowContext(ctx, `SELECT portfolio_id, currency FROM holdings WHERE id = ?`, holdingID).
+		Scan(&portfolioID, &currency)
+	if err != nil {
+		return err
+	}
+	if _, err := findCashAccount(ctx, q, portfolioID, currency); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoCashAccount
+		}
+		return err
+	}
+	return nil
+}
+
+// tradeCash is what a settled transaction does to the cash balance, in the
+// holding's currency: buys and fees are paid out, sale proceeds net of the
+// fee are paid in. Transfers move the asset itself and leave cash alone.
+func tradeCash(tx models.Transaction) float64 {
+	switch tx.Type {
+	case models.TxBuy:
+		return -(tx.Quantity*tx.Price + tx.Fee)
+	case models.TxSell:
+		return tx.Quantity*tx.Price - tx.Fee
+	case models.TxFee:
+		return -tx.Fee
+	}
+	return 0
+}
+
+func cashKey(portfolioID int64, currency string) string {
+	return fmt.Sprintf("%d:%s", portfolioID, normalizeCurrency(currency))
+}
@@ -0,0 +1,230 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"portfoliopulse/internal/models"
+)
+
+var (
+	ErrChannelExists  = errors.New("a channel with that name already exists")
+	ErrUnknownChannel = errors.New("no channel with that name")
+)
+
+const channelColumns = `id, name, type, url, chat_id, secret, template, created_at`
+
+// ListChannels returns every notification channel with its headers and
+// routing rules, in creation order.
+func (s *SQLiteStore) ListChannels(ctx context.Context) ([]models.NotificationChannel, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+channelColumns+` FROM notification_channels ORDER BY id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("query channels: %w", err)
+	}
+	defer rows.Close()
+
+	channels := make([]models.NotificationChannel, 0)
+	for rows.Next() {
+		c, err := scanChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate channels: %w", err)
+	}
+	rows.Close()
+
+	for i := range channels {
+		if err := loadChannelDetails(ctx, s.db, &channels[i]); err != nil {
+			return nil, err
+		}
+	}
+	return channels, nil
+}
+
+func (s *SQLiteStore) GetChannel(ctx context.Context, id int64) (models.NotificationChannel, error) {
+	return getChannel(ctx, s.db, id)
+}
+
+// CreateChannel stores c with its headers and rules. Names are unique.
+func (s *SQLiteStore) CreateChannel(ctx context.Context, c models.NotificationChannel) (models.NotificationChannel, error) {
+	dbtx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.NotificationChannel{}, fmt.Errorf("begin create channel: %w", err)
+	}
+	defer dbtx.Rollback()
+
+	c.Name = strings.TrimSpace(c.Name)
+	if err := checkChannelName(ctx, dbtx, c.Name, 0); err != nil {
+		return models.NotificationChannel{}, err
+	}
+	res, err := dbtx.ExecContext(ctx, `
+		INSERT INTO notification_channels(name, type, url, chat_id, secret, template)
+		VALUES (?, ?, ?, ?, ?, ?)`, c.Name, c.Type, c.URL, c.ChatID, c.Secret, c.Template)
+	if err != nil {
+		return models.NotificationChannel{}, fmt.Errorf("insert channel: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.NotificationChannel{}, fmt.Errorf("channel last insert id: %w", err)
+	}
+	if err := insertChannelDetails(ctx, dbtx, id, c); err != nil {
+		return models.NotificationChannel{}, err
+	}
+
+	out, err := getChannel(ctx, dbtx, id)
+	if err != nil {
+		return models.NotificationChannel{}, err
+	}
+	if err := dbtx.Commit(); err != nil {
+		return models.NotificationChannel{}, fmt.Errorf("commit create channel: %w", err)
+	}
+	return out, nil
+}
+
+// UpdateChannel replaces channel id, headers and rules included.
+func (s *SQLiteStore) UpdateChannel(ctx context.Context, id int64, c models.NotificationChannel) (models.NotificationChannel, error) {
+	dbtx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.NotificationChannel{}, fmt.Errorf("begin update channel: %w", err)
+	}
+	defer dbtx.Rollback()
+
+	if _, err := getChannel(ctx, dbtx, id); err != nil {
+		return models.NotificationChannel{}, err
+	}
+	c.Name = strings.TrimSpace(c.Name)
+	if err := checkChannelName(ctx, dbtx, c.Name, id); err != nil {
+		return models.NotificationChannel{}, err
+	}
+	if _, err := dbtx.ExecContext(ctx, `
+		UPDATE notification_channels SET name = ?, type = ?, url = ?, chat_id = ?, secret = ?, template = ?
+		WHERE id = ?`, c.Name, c.Type, c.URL, c.ChatID, c.Secret, c.Template, id); err != nil {
+		return models.NotificationChannel{}, fmt.Errorf("update channel: %w", err)
+	}
+	if _, err := dbtx.ExecContext(ctx, `DELETE FROM channel_headers WHERE channel_id = ?`, id); err != nil {
+		return models.NotificationChannel{}, fmt.Errorf("clear channel headers: %w", err)
+	}
+	if _, err := dbtx.ExecContext(ctx, `DELETE FROM channel_rules WHERE channel_id = ?`, id); err != nil {
+		return models.NotificationChannel{}, fmt.Errorf("clear channel rules: %w", err)
+	}
+	if err := insertChannelDetails(ctx, dbtx, id, c); err != nil {
+		return models.NotificationChannel{}, err
+	}
+
+	out, err := getChannel(ctx, dbtx, id)
+	if err != nil {
+		return models.NotificationChannel{}, err
+	}
+	if err := dbtx.Commit(); err != nil {
+		return models.NotificationChannel{}, fmt.Errorf("commit update channel: %w", err)
+	}
+	return out, nil
+}
+
+// DeleteChannel removes a channel with its headers and rules. Its logged
+// deliveries stay.
+func (s *SQLiteStore) DeleteChannel(ctx context.Context, id int64) error {
+	if _, err := getChannel(ctx, s.db, id); err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM notification_channels WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("delete channel: %w", err)
+	}
+	return nil
+}
+
+func getChannel(ctx context.Context, q querier, id int64) (models.NotificationChannel, error) {
+	c, err := scanChannel(q.QueryRowContext(ctx, `SELECT `+channelColumns+` FROM notification_channels WHERE id = ?`, id))
+	if err != nil {
+		return models.NotificationChannel{}, err
+	}
+	if err := loadChannelDetails(ctx, q, &c); err != nil {
+		return models.NotificationChannel{}, err
+	}
+	return c, nil
+}
+
+func scanChannel(sc scanner) (models.NotificationChannel, error) {
+	var c models.NotificationChannel
+	if err := sc.Scan(&c.ID, &c.Name, &c.Type, &c.URL, &c.ChatID, &c.Secret, &c.Template, &c.CreatedAt); err != nil {
+		return models.NotificationChannel{}, err
+	}
+	return c, nil
+}
+
+func loadChannelDetails(ctx context.Context, q querier, c *models.NotificationChannel) error {
+	rows, err := q.QueryContext(ctx, `SELECT name, value FROM channel_headers WHERE channel_id = ? ORDER BY name ASC`, c.ID)
+	if err != nil {
+		return fmt.Errorf("query channel headers: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return fmt.Errorf("scan channel header: %w", err)
+		}
+		if c.Headers == nil {
+			c.Headers = make(map[string]string)
+		}
+		c.Headers[name] = value
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate channel headers: %w", err)
+	}
+	rows.Close()
+
+	rules, err := q.QueryContext(ctx, `
+		SELECT ticker, asset_type, min_severity FROM channel_rules WHERE channel_id = ? ORDER BY id ASC`, c.ID)
+	if err != nil {
+		return fmt.Errorf("query channel rules: %w", err)
+	}
+	defer rules.Close()
+	c.Rules = make([]models.ChannelRule, 0)
+	for rules.Next() {
+		var r models.ChannelRule
+		if err := rules.Scan(&r.Ticker, &r.AssetType, &r.MinSeverity); err != nil {
+			return fmt.Errorf("scan channel rule: %w", err)
+		}
+		c.Rules = append(c.Rules, r)
+	}
+	if err := rules.Err(); err != nil {
+		return fmt.Errorf("iterate channel rules: %w", err)
+	}
+	return nil
+}
+
+// insertChannelDetails writes the headers and rules of channel id. Rule
+// tickers are upper-cased to match how alerts store them.
+func insertChannelDetails(ctx context.Context, q querier, id int64, c models.NotificationChannel) error {
+	for name, value := range c.Headers {
+		if _, err := q.ExecContext(ctx, `
+			INSERT INTO channel_headers(channel_id, name, value) VALUES (?, ?, ?)`, id, name, value); err != nil {
+			return fmt.Errorf("insert channel header: %w", err)
+		}
+	}
+	for _, r := range c.Rules {
+		if _, err := q.ExecContext(ctx, `
+			INSERT INTO channel_rules(channel_id, ticker, asset_type, min_severity) VALUES (?, ?, ?, ?)`,
+			id, strings.ToUpper(strings.TrimSpace(r.Ticker)), r.AssetType, r.MinSeverity); err != nil {
+			return fmt.Errorf("insert channel rule: %w", err)
+		}
+	}
+	return nil
+}
+
+func checkChannelName(ctx context.Context, q querier, name string, exceptID int64) error {
+	var count int
+	err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM notification_channels WHERE name = ? AND id <> ?`, name, exceptID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("check channel name: %w", err)
+	}
+	if count > 0 {
+		return ErrChannelExists
+	}
+	return nil
+}
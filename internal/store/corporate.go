@@ -0,0 +1,597 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"portfoliopulse/internal/alertexpr"
+	"portfoliopulse/internal/ledger"
+	"portfoliopulse/internal/models"
+)
+
+// ErrCorporateActionApplied rejects applying the same action twice.
+var ErrCorporateActionApplied = errors.New("corporate action already applied")
+
+const corporateActionColumns = `
+	id, type, asset_type, ticker, new_ticker, ratio, cost_fraction, effective_at, note, applied_at`
+
+func (s *SQLiteStore) ListCorporateActions(ctx context.Context) ([]models.CorporateAction, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+corporateActionColumns+`
+		FROM corporate_actions ORDER BY effective_at ASC, id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("query corporate actions: %w", err)
+	}
+	defer rows.Close()
+
+	actions := make([]models.CorporateAction, 0)
+	for rows.Next() {
+		a, err := scanCorporateAction(rows)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate corporate actions: %w", err)
+	}
+	return actions, nil
+}
+
+// GetCorporateAction returns an action together with its audit trail.
+func (s *SQLiteStore) GetCorporateAction(ctx context.Context, id int64) (models.CorporateAction, error) {
+	a, err := scanCorporateAction(s.db.QueryRowContext(ctx, `SELECT `+corporateActionColumns+`
+		FROM corporate_actions WHERE id = ?`, id))
+	if err != nil {
+		return models.CorporateAction{}, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT entity, entity_id, field, old_value, new_value, factor, row_count
+		FROM corporate_action_changes WHERE action_id = ? ORDER BY id ASC`, id)
+	if err != nil {
+		return models.CorporateAction{}, fmt.Errorf("query corporate action changes: %w", err)
+	}
+	defer rows.Close()
+
+	a.Changes = make([]models.CorporateActionChange, 0)
+	for rows.Next() {
+		var c models.CorporateActionChange
+		if err := rows.Scan(&c.Entity, &c.EntityID, &c.Field, &c.OldValue, &c.NewValue, &c.Factor, &c.Rows); err != nil {
+			return models.CorporateAction{}, fmt.Errorf("scan corporate action change: %w", err)
+		}
+		a.Changes = append(a.Changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return models.CorporateAction{}, fmt.Errorf("iterate corporate action changes: %w", err)
+	}
+	return a, nil
+}
+
+// ApplyCorporateAction records a and rewrites every holding of its ticker in
+// one transaction, logging each change:
+//
+//   - split and reverse_split multiply the quantity (and divide the price) of
+//     trades, lot selections and reinvestments before EffectiveAt by Ratio,
+//     and divide alert thresholds and earlier price history by it;
+//   - ticker_change renames holdings, folding them into an existing
+//     NewTicker holding in the same portfolio, alerts and price history;
+//   - merger converts the whole history into NewTicker at Ratio, folding it
+//     into an existing NewTicker holding in the same portfolio, and moves
+//     alerts across; price history of the old ticker is left alone;
+//   - spin_off moves CostFraction of the cost of each lot open at
+//     EffectiveAt into a new NewTicker lot of Ratio shares per share, dated
+//     like the parent lot, so total cost and cash are unchanged.
+func (s *SQLiteStore) ApplyCorporateAction(ctx context.Context, a models.CorporateAction) (models.CorporateAction, error) {
+	a.Ticker = strings.ToUpper(strings.TrimSpace(a.Ticker))
+	a.NewTicker = strings.ToUpper(strings.TrimSpace(a.NewTicker))
+	a.Note = strings.TrimSpace(a.Note)
+	if a.EffectiveAt.IsZero() {
+		a.EffectiveAt = time.Now().UTC()
+	}
+	a.EffectiveAt = a.EffectiveAt.UTC()
+
+	dbtx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.CorporateAction{}, fmt.Errorf("begin corporate action: %w", err)
+	}
+	defer dbtx.Rollback()
+
+	var applied int
+	if err := dbtx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM corporate_actions
+		WHERE type = ? AND asset_type = ? AND ticker = ? AND effective_at = ?`,
+		a.Type, a.AssetType, a.Ticker, a.EffectiveAt).Scan(&applied); err != nil {
+		return models.CorporateAction{}, fmt.Errorf("check corporate action: %w", err)
+	}
+	if applied > 0 {
+		return models.CorporateAction{}, ErrCorporateActionApplied
+	}
+
+	res, err := dbtx.ExecContext(ctx, `
+		INSERT INTO corporate_actions(type, asset_type, ticker, new_ticker, ratio, cost_fraction, effective_at, note)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.Type, a.AssetType, a.Ticker, a.NewTicker, a.Ratio, a.CostFraction, a.EffectiveAt, a.Note)
+	if err != nil {
+		return models.CorporateAction{}, fmt.Errorf("insert corporate action: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.CorporateAction{}, fmt.Errorf("corporate action last insert id: %w", err)
+	}
+
+	adj := &adjuster{ctx: ctx, q: dbtx, actionID: id}
+	holdings, err := adj.holdings(a.AssetType, a.Ticker)
+	if err != nil {
+		return models.CorporateAction{}, err
+	}
+
+	switch a.Type {
+	case models.ActionSplit, models.ActionReverseSplit:
+		for _, h := range holdings {
+			if err := adj.scaleHolding(h.ID, a.Ratio, a.EffectiveAt); err != nil {
+				return models.CorporateAction{}, err
+			}
+		}
+		if err := adj.adjustAlerts(a.AssetType, a.Ticker, a.Ticker, a.Ratio); err != nil {
+			return models.CorporateAction{}, err
+		}
+		if err := adj.scalePriceHistory(a.AssetType, a.Ticker, a.Ratio, a.EffectiveAt); err != nil {
+			return models.CorporateAction{}, err
+		}
+	case models.ActionTickerChange:
+		for _, h := range holdings {
+			if err := adj.mergeHolding(h, a.NewTicker); err != nil {
+				return models.CorporateAction{}, err
+			}
+		}
+		if err := adj.adjustAlerts(a.AssetType, a.Ticker, a.NewTicker, 1); err != nil {
+			return models.CorporateAction{}, err
+		}
+		if err := adj.renamePriceHistory(a.AssetType, a.Ticker, a.NewTicker); err != nil {
+			return models.CorporateAction{}, err
+		}
+	case models.ActionMerger:
+		for _, h := range holdings {
+			if err := adj.scaleHolding(h.ID, a.Ratio, time.Time{}); err != nil {
+				return models.CorporateAction{}, err
+			}
+			if err := adj.mergeHolding(h, a.NewTicker); err != nil {
+				return models.CorporateAction{}, err
+			}
+		}
+		if err := adj.adjustAlerts(a.AssetType, a.Ticker, a.NewTicker, a.Ratio); err != nil {
+			return models.CorporateAction{}, err
+		}
+	case models.ActionSpinOff:
+		for _, h := range holdings {
+			if err := adj.spinOff(h, a); err != nil {
+				return models.CorporateAction{}, err
+			}
+		}
+	default:
+		return models.CorporateAction{}, fmt.Errorf("unknown corporate action type %q", a.Type)
+	}
+
+	for _, holdingID := range adj.touched {
+		if err := checkLedger(ctx, dbtx, holdingID); err != nil {
+			return models.CorporateAction{}, err
+		}
+	}
+	if err := dbtx.Commit(); err != nil {
+		return models.CorporateAction{}, fmt.Errorf("commit corporate action: %w", err)
+	}
+	return s.GetCorporateAction(ctx, id)
+}
+
+func scanCorporateAction(sc scanner) (models.CorporateAction, error) {
+	var a models.CorporateAction
+	if err := sc.Scan(&a.ID, &a.Type, &a.AssetType, &a.Ticker, &a.NewTicker, &a.Ratio, &a.CostFraction,
+		&a.EffectiveAt, &a.Note, &a.AppliedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.CorporateAction{}, err
+		}
+		return models.CorporateAction{}, fmt.Errorf("scan corporate action: %w", err)
+	}
+	return a, nil
+}
+
+// adjuster rewrites rows for one corporate action inside its transaction
+// and writes the audit trail as it goes.
+type adjuster struct {
+	ctx      context.Context
+	q        querier
+	actionID int64
+	// touched lists the holdings whose ledger must still replay cleanly.
+	touched []int64
+}
+
+func (adj *adjuster) log(c models.CorporateActionChange) error {
+	if c.Rows == 0 {
+		c.Rows = 1
+	}
+	_, err := adj.q.ExecContext(adj.ctx, `
+		INSERT INTO corporate_action_changes(action_id, entity, entity_id, field, old_value, new_value, factor, row_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		adj.actionID, c.Entity, c.EntityID, c.Field, c.OldValue, c.NewValue, c.Factor, c.Rows)
+	if err != nil {
+		return fmt.Errorf("insert corporate action change: %w", err)
+	}
+	return nil
+}
+
+// logValue records a single field going from before to after on one row.
+func (adj *adjuster) logValue(entity string, id int64, field string, before, after float64) error {
+	return adj.log(models.CorporateActionChange{
+		Entity: entity, EntityID: id, Field: field, OldValue: formatFloat(before), NewValue: formatFloat(after),
+	})
+}
+
+func (adj *adjuster) holdings(assetType models.AssetType, ticker string) ([]models.Holding, error) {
+	rows, err := adj.q.QueryContext(adj.ctx, `
+		SELECT id, portfolio_id, ticker, asset_type, currency
+		FROM holdings WHERE asset_type = ? AND ticker = ? ORDER BY id ASC`, assetType, ticker)
+	if err != nil {
+		return nil, fmt.Errorf("query action holdings: %w", err)
+	}
+	defer rows.Close()
+
+	holdings := make([]models.Holding, 0)
+	for rows.Next() {
+		var h models.Holding
+		if err := rows.Scan(&h.ID, &h.PortfolioID, &h.Ticker, &h.AssetType, &h.Currency); err != nil {
+			return nil, fmt.Errorf("scan action holding: %w", err)
+		}
+		holdings = append(holdings, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate action holdings: %w", err)
+	}
+	return holdings, nil
+}
+
+// scaleHolding multiplies quantities by ratio and divides prices by it for
+// the holding's entries dated before the cutoff (all of them when the
+// cutoff is zero). Amounts, fees and therefore cash are unchanged.
+func (adj *adjuster) scaleHolding(holdingID int64, ratio float64, before time.Time) error {
+	adj.touched = append(adj.touched, holdingID)
+	txs, err := listTransactions(adj.ctx, adj.q, TransactionFilter{HoldingID: holdingID})
+	if err != nil {
+		return err
+	}
+	for _, tx := range txs {
+		if (!before.IsZero() && !tx.ExecutedAt.Before(before)) || tx.Quantity == 0 {
+			continue
+		}
+		quantity, price := tx.Quantity*ratio, tx.Price/ratio
+		if _, err := adj.q.ExecContext(adj.ctx, `
+			UPDATE transactions SET quantity = ?, price = ? WHERE id = ?`, quantity, price, tx.ID); err != nil {
+			return fmt.Errorf("scale transaction: %w", err)
+		}
+		if err := adj.logValue("transaction", tx.ID, "quantity", tx.Quantity, quantity); err != nil {
+			return err
+		}
+		if err := adj.logValue("transaction", tx.ID, "price", tx.Price, price); err != nil {
+			return err
+		}
+		if len(tx.Lots) > 0 {
+			res, err := adj.q.ExecContext(adj.ctx, `
+				UPDATE transaction_lots SET quantity = quantity * ? WHERE transaction_id = ?`, ratio, tx.ID)
+			if err != nil {
+				return fmt.Errorf("scale lot selections: %w", err)
+			}
+			n, _ := res.RowsAffected()
+			if err := adj.log(models.CorporateActionChange{
+				Entity: "lot_selection", EntityID: tx.ID, Field: "quantity", Factor: ratio, Rows: n,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	events, err := listIncome(adj.ctx, adj.q, IncomeFilter{HoldingID: holdingID})
+	if err != nil {
+		return err
+	}
+	for _, ev := range events {
+		if (!before.IsZero() && !ev.PaidAt.Before(before)) || ev.Quantity == 0 {
+			continue
+		}
+		quantity, price := ev.Quantity*ratio, ev.Price/ratio
+		if _, err := adj.q.ExecContext(adj.ctx, `
+			UPDATE income_events SET quantity = ?, price = ? WHERE id = ?`, quantity, price, ev.ID); err != nil {
+			return fmt.Errorf("scale income: %w", err)
+		}
+		if err := adj.logValue("income", ev.ID, "quantity", ev.Quantity, quantity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (adj *adjuster) renameHolding(holdingID int64, from, to string) error {
+	if _, err := adj.q.ExecContext(adj.ctx, `UPDATE holdings SET ticker = ? WHERE id = ?`, to, holdingID); err != nil {
+		return fmt.Errorf("rename holding: %w", err)
+	}
+	return adj.log(models.CorporateActionChange{Entity: "holding", EntityID: holdingID, Field: "ticker", OldValue: from, NewValue: to})
+}
+
+// mergeHolding moves an already scaled holding into the target ticker:
+// into the portfolio's existing holding of it, or by renaming it.
+func (adj *adjuster) mergeHolding(h models.Holding, target string) error {
+	var targetID int64
+	err := adj.q.QueryRowContext(adj.ctx, `
+		SELECT id FROM holdings WHERE portfolio_id = ? AND ticker = ? AND asset_type = ?
+		ORDER BY id ASC LIMIT 1`, h.PortfolioID, target, h.AssetType).Scan(&targetID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return adj.renameHolding(h.ID, h.Ticker, target)
+	}
+	if err != nil {
+		return fmt.Errorf("find merger target: %w", err)
+	}
+
+	for _, table := range []string{"transactions", "income_events"} {
+		if _, err := adj.q.ExecContext(adj.ctx, `UPDATE `+table+` SET holding_id = ? WHERE holding_id = ?`, targetID, h.ID); err != nil {
+			return fmt.Errorf("move %s to merger target: %w", table, err)
+		}
+	}
+	if _, err := adj.q.ExecContext(adj.ctx, `DELETE FROM holdings WHERE id = ?`, h.ID); err != nil {
+		return fmt.Errorf("delete merged holding: %w", err)
+	}
+	adj.touched = append(adj.touched, targetID)
+	return adj.log(models.CorporateActionChange{
+		Entity: "holding", EntityID: h.ID, Field: "merged_into", OldValue: h.Ticker, NewValue: strconv.FormatInt(targetID, 10),
+	})
+}
+
+// spinOff moves CostFraction of the cost of each lot of h open at the
+// action's effective time into a spin_off lot of the new ticker, dated like
+// the parent lot, and takes it off the parent lots with a cost_adjustment
+// dated just before the action. The parent's trades are left as booked,
+// so sales before the action keep their gains.
+func (adj *adjuster) spinOff(h models.Holding, a models.CorporateAction) error {
+	cutoff := a.EffectiveAt.Add(-time.Nanosecond)
+	txs, err := listTransactions(adj.ctx, adj.q, TransactionFilter{HoldingID: h.ID, To: cutoff})
+	if err != nil {
+		return err
+	}
+	pos, err := ledger.Replay(txs)
+	if err != nil {
+		return fmt.Errorf("replay holding %d: %w", h.ID, err)
+	}
+	if len(pos.Lots) == 0 {
+		return nil
+	}
+	adj.touched = append(adj.touched, h.ID)
+
+	childID, err := findOrCreateHolding(adj.ctx, adj.q, h.PortfolioID, a.NewTicker, h.AssetType, h.Currency)
+	if err != nil {
+		return err
+	}
+	adj.touched = append(adj.touched, childID)
+
+	selected := make([]models.LotSelection, 0, len(pos.Lots))
+	for _, lot := range pos.Lots {
+		if lot.Remaining <= 0 {
+			continue
+		}
+		selected = append(selected, models.LotSelection{LotID: lot.ID, Quantity: lot.Remaining})
+
+		quantity := lot.Remaining * a.Ratio
+		price := lot.CostPerUnit * a.CostFraction / a.Ratio
+		res, err := adj.q.ExecContext(adj.ctx, `
+			INSERT INTO transactions(holding_id, type, quantity, price, fee, fx_rate, executed_at, note)
+			VALUES (?, ?, ?, ?, 0, ?, ?, ?)`,
+			childID, models.TxSpinOff, quantity, price, lot.FXRate, lot.AcquiredAt.UTC(), "spin-off from "+h.Ticker)
+		if err != nil {
+			return fmt.Errorf("insert spin-off lot: %w", err)
+		}
+		childTx, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("spin-off lot last insert id: %w", err)
+		}
+		if err := adj.log(models.CorporateActionChange{
+			Entity: "transaction", EntityID: childTx, Field: "quantity", NewValue: formatFloat(quantity),
+		}); err != nil {
+			return err
+		}
+		if err := adj.log(models.CorporateActionChange{
+			Entity: "transaction", EntityID: childTx, Field: "price", NewValue: formatFloat(price),
+		}); err != nil {
+			return err
+		}
+	}
+
+	res, err := adj.q.ExecContext(adj.ctx, `
+		INSERT INTO transactions(holding_id, type, quantity, price, fee, fx_rate, executed_at, note)
+		VALUES (?, ?, 0, ?, 0, 0, ?, ?)`,
+		h.ID, models.TxCostAdjust, a.CostFraction, cutoff.UTC(), "spin-off of "+a.NewTicker)
+	if err != nil {
+		return fmt.Errorf("insert spin-off cost adjustment: %w", err)
+	}
+	adjustID, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("cost adjustment last insert id: %w", err)
+	}
+	if err := saveLotSelections(adj.ctx, adj.q, adjustID, selected); err != nil {
+		return err
+	}
+	return adj.log(models.CorporateActionChange{
+		Entity: "transaction", EntityID: adjustID, Field: "cost_fraction", NewValue: formatFloat(a.CostFraction),
+	})
+}
+
+// adjustAlerts moves alerts on ticker to newTicker and divides the price
+// levels they hold (absolute thresholds and hysteresis bands, and trailing
+// peaks) by ratio, then rewrites expression alerts that read the ticker.
+// Percent thresholds are unaffected.
+func (adj *adjuster) adjustAlerts(assetType models.AssetType, ticker, newTicker string, ratio float64) error {
+	rows, err := adj.q.QueryContext(adj.ctx, `SELECT `+alertColumns+alertFrom+`
+		WHERE a.asset_type = ? AND a.ticker = ? ORDER BY a.id ASC`, assetType, ticker)
+	if err != nil {
+		return fmt.Errorf("query action alerts: %w", err)
+	}
+	alerts := make([]models.PriceAlert, 0)
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		alerts = append(alerts, a)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("iterate action alerts: %w", err)
+	}
+	rows.Close()
+
+	for _, a := range alerts {
+		threshold, hysteresis, highWater := a.Threshold, a.Hysteresis, a.HighWaterMark/ratio
+		priced := a.Kind == models.AlertPrice && (a.Direction != models.AlertTrailing || a.Trail == models.TrailAmount)
+		if priced {
+			threshold /= ratio
+			hysteresis /= ratio
+		}
+		if _, err := adj.q.ExecContext(adj.ctx, `
+			UPDATE price_alerts SET ticker = ?, threshold = ?, hysteresis = ?, high_water = ? WHERE id = ?`,
+			newTicker, threshold, hysteresis, highWater, a.ID); err != nil {
+			return fmt.Errorf("adjust alert: %w", err)
+		}
+		if newTicker != ticker {
+			if err := adj.log(models.CorporateActionChange{
+				Entity: "alert", EntityID: a.ID, Field: "ticker", OldValue: ticker, NewValue: newTicker,
+			}); err != nil {
+				return err
+			}
+		}
+		if ratio == 1 {
+			continue
+		}
+		if priced {
+			if err := adj.logValue("alert", a.ID, "threshold", a.Threshold, threshold); err != nil {
+				return err
+			}
+			if a.Hysteresis > 0 {
+				if err := adj.logValue("alert", a.ID, "hysteresis", a.Hysteresis, hysteresis); err != nil {
+					return err
+				}
+			}
+		}
+		if a.HighWaterMark > 0 {
+			if err := adj.logValue("alert", a.ID, "highWaterMark", a.HighWaterMark, highWater); err != nil {
+				return err
+			}
+		}
+	}
+	return adj.adjustExpressions(assetType, ticker, newTicker, ratio)
+}
+
+// adjustExpressions points expression alerts reading ticker at newTicker,
+// scaling its price by ratio so their literals still mean what they did.
+func (adj *adjuster) adjustExpressions(assetType models.AssetType, ticker, newTicker string, ratio float64) error {
+	rows, err := adj.q.QueryContext(adj.ctx, `
+		SELECT id, expression FROM price_alerts WHERE kind = ? ORDER BY id ASC`, models.AlertExpression)
+	if err != nil {
+		return fmt.Errorf("query action expressions: %w", err)
+	}
+	type expression struct {
+		id  int64
+		src string
+	}
+	exprs := make([]expression, 0)
+	for rows.Next() {
+		var e expression
+		if err := rows.Scan(&e.id, &e.src); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan action expression: %w", err)
+		}
+		exprs = append(exprs, e)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("iterate action expressions: %w", err)
+	}
+	rows.Close()
+
+	for _, e := range exprs {
+		parsed, err := alertexpr.Parse(e.src)
+		if err != nil {
+			return fmt.Errorf("parse alert %d expression: %w", e.id, err)
+		}
+		if !parsed.Rewrite(alertexpr.Ref{Ticker: ticker, AssetType: assetType}, newTicker, ratio) {
+			continue
+		}
+		rewritten := parsed.String()
+		if _, err := adj.q.ExecContext(adj.ctx, `
+			UPDATE price_alerts SET expression = ? WHERE id = ?`, rewritten, e.id); err != nil {
+			return fmt.Errorf("rewrite alert expression: %w", err)
+		}
+		if err := adj.log(models.CorporateActionChange{
+			Entity: "alert", EntityID: e.id, Field: "expression", OldValue: e.src, NewValue: rewritten,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scalePriceHistory divides ticks and bars recorded before the cutoff by
+// ratio so the history lines up with post-action prices.
+func (adj *adjuster) scalePriceHistory(assetType models.AssetType, ticker string, ratio float64, before time.Time) error {
+	res, err := adj.q.ExecContext(adj.ctx, `
+		UPDATE price_history SET price = price / ?
+		WHERE asset_type = ? AND ticker = ? AND fetched_at < ?`, ratio, assetType, ticker, before)
+	if err != nil {
+		return fmt.Errorf("scale price ticks: %w", err)
+	}
+	if err := adj.logRows(res, "price_history", "price", 1/ratio, "", ""); err != nil {
+		return err
+	}
+
+	res, err = adj.q.ExecContext(adj.ctx, `
+		UPDATE price_bars SET open = open / ?, high = high / ?, low = low / ?, close = close / ?
+		WHERE asset_type = ? AND ticker = ? AND bucket_start < ?`, ratio, ratio, ratio, ratio, assetType, ticker, before)
+	if err != nil {
+		return fmt.Errorf("scale price bars: %w", err)
+	}
+	return adj.logRows(res, "price_bars", "price", 1/ratio, "", "")
+}
+
+// renamePriceHistory moves ticks and bars to the new ticker. Rows that
+// collide with ones already recorded under it are left on the old ticker.
+func (adj *adjuster) renamePriceHistory(assetType models.AssetType, ticker, newTicker string) error {
+	for _, table := range []string{"price_history", "price_bars"} {
+		res, err := adj.q.ExecContext(adj.ctx, `
+			UPDATE OR IGNORE `+table+` SET ticker = ? WHERE asset_type = ? AND ticker = ?`, newTicker, assetType, ticker)
+		if err != nil {
+			return fmt.Errorf("rename %s: %w", table, err)
+		}
+		if err := adj.logRows(res, table, "ticker", 0, ticker, newTicker); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logRows records a bulk rewrite, skipping ones that matched nothing.
+func (adj *adjuster) logRows(res sql.Result, entity, field string, factor float64, from, to string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s rows affected: %w", entity, err)
+	}
+	if n == 0 {
+		return nil
+	}
+	return adj.log(models.CorporateActionChange{
+		Entity: entity, Field: field, OldValue: from, NewValue: to, Factor: factor, Rows: n,
+	})
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,200 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"portfoliopulse/internal/models"
+)
+
+type IncomeFilter struct {
+	PortfolioID int64
+	HoldingID   int64
+	Type        models.IncomeType
+	From        time.Time
+	To          time.Time
+}
+
+const incomeColumns = `
+	e.id, h.portfolio_id, e.holding_id, h.ticker, h.asset_type, h.currency, e.type, e.amount, e.reinvested,
+	e.quantity, e.price, e.transaction_id, e.cash_settled, e.fx_rate, e.paid_at, e.note, e.created_at`
+
+func (s *SQLiteStore) ListIncome(ctx context.Context, filter IncomeFilter) ([]models.IncomeEvent, error) {
+	return listIncome(ctx, s.db, filter)
+}
+
+func (s *SQLiteStore) GetIncome(ctx context.Context, id int64) (models.IncomeEvent, error) {
+	return getIncome(ctx, s.db, id)
+}
+
+// CreateIncome books ev against ev.HoldingID, or against the first holding
+// matching Ticker/AssetType in ev.PortfolioID (creating one in ev.Currency
+// if none exists). A reinvested event also books a buy of ev.Quantity at
+// ev.Price on the payment date, so the reinvestment opens its own lot.
+func (s *SQLiteStore) CreateIncome(ctx context.Context, ev models.IncomeEvent) (models.IncomeEvent, error) {
+	ev.Ticker = strings.ToUpper(strings.TrimSpace(ev.Ticker))
+	ev.Note = strings.TrimSpace(ev.Note)
+	if ev.PaidAt.IsZero() {
+		ev.PaidAt = time.Now().UTC()
+	}
+
+	dbtx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.IncomeEvent{}, fmt.Errorf("begin create income: %w", err)
+	}
+	defer dbtx.Rollback()
+
+	if ev.HoldingID == 0 {
+		ev.PortfolioID, err = portfolioOrDefault(ctx, dbtx, ev.PortfolioID)
+		if err != nil {
+			return models.IncomeEvent{}, err
+		}
+		ev.HoldingID, err = findOrCreateHolding(ctx, dbtx, ev.PortfolioID, ev.Ticker, ev.AssetType, ev.Currency)
+		if err != nil {
+			return models.IncomeEvent{}, err
+		}
+	} else if _, err := getHolding(ctx, dbtx, ev.HoldingID); err != nil {
+		return models.IncomeEvent{}, err
+	}
+	if err := checkCashSettlement(ctx, dbtx, ev.CashSettled, ev.HoldingID); err != nil {
+		return models.IncomeEvent{}, err
+	}
+
+	var txID sql.NullInt64
+	if ev.Reinvested {
+		res, err := dbtx.ExecContext(ctx, `
+			INSERT INTO transactions(holding_id, type, quantity, price, fx_rate, executed_at, note)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			ev.HoldingID, models.TxBuy, ev.Quantity, ev.Price, ev.FXRate, ev.PaidAt.UTC(), "reinvested "+string(ev.Type))
+		if err != nil {
+			return models.IncomeEvent{}, fmt.Errorf("insert reinvestment: %w", err)
+		}
+		if txID.Int64, err = res.LastInsertId(); err != nil {
+			return models.IncomeEvent{}, fmt.Errorf("reinvestment last insert id: %w", err)
+		}
+		txID.Valid = true
+	}
+
+	res, err := dbtx.ExecContext(ctx, `
+		INSERT INTO income_events(holding_id, type, amount, reinvested, quantity, price, transaction_id, cash_settled, fx_rate, paid_at, note)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		ev.HoldingID, ev.Type, ev.Amount, ev.Reinvested, ev.Quantity, ev.Price, txID, ev.CashSettled, ev.FXRate, ev.PaidAt.UTC(), ev.Note)
+	if err != nil {
+		return models.IncomeEvent{}, fmt.Errorf("insert income: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.IncomeEvent{}, fmt.Errorf("income last insert id: %w", err)
+	}
+	if err := dbtx.Commit(); err != nil {
+		return models.IncomeEvent{}, fmt.Errorf("commit create income: %w", err)
+	}
+	return s.GetIncome(ctx, id)
+}
+
+// DeleteIncome removes an event and the reinvestment buy it booked, unless
+// a later sell still needs that lot.
+func (s *SQLiteStore) DeleteIncome(ctx context.Context, id int64) error {
+	dbtx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin delete income: %w", err)
+	}
+	defer dbtx.Rollback()
+
+	ev, err := getIncome(ctx, dbtx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := dbtx.ExecContext(ctx, `DELETE FROM income_events WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("delete income: %w", err)
+	}
+	if ev.TransactionID != 0 {
+		if _, err := dbtx.ExecContext(ctx, `DELETE FROM transactions WHERE id = ?`, ev.TransactionID); err != nil {
+			return fmt.Errorf("delete reinvestment: %w", err)
+		}
+		if err := checkLedger(ctx, dbtx, ev.HoldingID); err != nil {
+			return err
+		}
+	}
+	if err := dbtx.Commit(); err != nil {
+		return fmt.Errorf("commit delete income: %w", err)
+	}
+	return nil
+}
+
+func listIncome(ctx context.Context, q querier, filter IncomeFilter) ([]models.IncomeEvent, error) {
+	where := make([]string, 0, 5)
+	args := make([]any, 0, 5)
+	if filter.PortfolioID != 0 {
+		where = append(where, "h.portfolio_id = ?")
+		args = append(args, filter.PortfolioID)
+	}
+	if filter.HoldingID != 0 {
+		where = append(where, "e.holding_id = ?")
+		args = append(args, filter.HoldingID)
+	}
+	if filter.Type != "" {
+		where = append(where, "e.type = ?")
+		args = append(args, filter.Type)
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "e.paid_at >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "e.paid_at <= ?")
+		args = append(args, filter.To.UTC())
+	}
+
+	query := `SELECT ` + incomeColumns + `
+		FROM income_events e JOIN holdings h ON h.id = e.holding_id`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY e.paid_at ASC, e.id ASC"
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query income: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]models.IncomeEvent, 0)
+	for rows.Next() {
+		ev, err := scanIncome(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate income: %w", err)
+	}
+	return events, nil
+}
+
+func getIncome(ctx context.Context, q querier, id int64) (models.IncomeEvent, error) {
+	row := q.QueryRowContext(ctx, `SELECT `+incomeColumns+`
+		FROM income_events e JOIN holdings h ON h.id = e.holding_id
+		WHERE e.id = ?`, id)
+	return scanIncome(row)
+}
+
+func scanIncome(sc scanner) (models.IncomeEvent, error) {
+	var ev models.IncomeEvent
+	var txID sql.NullInt64
+	if err := sc.Scan(&ev.ID, &ev.PortfolioID, &ev.HoldingID, &ev.Ticker, &ev.AssetType, &ev.Currency, &ev.Type,
+		&ev.Amount, &ev.Reinvested, &ev.Quantity, &ev.Price, &txID, &ev.CashSettled, &ev.FXRate, &ev.PaidAt,
+		&ev.Note, &ev.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.IncomeEvent{}, err
+		}
+		return models.IncomeEvent{}, fmt.Errorf("scan income: %w", err)
+	}
+	ev.TransactionID = txID.Int64
+	return ev, nil
+}
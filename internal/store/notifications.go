@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"portfoliopulse/internal/models"
+)
+
+// DeliveryFilter narrows ListDeliveries. Zero fields match everything; a
+// zero Limit returns the latest 100.
+type DeliveryFilter struct {
+	AlertID int64
+	EventID int64
+	Channel string
+	Status  models.DeliveryStatus
+	Limit   int
+}
+
+const deliveryColumns = `
+	id, channel, channel_type, event, alert_id, event_id, status, attempts, response_code, error, created_at, updated_at, delivered_at`
+
+// CreateDelivery logs a new delivery, stamping its creation time.
+func (s *SQLiteStore) CreateDelivery(ctx context.Context, d models.NotificationDelivery) (models.NotificationDelivery, error) {
+	now := time.Now().UTC()
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO notification_deliveries(channel, channel_type, event, alert_id, event_id, status, attempts, response_code, error,
+			created_at, updated_at, delivered_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.Channel, d.ChannelType, d.Event, d.AlertID, d.EventID, d.Status, d.Attempts, d.ResponseCode, d.Error, now, now, d.DeliveredAt)
+	if err != nil {
+		return models.NotificationDelivery{}, fmt.Errorf("insert delivery: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.NotificationDelivery{}, fmt.Errorf("delivery last insert id: %w", err)
+	}
+	return scanDelivery(s.db.QueryRowContext(ctx, `SELECT `+deliveryColumns+` FROM notification_deliveries WHERE id = ?`, id))
+}
+
+// UpdateDelivery records the outcome of another attempt at delivery d.ID.
+func (s *SQLiteStore) UpdateDelivery(ctx context.Context, d models.NotificationDelivery) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE notification_deliveries
+		SET status = ?, attempts = ?, response_code = ?, error = ?, updated_at = ?, delivered_at = ?
+		WHERE id = ?`,
+		d.Status, d.Attempts, d.ResponseCode, d.Error, time.Now().UTC(), d.DeliveredAt, d.ID)
+	if err != nil {
+		return fmt.Errorf("update delivery: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delivery rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListDeliveries returns logged deliveries matching filter, newest first.
+func (s *SQLiteStore) ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]models.NotificationDelivery, error) {
+	where := make([]string, 0, 4)
+	args := make([]any, 0, 5)
+	if filter.AlertID != 0 {
+		where = append(where, "alert_id = ?")
+		args = append(args, filter.AlertID)
+	}
+	if filter.EventID != 0 {
+		where = append(where, "event_id = ?")
+		args = append(args, filter.EventID)
+	}
+	if filter.Channel != "" {
+		where = append(where, "channel = ?")
+		args = append(args, filter.Channel)
+	}
+	if filter.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, filter.Status)
+	}
+
+	query := `SELECT ` + deliveryColumns + ` FROM notification_deliveries`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]models.NotificationDelivery, 0)
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func scanDelivery(sc scanner) (models.NotificationDelivery, error) {
+	var d models.NotificationDelivery
+	var deliveredAt sql.NullTime
+	if err := sc.Scan(&d.ID, &d.Channel, &d.ChannelType, &d.Event, &d.AlertID, &d.EventID, &d.Status, &d.Attempts, &d.ResponseCode,
+		&d.Error, &d.CreatedAt, &d.UpdatedAt, &deliveredAt); err != nil {
+		return models.NotificationDelivery{}, fmt.Errorf("scan delivery: %w", err)
+	}
+	if deliveredAt.Valid {
+		t := deliveredAt.Time
+		d.DeliveredAt = &t
+	}
+	return d, nil
+}
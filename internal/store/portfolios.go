@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"portfoliopulse/internal/models"
+)
+
+var (
+	ErrDefaultPortfolio = errors.New("the default portfolio cannot be deleted")
+	ErrPortfolioExists  = errors.New("a portfolio with that name already exists")
+)
+
+func (s *SQLiteStore) ListPortfolios(ctx context.Context) ([]models.Portfolio, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, name, created_at FROM portfolios ORDER BY id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("query portfolios: %w", err)
+	}
+	defer rows.Close()
+
+	portfolios := make([]models.Portfolio, 0)
+	for rows.Next() {
+		var p models.Portfolio
+		if err := rows.Scan(&p.ID, &p.Name, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan portfolio: %w", err)
+		}
+		portfolios = append(portfolios, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate portfolios: %w", err)
+	}
+	return portfolios, nil
+}
+
+func (s *SQLiteStore) GetPortfolio(ctx context.Context, id int64) (models.Portfolio, error) {
+	return getPortfolio(ctx, s.db, id)
+}
+
+func (s *SQLiteStore) CreatePortfolio(ctx context.Context, p models.Portfolio) (models.Portfolio, error) {
+	p.Name = strings.TrimSpace(p.Name)
+	if err := checkPortfolioName(ctx, s.db, p.Name, 0); err != nil {
+		return models.Portfolio{}, err
+	}
+
+	res, err := s.db.ExecContext(ctx, `INSERT INTO portfolios(name) VALUES (?)`, p.Name)
+	if err != nil {
+		return models.Portfolio{}, fmt.Errorf("insert portfolio: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.Portfolio{}, fmt.Errorf("portfolio last insert id: %w", err)
+	}
+	return getPortfolio(ctx, s.db, id)
+}
+
+func (s *SQLiteStore) RenamePortfolio(ctx context.Context, id int64, name string) (models.Portfolio, error) {
+	name = strings.TrimSpace(name)
+	if _, err := getPortfolio(ctx, s.db, id); err != nil {
+		return models.Portfolio{}, err
+	}
+	if err := checkPortfolioName(ctx, s.db, name, id); err != nil {
+		return models.Portfolio{}, err
+	}
+	if _, err := s.db.ExecContext(ctx, `UPDATE portfolios SET name = ? WHERE id = ?`, name, id); err != nil {
+		return models.Portfolio{}, fmt.Errorf("rename portfolio: %w", err)
+	}
+	return getPortfolio(ctx, s.db, id)
+}
+
+// DeletePortfolio removes a portfolio together with its holdings, their
+// transactions, its alerts, its cash accounts and its value snapshots
+// (their holdings go with them). The default portfolio always stays.
+func (s *SQLiteStore) DeletePortfolio(ctx context.Context, id int64) error {
+	if id == models.DefaultPortfolioID {
+		return ErrDefaultPortfolio
+	}
+
+	dbtx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin delete portfolio: %w", err)
+	}
+	defer dbtx.Rollback()
+
+	if _, err := getPortfolio(ctx, dbtx, id); err != nil {
+		return err
+	}
+	if _, err := dbtx.ExecContext(ctx, `DELETE FROM holdings WHERE portfolio_id = ?`, id); err != nil {
+		return fmt.Errorf("delete portfolio holdings: %w", err)
+	}
+	if _, err := dbtx.ExecContext(ctx, `DELETE FROM price_alerts WHERE portfolio_id = ?`, id); err != nil {
+		return fmt.Errorf("delete portfolio alerts: %w", err)
+	}
+	if _, err := dbtx.ExecContext(ctx, `DELETE FROM cash_accounts WHERE portfolio_id = ?`, id); err != nil {
+		return fmt.Errorf("delete portfolio cash accounts: %w", err)
+	}
+	if _, err := dbtx.ExecContext(ctx, `DELETE FROM portfolio_snapshots WHERE portfolio_id = ?`, id); err != nil {
+		return fmt.Errorf("delete portfolio snapshots: %w", err)
+	}
+	if _, err := dbtx.ExecContext(ctx, `DELETE FROM portfolios WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("delete portfolio: %w", err)
+	}
+	if err := dbtx.Commit(); err != nil {
+		return fmt.Errorf("commit delete portfolio: %w", err)
+	}
+	return nil
+}
+
+func getPortfolio(ctx context.Context, q querier, id int64) (models.Portfolio, error) {
+	var p models.Portfolio
+	err := q.QueryRowContext(ctx, `SELECT id, name, created_at FROM portfolios WHERE id = ?`, id).
+		Scan(&p.ID, &p.Name, &p.CreatedAt)
+	if err != nil {
+		return models.Portfolio{}, err
+	}
+	return p, nil
+}
+
+func checkPortfolioName(ctx context.Context, q querier, name string, exceptID int64) error {
+	var count int
+	err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM portfolios WHERE name = ? AND id <> ?`, name, exceptID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("check portfolio name: %w", err)
+	}
+	if count > 0 {
+		return ErrPortfolioExists
+	}
+	return nil
+}
+
+// portfolioOrDefault resolves an unset portfolio to the default one and
+// confirms the portfolio exists.
+func portfolioOrDefault(ctx context.Context, q querier, id int64) (int64, error) {
+	if id == 0 {
+		return models.DefaultPortfolioID, nil
+	}
+	if _, err := getPortfolio(ctx, q, id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
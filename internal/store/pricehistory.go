@@ -0,0 +1,171 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"portfoliopulse/internal/models"
+)
+
+// rollupIntervals are maintained incrementally as ticks arrive.
+var rollupIntervals = []models.BarInterval{models.BarMinute, models.BarHour, models.BarDay}
+
+// RecordPrices appends ticks to price history and folds each one into its
+// 1m, 1h and 1d bars. A tick already recorded (same ticker and timestamp) is
+// skipped, so re-recording an unchanged cached quote is harmless.
+func (s *SQLiteStore) RecordPrices(ctx context.Context, ticks []models.PriceTick) error {
+	if len(ticks) == 0 {
+		return nil
+	}
+
+	dbtx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin record prices: %w", err)
+	}
+	defer dbtx.Rollback()
+
+	for _, t := range ticks {
+		ticker := strings.ToUpper(strings.TrimSpace(t.Ticker))
+		at := t.At.UTC()
+		res, err := dbtx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO price_history(asset_type, ticker, price, source, fetched_at)
+			VALUES (?, ?, ?, ?, ?)`, t.AssetType, ticker, t.Price, t.Source, at)
+		if err != nil {
+			return fmt.Errorf("insert price tick: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			continue
+		}
+
+		for _, interval := range rollupIntervals {
+			bucket := at.Truncate(interval.Duration())
+			_, err := dbtx.ExecContext(ctx, `
+				INSERT INTO price_bars(asset_type, ticker, interval, bucket_start, open, high, low, close, close_at, ticks)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 1)
+				ON CONFLICT(asset_type, ticker, interval, bucket_start) DO UPDATE SET
+					high = MAX(high, excluded.high),
+					low = MIN(low, excluded.low),
+					close = CASE WHEN excluded.close_at >= close_at THEN excluded.close ELSE close END,
+					close_at = MAX(close_at, excluded.close_at),
+					ticks = ticks + 1`,
+				t.AssetType, ticker, interval, bucket, t.Price, t.Price, t.Price, t.Price, at)
+			if err != nil {
+				return fmt.Errorf("upsert %s bar: %w", interval, err)
+			}
+		}
+	}
+
+	if err := dbtx.Commit(); err != nil {
+		return fmt.Errorf("commit record prices: %w", err)
+	}
+	return nil
+}
+
+// ListPriceBars returns bars whose bucket starts within [from, to], oldest
+// first. For models.BarTick each raw tick is returned as a flat bar.
+func (s *SQLiteStore) ListPriceBars(ctx context.Context, assetType models.AssetType, ticker string, interval models.BarInterval, from, to time.Time) ([]models.PriceBar, error) {
+	ticker = strings.ToUpper(strings.TrimSpace(ticker))
+
+	var query string
+	args := []any{assetType, ticker}
+	if interval == models.BarTick {
+		query = `
+			SELECT fetched_at, price, price, price, price, 1
+			FROM price_history
+			WHERE asset_type = ? AND ticker = ? AND fetched_at >= ? AND fetched_at <= ?
+			ORDER BY fetched_at ASC`
+	} else {
+		query = `
+			SELECT bucket_start, open, high, low, close, ticks
+			FROM price_bars
+			WHERE asset_type = ? AND ticker = ? AND interval = ? AND bucket_start >= ? AND bucket_start <= ?
+			ORDER BY bucket_start ASC`
+		args = append(args, interval)
+	}
+	args = append(args, from.UTC(), to.UTC())
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query price bars: %w", err)
+	}
+	defer rows.Close()
+
+	bars := make([]models.PriceBar, 0)
+	for rows.Next() {
+		var b models.PriceBar
+		if err := rows.Scan(&b.Start, &b.Open, &b.High, &b.Low, &b.Close, &b.Ticks); err != nil {
+			return nil, fmt.Errorf("scan price bar: %w", err)
+		}
+		bars = append(bars, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate price bars: %w", err)
+	}
+	return bars, nil
+}
+
+// PriceAt returns the last price recorded at or before at, from raw ticks
+// or, once those are pruned, from the close of the coarser bars. It returns
+// sql.ErrNoRows when nothing that old was recorded.
+func (s *SQLiteStore) PriceAt(ctx context.Context, assetType models.AssetType, ticker string, at time.Time) (float64, error) {
+	ticker = strings.ToUpper(strings.TrimSpace(ticker))
+	var price float64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT price FROM (
+			SELECT price, fetched_at AS observed_at FROM price_history
+			WHERE asset_type = ? AND ticker = ? AND fetched_at <= ?
+			UNION ALL
+			SELECT close, close_at FROM price_bars
+			WHERE asset_type = ? AND ticker = ? AND close_at <= ?
+		) ORDER BY observed_at DESC LIMIT 1`,
+		assetType, ticker, at.UTC(), assetType, ticker, at.UTC()).Scan(&price)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("query price at: %w", err)
+	}
+	return price, err
+}
+
+// PreviousClose returns the close of the last daily bar that started
+// before the given day start, or sql.ErrNoRows.
+func (s *SQLiteStore) PreviousClose(ctx context.Context, assetType models.AssetType, ticker string, dayStart time.Time) (float64, error) {
+	ticker = strings.ToUpper(strings.TrimSpace(ticker))
+	var price float64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT close FROM price_bars
+		WHERE asset_type = ? AND ticker = ? AND interval = ? AND bucket_start < ?
+		ORDER BY bucket_start DESC LIMIT 1`, assetType, ticker, models.BarDay, dayStart.UTC()).Scan(&price)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("query previous close: %w", err)
+	}
+	return price, err
+}
+
+// PrunePriceHistory deletes ticks and bars older than the cutoff given for
+// their interval. Intervals missing from cutoffs are kept forever.
+func (s *SQLiteStore) PrunePriceHistory(ctx context.Context, cutoffs map[models.BarInterval]time.Time) (int64, error) {
+	var total int64
+	for interval, cutoff := range cutoffs {
+		var (
+			res sql.Result
+			err error
+		)
+		if interval == models.BarTick {
+			res, err = s.db.ExecContext(ctx, `DELETE FROM price_history WHERE fetched_at < ?`, cutoff.UTC())
+		} else {
+			res, err = s.db.ExecContext(ctx, `DELETE FROM price_bars WHERE interval = ? AND bucket_start < ?`, interval, cutoff.UTC())
+		}
+		if err != nil {
+			return total, fmt.Errorf("prune %s history: %w", interval, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, fmt.Errorf("prune %s rows affected: %w", interval, err)
+		}
+		total += n
+	}
+	return total, nil
+}
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"portfoliopulse/internal/models"
+)
+
+type SnapshotFilter struct {
+	// PortfolioID picks one portfolio's snapshots; zero picks the combined
+	// ones.
+	PortfolioID int64
+	// Kind limits results to one kind; empty returns both.
+	Kind         models.SnapshotKind
+	From         time.Time
+	To           time.Time
+	WithHoldings bool
+}
+
+// SavePortfolioSnapshot persists a valuation. Saving an end-of-day snapshot
+// for a portfolio and day that already has one replaces it.
+func (s *SQLiteStore) SavePortfolioSnapshot(ctx context.Context, snap models.ValueSnapshot) (models.ValueSnapshot, error) {
+	snap.TakenAt = snap.TakenAt.UTC()
+	if snap.Day == "" {
+		snap.Day = snap.TakenAt.Format("2006-01-02")
+	}
+
+	dbtx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ValueSnapshot{}, fmt.Errorf("begin save snapshot: %w", err)
+	}
+	defer dbtx.Rollback()
+
+	if snap.Kind == models.SnapshotEOD {
+		if _, err := dbtx.ExecContext(ctx, `
+			DELETE FROM portfolio_snapshots WHERE portfolio_id = ? AND kind = ? AND day = ?`, snap.PortfolioID, snap.Kind, snap.Day); err != nil {
+			return models.ValueSnapshot{}, fmt.Errorf("replace eod snapshot: %w", err)
+		}
+	}
+
+	res, err := dbtx.ExecContext(ctx, `
+		INSERT INTO portfolio_snapshots(portfolio_id, kind, day, taken_at, total_value, total_cost, total_pnl, total_realized_pnl)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		snap.PortfolioID, snap.Kind, snap.Day, snap.TakenAt, snap.TotalValue, snap.TotalCost, snap.TotalPnL, snap.TotalRealizedPnL)
+	if err != nil {
+		return models.ValueSnapshot{}, fmt.Errorf("insert snapshot: %w", err)
+	}
+	snap.ID, err = res.LastInsertId()
+	if err != nil {
+		return models.ValueSnapshot{}, fmt.Errorf("snapshot last insert id: %w", err)
+	}
+
+	for _, h := range snap.Holdings {
+		_, err := dbtx.ExecContext(ctx, `
+			INSERT INTO portfolio_snapshot_holdings(snapshot_id, holding_id, ticker, asset_type, quantity, price, market_value, cost_basis)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			snap.ID, h.HoldingID, h.Ticker, h.AssetType, h.Quantity, h.Price, h.MarketValue, h.CostBasis)
+		if err != nil {
+			return models.ValueSnapshot{}, fmt.Errorf("insert snapshot holding: %w", err)
+		}
+	}
+
+	if err := dbtx.Commit(); err != nil {
+		return models.ValueSnapshot{}, fmt.Errorf("commit save snapshot: %w", err)
+	}
+	return snap, nil
+}
+
+// ListPortfolioSnapshots returns snapshots oldest first.
+func (s *SQLiteStore) ListPortfolioSnapshots(ctx context.Context, filter SnapshotFilter) ([]models.ValueSnapshot, error) {
+	where := []string{"portfolio_id = ?"}
+	args := []any{filter.PortfolioID}
+	if filter.Kind != "" {
+		where = append(where, "kind = ?")
+		args = append(args, filter.Kind)
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "taken_at >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "taken_at <= ?")
+		args = append(args, filter.To.UTC())
+	}
+
+	query := `SELECT id, portfolio_id, kind, day, taken_at, total_value, total_cost, total_pnl, total_realized_pnl
+		FROM portfolio_snapshots WHERE ` + strings.Join(where, " AND ")
+	query += " ORDER BY taken_at ASC, id ASC"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	snaps := make([]models.ValueSnapshot, 0)
+	index := make(map[int64]int)
+	for rows.Next() {
+		var v models.ValueSnapshot
+		if err := rows.Scan(&v.ID, &v.PortfolioID, &v.Kind, &v.Day, &v.TakenAt, &v.TotalValue, &v.TotalCost, &v.TotalPnL, &v.TotalRealizedPnL); err != nil {
+			return nil, fmt.Errorf("scan snapshot: %w", err)
+		}
+		index[v.ID] = len(snaps)
+		snaps = append(snaps, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate snapshots: %w", err)
+	}
+	rows.Close()
+
+	if !filter.WithHoldings || len(snaps) == 0 {
+		return snaps, nil
+	}
+
+	hquery := `SELECT sh.snapshot_id, sh.holding_id, sh.ticker, sh.asset_type, sh.quantity, sh.price, sh.market_value, sh.cost_basis
+		FROM portfolio_snapshot_holdings sh JOIN portfolio_snapshots ps ON ps.id = sh.snapshot_id
+		WHERE ` + strings.Join(where, " AND ")
+	hrows, err := s.db.QueryContext(ctx, hquery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query snapshot holdings: %w", err)
+	}
+	defer hrows.Close()
+
+	for hrows.Next() {
+		var snapID int64
+		var h models.HoldingValue
+		if err := hrows.Scan(&snapID, &h.HoldingID, &h.Ticker, &h.AssetType, &h.Quantity, &h.Price, &h.MarketValue, &h.CostBasis); err != nil {
+			return nil, fmt.Errorf("scan snapshot holding: %w", err)
+		}
+		if i, ok := index[snapID]; ok {
+			snaps[i].Holdings = append(snaps[i].Holdings, h)
+		}
+	}
+	if err := hrows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate snapshot holdings: %w", err)
+	}
+	return snaps, nil
+}
+
+// PreviousPortfolioClose returns the total value of portfolioID's last
+// end-of-day snapshot for a day before the given day start, or
+// sql.ErrNoRows. A zero portfolioID reads the combined snapshots.
+func (s *SQLiteStore) PreviousPortfolioClose(ctx context.Context, portfolioID int64, dayStart time.Time) (float64, error) {
+	var value float64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT total_value FROM portfolio_snapshots
+		WHERE portfolio_id = ? AND kind = ? AND day < ?
+		ORDER BY day DESC LIMIT 1`, portfolioID, models.SnapshotEOD, dayStart.UTC().Format("2006-01-02")).Scan(&value)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("query previous portfolio close: %w", err)
+	}
+	return value, err
+}
+
+// PeakPortfolioValue returns the highest total value of any of
+// portfolioID's snapshots, or sql.ErrNoRows before the first one is saved.
+// A zero portfolioID reads the combined snapshots.
+func (s *SQLiteStore) PeakPortfolioValue(ctx context.Context, portfolioID int64) (float64, error) {
+	var peak sql.NullFloat64
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT MAX(total_value) FROM portfolio_snapshots WHERE portfolio_id = ?`, portfolioID).Scan(&peak); err != nil {
+		return 0, fmt.Errorf("query peak portfolio value: %w", err)
+	}
+	if !peak.Valid {
+		return 0, sql.ErrNoRows
+	}
+	return peak.Float64, nil
+}
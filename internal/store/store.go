@@ -7,17 +7,81 @@ import (
 	"strings"
 	"time"
 
+	"portfoliopulse/internal/ledger"
 	"portfoliopulse/internal/models"
 )
 
 type Store interface {
+	ListPortfolios(ctx context.Context) ([]models.Portfolio, error)
+	GetPortfolio(ctx context.Context, id int64) (models.Portfolio, error)
+	CreatePortfolio(ctx context.Context, p models.Portfolio) (models.Portfolio, error)
+	RenamePortfolio(ctx context.Context, id int64, name string) (models.Portfolio, error)
+	DeletePortfolio(ctx context.Context, id int64) error
 	ListHoldings(ctx context.Context) ([]models.Holding, error)
+	GetHolding(ctx context.Context, id int64) (models.Holding, error)
 	CreateHolding(ctx context.Context, h models.Holding) (models.Holding, error)
 	DeleteHolding(ctx context.Context, id int64) error
+	ListTransactions(ctx context.Context, filter TransactionFilter) ([]models.Transaction, error)
+	GetTransaction(ctx context.Context, id int64) (models.Transaction, error)
+	CreateTransaction(ctx context.Context, tx models.Transaction) (models.Transaction, error)
+	UpdateTransaction(ctx context.Context, tx models.Transaction) (models.Transaction, error)
+	DeleteTransaction(ctx context.Context, id int64) error
+	ListLots(ctx context.Context, holdingID int64) ([]models.Lot, error)
+	ListRealizedGains(ctx context.Context, filter TransactionFilter) ([]models.RealizedGain, error)
+	ListCashAccounts(ctx context.Context) ([]models.CashAccount, error)
+	GetCashAccount(ctx context.Context, id int64) (models.CashAccount, error)
+	CreateCashAccount(ctx context.Context, a models.CashAccount) (models.CashAccount, error)
+	DeleteCashAccount(ctx context.Context, id int64) error
+	ListCashMovements(ctx context.Context, accountID int64) ([]models.CashMovement, error)
+	CreateCashMovement(ctx context.Context, m models.CashMovement) (models.CashMovement, error)
+	DeleteCashMovement(ctx context.Context, accountID, id int64) error
+	ListIncome(ctx context.Context, filter IncomeFilter) ([]models.IncomeEvent, error)
+	GetIncome(ctx context.Context, id int64) (models.IncomeEvent, error)
+	CreateIncome(ctx context.Context, ev models.IncomeEvent) (models.IncomeEvent, error)
+	DeleteIncome(ctx context.Context, id int64) error
+	ListCorporateActions(ctx context.Context) ([]models.CorporateAction, error)
+	GetCorporateAction(ctx context.Context, id int64) (models.CorporateAction, error)
+	ApplyCorporateAction(ctx context.Context, a models.CorporateAction) (models.CorporateAction, error)
+	RecordPrices(ctx context.Context, ticks []models.PriceTick) error
+	ListPriceBars(ctx context.Context, assetType models.AssetType, ticker string, interval models.BarInterval, from, to time.Time) ([]models.PriceBar, error)
+	PriceAt(ctx context.Context, assetType models.AssetType, ticker string, at time.Time) (float64, error)
+	PreviousClose(ctx context.Context, assetType models.AssetType, ticker string, dayStart time.Time) (float64, error)
+	PrunePriceHistory(ctx context.Context, cutoffs map[models.BarInterval]time.Time) (int64, error)
+	SavePortfolioSnapshot(ctx context.Context, snap models.ValueSnapshot) (models.ValueSnapshot, error)
+	ListPortfolioSnapshots(ctx context.Context, filter SnapshotFilter) ([]models.ValueSnapshot, error)
+	SetHoldingTags(ctx context.Context, id int64, tags []string) (models.Holding, error)
+	ListAllocationTargets(ctx context.Context, pid int64) ([]models.AllocationTarget, error)
+	SetAllocationTargets(ctx context.Context, pid int64, targets []models.AllocationTarget) ([]models.AllocationTarget, error)
+	PreviousPortfolioClose(ctx context.Context, portfolioID int64, dayStart time.Time) (float64, error)
+	PeakPortfolioValue(ctx context.Context, portfolioID int64) (float64, error)
 	ListAlerts(ctx context.Context) ([]models.PriceAlert, error)
+	GetAlert(ctx context.Context, id int64) (models.PriceAlert, error)
 	CreateAlert(ctx context.Context, alert models.PriceAlert) (models.PriceAlert, error)
 	DeleteAlert(ctx context.Context, id int64) error
-	MarkAlertTriggered(ctx context.Context, id int64, triggeredAt time.Time) error
+	MarkAlertTriggered(ctx context.Context, ev models.AlertEvent) (models.AlertEvent, bool, error)
+	RaiseAlertHighWater(ctx context.Context, id int64, price float64, at time.Time) error
+	RearmAlert(ctx context.Context, id int64, highWater float64, at time.Time) error
+	ListChannels(ctx context.Context) ([]models.NotificationChannel, error)
+	GetChannel(ctx context.Context, id int64) (models.NotificationChannel, error)
+	CreateChannel(ctx context.Context, c models.NotificationChannel) (models.NotificationChannel, error)
+	UpdateChannel(ctx context.Context, id int64, c models.NotificationChannel) (models.NotificationChannel, error)
+	DeleteChannel(ctx context.Context, id int64) error
+	CreateDelivery(ctx context.Context, d models.NotificationDelivery) (models.NotificationDelivery, error)
+	UpdateDelivery(ctx context.Context, d models.NotificationDelivery) error
+	ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]models.NotificationDelivery, error)
+	ListAlertEvents(ctx context.Context, alertID int64) ([]models.AlertEvent, error)
+	ListEvents(ctx context.Context, filter AlertEventFilter) ([]models.AlertEvent, error)
+	GetAlertEvent(ctx context.Context, id int64) (models.AlertEvent, error)
+	AcknowledgeAlertEvent(ctx context.Context, id int64, at time.Time) (models.AlertEvent, error)
+	SetAlertEventNote(ctx context.Context, id int64, note string) (models.AlertEvent, error)
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx so read helpers can run
+// inside or outside a transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 }
 
 type SQLiteStore struct {
@@ -30,7 +94,7 @@ func NewSQLiteStore(db *sql.DB) *SQLiteStore {
 
 func (s *SQLiteStore) ListHoldings(ctx context.Context) ([]models.Holding, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, ticker, asset_type, quantity, avg_cost, created_at
+		SELECT id, portfolio_id, ticker, asset_type, currency, created_at
 		FROM holdings ORDER BY id ASC`)
 	if err != nil {
 		return nil, fmt.Errorf("query holdings: %w", err)
@@ -40,7 +104,7 @@ func (s *SQLiteStore) ListHoldings(ctx context.Context) ([]models.Holding, error
 	holdings := make([]models.Holding, 0)
 	for rows.Next() {
 		var h models.Holding
-		if err := rows.Scan(&h.ID, &h.Ticker, &h.AssetType, &h.Quantity, &h.AvgCost, &h.CreatedAt); err != nil {
+		if err := rows.Scan(&h.ID, &h.PortfolioID, &h.Ticker, &h.AssetType, &h.Currency, &h.CreatedAt); err != nil {
 			return nil, fmt.Errorf("scan holding: %w", err)
 		}
 		holdings = append(holdings, h)
@@ -48,32 +112,74 @@ func (s *SQLiteStore) ListHoldings(ctx context.Context) ([]models.Holding, error
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("iterate holdings: %w", err)
 	}
+
+	txs, err := listTransactions(ctx, s.db, TransactionFilter{})
+	if err != nil {
+		return nil, err
+	}
+	byHolding := make(map[int64][]models.Transaction)
+	for _, tx := range txs {
+		byHolding[tx.HoldingID] = append(byHolding[tx.HoldingID], tx)
+	}
+
+	tags, err := listHoldingTags(ctx, s.db, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range holdings {
+		if err := applyLedger(&holdings[i], byHolding[holdings[i].ID]); err != nil {
+			return nil, err
+		}
+		holdings[i].Tags = tags[holdings[i].ID]
+	}
 	return holdings, nil
 }
 
+func (s *SQLiteStore) GetHolding(ctx context.Context, id int64) (models.Holding, error) {
+	return getHolding(ctx, s.db, id)
+}
+
+// CreateHolding registers a position in h.PortfolioID (the default portfolio
+// when unset) and, when a quantity is given, books it as an opening buy at
+// AvgCost so the ledger stays the source of truth. The opening buy records
+// h.CostFXRate as its FX rate.
 func (s *SQLiteStore) CreateHolding(ctx context.Context, h models.Holding) (models.Holding, error) {
 	h.Ticker = strings.ToUpper(strings.TrimSpace(h.Ticker))
-	res, err := s.db.ExecContext(ctx, `
-		INSERT INTO holdings(ticker, asset_type, quantity, avg_cost)
-		VALUES (?, ?, ?, ?)`, h.Ticker, h.AssetType, h.Quantity, h.AvgCost)
+	h.Currency = normalizeCurrency(h.Currency)
+
+	dbtx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return models.Holding{}, fmt.Errorf("insert holding: %w", err)
+		return models.Holding{}, fmt.Errorf("begin create holding: %w", err)
 	}
+	defer dbtx.Rollback()
 
-	id, err := res.LastInsertId()
+	h.PortfolioID, err = portfolioOrDefault(ctx, dbtx, h.PortfolioID)
+	if err != nil {
+		return models.Holding{}, err
+	}
+	id, err := insertHolding(ctx, dbtx, h.PortfolioID, h.Ticker, h.AssetType, h.Currency)
 	if err != nil {
-		return models.Holding{}, fmt.Errorf("holding last insert id: %w", err)
+		return models.Holding{}, err
 	}
 
-	row := s.db.QueryRowContext(ctx, `
-		SELECT id, ticker, asset_type, quantity, avg_cost, created_at
-		FROM holdings WHERE id = ?`, id)
+	if h.Quantity > 0 {
+		_, err := dbtx.ExecContext(ctx, `
+			INSERT INTO transactions(holding_id, type, quantity, price, fx_rate, executed_at, note)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, id, models.TxBuy, h.Quantity, h.AvgCost, h.CostFXRate, time.Now().UTC(), "opening balance")
+		if err != nil {
+			return models.Holding{}, fmt.Errorf("insert opening transaction: %w", err)
+		}
+	}
 
-	var out models.Holding
-	if err := row.Scan(&out.ID, &out.Ticker, &out.AssetType, &out.Quantity, &out.AvgCost, &out.CreatedAt); err != nil {
-		return models.Holding{}, fmt.Errorf("fetch inserted holding: %w", err)
+	if err := dbtx.Commit(); err != nil {
+		return models.Holding{}, fmt.Errorf("commit create holding: %w", err)
 	}
 
+	out, err := getHolding(ctx, s.db, id)
+	if err != nil {
+		return models.Holding{}, fmt.Errorf("fetch inserted holding: %w", err)
+	}
 	return out, nil
 }
 
@@ -92,91 +198,61 @@ func (s *SQLiteStore) DeleteHolding(ctx context.Context, id int64) error {
 	return nil
 }
 
-func (s *SQLiteStore) ListAlerts(ctx context.Context) ([]models.PriceAlert, error) {
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, ticker, asset_type, direction, threshold, created_at, triggered, triggered_at
-		FROM price_alerts ORDER BY id ASC`)
+func insertHolding(ctx context.Context, q querier, portfolioID int64, ticker string, assetType models.AssetType, currency string) (int64, error) {
+	res, err := q.ExecContext(ctx, `
+		INSERT INTO holdings(portfolio_id, ticker, asset_type, currency, quantity, avg_cost)
+		VALUES (?, ?, ?, ?, 0, 0)`, portfolioID, ticker, assetType, normalizeCurrency(currency))
 	if err != nil {
-		return nil, fmt.Errorf("query alerts: %w", err)
-	}
-	defer rows.Close()
-
-	alerts := make([]models.PriceAlert, 0)
-	for rows.Next() {
-		var a models.PriceAlert
-		var triggeredInt int
-		var triggeredAt sql.NullTime
-		if err := rows.Scan(&a.ID, &a.Ticker, &a.AssetType, &a.Direction, &a.Threshold, &a.CreatedAt, &triggeredInt, &triggeredAt); err != nil {
-			return nil, fmt.Errorf("scan alert: %w", err)
-		}
-		a.Triggered = triggeredInt == 1
-		if triggeredAt.Valid {
-			t := triggeredAt.Time
-			a.TriggeredAt = &t
-		}
-		alerts = append(alerts, a)
+		return 0, fmt.Errorf("insert holding: %w", err)
 	}
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("iterate alerts: %w", err)
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("holding last insert id: %w", err)
 	}
-	return alerts, nil
+	return id, nil
 }
 
-func (s *SQLiteStore) CreateAlert(ctx context.Context, alert models.PriceAlert) (models.PriceAlert, error) {
-	alert.Ticker = strings.ToUpper(strings.TrimSpace(alert.Ticker))
-	res, err := s.db.ExecContext(ctx, `
-		INSERT INTO price_alerts(ticker, asset_type, direction, threshold)
-		VALUES (?, ?, ?, ?)`, alert.Ticker, alert.AssetType, alert.Direction, alert.Threshold)
+func getHolding(ctx context.Context, q querier, id int64) (models.Holding, error) {
+	var h models.Holding
+	err := q.QueryRowContext(ctx, `
+		SELECT id, portfolio_id, ticker, asset_type, currency, created_at
+		FROM holdings WHERE id = ?`, id).Scan(&h.ID, &h.PortfolioID, &h.Ticker, &h.AssetType, &h.Currency, &h.CreatedAt)
 	if err != nil {
-		return models.PriceAlert{}, fmt.Errorf("insert alert: %w", err)
+		return models.Holding{}, err
 	}
 
-	id, err := res.LastInsertId()
+	txs, err := listTransactions(ctx, q, TransactionFilter{HoldingID: id})
 	if err != nil {
-		return models.PriceAlert{}, fmt.Errorf("alert last insert id: %w", err)
+		return models.Holding{}, err
 	}
-
-	row := s.db.QueryRowContext(ctx, `
-		SELECT id, ticker, asset_type, direction, threshold, created_at, triggered, triggered_at
-		FROM price_alerts WHERE id = ?`, id)
-
-	var out models.PriceAlert
-	var triggeredInt int
-	var triggeredAt sql.NullTime
-	if err := row.Scan(&out.ID, &out.Ticker, &out.AssetType, &out.Direction, &out.Threshold, &out.CreatedAt, &triggeredInt, &triggeredAt); err != nil {
-		return models.PriceAlert{}, fmt.Errorf("fetch inserted alert: %w", err)
+	if err := applyLedger(&h, txs); err != nil {
+		return models.Holding{}, err
 	}
-	out.Triggered = triggeredInt == 1
-	if triggeredAt.Valid {
-		t := triggeredAt.Time
-		out.TriggeredAt = &t
+	tags, err := listHoldingTags(ctx, q, id)
+	if err != nil {
+		return models.Holding{}, err
 	}
-
-	return out, nil
+	h.Tags = tags[id]
+	return h, nil
 }
 
-func (s *SQLiteStore) DeleteAlert(ctx context.Context, id int64) error {
-	res, err := s.db.ExecContext(ctx, `DELETE FROM price_alerts WHERE id = ?`, id)
-	if err != nil {
-		return fmt.Errorf("delete alert: %w", err)
-	}
-	rows, err := res.RowsAffected()
+func applyLedger(h *models.Holding, txs []models.Transaction) error {
+	pos, err := ledger.Replay(txs)
 	if err != nil {
-		return fmt.Errorf("alert rows affected: %w", err)
-	}
-	if rows == 0 {
-		return sql.ErrNoRows
+		return fmt.Errorf("replay holding %d: %w", h.ID, err)
 	}
+	h.Quantity = pos.Quantity
+	h.AvgCost = pos.AvgCost()
+	h.CostFXRate = pos.CostFXRate()
+	h.RealizedPnL = pos.RealizedGain()
 	return nil
 }
 
-func (s *SQLiteStore) MarkAlertTriggered(ctx context.Context, id int64, triggeredAt time.Time) error {
-	_, err := s.db.ExecContext(ctx, `
-		UPDATE price_alerts
-		SET triggered = 1, triggered_at = ?
-		WHERE id = ?`, triggeredAt, id)
-	if err != nil {
-		return fmt.Errorf("mark alert triggered: %w", err)
+// normalizeCurrency upper-cases an ISO code, defaulting to USD.
+func normalizeCurrency(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return models.DefaultCurrency
 	}
-	return nil
+	return code
 }
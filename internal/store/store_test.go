@@ -3,11 +3,14 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"math"
 	"path/filepath"
 	"testing"
 	"time"
 
 	"portfoliopulse/internal/db"
+	"portfoliopulse/internal/ledger"
 	"portfoliopulse/internal/models"
 )
 
@@ -55,6 +58,75 @@ func TestHoldingCRUD(t *testing.T) {
 	}
 }
 
+func TestTransactionsDriveHoldings(t *testing.T) {
+	s, sqlDB := setupStore(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	base := time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC)
+	buy, err := s.CreateTransaction(ctx, models.Transaction{
+		Ticker:     "msft",
+		AssetType:  models.AssetStock,
+		Type:       models.TxBuy,
+		Quantity:   4,
+		Price:      100,
+		ExecutedAt: base,
+	})
+	if err != nil {
+		t.Fatalf("create buy: %v", err)
+	}
+	if buy.HoldingID == 0 || buy.Ticker != "MSFT" {
+		t.Fatalf("unexpected buy: %+v", buy)
+	}
+
+	if _, err := s.CreateTransaction(ctx, models.Transaction{
+		HoldingID:  buy.HoldingID,
+		Type:       models.TxSell,
+		Quantity:   1,
+		Price:      120,
+		ExecutedAt: base.Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("create sell: %v", err)
+	}
+
+	if _, err := s.CreateTransaction(ctx, models.Transaction{
+		HoldingID:  buy.HoldingID,
+		Type:       models.TxSell,
+		Quantity:   10,
+		Price:      120,
+		ExecutedAt: base.Add(2 * time.Hour),
+	}); !errors.Is(err, ledger.ErrInsufficientQuantity) {
+		t.Fatalf("expected oversell rejection, got %v", err)
+	}
+
+	holdings, err := s.ListHoldings(ctx)
+	if err != nil {
+		t.Fatalf("list holdings: %v", err)
+	}
+	if len(holdings) != 1 || holdings[0].Quantity != 3 || holdings[0].AvgCost != 100 {
+		t.Fatalf("unexpected derived holdings: %+v", holdings)
+	}
+
+	if err := s.DeleteTransaction(ctx, buy.ID); !errors.Is(err, ledger.ErrInsufficientQuantity) {
+		t.Fatalf("expected delete of backing buy to be rejected, got %v", err)
+	}
+
+	txs, err := s.ListTransactions(ctx, TransactionFilter{Ticker: "MSFT"})
+	if err != nil {
+		t.Fatalf("list transactions: %v", err)
+	}
+	if len(txs) != 2 {
+		t.Fatalf("expected 2 transactions, got %d", len(txs))
+	}
+
+	if err := s.DeleteHolding(ctx, buy.HoldingID); err != nil {
+		t.Fatalf("delete holding: %v", err)
+	}
+	if _, err := s.GetTransaction(ctx, buy.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected transactions to cascade with holding, got %v", err)
+	}
+}
+
 func TestAlertCRUDAndTrigger(t *testing.T) {
 	s, sqlDB := setupStore(t)
 	defer sqlDB.Close()
@@ -74,8 +146,16 @@ func TestAlertCRUDAndTrigger(t *testing.T) {
 	}
 
 	now := time.Now().UTC().Truncate(time.Second)
-	if err := s.MarkAlertTriggered(ctx, created.ID, now); err != nil {
-		t.Fatalf("mark alert triggered: %v", err)
+	first, fired, err := s.MarkAlertTriggered(ctx, models.AlertEvent{AlertID: created.ID, FiredAt: now, Price: 101000, TotalValue: 250000})
+	if err != nil || !fired {
+		t.Fatalf("mark alert triggered: %v %v", fired, err)
+	}
+	// A disarmed alert is not fired again by a concurrent refresh.
+	if _, fired, err := s.MarkAlertTriggered(ctx, models.AlertEvent{AlertID: created.ID, FiredAt: now}); err != nil || fired {
+		t.Fatalf("expected a triggered alert not to fire again, got %v %v", fired, err)
+	}
+	if first.ID == 0 || first.Price != 101000 || first.TotalValue != 250000 || first.AcknowledgedAt != nil || len(first.Deliveries) != 0 {
+		t.Fatalf("unexpected alert event: %+v", first)
 	}
 
 	alerts, err := s.ListAlerts(ctx)
@@ -85,11 +165,750 @@ func TestAlertCRUDAndTrigger(t *testing.T) {
 	if len(alerts) != 1 {
 		t.Fatalf("expected 1 alert, got %d", len(alerts))
 	}
-	if !alerts[0].Triggered || alerts[0].TriggeredAt == nil {
+	if !alerts[0].Triggered || alerts[0].TriggeredAt == nil || !alerts[0].TriggeredAt.Equal(now) || alerts[0].FireCount != 1 {
 		t.Fatalf("expected triggered alert, got %+v", alerts[0])
 	}
 
+	if err := s.RearmAlert(ctx, created.ID, 0, now); err != nil {
+		t.Fatalf("rearm alert: %v", err)
+	}
+	later := now.Add(time.Hour)
+	if _, fired, err := s.MarkAlertTriggered(ctx, models.AlertEvent{AlertID: created.ID, FiredAt: later}); err != nil || !fired {
+		t.Fatalf("mark alert triggered again: %v %v", fired, err)
+	}
+	got, err := s.GetAlert(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("get alert: %v", err)
+	}
+	if !got.Triggered || !got.TriggeredAt.Equal(later) || got.FireCount != 2 || got.Mode != models.AlertOnce {
+		t.Fatalf("expected a second firing, got %+v", got)
+	}
+	events, err := s.ListAlertEvents(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("list alert events: %v", err)
+	}
+	if len(events) != 2 || !events[0].FiredAt.Equal(later) || !events[1].FiredAt.Equal(now) {
+		t.Fatalf("expected two events newest first, got %+v", events)
+	}
+
+	// Cooldown alerts record the event but stay armed.
+	cooldown, err := s.CreateAlert(ctx, models.PriceAlert{
+		Ticker: "ETH", AssetType: models.AssetCrypto, Direction: models.AlertBelow, Threshold: 2000,
+		Mode: models.AlertCooldown, CooldownMinutes: 30,
+	})
+	if err != nil {
+		t.Fatalf("create cooldown alert: %v", err)
+	}
+	if _, fired, err := s.MarkAlertTriggered(ctx, models.AlertEvent{AlertID: cooldown.ID, FiredAt: now}); err != nil || !fired {
+		t.Fatalf("mark cooldown alert triggered: %v %v", fired, err)
+	}
+	if _, fired, err := s.MarkAlertTriggered(ctx, models.AlertEvent{AlertID: cooldown.ID, FiredAt: now.Add(10 * time.Minute)}); err != nil || fired {
+		t.Fatalf("expected the cooldown to hold the alert back, got %v %v", fired, err)
+	}
+	if got, _ := s.GetAlert(ctx, cooldown.ID); got.Triggered || got.TriggeredAt == nil || got.FireCount != 1 {
+		t.Fatalf("expected an armed cooldown alert with one event, got %+v", got)
+	}
+
+	// Deliveries are linked to their event; acknowledging keeps the first time.
+	if _, err := s.CreateDelivery(ctx, models.NotificationDelivery{
+		Channel: "ops", ChannelType: "webhook", Event: "alert.fired", AlertID: created.ID, EventID: first.ID, Status: models.DeliveryDelivered,
+	}); err != nil {
+		t.Fatalf("create delivery: %v", err)
+	}
+	acked, err := s.AcknowledgeAlertEvent(ctx, first.ID, later)
+	if err != nil {
+		t.Fatalf("acknowledge alert event: %v", err)
+	}
+	if acked, _ = s.AcknowledgeAlertEvent(ctx, first.ID, later.Add(time.Hour)); acked.AcknowledgedAt == nil || !acked.AcknowledgedAt.Equal(later) {
+		t.Fatalf("expected the first acknowledgement to stick, got %+v", acked)
+	}
+	noted, err := s.SetAlertEventNote(ctx, first.ID, "  sold half  ")
+	if err != nil || noted.Note != "sold half" || len(noted.Deliveries) != 1 || noted.Deliveries[0].Channel != "ops" {
+		t.Fatalf("expected a noted event with its delivery, got %+v %v", noted, err)
+	}
+	unacked, err := s.ListEvents(ctx, AlertEventFilter{Unacknowledged: true})
+	if err != nil {
+		t.Fatalf("list unacknowledged events: %v", err)
+	}
+	if len(unacked) != 2 || unacked[0].AlertID != created.ID || unacked[1].AlertID != cooldown.ID {
+		t.Fatalf("expected the two unacknowledged events, got %+v", unacked)
+	}
+	if _, err := s.AcknowledgeAlertEvent(ctx, 999, now); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected ErrNoRows acknowledging a missing event, got %v", err)
+	}
+
 	if err := s.DeleteAlert(ctx, created.ID); err != nil {
 		t.Fatalf("delete alert: %v", err)
 	}
+	if _, err := s.ListAlertEvents(ctx, created.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected ErrNoRows for a deleted alert's events, got %v", err)
+	}
+	if err := s.RearmAlert(ctx, created.ID, 0, now); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected ErrNoRows rearming a deleted alert, got %v", err)
+	}
+}
+
+func TestHoldingTagsAndTargets(t *testing.T) {
+	s, sqlDB := setupStore(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	h, err := s.CreateHolding(ctx, models.Holding{Ticker: "AAPL", AssetType: models.AssetStock, Quantity: 1, AvgCost: 100})
+	if err != nil {
+		t.Fatalf("create holding: %v", err)
+	}
+	if _, err := s.SetHoldingTags(ctx, h.ID, []string{"Tech", " growth", "tech", ""}); err != nil {
+		t.Fatalf("set tags: %v", err)
+	}
+	holdings, err := s.ListHoldings(ctx)
+	if err != nil {
+		t.Fatalf("list holdings: %v", err)
+	}
+	if tags := holdings[0].Tags; len(tags) != 2 || tags[0] != "growth" || tags[1] != "tech" {
+		t.Fatalf("expected normalized tags, got %v", tags)
+	}
+	if _, err := s.SetHoldingTags(ctx, 999, []string{"x"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected ErrNoRows tagging a missing holding, got %v", err)
+	}
+
+	targets, err := s.SetAllocationTargets(ctx, models.DefaultPortfolioID, []models.AllocationTarget{
+		{Bucket: models.BucketTicker, AssetType: models.AssetStock, Key: " aapl", WeightPct: 60},
+		{Bucket: models.BucketTag, Key: "Tech", WeightPct: 40},
+	})
+	if err != nil {
+		t.Fatalf("set targets: %v", err)
+	}
+	if len(targets) != 2 || targets[0].Key != "tech" || targets[1].Key != "AAPL" || targets[1].PortfolioID != models.DefaultPortfolioID {
+		t.Fatalf("unexpected targets: %+v", targets)
+	}
+	// Setting again replaces the whole set.
+	if targets, err = s.SetAllocationTargets(ctx, models.DefaultPortfolioID, nil); err != nil || len(targets) != 0 {
+		t.Fatalf("expected targets cleared, got %+v %v", targets, err)
+	}
+	if _, err := s.SetAllocationTargets(ctx, 999, nil); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected ErrNoRows for a missing portfolio, got %v", err)
+	}
+}
+
+func TestPriceHistoryRollup(t *testing.T) {
+	s, sqlDB := setupStore(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	base := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	ticks := []models.PriceTick{
+		{AssetType: models.AssetCrypto, Ticker: "btc", Price: 100, At: base.Add(10 * time.Second)},
+		{AssetType: models.AssetCrypto, Ticker: "BTC", Price: 120, At: base.Add(20 * time.Second)},
+		{AssetType: models.AssetCrypto, Ticker: "BTC", Price: 90, At: base.Add(30 * time.Second)},
+		{AssetType: models.AssetCrypto, Ticker: "BTC", Price: 110, At: base.Add(70 * time.Second)},
+	}
+	if err := s.RecordPrices(ctx, ticks); err != nil {
+		t.Fatalf("record prices: %v", err)
+	}
+	// Re-recording the same tick must not double count it.
+	if err := s.RecordPrices(ctx, ticks[3:]); err != nil {
+		t.Fatalf("re-record price: %v", err)
+	}
+
+	minute, err := s.ListPriceBars(ctx, models.AssetCrypto, "BTC", models.BarMinute, base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("list minute bars: %v", err)
+	}
+	if len(minute) != 2 {
+		t.Fatalf("expected 2 minute bars, got %+v", minute)
+	}
+	if b := minute[0]; b.Open != 100 || b.High != 120 || b.Low != 90 || b.Close != 90 || b.Ticks != 3 {
+		t.Fatalf("unexpected first minute bar: %+v", b)
+	}
+
+	hour, err := s.ListPriceBars(ctx, models.AssetCrypto, "BTC", models.BarHour, base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("list hour bars: %v", err)
+	}
+	if len(hour) != 1 || hour[0].Close != 110 || hour[0].Ticks != 4 {
+		t.Fatalf("unexpected hour bars: %+v", hour)
+	}
+
+	if p, err := s.PriceAt(ctx, models.AssetCrypto, "btc", base.Add(25*time.Second)); err != nil || p != 120 {
+		t.Fatalf("expected 120 as of 14:00:25, got %v (%v)", p, err)
+	}
+	if _, err := s.PriceAt(ctx, models.AssetCrypto, "BTC", base); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows before the first tick, got %v", err)
+	}
+	dayStart := base.Truncate(24 * time.Hour)
+	if p, err := s.PreviousClose(ctx, models.AssetCrypto, "BTC", dayStart.AddDate(0, 0, 1)); err != nil || p != 110 {
+		t.Fatalf("expected a previous close of 110, got %v (%v)", p, err)
+	}
+	if _, err := s.PreviousClose(ctx, models.AssetCrypto, "BTC", dayStart); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows without an earlier day, got %v", err)
+	}
+
+	n, err := s.PrunePriceHistory(ctx, map[models.BarInterval]time.Time{
+		models.BarTick:   base.Add(time.Minute),
+		models.BarMinute: base.Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if n != 4 {
+		t.Fatalf("expected 3 ticks and 1 minute bar pruned, got %d", n)
+	}
+	raw, err := s.ListPriceBars(ctx, models.AssetCrypto, "BTC", models.BarTick, base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("list ticks: %v", err)
+	}
+	if len(raw) != 1 || raw[0].Close != 110 {
+		t.Fatalf("unexpected ticks after prune: %+v", raw)
+	}
+}
+
+func TestPortfolioSnapshots(t *testing.T) {
+	s, sqlDB := setupStore(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	day := time.Date(2024, 5, 1, 21, 0, 0, 0, time.UTC)
+	save := func(kind models.SnapshotKind, at time.Time, value float64) {
+		t.Helper()
+		_, err := s.SavePortfolioSnapshot(ctx, models.ValueSnapshot{
+			Kind:       kind,
+			TakenAt:    at,
+			TotalValue: value,
+			Holdings:   []models.HoldingValue{{HoldingID: 1, Ticker: "AAPL", AssetType: models.AssetStock, Quantity: 1, Price: value, MarketValue: value}},
+		})
+		if err != nil {
+			t.Fatalf("save snapshot: %v", err)
+		}
+	}
+	if _, err := s.PeakPortfolioValue(ctx, 0); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected ErrNoRows before any snapshot, got %v", err)
+	}
+	save(models.SnapshotEOD, day, 100)
+	save(models.SnapshotEOD, day.Add(time.Hour), 105) // replaces the first
+	save(models.SnapshotEOD, day.Add(24*time.Hour), 110)
+	save(models.SnapshotIntraday, day.Add(-time.Hour), 99)
+
+	eod, err := s.ListPortfolioSnapshots(ctx, SnapshotFilter{Kind: models.SnapshotEOD, WithHoldings: true})
+	if err != nil {
+		t.Fatalf("list eod: %v", err)
+	}
+	if len(eod) != 2 || eod[0].TotalValue != 105 || eod[1].TotalValue != 110 {
+		t.Fatalf("unexpected eod snapshots: %+v", eod)
+	}
+	if len(eod[0].Holdings) != 1 || eod[0].Holdings[0].MarketValue != 105 {
+		t.Fatalf("expected holdings on snapshot, got %+v", eod[0].Holdings)
+	}
+
+	if peak, err := s.PeakPortfolioValue(ctx, 0); err != nil || peak != 110 {
+		t.Fatalf("expected a peak of 110, got %v %v", peak, err)
+	}
+	if prev, err := s.PreviousPortfolioClose(ctx, 0, day.Truncate(24*time.Hour).Add(24*time.Hour)); err != nil || prev != 105 {
+		t.Fatalf("expected the May 1 close of 105, got %v %v", prev, err)
+	}
+	if _, err := s.PreviousPortfolioClose(ctx, 0, day.Truncate(24*time.Hour)); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected ErrNoRows before the first close, got %v", err)
+	}
+
+	// A portfolio's own snapshots sit beside the combined ones.
+	if _, err := s.SavePortfolioSnapshot(ctx, models.ValueSnapshot{PortfolioID: 2, Kind: models.SnapshotEOD, TakenAt: day, TotalValue: 40}); err != nil {
+		t.Fatalf("save portfolio snapshot: %v", err)
+	}
+	if prev, err := s.PreviousPortfolioClose(ctx, 2, day.Truncate(24*time.Hour).Add(24*time.Hour)); err != nil || prev != 40 {
+		t.Fatalf("expected portfolio 2's close of 40, got %v %v", prev, err)
+	}
+	if peak, err := s.PeakPortfolioValue(ctx, 2); err != nil || peak != 40 {
+		t.Fatalf("expected portfolio 2's peak of 40, got %v %v", peak, err)
+	}
+	if prev, _ := s.PreviousPortfolioClose(ctx, 0, day.Truncate(24*time.Hour).Add(24*time.Hour)); prev != 105 {
+		t.Fatalf("expected the combined close to stay 105, got %v", prev)
+	}
+
+	all, err := s.ListPortfolioSnapshots(ctx, SnapshotFilter{To: day.Add(2 * time.Hour)})
+	if err != nil {
+		t.Fatalf("list all: %v", err)
+	}
+	if len(all) != 2 || all[0].Kind != models.SnapshotIntraday || all[0].Holdings != nil {
+		t.Fatalf("unexpected filtered snapshots: %+v", all)
+	}
+}
+
+func TestPortfoliosScopeHoldingsAndAlerts(t *testing.T) {
+	s, sqlDB := setupStore(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	ira, err := s.CreatePortfolio(ctx, models.Portfolio{Name: " IRA "})
+	if err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	if ira.Name != "IRA" {
+		t.Fatalf("expected trimmed name, got %q", ira.Name)
+	}
+	if _, err := s.CreatePortfolio(ctx, models.Portfolio{Name: "ira"}); !errors.Is(err, ErrPortfolioExists) {
+		t.Fatalf("expected ErrPortfolioExists, got %v", err)
+	}
+
+	// The same ticker in two portfolios stays two holdings.
+	buy := models.Transaction{Ticker: "AAPL", AssetType: models.AssetStock, Type: models.TxBuy, Quantity: 1, Price: 100}
+	inDefault, err := s.CreateTransaction(ctx, buy)
+	if err != nil {
+		t.Fatalf("buy in default: %v", err)
+	}
+	buy.PortfolioID = ira.ID
+	inIRA, err := s.CreateTransaction(ctx, buy)
+	if err != nil {
+		t.Fatalf("buy in ira: %v", err)
+	}
+	if inDefault.PortfolioID != models.DefaultPortfolioID || inIRA.PortfolioID != ira.ID || inDefault.HoldingID == inIRA.HoldingID {
+		t.Fatalf("expected separate holdings per portfolio: %+v %+v", inDefault, inIRA)
+	}
+	buy.PortfolioID = 99
+	if _, err := s.CreateTransaction(ctx, buy); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows for unknown portfolio, got %v", err)
+	}
+
+	if _, err := s.CreateAlert(ctx, models.PriceAlert{PortfolioID: ira.ID, Ticker: "AAPL", AssetType: models.AssetStock, Direction: models.AlertAbove, Threshold: 300}); err != nil {
+		t.Fatalf("create alert: %v", err)
+	}
+	if _, err := s.SavePortfolioSnapshot(ctx, models.ValueSnapshot{
+		PortfolioID: ira.ID, Kind: models.SnapshotEOD, TakenAt: time.Now().UTC(), TotalValue: 100,
+		Holdings: []models.HoldingValue{{HoldingID: inIRA.HoldingID, Ticker: "AAPL", AssetType: models.AssetStock, Quantity: 1}},
+	}); err != nil {
+		t.Fatalf("save snapshot: %v", err)
+	}
+
+	if err := s.DeletePortfolio(ctx, models.DefaultPortfolioID); !errors.Is(err, ErrDefaultPortfolio) {
+		t.Fatalf("expected ErrDefaultPortfolio, got %v", err)
+	}
+	if err := s.DeletePortfolio(ctx, ira.ID); err != nil {
+		t.Fatalf("delete portfolio: %v", err)
+	}
+	holdings, err := s.ListHoldings(ctx)
+	if err != nil {
+		t.Fatalf("list holdings: %v", err)
+	}
+	alerts, err := s.ListAlerts(ctx)
+	if err != nil {
+		t.Fatalf("list alerts: %v", err)
+	}
+	if len(holdings) != 1 || holdings[0].PortfolioID != models.DefaultPortfolioID || len(alerts) != 0 {
+		t.Fatalf("expected ira holdings and alerts removed, got %+v %+v", holdings, alerts)
+	}
+	var snapshotRows int
+	if err := sqlDB.QueryRow(`SELECT (SELECT COUNT(*) FROM portfolio_snapshots) + (SELECT COUNT(*) FROM portfolio_snapshot_holdings)`).Scan(&snapshotRows); err != nil || snapshotRows != 0 {
+		t.Fatalf("expected ira snapshots removed, got %d rows (%v)", snapshotRows, err)
+	}
+}
+
+func TestCashAccountBalances(t *testing.T) {
+	s, sqlDB := setupStore(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	buy := models.Transaction{Ticker: "AAPL", AssetType: models.AssetStock, Type: models.TxBuy, Quantity: 2, Price: 100, Fee: 1, CashSettled: true}
+	if _, err := s.CreateTransaction(ctx, buy); !errors.Is(err, ErrNoCashAccount) {
+		t.Fatalf("expected ErrNoCashAccount, got %v", err)
+	}
+
+	account, err := s.CreateCashAccount(ctx, models.CashAccount{Currency: "usd"})
+	if err != nil {
+		t.Fatalf("create cash account: %v", err)
+	}
+	if account.PortfolioID != models.DefaultPortfolioID || account.Currency != "USD" || account.Balance != 0 {
+		t.Fatalf("unexpected account: %+v", account)
+	}
+	if _, err := s.CreateCashAccount(ctx, models.CashAccount{Currency: "USD"}); !errors.Is(err, ErrCashAccountExists) {
+		t.Fatalf("expected ErrCashAccountExists, got %v", err)
+	}
+
+	if _, err := s.CreateCashMovement(ctx, models.CashMovement{AccountID: account.ID, Type: models.CashDeposit, Amount: 1000}); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	withdrawal, err := s.CreateCashMovement(ctx, models.CashMovement{AccountID: account.ID, Type: models.CashWithdrawal, Amount: 50})
+	if err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	if withdrawal.Amount != -50 {
+		t.Fatalf("expected withdrawals stored as debits, got %v", withdrawal.Amount)
+	}
+	settled, err := s.CreateTransaction(ctx, buy)
+	if err != nil {
+		t.Fatalf("settled buy: %v", err)
+	}
+	sell := models.Transaction{HoldingID: settled.HoldingID, Type: models.TxSell, Quantity: 1, Price: 150, Fee: 1, CashSettled: true}
+	if _, err := s.CreateTransaction(ctx, sell); err != nil {
+		t.Fatalf("settled sell: %v", err)
+	}
+	buy.CashSettled = false
+	if _, err := s.CreateTransaction(ctx, buy); err != nil {
+		t.Fatalf("unsettled buy: %v", err)
+	}
+
+	// 1000 - 50 - (200 + 1) + (150 - 1); the unsettled buy is not paid from cash.
+	got, err := s.GetCashAccount(ctx, account.ID)
+	if err != nil {
+		t.Fatalf("get cash account: %v", err)
+	}
+	if got.Balance != 898 {
+		t.Fatalf("expected balance 898, got %v", got.Balance)
+	}
+	movements, err := s.ListCashMovements(ctx, account.ID)
+	if err != nil {
+		t.Fatalf("list movements: %v", err)
+	}
+	if len(movements) != 4 || movements[2].Type != models.CashTrade || movements[2].TransactionID != settled.ID {
+		t.Fatalf("unexpected movements: %+v", movements)
+	}
+
+	if err := s.DeleteCashMovement(ctx, account.ID, withdrawal.ID); err != nil {
+		t.Fatalf("delete movement: %v", err)
+	}
+	if err := s.DeleteCashMovement(ctx, account.ID, withdrawal.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows, got %v", err)
+	}
+	if err := s.DeleteCashAccount(ctx, account.ID); err != nil {
+		t.Fatalf("delete cash account: %v", err)
+	}
+	stored, err := s.GetTransaction(ctx, settled.ID)
+	if err != nil {
+		t.Fatalf("get transaction: %v", err)
+	}
+	if stored.CashSettled {
+		t.Fatalf("expected trades to be unsettled once their account is gone")
+	}
+}
+
+func TestIncomeEvents(t *testing.T) {
+	s, sqlDB := setupStore(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	buy, err := s.CreateTransaction(ctx, models.Transaction{Ticker: "VYM", AssetType: models.AssetStock, Type: models.TxBuy, Quantity: 10, Price: 100})
+	if err != nil {
+		t.Fatalf("buy: %v", err)
+	}
+	account, err := s.CreateCashAccount(ctx, models.CashAccount{Currency: "USD"})
+	if err != nil {
+		t.Fatalf("create cash account: %v", err)
+	}
+
+	paid, err := s.CreateIncome(ctx, models.IncomeEvent{HoldingID: buy.HoldingID, Type: models.IncomeDividend, Amount: 25, CashSettled: true})
+	if err != nil {
+		t.Fatalf("cash dividend: %v", err)
+	}
+	if paid.Ticker != "VYM" || paid.Reinvested || paid.TransactionID != 0 {
+		t.Fatalf("unexpected cash dividend: %+v", paid)
+	}
+	reinvested, err := s.CreateIncome(ctx, models.IncomeEvent{
+		HoldingID: buy.HoldingID, Type: models.IncomeDividend, Amount: 20, Reinvested: true, Quantity: 0.2, Price: 100,
+	})
+	if err != nil {
+		t.Fatalf("reinvested dividend: %v", err)
+	}
+	if reinvested.TransactionID == 0 {
+		t.Fatalf("expected the reinvestment to book a buy: %+v", reinvested)
+	}
+
+	lots, err := s.ListLots(ctx, buy.HoldingID)
+	if err != nil {
+		t.Fatalf("list lots: %v", err)
+	}
+	if len(lots) != 2 || lots[1].ID != reinvested.TransactionID || lots[1].Quantity != 0.2 || lots[1].CostPerUnit != 100 {
+		t.Fatalf("expected a reinvestment lot, got %+v", lots)
+	}
+	got, err := s.GetCashAccount(ctx, account.ID)
+	if err != nil {
+		t.Fatalf("get cash account: %v", err)
+	}
+	if got.Balance != 25 {
+		t.Fatalf("expected only the cash dividend in the balance, got %v", got.Balance)
+	}
+
+	events, err := s.ListIncome(ctx, IncomeFilter{Type: models.IncomeDividend, HoldingID: buy.HoldingID})
+	if err != nil {
+		t.Fatalf("list income: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+
+	if err := s.DeleteIncome(ctx, reinvested.ID); err != nil {
+		t.Fatalf("delete income: %v", err)
+	}
+	if _, err := s.GetTransaction(ctx, reinvested.TransactionID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected the reinvestment buy to be deleted, got %v", err)
+	}
+	if _, err := s.GetIncome(ctx, reinvested.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestApplyCorporateActions(t *testing.T) {
+	s, sqlDB := setupStore(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	exDate := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+	buy, err := s.CreateTransaction(ctx, models.Transaction{
+		Ticker: "AAPL", AssetType: models.AssetStock, Type: models.TxBuy, Quantity: 10, Price: 400, ExecutedAt: exDate.AddDate(0, -1, 0),
+	})
+	if err != nil {
+		t.Fatalf("buy: %v", err)
+	}
+	if _, err := s.CreateTransaction(ctx, models.Transaction{
+		HoldingID: buy.HoldingID, Type: models.TxBuy, Quantity: 1, Price: 110, ExecutedAt: exDate.AddDate(0, 0, 1),
+	}); err != nil {
+		t.Fatalf("post-split buy: %v", err)
+	}
+	alert, err := s.CreateAlert(ctx, models.PriceAlert{Ticker: "AAPL", AssetType: models.AssetStock, Direction: models.AlertAbove, Threshold: 480})
+	if err != nil {
+		t.Fatalf("create alert: %v", err)
+	}
+	if err := s.RecordPrices(ctx, []models.PriceTick{
+		{Ticker: "AAPL", AssetType: models.AssetStock, Price: 400, At: exDate.Add(-time.Hour)},
+		{Ticker: "AAPL", AssetType: models.AssetStock, Price: 101, At: exDate.Add(time.Hour)},
+	}); err != nil {
+		t.Fatalf("record prices: %v", err)
+	}
+
+	split, err := s.ApplyCorporateAction(ctx, models.CorporateAction{
+		Type: models.ActionSplit, AssetType: models.AssetStock, Ticker: "aapl", Ratio: 4, EffectiveAt: exDate,
+	})
+	if err != nil {
+		t.Fatalf("apply split: %v", err)
+	}
+	h, err := s.GetHolding(ctx, buy.HoldingID)
+	if err != nil {
+		t.Fatalf("get holding: %v", err)
+	}
+	if h.Quantity != 41 || math.Abs(h.AvgCost*h.Quantity-4110) > 1e-9 {
+		t.Fatalf("expected 41 shares costing 4110, got %+v", h)
+	}
+	alerts, _ := s.ListAlerts(ctx)
+	if alerts[0].ID != alert.ID || alerts[0].Threshold != 120 {
+		t.Fatalf("expected the alert threshold divided by 4, got %+v", alerts[0])
+	}
+	ticks, err := s.ListPriceBars(ctx, models.AssetStock, "AAPL", models.BarTick, exDate.AddDate(0, 0, -1), exDate.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("list ticks: %v", err)
+	}
+	if len(ticks) != 2 || ticks[0].Close != 100 || ticks[1].Close != 101 {
+		t.Fatalf("expected only pre-split ticks adjusted, got %+v", ticks)
+	}
+	// quantity and price of the first buy, the alert, the tick and its three bars.
+	if len(split.Changes) != 5 || split.Changes[0].OldValue != "10" || split.Changes[0].NewValue != "40" {
+		t.Fatalf("unexpected audit trail: %+v", split.Changes)
+	}
+	if _, err := s.ApplyCorporateAction(ctx, models.CorporateAction{
+		Type: models.ActionSplit, AssetType: models.AssetStock, Ticker: "AAPL", Ratio: 4, EffectiveAt: exDate,
+	}); !errors.Is(err, ErrCorporateActionApplied) {
+		t.Fatalf("expected ErrCorporateActionApplied, got %v", err)
+	}
+
+	// A spin-off of 1 SPUN per 2 AAPL moving 10% of the cost keeps the total.
+	if _, err := s.ApplyCorporateAction(ctx, models.CorporateAction{
+		Type: models.ActionSpinOff, AssetType: models.AssetStock, Ticker: "AAPL", NewTicker: "SPUN",
+		Ratio: 0.5, CostFraction: 0.1, EffectiveAt: exDate.AddDate(0, 1, 0),
+	}); err != nil {
+		t.Fatalf("apply spin-off: %v", err)
+	}
+	holdings, err := s.ListHoldings(ctx)
+	if err != nil {
+		t.Fatalf("list holdings: %v", err)
+	}
+	if len(holdings) != 2 || holdings[1].Ticker != "SPUN" || holdings[1].Quantity != 20.5 {
+		t.Fatalf("expected a SPUN holding of 20.5, got %+v", holdings)
+	}
+	parentCost := holdings[0].AvgCost * holdings[0].Quantity
+	childCost := holdings[1].AvgCost * holdings[1].Quantity
+	if math.Abs(parentCost-3699) > 1e-9 || math.Abs(childCost-411) > 1e-9 {
+		t.Fatalf("expected cost 3699 + 411, got %v + %v", parentCost, childCost)
+	}
+
+	// SPUN merges into an existing XYZ holding at 2 XYZ per SPUN.
+	if _, err := s.CreateTransaction(ctx, models.Transaction{Ticker: "XYZ", AssetType: models.AssetStock, Type: models.TxBuy, Quantity: 5, Price: 10}); err != nil {
+		t.Fatalf("xyz buy: %v", err)
+	}
+	if _, err := s.ApplyCorporateAction(ctx, models.CorporateAction{
+		Type: models.ActionMerger, AssetType: models.AssetStock, Ticker: "SPUN", NewTicker: "XYZ", Ratio: 2,
+	}); err != nil {
+		t.Fatalf("apply merger: %v", err)
+	}
+	holdings, _ = s.ListHoldings(ctx)
+	if len(holdings) != 2 || holdings[1].Ticker != "XYZ" || holdings[1].Quantity != 46 {
+		t.Fatalf("expected 46 XYZ after the merger, got %+v", holdings)
+	}
+
+	renamed, err := s.ApplyCorporateAction(ctx, models.CorporateAction{
+		Type: models.ActionTickerChange, AssetType: models.AssetStock, Ticker: "AAPL", NewTicker: "APPL", Ratio: 1,
+	})
+	if err != nil {
+		t.Fatalf("apply ticker change: %v", err)
+	}
+	holdings, _ = s.ListHoldings(ctx)
+	alerts, _ = s.ListAlerts(ctx)
+	if holdings[0].Ticker != "APPL" || alerts[0].Ticker != "APPL" || renamed.Changes[0].Field != "ticker" {
+		t.Fatalf("expected AAPL renamed everywhere, got %+v %+v", holdings[0], alerts[0])
+	}
+	actions, err := s.ListCorporateActions(ctx)
+	if err != nil || len(actions) != 4 {
+		t.Fatalf("expected 4 recorded actions, got %d (%v)", len(actions), err)
+	}
+}
+
+func TestTickerChangeFoldsIntoExistingHolding(t *testing.T) {
+	s, sqlDB := setupStore(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	old, err := s.CreateTransaction(ctx, models.Transaction{Ticker: "FB", AssetType: models.AssetStock, Type: models.TxBuy, Quantity: 3, Price: 100})
+	if err != nil {
+		t.Fatalf("fb buy: %v", err)
+	}
+	current, err := s.CreateTransaction(ctx, models.Transaction{Ticker: "META", AssetType: models.AssetStock, Type: models.TxBuy, Quantity: 2, Price: 300})
+	if err != nil {
+		t.Fatalf("meta buy: %v", err)
+	}
+
+	if _, err := s.ApplyCorporateAction(ctx, models.CorporateAction{
+		Type: models.ActionTickerChange, AssetType: models.AssetStock, Ticker: "FB", NewTicker: "META", Ratio: 1,
+	}); err != nil {
+		t.Fatalf("apply ticker change: %v", err)
+	}
+	holdings, err := s.ListHoldings(ctx)
+	if err != nil || len(holdings) != 1 {
+		t.Fatalf("expected a single META holding, got %+v (%v)", holdings, err)
+	}
+	if holdings[0].ID != current.HoldingID || holdings[0].Quantity != 5 || math.Abs(holdings[0].AvgCost*5-900) > 1e-9 {
+		t.Fatalf("expected FB folded into META as 5 shares costing 900, got %+v", holdings[0])
+	}
+	if _, err := s.GetHolding(ctx, old.HoldingID); err == nil {
+		t.Fatalf("expected the FB holding removed")
+	}
+}
+
+func TestCorporateActionsRewriteExpressions(t *testing.T) {
+	s, sqlDB := setupStore(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	alert, err := s.CreateAlert(ctx, models.PriceAlert{
+		Kind: models.AlertExpression, Scope: models.ScopePortfolio, PortfolioID: models.DefaultPortfolioID,
+		Expression: `price("AAPL", "stock") > 200 && value("AAPL", "stock") > price("AAPL", "crypto")`,
+	})
+	if err != nil {
+		t.Fatalf("create alert: %v", err)
+	}
+
+	split, err := s.ApplyCorporateAction(ctx, models.CorporateAction{
+		Type: models.ActionSplit, AssetType: models.AssetStock, Ticker: "AAPL", Ratio: 4,
+		EffectiveAt: time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("apply split: %v", err)
+	}
+	want := `price("AAPL", "stock") * 4 > 200 && value("AAPL", "stock") > price("AAPL", "crypto")`
+	if len(split.Changes) != 1 || split.Changes[0].EntityID != alert.ID || split.Changes[0].NewValue != want {
+		t.Fatalf("expected the stock price scaled in the logged expression, got %+v", split.Changes)
+	}
+
+	renamed, err := s.ApplyCorporateAction(ctx, models.CorporateAction{
+		Type: models.ActionTickerChange, AssetType: models.AssetStock, Ticker: "AAPL", NewTicker: "APPL", Ratio: 1,
+	})
+	if err != nil {
+		t.Fatalf("apply ticker change: %v", err)
+	}
+	want = `price("APPL", "stock") * 4 > 200 && value("APPL", "stock") > price("AAPL", "crypto")`
+	alerts, _ := s.ListAlerts(ctx)
+	if alerts[0].Expression != want || len(renamed.Changes) != 1 || renamed.Changes[0].Field != "expression" {
+		t.Fatalf("expected the stock refs renamed, got %q and %+v", alerts[0].Expression, renamed.Changes)
+	}
+}
+
+func TestSpinOffAfterPartialSale(t *testing.T) {
+	s, sqlDB := setupStore(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	exDate := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+	buy, err := s.CreateTransaction(ctx, models.Transaction{
+		Ticker: "ABC", AssetType: models.AssetStock, Type: models.TxBuy, Quantity: 100, Price: 10, ExecutedAt: exDate.AddDate(0, -2, 0),
+	})
+	if err != nil {
+		t.Fatalf("buy: %v", err)
+	}
+	if _, err := s.CreateTransaction(ctx, models.Transaction{
+		HoldingID: buy.HoldingID, Type: models.TxSell, Quantity: 50, Price: 12, ExecutedAt: exDate.AddDate(0, -1, 0),
+	}); err != nil {
+		t.Fatalf("sell: %v", err)
+	}
+
+	// Only the 50 shares still held at the ex-date give up cost.
+	if _, err := s.ApplyCorporateAction(ctx, models.CorporateAction{
+		Type: models.ActionSpinOff, AssetType: models.AssetStock, Ticker: "ABC", NewTicker: "NEWCO",
+		Ratio: 1, CostFraction: 0.2, EffectiveAt: exDate,
+	}); err != nil {
+		t.Fatalf("apply spin-off: %v", err)
+	}
+	holdings, err := s.ListHoldings(ctx)
+	if err != nil || len(holdings) != 2 {
+		t.Fatalf("expected ABC and NEWCO, got %+v (%v)", holdings, err)
+	}
+	parent, child := holdings[0], holdings[1]
+	if math.Abs(parent.AvgCost*parent.Quantity-400) > 1e-9 || math.Abs(child.AvgCost*child.Quantity-100) > 1e-9 {
+		t.Fatalf("expected cost 400 + 100, got %+v %+v", parent, child)
+	}
+	if math.Abs(parent.RealizedPnL-100) > 1e-9 {
+		t.Fatalf("expected the earlier sale to keep its 100 gain, got %v", parent.RealizedPnL)
+	}
+	lots, err := s.ListLots(ctx, child.ID)
+	if err != nil || len(lots) != 1 || !lots[0].AcquiredAt.Equal(buy.ExecutedAt) {
+		t.Fatalf("expected one NEWCO lot dated like the buy, got %+v (%v)", lots, err)
+	}
+}
+
+func TestNotificationChannels(t *testing.T) {
+	s, sqlDB := setupStore(t)
+	defer sqlDB.Close()
+
+	ctx := context.Background()
+	created, err := s.CreateChannel(ctx, models.NotificationChannel{
+		Name:    " ops ",
+		Type:    models.ChannelSlack,
+		URL:     "https://hooks.slack.com/services/x",
+		Headers: map[string]string{"X-Team": "ops"},
+		Rules: []models.ChannelRule{
+			{Ticker: " btc", AssetType: models.AssetCrypto},
+			{MinSeverity: models.SeverityCritical},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	if created.Name != "ops" || created.Headers["X-Team"] != "ops" || len(created.Rules) != 2 || created.Rules[0].Ticker != "BTC" {
+		t.Fatalf("unexpected channel: %+v", created)
+	}
+	if _, err := s.CreateChannel(ctx, models.NotificationChannel{Name: "ops", Type: models.ChannelWebhook, URL: "https://example.com"}); !errors.Is(err, ErrChannelExists) {
+		t.Fatalf("expected ErrChannelExists, got %v", err)
+	}
+
+	created.Rules = nil
+	created.Headers = nil
+	updated, err := s.UpdateChannel(ctx, created.ID, created)
+	if err != nil || len(updated.Rules) != 0 || updated.Headers != nil {
+		t.Fatalf("expected rules and headers cleared, got %+v %v", updated, err)
+	}
+	if _, err := s.UpdateChannel(ctx, 999, created); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected ErrNoRows updating a missing channel, got %v", err)
+	}
+
+	if err := s.DeleteChannel(ctx, created.ID); err != nil {
+		t.Fatalf("delete channel: %v", err)
+	}
+	if channels, err := s.ListChannels(ctx); err != nil || len(channels) != 0 {
+		t.Fatalf("expected no channels, got %+v %v", channels, err)
+	}
+	if err := s.DeleteChannel(ctx, created.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected ErrNoRows deleting twice, got %v", err)
+	}
 }
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"portfoliopulse/internal/models"
+)
+
+// SetHoldingTags replaces the tags of holding id. Tags are trimmed,
+// lower-cased and de-duplicated; an empty list clears them.
+func (s *SQLiteStore) SetHoldingTags(ctx context.Context, id int64, tags []string) (models.Holding, error) {
+	dbtx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Holding{}, fmt.Errorf("begin set holding tags: %w", err)
+	}
+	defer dbtx.Rollback()
+
+	if _, err := getHolding(ctx, dbtx, id); err != nil {
+		return models.Holding{}, err
+	}
+	if _, err := dbtx.ExecContext(ctx, `DELETE FROM holding_tags WHERE holding_id = ?`, id); err != nil {
+		return models.Holding{}, fmt.Errorf("clear holding tags: %w", err)
+	}
+	for _, tag := range normalizeTags(tags) {
+		if _, err := dbtx.ExecContext(ctx, `
+			INSERT INTO holding_tags(holding_id, tag) VALUES (?, ?)`, id, tag); err != nil {
+			return models.Holding{}, fmt.Errorf("insert holding tag: %w", err)
+		}
+	}
+
+	h, err := getHolding(ctx, dbtx, id)
+	if err != nil {
+		return models.Holding{}, err
+	}
+	if err := dbtx.Commit(); err != nil {
+		return models.Holding{}, fmt.Errorf("commit set holding tags: %w", err)
+	}
+	return h, nil
+}
+
+// listHoldingTags returns tags by holding ID, for one holding or for all of
+// them when id is zero.
+func listHoldingTags(ctx context.Context, q querier, id int64) (map[int64][]string, error) {
+	query := `SELECT holding_id, tag FROM holding_tags`
+	args := make([]any, 0, 1)
+	if id != 0 {
+		query += ` WHERE holding_id = ?`
+		args = append(args, id)
+	}
+	rows, err := q.QueryContext(ctx, query+` ORDER BY holding_id ASC, tag ASC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query holding tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := make(map[int64][]string)
+	for rows.Next() {
+		var holdingID int64
+		var tag string
+		if err := rows.Scan(&holdingID, &tag); err != nil {
+			return nil, fmt.Errorf("scan holding tag: %w", err)
+		}
+		tags[holdingID] = append(tags[holdingID], tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate holding tags: %w", err)
+	}
+	return tags, nil
+}
+
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ListAllocationTargets returns the target weights of portfolio pid, or of
+// every portfolio when pid is zero.
+func (s *SQLiteStore) ListAllocationTargets(ctx context.Context, pid int64) ([]models.AllocationTarget, error) {
+	query := `SELECT portfolio_id, bucket, asset_type, key, weight_pct FROM allocation_targets`
+	args := make([]any, 0, 1)
+	if pid != 0 {
+		query += ` WHERE portfolio_id = ?`
+		args = append(args, pid)
+	}
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY portfolio_id ASC, bucket ASC, asset_type ASC, key ASC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query allocation targets: %w", err)
+	}
+	defer rows.Close()
+
+	targets := make([]models.AllocationTarget, 0)
+	for rows.Next() {
+		var t models.AllocationTarget
+		if err := rows.Scan(&t.PortfolioID, &t.Bucket, &t.AssetType, &t.Key, &t.WeightPct); err != nil {
+			return nil, fmt.Errorf("scan allocation target: %w", err)
+		}
+		targets = append(targets, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate allocation targets: %w", err)
+	}
+	return targets, nil
+}
+
+// SetAllocationTargets replaces every target of portfolio pid. Ticker keys
+// are upper-cased and tag keys lower-cased to match how holdings store
+// them.
+func (s *SQLiteStore) SetAllocationTargets(ctx context.Context, pid int64, targets []models.AllocationTarget) ([]models.AllocationTarget, error) {
+	dbtx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin set allocation targets: %w", err)
+	}
+	defer dbtx.Rollback()
+
+	if _, err := getPortfolio(ctx, dbtx, pid); err != nil {
+		return nil, err
+	}
+	if _, err := dbtx.ExecContext(ctx, `DELETE FROM allocation_targets WHERE portfolio_id = ?`, pid); err != nil {
+		return nil, fmt.Errorf("clear allocation targets: %w", err)
+	}
+	for _, t := range targets {
+		key := strings.TrimSpace(t.Key)
+		switch t.Bucket {
+		case models.BucketTicker:
+			key = strings.ToUpper(key)
+		case models.BucketTag:
+			key = strings.ToLower(key)
+		}
+		if _, err := dbtx.ExecContext(ctx, `
+			INSERT INTO allocation_targets(portfolio_id, bucket, asset_type, key, weight_pct)
+			VALUES (?, ?, ?, ?, ?)`, pid, t.Bucket, t.AssetType, key, t.WeightPct); err != nil {
+			return nil, fmt.Errorf("insert allocation target: %w", err)
+		}
+	}
+	if err := dbtx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit set allocation targets: %w", err)
+	}
+	return s.ListAllocationTargets(ctx, pid)
+}
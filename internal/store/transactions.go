@@ -0,0 +1,402 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"portfoliopulse/internal/ledger"
+	"portfoliopulse/internal/models"
+)
+
+// ErrHoldingPortfolio rejects a transaction whose holding is in another
+// portfolio than the one it was booked under.
+var ErrHoldingPortfolio = errors.New("the holding belongs to another portfolio")
+
+type TransactionFilter struct {
+	PortfolioID int64
+	HoldingID   int64
+	Ticker      string
+	AssetType   models.AssetType
+	From        time.Time
+	To          time.Time
+}
+
+const transactionColumns = `
+	t.id, h.portfolio_id, t.holding_id, h.ticker, h.asset_type, h.currency, t.type, t.quantity, t.price, t.fee, t.fx_rate,
+	t.cost_method, t.cash_settled, t.executed_at, t.note, t.created_at`
+
+func (s *SQLiteStore) ListTransactions(ctx context.Context, filter TransactionFilter) ([]models.Transaction, error) {
+	return listTransactions(ctx, s.db, filter)
+}
+
+func (s *SQLiteStore) GetTransaction(ctx context.Context, id int64) (models.Transaction, error) {
+	return getTransaction(ctx, s.db, id)
+}
+
+// CreateTransaction books tx against tx.HoldingID, or against the first
+// holding matching Ticker/AssetType in tx.PortfolioID (creating one in
+// tx.Currency if none exists; an unset portfolio means the default one). A
+// HoldingID outside a set tx.PortfolioID is rejected with
+// ErrHoldingPortfolio. The holding's ledger is replayed before commit so an
+// oversell is rejected with ledger.ErrInsufficientQuantity and nothing is
+// written. A CashSettled trade needs a cash account in the holding's
+// portfolio and currency.
+func (s *SQLiteStore) CreateTransaction(ctx context.Context, tx models.Transaction) (models.Transaction, error) {
+	tx.Ticker = strings.ToUpper(strings.TrimSpace(tx.Ticker))
+	if tx.ExecutedAt.IsZero() {
+		tx.ExecutedAt = time.Now().UTC()
+	}
+
+	dbtx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Transaction{}, fmt.Errorf("begin create transaction: %w", err)
+	}
+	defer dbtx.Rollback()
+
+	if tx.HoldingID == 0 {
+		tx.PortfolioID, err = portfolioOrDefault(ctx, dbtx, tx.PortfolioID)
+		if err != nil {
+			return models.Transaction{}, err
+		}
+		tx.HoldingID, err = findOrCreateHolding(ctx, dbtx, tx.PortfolioID, tx.Ticker, tx.AssetType, tx.Currency)
+		if err != nil {
+			return models.Transaction{}, err
+		}
+	} else {
+		h, err := getHolding(ctx, dbtx, tx.HoldingID)
+		if err != nil {
+			return models.Transaction{}, err
+		}
+		if tx.PortfolioID != 0 && h.PortfolioID != tx.PortfolioID {
+			return models.Transaction{}, ErrHoldingPortfolio
+		}
+	}
+	if err := checkCashSettlement(ctx, dbtx, tx.CashSettled, tx.HoldingID); err != nil {
+		return models.Transaction{}, err
+	}
+
+	res, err := dbtx.ExecContext(ctx, `
+		INSERT INTO transactions(holding_id, type, quantity, price, fee, fx_rate, cost_method, cash_settled, executed_at, note)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		tx.HoldingID, tx.Type, tx.Quantity, tx.Price, tx.Fee, tx.FXRate, tx.CostMethod, tx.CashSettled, tx.ExecutedAt.UTC(), tx.Note)
+	if err != nil {
+		return models.Transaction{}, fmt.Errorf("insert transaction: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.Transaction{}, fmt.Errorf("transaction last insert id: %w", err)
+	}
+	if err := saveLotSelections(ctx, dbtx, id, tx.Lots); err != nil {
+		return models.Transaction{}, err
+	}
+
+	if err := checkLedger(ctx, dbtx, tx.HoldingID); err != nil {
+		return models.Transaction{}, err
+	}
+	if err := dbtx.Commit(); err != nil {
+		return models.Transaction{}, fmt.Errorf("commit create transaction: %w", err)
+	}
+
+	out, err := s.GetTransaction(ctx, id)
+	if err != nil {
+		return models.Transaction{}, fmt.Errorf("fetch inserted transaction: %w", err)
+	}
+	return out, nil
+}
+
+// UpdateTransaction replaces the economic fields of an existing entry; a
+// zero ExecutedAt keeps the stored time. The owning holding cannot change;
+// delete and re-create to move an entry.
+func (s *SQLiteStore) UpdateTransaction(ctx context.Context, tx models.Transaction) (models.Transaction, error) {
+	dbtx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Transaction{}, fmt.Errorf("begin update transaction: %w", err)
+	}
+	defer dbtx.Rollback()
+
+	existing, err := getTransaction(ctx, dbtx, tx.ID)
+	if err != nil {
+		return models.Transaction{}, err
+	}
+	if tx.ExecutedAt.IsZero() {
+		tx.ExecutedAt = existing.ExecutedAt
+	}
+	if err := checkCashSettlement(ctx, dbtx, tx.CashSettled, existing.HoldingID); err != nil {
+		return models.Transaction{}, err
+	}
+
+	_, err = dbtx.ExecContext(ctx, `
+		UPDATE transactions
+		SET type = ?, quantity = ?, price = ?, fee = ?, fx_rate = ?, cost_method = ?, cash_settled = ?, executed_at = ?, note = ?
+		WHERE id = ?`,
+		tx.Type, tx.Quantity, tx.Price, tx.Fee, tx.FXRate, tx.CostMethod, tx.CashSettled, tx.ExecutedAt.UTC(), tx.Note, tx.ID)
+	if err != nil {
+		return models.Transaction{}, fmt.Errorf("update transaction: %w", err)
+	}
+	if err := saveLotSelections(ctx, dbtx, tx.ID, tx.Lots); err != nil {
+		return models.Transaction{}, err
+	}
+
+	if err := checkLedger(ctx, dbtx, existing.HoldingID); err != nil {
+		return models.Transaction{}, err
+	}
+	if err := dbtx.Commit(); err != nil {
+		return models.Transaction{}, fmt.Errorf("commit update transaction: %w", err)
+	}
+	return s.GetTransaction(ctx, tx.ID)
+}
+
+// DeleteTransaction removes an entry unless doing so would leave a later
+// sell without enough quantity behind it.
+func (s *SQLiteStore) DeleteTransaction(ctx context.Context, id int64) error {
+	dbtx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin delete transaction: %w", err)
+	}
+	defer dbtx.Rollback()
+
+	existing, err := getTransaction(ctx, dbtx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := dbtx.ExecContext(ctx, `DELETE FROM transactions WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("delete transaction: %w", err)
+	}
+	if err := checkLedger(ctx, dbtx, existing.HoldingID); err != nil {
+		return err
+	}
+	if err := dbtx.Commit(); err != nil {
+		return fmt.Errorf("commit delete transaction: %w", err)
+	}
+	return nil
+}
+
+func listTransactions(ctx context.Context, q querier, filter TransactionFilter) ([]models.Transaction, error) {
+	where := make([]string, 0, 4)
+	args := make([]any, 0, 4)
+	if filter.PortfolioID != 0 {
+		where = append(where, "h.portfolio_id = ?")
+		args = append(args, filter.PortfolioID)
+	}
+	if filter.HoldingID != 0 {
+		where = append(where, "t.holding_id = ?")
+		args = append(args, filter.HoldingID)
+	}
+	if ticker := strings.ToUpper(strings.TrimSpace(filter.Ticker)); ticker != "" {
+		where = append(where, "h.ticker = ?")
+		args = append(args, ticker)
+	}
+	if filter.AssetType != "" {
+		where = append(where, "h.asset_type = ?")
+		args = append(args, filter.AssetType)
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "t.executed_at >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "t.executed_at <= ?")
+		args = append(args, filter.To.UTC())
+	}
+
+	query := `SELECT ` + transactionColumns + `
+		FROM transactions t JOIN holdings h ON h.id = t.holding_id`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY t.executed_at ASC, t.id ASC"
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query transactions: %w", err)
+	}
+	defer rows.Close()
+
+	txs := make([]models.Transaction, 0)
+	for rows.Next() {
+		tx, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate transactions: %w", err)
+	}
+	rows.Close()
+
+	if err := attachLotSelections(ctx, q, txs); err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+func getTransaction(ctx context.Context, q querier, id int64) (models.Transaction, error) {
+	row := q.QueryRowContext(ctx, `SELECT `+transactionColumns+`
+		FROM transactions t JOIN holdings h ON h.id = t.holding_id
+		WHERE t.id = ?`, id)
+	tx, err := scanTransaction(row)
+	if err != nil {
+		return models.Transaction{}, err
+	}
+	txs := []models.Transaction{tx}
+	if err := attachLotSelections(ctx, q, txs); err != nil {
+		return models.Transaction{}, err
+	}
+	return txs[0], nil
+}
+
+func saveLotSelections(ctx context.Context, q querier, txID int64, lots []models.LotSelection) error {
+	if _, err := q.ExecContext(ctx, `DELETE FROM transaction_lots WHERE transaction_id = ?`, txID); err != nil {
+		return fmt.Errorf("clear lot selections: %w", err)
+	}
+	for _, sel := range lots {
+		if _, err := q.ExecContext(ctx, `
+			INSERT INTO transaction_lots(transaction_id, lot_id, quantity)
+			VALUES (?, ?, ?)`, txID, sel.LotID, sel.Quantity); err != nil {
+			return fmt.Errorf("insert lot selection: %w", err)
+		}
+	}
+	return nil
+}
+
+// attachLotSelections fills Lots on the specific-lot sells and the cost
+// adjustments in txs.
+func attachLotSelections(ctx context.Context, q querier, txs []models.Transaction) error {
+	index := make(map[int64]int)
+	ids := make([]any, 0)
+	for i, tx := range txs {
+		if tx.CostMethod == models.CostSpecific || tx.Type == models.TxCostAdjust {
+			index[tx.ID] = i
+			ids = append(ids, tx.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	rows, err := q.QueryContext(ctx, `
+		SELECT transaction_id, lot_id, quantity FROM transaction_lots
+		WHERE transaction_id IN (`+placeholders+`) ORDER BY rowid ASC`, ids...)
+	if err != nil {
+		return fmt.Errorf("query lot selections: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var txID int64
+		var sel models.LotSelection
+		if err := rows.Scan(&txID, &sel.LotID, &sel.Quantity); err != nil {
+			return fmt.Errorf("scan lot selection: %w", err)
+		}
+		i := index[txID]
+		txs[i].Lots = append(txs[i].Lots, sel)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate lot selections: %w", err)
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTransaction(sc scanner) (models.Transaction, error) {
+	var tx models.Transaction
+	if err := sc.Scan(&tx.ID, &tx.PortfolioID, &tx.HoldingID, &tx.Ticker, &tx.AssetType, &tx.Currency, &tx.Type, &tx.Quantity,
+		&tx.Price, &tx.Fee, &tx.FXRate, &tx.CostMethod, &tx.CashSettled, &tx.ExecutedAt, &tx.Note, &tx.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Transaction{}, err
+		}
+		return models.Transaction{}, fmt.Errorf("scan transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// ListLots returns the open lots of a holding in acquisition order.
+func (s *SQLiteStore) ListLots(ctx context.Context, holdingID int64) ([]models.Lot, error) {
+	if _, err := getHolding(ctx, s.db, holdingID); err != nil {
+		return nil, err
+	}
+	txs, err := listTransactions(ctx, s.db, TransactionFilter{HoldingID: holdingID})
+	if err != nil {
+		return nil, err
+	}
+	pos, err := ledger.Replay(txs)
+	if err != nil {
+		return nil, fmt.Errorf("replay holding %d: %w", holdingID, err)
+	}
+	return pos.Lots, nil
+}
+
+// ListRealizedGains replays the full history of every holding matching the
+// filter, since lots opened before From still determine the cost of sells
+// inside the window, then keeps the gains realized between From and To.
+func (s *SQLiteStore) ListRealizedGains(ctx context.Context, filter TransactionFilter) ([]models.RealizedGain, error) {
+	from, to := filter.From, filter.To
+	filter.From, filter.To = time.Time{}, time.Time{}
+
+	txs, err := listTransactions(ctx, s.db, filter)
+	if err != nil {
+		return nil, err
+	}
+	byHolding := make(map[int64][]models.Transaction)
+	order := make([]int64, 0)
+	for _, tx := range txs {
+		if _, ok := byHolding[tx.HoldingID]; !ok {
+			order = append(order, tx.HoldingID)
+		}
+		byHolding[tx.HoldingID] = append(byHolding[tx.HoldingID], tx)
+	}
+
+	gains := make([]models.RealizedGain, 0)
+	for _, id := range order {
+		pos, err := ledger.Replay(byHolding[id])
+		if err != nil {
+			return nil, fmt.Errorf("replay holding %d: %w", id, err)
+		}
+		for _, g := range pos.Realized {
+			if !from.IsZero() && g.SoldAt.Before(from) {
+				continue
+			}
+			if !to.IsZero() && g.SoldAt.After(to) {
+				continue
+			}
+			gains = append(gains, g)
+		}
+	}
+	sort.SliceStable(gains, func(i, j int) bool { return gains[i].SoldAt.Before(gains[j].SoldAt) })
+	return gains, nil
+}
+
+func findOrCreateHolding(ctx context.Context, q querier, portfolioID int64, ticker string, assetType models.AssetType, currency string) (int64, error) {
+	var id int64
+	err := q.QueryRowContext(ctx, `
+		SELECT id FROM holdings WHERE portfolio_id = ? AND ticker = ? AND asset_type = ?
+		ORDER BY id ASC LIMIT 1`, portfolioID, ticker, assetType).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("find holding: %w", err)
+	}
+	return insertHolding(ctx, q, portfolioID, ticker, assetType, currency)
+}
+
+func checkLedger(ctx context.Context, q querier, holdingID int64) error {
+	txs, err := listTransactions(ctx, q, TransactionFilter{HoldingID: holdingID})
+	if err != nil {
+		return err
+	}
+	if _, err := ledger.Replay(txs); err != nil {
+		return err
+	}
+	return nil
+}
@@ -150,7 +150,7 @@ export default function App() {
         <div>
           <div className="panel">
             <h3>Allocation</h3>
-            <PortfolioPieChart holdings={holdings} />
+            <PortfolioPieChart allocation={portfolio?.allocation} />
           </div>
 
           <div className="panel">
@@ -3,10 +3,10 @@ import { PieChart, Pie, Cell, Tooltip, ResponsiveContainer } from 'recharts'
 
 const COLORS = ['#6366f1', '#22c55e', '#eab308', '#ef4444', '#06b6d4', '#f97316', '#a78bfa', '#ec4899', '#14b8a6', '#f43f5e']
 
-export default function PortfolioPieChart({ holdings }) {
-  const data = (holdings || [])
-    .filter((h) => h.marketValue > 0)
-    .map((h) => ({ name: h.ticker, value: h.marketValue }))
+export default function PortfolioPieChart({ allocation }) {
+  const data = (allocation || [])
+    .filter((a) => a.value > 0)
+    .map((a) => ({ name: a.label, value: a.value }))
 
   if (data.length === 0) {
     return <div className="no-data">Add holdings to see allocation</div>